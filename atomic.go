@@ -0,0 +1,50 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// rawStore is the store used by the raw file helpers, which bypass encoding.
+var rawStore = &Store[[]byte]{}
+
+// AtomicWriteFile atomically replaces the contents of the file at path with
+// data, creating it with the specified mode if it does not exist.
+//
+// The file is replaced with the same locking and atomicity guarantees as
+// Store.ForceStore, which means that concurrent readers using AtomicReadFile
+// or Store.Load observe either the old or the new contents, but never
+// a mix of both.
+func AtomicWriteFile(ctx context.Context, path string, data []byte, mode os.FileMode) error {
+	err := ErrRetry
+	for err == ErrRetry {
+		err = rawStore.replace(ctx, path, mode, nil, true, func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		})
+	}
+	return err
+}
+
+// AtomicReadFile reads the contents of the file at path while holding
+// a shared lock on it, which guarantees that the contents are not being
+// written to concurrently by AtomicWriteFile or a Store.
+func AtomicReadFile(ctx context.Context, path string) ([]byte, error) {
+	rdf, err := openShared(nil, path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer closeLocked(rdf)
+
+	if err := RLock(ctx, rdf); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(rdf)
+}
@@ -0,0 +1,63 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestAtomicFile(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("NotExist", func(t *testing.T) {
+		if _, err := AtomicReadFile(context.Background(), filepath.Join(dir, "missing")); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected ErrNotExist, got %v", err)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		path := filepath.Join(dir, "file")
+
+		// Readers must only ever observe one of the written payloads.
+		payloads := [][]byte{
+			bytes.Repeat([]byte("a"), 1<<16),
+			bytes.Repeat([]byte("b"), 1<<10),
+		}
+		if err := AtomicWriteFile(context.Background(), path, payloads[0], 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		var wait sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wait.Add(2)
+			go func(i int) {
+				defer wait.Done()
+				if err := AtomicWriteFile(context.Background(), path, payloads[i%2], 0666); err != nil {
+					t.Error(err)
+				}
+			}(i)
+			go func() {
+				defer wait.Done()
+				data, err := AtomicReadFile(context.Background(), path)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !bytes.Equal(data, payloads[0]) && !bytes.Equal(data, payloads[1]) {
+					t.Errorf("read torn contents of %d bytes", len(data))
+				}
+			}()
+		}
+		wait.Wait()
+	})
+}
@@ -0,0 +1,311 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"time"
+)
+
+// ErrUnsupported is returned by the optional methods of backends when they do
+// not support the operation, in which case stores fall back to other means of
+// performing it.
+var ErrUnsupported = errors.New("the operation is not supported")
+
+// A File is a file opened by a Backend. *os.File implements it.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.WriterAt
+	io.Seeker
+	io.Closer
+	Name() string
+	Stat() (fs.FileInfo, error)
+	Sync() error
+	Truncate(size int64) error
+}
+
+// A FileStat holds the metadata of a file that stores rely on.
+type FileStat struct {
+	// Dev and Ino identify the file: no two files that exist at the same
+	// time share them, and renaming or linking a file preserves them. Ino
+	// is never zero, and is part of the canary of the file, along with
+	// Size and ModTime.
+	Dev, Ino uint64
+
+	// Size is the size of the file in bytes.
+	Size int64
+
+	// ModTime is the modification time of the file, or the zero time if
+	// the backend does not know it.
+	ModTime time.Time
+
+	// Symlink is set if the file is a symbolic link.
+	Symlink bool
+}
+
+// A Backend provides the file operations that a Store performs. Stores operate
+// on the file system of the operating system by default, as implemented by
+// OSBackend; other backends, configured with WithBackend, let stores operate
+// on anything that can provide the same guarantees, such as the in-memory
+// files of package memstore, FUSE file systems, or object stores.
+//
+// Stores rely on the semantics of POSIX file systems: files are replaced
+// atomically by renaming other files over them, and the identity of a file,
+// as reported by Lstat and Fstat, follows the file across renames rather than
+// staying with its name. Package backendtest checks that a backend provides
+// them.
+//
+// Backends may also implement DirSyncer, NoReplaceRenamer, Exchanger and
+// LockBreaker, which stores use when available.
+type Backend interface {
+	// OpenFile opens the named file like os.OpenFile. Flags that the
+	// backend does not know about are ignored.
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+
+	// Rename atomically moves the file at the name of f, which was opened
+	// by the backend, to newname, replacing any file at newname.
+	Rename(f File, newname string) error
+
+	// Link creates newname as a hard link to the file at oldname. It fails
+	// with an error wrapping fs.ErrExist if newname already exists.
+	Link(oldname, newname string) error
+
+	// Remove removes the named file.
+	Remove(name string) error
+
+	// Lstat returns the metadata of the named file, without following
+	// symbolic links.
+	Lstat(name string) (FileStat, error)
+
+	// Fstat returns the metadata of f, which was opened by the backend.
+	Fstat(f File) (FileStat, error)
+
+	// ReadDir returns the entries of the named directory, sorted by name.
+	ReadDir(name string) ([]fs.DirEntry, error)
+
+	// Lock acquires an exclusive lock on f, which was opened by the
+	// backend, blocking until the lock is available or the context is done.
+	// Locks are held by f rather than by the process, and get released
+	// when f is closed.
+	Lock(ctx context.Context, f File) error
+
+	// RLock is like Lock, but acquires a shared lock.
+	RLock(ctx context.Context, f File) error
+
+	// TryLock is like Lock, but fails with an error wrapping ErrWouldBlock
+	// rather than blocking if the lock is not available.
+	TryLock(f File) error
+}
+
+// A DirSyncer is a Backend that can flush directories to stable storage,
+// which stores configured with WithSyncDir do after renaming or removing
+// files. With other backends, WithSyncDir has no effect.
+type DirSyncer interface {
+	// SyncDir flushes the named directory to stable storage, which makes
+	// the renames and removals of its entries durable.
+	SyncDir(name string) error
+}
+
+// A NoReplaceRenamer is a Backend that can rename files without replacing
+// existing ones, which StoreExclusive uses. With other backends, StoreExclusive
+// links files to their new name, then removes their old name.
+type NoReplaceRenamer interface {
+	// RenameNoReplace is like Rename, except that it fails with an error
+	// wrapping fs.ErrExist if newname already exists.
+	RenameNoReplace(f File, newname string) error
+}
+
+// An Exchanger is a Backend that can atomically exchange two files, which Swap
+// uses. With other backends, or if Exchange fails with ErrUnsupported, Swap
+// replaces each file in turn with a hard link to the other.
+type Exchanger interface {
+	// Exchange atomically exchanges the files at name1 and name2, which
+	// must both exist.
+	Exchange(name1, name2 string) error
+}
+
+// A LockBreaker is a Backend whose locks do not get released when their
+// holder crashes, such as locks implemented with sentinel files, and that can
+// forcibly release them, which BreakStale does with stale lock files.
+type LockBreaker interface {
+	// BreakLock releases the exclusive lock held on the named file, whoever
+	// holds it. It succeeds if the file is not locked.
+	BreakLock(name string) error
+}
+
+// OSBackend returns a Backend that operates on the file system of the
+// operating system, which is what stores use unless configured with
+// WithBackend. Relative paths are resolved against dir, like with InDir, or
+// against the current working directory if dir is nil, and files are locked
+// with the specified style of locks, like with WithLockStyle.
+//
+// The backend opens files as *os.File values, and implements DirSyncer,
+// NoReplaceRenamer and Exchanger.
+func OSBackend(dir *os.File, style LockStyle) Backend {
+	return osBackend{dir: dir, style: style}
+}
+
+// fs returns the backend of the store.
+func (store *Store[T]) fs() Backend {
+	if store.backend != nil {
+		return store.backend
+	}
+	return osBackend{dir: store.dir, style: store.opts.lockStyle}
+}
+
+// osDir returns the directory against which the store resolves relative
+// paths, and whether the store operates on the file system of the operating
+// system at all. Features that rely on the operating system are only
+// available if it does.
+func (store *Store[T]) osDir() (*os.File, bool) {
+	b, ok := store.fs().(osBackend)
+	return b.dir, ok
+}
+
+// osBackend is the Backend of stores that operate on the file system of the
+// operating system, which resolves relative paths against dir and locks files
+// with the specified lock style.
+type osBackend struct {
+	dir   *os.File
+	style LockStyle
+}
+
+func (b osBackend) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	f, err := openShared(b.dir, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (b osBackend) Rename(f File, newname string) error {
+	osf, ok := f.(OSFile)
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: f.Name(), New: newname, Err: os.ErrInvalid}
+	}
+	return rename(b.dir, osf, newname)
+}
+
+func (b osBackend) RenameNoReplace(f File, newname string) error {
+	osf, ok := f.(OSFile)
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: f.Name(), New: newname, Err: os.ErrInvalid}
+	}
+	return renameNoReplace(b.dir, osf, newname)
+}
+
+func (b osBackend) Exchange(name1, name2 string) error {
+	return exchange(b.dir, name1, name2)
+}
+
+func (b osBackend) SyncDir(name string) error {
+	return syncDir(b.dir, name)
+}
+
+func (b osBackend) Link(oldname, newname string) error {
+	return link(b.dir, oldname, newname)
+}
+
+func (b osBackend) Remove(name string) error {
+	return unlink(b.dir, name)
+}
+
+func (b osBackend) Lstat(name string) (FileStat, error) {
+	return lstat(b.dir, name)
+}
+
+func (b osBackend) Fstat(f File) (FileStat, error) {
+	osf, err := asOSFile("fstat", f)
+	if err != nil {
+		return FileStat{}, err
+	}
+	return lstat(osf, "")
+}
+
+func (b osBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	d, err := openShared(b.dir, name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := d.ReadDir(-1)
+	d.Close()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (b osBackend) Lock(ctx context.Context, f File) error {
+	osf, err := asOSFile("lock", f)
+	if err != nil {
+		return err
+	}
+	return b.style.Lock(ctx, osf)
+}
+
+func (b osBackend) RLock(ctx context.Context, f File) error {
+	osf, err := asOSFile("lock", f)
+	if err != nil {
+		return err
+	}
+	return b.style.RLock(ctx, osf)
+}
+
+func (b osBackend) TryLock(f File) error {
+	osf, err := asOSFile("lock", f)
+	if err != nil {
+		return err
+	}
+	return b.style.TryLock(osf)
+}
+
+// asOSFile returns the *os.File behind f, which fails if f was not opened by
+// the file system of the operating system.
+func asOSFile(op string, f File) (*os.File, error) {
+	switch f := f.(type) {
+	case *os.File:
+		return f, nil
+	case namedFile:
+		return f.File, nil
+	}
+	return nil, &os.PathError{Op: op, Path: f.Name(), Err: os.ErrInvalid}
+}
+
+// closeFile closes f, which was opened by the backend of a store, making sure
+// to release the locks of files of the operating system; see closeLocked.
+func closeFile(f File) error {
+	if osf, ok := f.(*os.File); ok {
+		return closeLocked(osf)
+	}
+	return f.Close()
+}
+
+// deleted returns whether f is no longer reachable through its name in b,
+// along with the metadata of f.
+func deleted(b Backend, f File) (st FileStat, ok bool, e error) {
+	st, err := b.Fstat(f)
+	if err != nil {
+		return st, true, err
+	}
+
+	pst, err := b.Lstat(f.Name())
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return st, true, nil
+	case err != nil:
+		return st, true, err
+	}
+	return st, st.Ino != pst.Ino, nil
+}
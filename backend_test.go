@@ -0,0 +1,26 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store_test
+
+import (
+	"os"
+	"testing"
+
+	"barney.ci/go-store"
+	"barney.ci/go-store/backendtest"
+)
+
+func TestOSBackend(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) store.Backend {
+		dir, err := os.Open(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { dir.Close() })
+		return store.OSBackend(dir, store.FlockLocks)
+	})
+}
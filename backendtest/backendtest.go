@@ -0,0 +1,359 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+// Package backendtest provides a conformance test suite for the backends
+// passed to store.WithBackend.
+package backendtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"barney.ci/go-store"
+)
+
+// Run checks that the backends returned by newBackend provide the semantics
+// that stores rely on, as documented on store.Backend, and that stores using
+// them work correctly under concurrent updates.
+//
+// newBackend must return a new, empty backend every time it gets called. The
+// suite only uses relative names of files at the root of the backend.
+//
+// A typical use is:
+//
+//	func TestBackend(t *testing.T) {
+//	    backendtest.Run(t, func(t *testing.T) store.Backend {
+//	        return mybackend.New(t.TempDir())
+//	    })
+//	}
+func Run(t *testing.T, newBackend func(t *testing.T) store.Backend) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	t.Run("OpenFile", func(t *testing.T) {
+		b := newBackend(t)
+
+		if _, err := b.OpenFile("file", os.O_RDONLY, 0); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("opening a missing file: expected ErrNotExist, got %v", err)
+		}
+		f := create(t, b, "file", "hello")
+		defer f.Close()
+
+		if _, err := b.OpenFile("file", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666); !errors.Is(err, fs.ErrExist) {
+			t.Fatalf("exclusively creating an existing file: expected ErrExist, got %v", err)
+		}
+		if got := read(t, b, "file"); got != "hello" {
+			t.Fatalf("expected %q, got %q", "hello", got)
+		}
+
+		if _, err := f.WriteAt([]byte("J"), 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Truncate(3); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 2)
+		if _, err := f.ReadAt(buf, 1); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != "el" {
+			t.Fatalf("expected %q, got %q", "el", buf)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != 3 {
+			t.Fatalf("expected a size of 3, got %d", info.Size())
+		}
+		if got := read(t, b, "file"); got != "Jel" {
+			t.Fatalf("expected %q, got %q", "Jel", got)
+		}
+
+		trunc, err := b.OpenFile("file", os.O_WRONLY|os.O_TRUNC, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trunc.Close()
+		if got := read(t, b, "file"); got != "" {
+			t.Fatalf("expected the file to be truncated, got %q", got)
+		}
+	})
+
+	t.Run("Stat", func(t *testing.T) {
+		b := newBackend(t)
+
+		if _, err := b.Lstat("file"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("expected ErrNotExist, got %v", err)
+		}
+		f := create(t, b, "file", "hello")
+		defer f.Close()
+		g := create(t, b, "other", "")
+		defer g.Close()
+
+		st, err := b.Lstat("file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fst, err := b.Fstat(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gst, err := b.Fstat(g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case st.Ino == 0:
+			t.Fatal("expected a non-zero inode")
+		case st.Dev != fst.Dev || st.Ino != fst.Ino:
+			t.Fatalf("Lstat and Fstat disagree: %+v, %+v", st, fst)
+		case st.Dev == gst.Dev && st.Ino == gst.Ino:
+			t.Fatalf("distinct files share their identity: %+v, %+v", st, gst)
+		case st.Size != 5:
+			t.Fatalf("expected a size of 5, got %d", st.Size)
+		}
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		b := newBackend(t)
+
+		f := create(t, b, "old", "new contents")
+		defer f.Close()
+		create(t, b, "new", "old contents").Close()
+
+		before, err := b.Fstat(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Rename(f, "new"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.Lstat("old"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("expected the old name to be gone, got %v", err)
+		}
+		after, err := b.Lstat("new")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after.Ino != before.Ino {
+			t.Fatalf("renaming changed the identity of the file: %+v, %+v", before, after)
+		}
+		if got := read(t, b, "new"); got != "new contents" {
+			t.Fatalf("expected %q, got %q", "new contents", got)
+		}
+	})
+
+	t.Run("Link", func(t *testing.T) {
+		b := newBackend(t)
+
+		create(t, b, "file", "contents").Close()
+		create(t, b, "other", "").Close()
+
+		if err := b.Link("file", "other"); !errors.Is(err, fs.ErrExist) {
+			t.Fatalf("linking over an existing file: expected ErrExist, got %v", err)
+		}
+		if err := b.Link("file", "link"); err != nil {
+			t.Fatal(err)
+		}
+		st, err := b.Lstat("file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		lst, err := b.Lstat("link")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Ino != lst.Ino {
+			t.Fatalf("links have distinct identities: %+v, %+v", st, lst)
+		}
+
+		if err := b.Remove("file"); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Remove("file"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("removing a missing file: expected ErrNotExist, got %v", err)
+		}
+		if got := read(t, b, "link"); got != "contents" {
+			t.Fatalf("expected %q, got %q", "contents", got)
+		}
+	})
+
+	t.Run("ReadDir", func(t *testing.T) {
+		b := newBackend(t)
+
+		for _, name := range []string{"b", "c", "a"} {
+			create(t, b, name, "").Close()
+		}
+		entries, err := b.ReadDir(".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				t.Fatalf("expected %s to be a regular file, got %v", entry.Name(), entry.Type())
+			}
+			names = append(names, entry.Name())
+		}
+		if len(names) != 3 || names[0] != "a" || names[1] != "b" || names[2] != "c" {
+			t.Fatalf("expected [a b c], got %v", names)
+		}
+	})
+
+	t.Run("Locks", func(t *testing.T) {
+		b := newBackend(t)
+
+		f1 := create(t, b, "file", "")
+		defer f1.Close()
+		f2, err := b.OpenFile("file", os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f2.Close()
+		f3, err := b.OpenFile("file", os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f3.Close()
+
+		// Shared locks do not exclude each other, but exclude exclusive
+		// locks.
+		if err := b.RLock(ctx, f2); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.RLock(ctx, f3); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.TryLock(f1); !errors.Is(err, store.ErrWouldBlock) {
+			t.Fatalf("expected ErrWouldBlock, got %v", err)
+		}
+		f2.Close()
+		f3.Close()
+
+		// Closing the files released their locks.
+		if err := b.TryLock(f1); err != nil {
+			t.Fatal(err)
+		}
+
+		f4, err := b.OpenFile("file", os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f4.Close()
+
+		timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		if err := b.RLock(timeout, f4); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected DeadlineExceeded, got %v", err)
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			done <- b.RLock(ctx, f4)
+		}()
+		f1.Close()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Store", func(t *testing.T) {
+		st := store.New[int](json.NewEncoder, json.NewDecoder, store.WithBackend(newBackend(t)), store.WithBackups(1))
+
+		const workers, increments = 4, 25
+
+		var wg sync.WaitGroup
+		errs := make(chan error, workers)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < increments; j++ {
+					err := st.LoadAndStore(ctx, "counter", 0666, func(ctx context.Context, val *int, err error) error {
+						if err != nil && !errors.Is(err, fs.ErrNotExist) {
+							return err
+						}
+						*val++
+						return nil
+					})
+					if err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatal(err)
+		}
+
+		var val int
+		canary, err := st.Load(ctx, "counter", &val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != workers*increments {
+			t.Fatalf("expected %d, got %d", workers*increments, val)
+		}
+		if err := st.LoadVersion(ctx, "counter", 1, &val); err != nil {
+			t.Fatal(err)
+		}
+		if val != workers*increments-1 {
+			t.Fatalf("expected a backup of %d, got %d", workers*increments-1, val)
+		}
+
+		if err := st.Delete(ctx, "counter", canary); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := st.Load(ctx, "counter", &val); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("expected ErrNotExist, got %v", err)
+		}
+	})
+}
+
+// create creates the named file with the specified contents, and returns it
+// open for reading and writing.
+func create(t *testing.T, b store.Backend, name, contents string) store.File {
+	t.Helper()
+
+	f, err := b.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(f, contents); err != nil {
+		f.Close()
+		t.Fatal(err)
+	}
+	return f
+}
+
+// read returns the contents of the named file.
+func read(t *testing.T, b store.Backend, name string) string {
+	t.Helper()
+
+	f, err := b.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
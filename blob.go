@@ -0,0 +1,103 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// errStreamConsumed is returned when the data streamed by StoreFrom would need
+// to be read a second time.
+var errStreamConsumed = errors.New("the stream was already consumed")
+
+// StoreFrom atomically replaces the contents of the file at path with the data
+// read from r until EOF, like ForceStore, except that the data is streamed
+// to the file as-is rather than marshaled from a value. This allows publishing
+// large binary artifacts without holding them in memory.
+//
+// The data bypasses the encoder of the store, as well as the transformations
+// configured with WithChecksum, WithEncryption, WithCompression and
+// WithMigrations. WithMaxBytes still limits its size. If reading from r
+// fails, the file remains untouched.
+func (store *Store[T]) StoreFrom(ctx context.Context, path string, mode os.FileMode, r io.Reader) (err error) {
+	ctx, span := store.startSpan(ctx, "StoreFrom", path)
+	defer func() { endSpan(span, err) }()
+
+	// Retrying is safe, since acquiring the lock fails with ErrRetry before
+	// anything is read from r.
+	write := store.streamWriter(r)
+	err = ErrRetry
+	for err == ErrRetry {
+		err = store.replace(ctx, path, mode, nil, true, write)
+	}
+	return err
+}
+
+// streamWriter returns a function that copies the data read from r. Since r
+// can only be read once, the function fails if called again; commit copies
+// the recovery copy instead of writing the same contents twice.
+func (store *Store[T]) streamWriter(r io.Reader) func(io.Writer) error {
+	consumed := false
+	return func(w io.Writer) error {
+		if consumed {
+			return errStreamConsumed
+		}
+		consumed = true
+
+		if store.opts.maxBytes > 0 {
+			w = &limitedWriter{w: w, n: store.opts.maxBytes}
+		}
+		_, err := io.Copy(w, r)
+		return err
+	}
+}
+
+// LoadTo copies the contents of the file at path to w, as-is, while holding
+// the shared lock of the file. It is the counterpart of StoreFrom.
+//
+// LoadTo may block if another store is in the process of writing to the file.
+func (store *Store[T]) LoadTo(ctx context.Context, path string, w io.Writer) (err error) {
+	ctx, span := store.startSpan(ctx, "LoadTo", path)
+	defer func() { endSpan(span, err) }()
+
+	if store.opts.objects != nil {
+		rc, _, err := store.opts.objects.Get(ctx, path, "")
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		_, err = io.Copy(w, rc)
+		return err
+	}
+
+	rdf, err := store.open(path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer closeFile(rdf)
+
+	var start time.Time
+	if span != nil {
+		start = time.Now()
+	}
+	if err := store.fs().RLock(ctx, rdf); err != nil {
+		return err
+	}
+	traceLockWait(span, start)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	_, err = io.Copy(w, rdf)
+	return err
+}
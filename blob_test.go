@@ -0,0 +1,125 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBlob(t *testing.T) {
+	ctx := context.Background()
+
+	// A blob large enough to span multiple copy buffers.
+	blob := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		store := New[struct{}](json.NewEncoder, json.NewDecoder)
+		path := filepath.Join(t.TempDir(), "image")
+
+		for i := 0; i < 2; i++ {
+			if err := store.StoreFrom(ctx, path, 0666, bytes.NewReader(blob)); err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := store.LoadTo(ctx, path, &buf); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), blob) {
+				t.Fatalf("expected %d bytes of blob, got %d different bytes", len(blob), buf.Len())
+			}
+		}
+		if _, err := os.Stat(path + ".lock"); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected the temporary file to have been renamed, got %v", err)
+		}
+	})
+
+	t.Run("ReadError", func(t *testing.T) {
+		store := New[struct{}](json.NewEncoder, json.NewDecoder, WithStableLockFile())
+		path := filepath.Join(t.TempDir(), "image")
+
+		if err := store.StoreFrom(ctx, path, 0666, bytes.NewReader([]byte("old"))); err != nil {
+			t.Fatal(err)
+		}
+
+		errBroken := errors.New("broken pipe")
+		r := io.MultiReader(bytes.NewReader(blob), &errReader{err: errBroken})
+		if err := store.StoreFrom(ctx, path, 0666, r); !errors.Is(err, errBroken) {
+			t.Fatalf("expected %v, got %v", errBroken, err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "old" {
+			t.Fatalf("expected the file to remain untouched, got %d bytes", len(data))
+		}
+		entries, err := os.ReadDir(filepath.Dir(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if filepath.Ext(entry.Name()) == ".tmp" {
+				t.Fatalf("expected no temporary file to be left behind, got %v", entry.Name())
+			}
+		}
+	})
+
+	t.Run("MaxBytes", func(t *testing.T) {
+		store := New[struct{}](json.NewEncoder, json.NewDecoder, WithMaxBytes(1024))
+		path := filepath.Join(t.TempDir(), "image")
+
+		if err := store.StoreFrom(ctx, path, 0666, bytes.NewReader(blob)); !errors.Is(err, ErrTooLarge) {
+			t.Fatalf("expected %v, got %v", ErrTooLarge, err)
+		}
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected the file not to exist, got %v", err)
+		}
+	})
+
+	t.Run("Recovery", func(t *testing.T) {
+		store := New[struct{}](json.NewEncoder, json.NewDecoder, WithRecovery())
+		path := filepath.Join(t.TempDir(), "image")
+
+		if err := store.StoreFrom(ctx, path, 0666, bytes.NewReader(blob)); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{path, path + ".bak"} {
+			data, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, blob) {
+				t.Fatalf("expected %v to hold the blob, got %d different bytes", name, len(data))
+			}
+		}
+	})
+
+	t.Run("NotExist", func(t *testing.T) {
+		store := New[struct{}](json.NewEncoder, json.NewDecoder)
+		path := filepath.Join(t.TempDir(), "image")
+
+		if err := store.LoadTo(ctx, path, io.Discard); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected %v, got %v", os.ErrNotExist, err)
+		}
+	})
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
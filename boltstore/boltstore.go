@@ -0,0 +1,151 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+// Package boltstore provides a store.ObjectBackend that keeps files as the
+// keys of a bucket of a bbolt database, using the sequence numbers of the
+// bucket as canaries and transactions in place of locks. This gives programs
+// a migration path for when keeping one file per value stops scaling: the
+// values of a store move into a single database file, with the same Load,
+// Store and LoadAndStore semantics.
+//
+// Basic usage is:
+//
+//	db, err := bbolt.Open("values.db", 0666, nil)
+//	if err != nil {
+//	    return err
+//	}
+//	st := store.New[Type](json.NewEncoder, json.NewDecoder, store.WithObjectBackend(boltstore.New(db, "values")))
+package boltstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/fs"
+	"strconv"
+
+	"barney.ci/go-store"
+	"go.etcd.io/bbolt"
+)
+
+// A DB is a bucket of a bbolt database, which implements
+// store.ObjectBackend.
+//
+// The names of files are the keys of the bucket, which gets created on the
+// first write. Each value holds the contents of its file, preceded by the
+// sequence number that the bucket had when the file was last written, which
+// is its version.
+type DB struct {
+	db     *bbolt.DB
+	bucket []byte
+}
+
+// New returns a DB that keeps files in the named bucket of db. The database
+// is shared with its other users, and must be closed by the caller once the
+// stores using it are done.
+func New(db *bbolt.DB, bucket string) *DB {
+	return &DB{db: db, bucket: []byte(bucket)}
+}
+
+// seqLen is the length of the sequence number that precedes contents.
+const seqLen = 8
+
+// version returns the version of the value v of a file.
+func version(v []byte) string {
+	return strconv.FormatUint(binary.BigEndian.Uint64(v[:seqLen]), 10)
+}
+
+// Get implements store.ObjectBackend.
+func (db *DB) Get(ctx context.Context, name, ifNoneMatch string) (io.ReadCloser, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	var (
+		data []byte
+		ver  string
+	)
+	err := db.db.View(func(tx *bbolt.Tx) error {
+		v := db.get(tx, name)
+		if v == nil {
+			return &fs.PathError{Op: "get", Path: name, Err: fs.ErrNotExist}
+		}
+		if ver = version(v); ver == ifNoneMatch {
+			return store.ErrNotModified
+		}
+		// Values are only valid for the duration of the transaction.
+		data = append([]byte(nil), v[seqLen:]...)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return io.NopCloser(bytes.NewReader(data)), ver, nil
+}
+
+// Put implements store.ObjectBackend.
+func (db *DB) Put(ctx context.Context, name string, data []byte, ifMatch string, force bool) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	var ver string
+	err := db.db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(db.bucket)
+		if err != nil {
+			return err
+		}
+		v := db.get(tx, name)
+		switch {
+		case force:
+		case ifMatch == "" && v != nil, ifMatch != "" && (v == nil || version(v) != ifMatch):
+			return store.ErrRetry
+		}
+
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		v = make([]byte, seqLen+len(data))
+		binary.BigEndian.PutUint64(v, seq)
+		copy(v[seqLen:], data)
+		if err := b.Put([]byte(name), v); err != nil {
+			return err
+		}
+		ver = version(v)
+		return nil
+	})
+	return ver, err
+}
+
+// Delete implements store.ObjectBackend.
+func (db *DB) Delete(ctx context.Context, name, ifMatch string, force bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return db.db.Update(func(tx *bbolt.Tx) error {
+		v := db.get(tx, name)
+		switch {
+		case v == nil && (force || ifMatch == ""):
+			return &fs.PathError{Op: "delete", Path: name, Err: fs.ErrNotExist}
+		case v == nil, !force && version(v) != ifMatch:
+			return store.ErrRetry
+		}
+		return tx.Bucket(db.bucket).Delete([]byte(name))
+	})
+}
+
+// get returns the value of the named file in tx, or nil if there is none.
+func (db *DB) get(tx *bbolt.Tx, name string) []byte {
+	b := tx.Bucket(db.bucket)
+	if b == nil {
+		return nil
+	}
+	v := b.Get([]byte(name))
+	if len(v) < seqLen {
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,175 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package boltstore_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"barney.ci/go-store"
+	"barney.ci/go-store/boltstore"
+	"go.etcd.io/bbolt"
+)
+
+// openDB opens a new database in a temporary directory, and returns it along
+// with its path.
+func openDB(t *testing.T) (*bbolt.DB, string) {
+	path := filepath.Join(t.TempDir(), "values.db")
+	db, err := bbolt.Open(path, 0666, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, path
+}
+
+type Counter struct {
+	N int
+}
+
+func TestDB(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("StoreLoad", func(t *testing.T) {
+		db, _ := openDB(t)
+		st := store.New[Counter](json.NewEncoder, json.NewDecoder, store.WithObjectBackend(boltstore.New(db, "values")))
+
+		var val Counter
+		if _, err := st.Load(ctx, "counter.json", &val); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected ErrNotExist, got %v", err)
+		}
+		if err := st.Store(ctx, "counter.json", 0666, &Counter{N: 42}, nil); err != nil {
+			t.Fatal(err)
+		}
+		canary, err := st.Load(ctx, "counter.json", &val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val.N != 42 {
+			t.Fatalf("expected 42, got %d", val.N)
+		}
+		if canary != "1" {
+			t.Fatalf("expected the sequence number as canary, got %v", canary)
+		}
+
+		if _, err := st.LoadIfChanged(ctx, "counter.json", canary, &val); err != store.ErrNotModified {
+			t.Fatalf("expected ErrNotModified, got %v", err)
+		}
+		if err := st.Store(ctx, "counter.json", 0666, &Counter{N: 1}, nil); err != store.ErrRetry {
+			t.Fatalf("expected ErrRetry, got %v", err)
+		}
+		if err := st.StoreExclusive(ctx, "counter.json", 0666, &Counter{N: 1}); !errors.Is(err, os.ErrExist) {
+			t.Fatalf("expected ErrExist, got %v", err)
+		}
+		if err := st.Store(ctx, "counter.json", 0666, &Counter{N: 43}, canary); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.Delete(ctx, "counter.json", canary); err != store.ErrRetry {
+			t.Fatalf("expected ErrRetry, got %v", err)
+		}
+		canary, err = st.Load(ctx, "counter.json", &val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := st.Delete(ctx, "counter.json", canary); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.Delete(ctx, "counter.json", nil); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected ErrNotExist, got %v", err)
+		}
+	})
+
+	t.Run("Reopen", func(t *testing.T) {
+		db, path := openDB(t)
+		st := store.New[Counter](json.NewEncoder, json.NewDecoder, store.WithObjectBackend(boltstore.New(db, "values")))
+		if err := st.Store(ctx, "counter.json", 0666, &Counter{N: 7}, nil); err != nil {
+			t.Fatal(err)
+		}
+		var val Counter
+		canary, err := st.Load(ctx, "counter.json", &val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		db, err = bbolt.Open(path, 0666, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		st = store.New[Counter](json.NewEncoder, json.NewDecoder, store.WithObjectBackend(boltstore.New(db, "values")))
+		if _, err := st.LoadIfChanged(ctx, "counter.json", canary, &val); err != store.ErrNotModified {
+			t.Fatalf("expected the canary to survive reopening, got %v", err)
+		}
+		if err := st.Store(ctx, "counter.json", 0666, &Counter{N: 8}, canary); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Buckets", func(t *testing.T) {
+		db, _ := openDB(t)
+		a := store.New[Counter](json.NewEncoder, json.NewDecoder, store.WithObjectBackend(boltstore.New(db, "a")))
+		b := store.New[Counter](json.NewEncoder, json.NewDecoder, store.WithObjectBackend(boltstore.New(db, "b")))
+
+		if err := a.Store(ctx, "counter.json", 0666, &Counter{N: 1}, nil); err != nil {
+			t.Fatal(err)
+		}
+		var val Counter
+		if _, err := b.Load(ctx, "counter.json", &val); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected buckets to be independent, got %v", err)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		db, _ := openDB(t)
+		st := store.New[Counter](json.NewEncoder, json.NewDecoder, store.WithObjectBackend(boltstore.New(db, "values")))
+
+		const workers, increments = 8, 25
+
+		var wg sync.WaitGroup
+		errs := make(chan error, workers)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < increments; j++ {
+					err := st.LoadAndStore(ctx, "dir/counter.json", 0666, func(ctx context.Context, val *Counter, err error) error {
+						if err != nil && !errors.Is(err, os.ErrNotExist) {
+							return err
+						}
+						val.N++
+						return nil
+					})
+					if err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatal(err)
+		}
+
+		var val Counter
+		if _, err := st.Load(ctx, "dir/counter.json", &val); err != nil {
+			t.Fatal(err)
+		}
+		if val.N != workers*increments {
+			t.Fatalf("expected %d, got %d", workers*increments, val.N)
+		}
+	})
+}
@@ -0,0 +1,18 @@
+module barney.ci/go-store/boltstore
+
+go 1.22
+
+require (
+	barney.ci/go-store v0.0.0
+	go.etcd.io/bbolt v1.3.11
+)
+
+require (
+	github.com/vmihailenco/msgpack/v5 v5.4.1 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	go.opentelemetry.io/otel v1.17.0 // indirect
+	go.opentelemetry.io/otel/trace v1.17.0 // indirect
+	golang.org/x/sys v0.5.0 // indirect
+)
+
+replace barney.ci/go-store => ../
@@ -0,0 +1,139 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A Cached caches the values of files loaded with a store, for files that get
+// read much more often than they get written, such as configuration files.
+//
+// Get only checks that the file is still the one it last loaded, which costs
+// a single lstat(2), and only loads it again once it was replaced. Since
+// stores replace files rather than writing to them in place, this catches
+// every store to the file, but relies on the identity of files as much as
+// the canaries of stores do; a time to live bounds how long a cached value
+// gets trusted regardless, for file systems where that identity is
+// unreliable.
+type Cached[T any] struct {
+	store *Store[T]
+	ttl   time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry[T]
+}
+
+type cacheEntry[T any] struct {
+	mu     sync.RWMutex
+	valid  bool
+	val    T
+	canary Canary
+	loaded time.Time
+
+	// dev and file identify the file that the value was loaded from, if
+	// it can be checked with Lstat.
+	quick bool
+	dev   uint64
+	file  FileCanary
+}
+
+// NewCached returns a Cached that loads files with the specified store, and
+// loads them again once they are older than ttl, if positive, even if they
+// did not change.
+func NewCached[T any](store *Store[T], ttl time.Duration) *Cached[T] {
+	return &Cached[T]{
+		store:   store,
+		ttl:     ttl,
+		entries: map[string]*cacheEntry[T]{},
+	}
+}
+
+func (c *Cached[T]) entry(path string) *cacheEntry[T] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entries[path]
+	if e == nil {
+		e = &cacheEntry[T]{}
+		c.entries[path] = e
+	}
+	return e
+}
+
+// Get returns the contents of the file at path, from the cache if the file
+// did not change since it was last loaded.
+//
+// The value is shared with the cache and with the other callers of Get, and
+// must therefore not be modified, including through the pointers, maps and
+// slices that it may hold.
+//
+// Symbolic links, and files of stores configured with WithObjectBackend,
+// cannot be checked with lstat(2), and neither can files of stores configured
+// with WithGenerations, which do not trust inode numbers; for those, Get goes
+// through LoadIfChanged, which opens the file every time, but still only
+// decodes it once it changed, unless the store was configured with
+// WithCanaryFunc.
+func (c *Cached[T]) Get(ctx context.Context, path string) (T, error) {
+	e := c.entry(path)
+
+	st, err := c.store.fs().Lstat(path)
+	quick := err == nil && !st.Symlink && !c.store.opts.generations
+
+	e.mu.RLock()
+	if c.fresh(e, quick, st) {
+		defer e.mu.RUnlock()
+		return e.val, nil
+	}
+	e.mu.RUnlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if c.fresh(e, quick, st) {
+		return e.val, nil
+	}
+
+	canary := e.canary
+	if !e.valid || c.expired(e) {
+		canary = nil
+	}
+	var v T
+	newCanary, err := c.store.LoadIfChanged(ctx, path, canary, &v)
+	switch {
+	case err == ErrNotModified:
+	case err != nil:
+		var zero T
+		e.valid, e.val, e.canary = false, zero, nil
+		return zero, err
+	default:
+		e.val, e.canary, e.loaded = v, newCanary, time.Now()
+	}
+	// The file was checked before loading it, so that it is at least as
+	// recent as the check, and gets loaded again if it changed since.
+	e.valid, e.quick, e.dev, e.file = true, quick, st.Dev, fileCanary(st)
+	return e.val, nil
+}
+
+// fresh returns whether the value of e is known to be current, given the
+// result of checking the file with Lstat. e must be locked.
+func (c *Cached[T]) fresh(e *cacheEntry[T], quick bool, st FileStat) bool {
+	return e.valid && e.quick && quick && st.Dev == e.dev && fileCanary(st) == e.file && !c.expired(e)
+}
+
+// expired returns whether the value of e outlived the time to live of c.
+func (c *Cached[T]) expired(e *cacheEntry[T]) bool {
+	return c.ttl > 0 && time.Since(e.loaded) >= c.ttl
+}
+
+// Invalidate drops the cached value of the file at path, if any, so that the
+// next call to Get loads it again.
+func (c *Cached[T]) Invalidate(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, path)
+}
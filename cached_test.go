@@ -0,0 +1,107 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCached(t *testing.T) {
+	ctx := context.Background()
+
+	var decodes atomic.Int64
+	newDecoder := func(r io.Reader) *json.Decoder {
+		decodes.Add(1)
+		return json.NewDecoder(r)
+	}
+	store := New[int](json.NewEncoder, newDecoder)
+
+	// get checks that Get returns the expected value after the expected
+	// number of decodes.
+	get := func(t *testing.T, c *Cached[int], path string, expected int, expectedDecodes int64) {
+		t.Helper()
+		decodes.Store(0)
+		val, err := c.Get(ctx, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != expected {
+			t.Fatalf("expected %d, got %d", expected, val)
+		}
+		if n := decodes.Load(); n != expectedDecodes {
+			t.Fatalf("expected %d decodes, got %d", expectedDecodes, n)
+		}
+	}
+
+	t.Run("Replaced", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.json")
+		c := NewCached(store, 0)
+
+		if _, err := c.Get(ctx, path); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected %v, got %v", os.ErrNotExist, err)
+		}
+
+		if err := store.ForceStore(ctx, path, 0666, new(int)); err != nil {
+			t.Fatal(err)
+		}
+		get(t, c, path, 0, 1)
+		get(t, c, path, 0, 0)
+
+		v := 1
+		if err := store.ForceStore(ctx, path, 0666, &v); err != nil {
+			t.Fatal(err)
+		}
+		get(t, c, path, 1, 1)
+		get(t, c, path, 1, 0)
+
+		c.Invalidate(path)
+		get(t, c, path, 1, 1)
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.json")
+		c := NewCached(store, 10*time.Millisecond)
+
+		if err := store.ForceStore(ctx, path, 0666, new(int)); err != nil {
+			t.Fatal(err)
+		}
+		get(t, c, path, 0, 1)
+		get(t, c, path, 0, 0)
+		time.Sleep(20 * time.Millisecond)
+		get(t, c, path, 0, 1)
+	})
+
+	t.Run("Symlink", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "config.json")
+		if err := store.ForceStore(ctx, path, 0666, new(int)); err != nil {
+			t.Fatal(err)
+		}
+		link := filepath.Join(dir, "link.json")
+		if err := os.Symlink(path, link); err != nil {
+			t.Skip(err)
+		}
+		c := NewCached(store, 0)
+
+		get(t, c, link, 0, 1)
+		get(t, c, link, 0, 0)
+
+		v := 1
+		if err := store.ForceStore(ctx, path, 0666, &v); err != nil {
+			t.Fatal(err)
+		}
+		get(t, c, link, 1, 1)
+	})
+}
@@ -0,0 +1,155 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"barney.ci/go-store"
+)
+
+// newStore returns a store of JSON files, which get stored compacted, like
+// json.Encoder writes them.
+func (c *cli) newStore() *store.Store[json.RawMessage] {
+	return store.New[json.RawMessage](json.NewEncoder, json.NewDecoder,
+		store.WithOnRetry(func(ctx context.Context, path string, attempt int) error {
+			fmt.Fprintf(c.stderr, "go-store: %s changed concurrently, starting over\n", path)
+			return nil
+		}))
+}
+
+// parseFile parses the flags of the commands that write files, and returns
+// the mode of new files along with the remaining arguments.
+func parseFile(cmd string, args []string, minArgs, maxArgs int) (os.FileMode, []string, error) {
+	fset := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fset.SetOutput(io.Discard)
+	mode := fset.String("m", "0644", "mode of new files, in octal")
+	if err := fset.Parse(args); err != nil {
+		return 0, nil, usageError(err.Error())
+	}
+	perm, err := strconv.ParseUint(*mode, 8, 32)
+	if err != nil || perm > 0777 {
+		return 0, nil, usageError(fmt.Sprintf("invalid mode %q", *mode))
+	}
+	args = fset.Args()
+	if len(args) < minArgs || len(args) > maxArgs {
+		return 0, nil, usageError(fmt.Sprintf("wrong number of arguments for %s", cmd))
+	}
+	return os.FileMode(perm), args, nil
+}
+
+// get runs the get command.
+func (c *cli) get(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return usageError("get requires a file")
+	}
+	var val json.RawMessage
+	if _, err := c.newStore().Load(ctx, args[0], &val); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(c.stdout, "%s\n", bytes.TrimSpace(val))
+	return err
+}
+
+// set runs the set command.
+func (c *cli) set(ctx context.Context, args []string) error {
+	mode, args, err := parseFile("set", args, 1, 2)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	if len(args) == 2 {
+		data = []byte(args[1])
+	} else if data, err = io.ReadAll(c.stdin); err != nil {
+		return err
+	}
+	if !json.Valid(data) {
+		return fmt.Errorf("%s: invalid JSON", args[0])
+	}
+	val := json.RawMessage(data)
+	return c.newStore().ForceStore(ctx, args[0], mode, &val)
+}
+
+// edit runs the edit command.
+func (c *cli) edit(ctx context.Context, args []string) error {
+	mode, args, err := parseFile("edit", args, 1, 1)
+	if err != nil {
+		return err
+	}
+	name := args[0]
+
+	tmp, err := os.MkdirTemp("", "go-store-edit")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	path := filepath.Join(tmp, filepath.Base(name))
+
+	return c.newStore().LoadAndStore(ctx, name, mode, func(ctx context.Context, val *json.RawMessage, err error) error {
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		var before []byte
+		if len(*val) > 0 {
+			var buf bytes.Buffer
+			if err := json.Indent(&buf, *val, "", "\t"); err != nil {
+				return err
+			}
+			buf.WriteByte('\n')
+			before = buf.Bytes()
+		}
+		if err := os.WriteFile(path, before, 0600); err != nil {
+			return err
+		}
+		if err := c.runEditor(ctx, path); err != nil {
+			return err
+		}
+		after, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if bytes.Equal(before, after) {
+			return store.ErrNoChange
+		}
+		if !json.Valid(after) {
+			return fmt.Errorf("%s: invalid JSON", name)
+		}
+		*val = after
+		return nil
+	})
+}
+
+// runEditor runs the editor of the user on the file at path.
+func (c *cli) runEditor(ctx context.Context, path string) error {
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+		if runtime.GOOS == "windows" {
+			editor = []string{"notepad"}
+		}
+	}
+	cmd := exec.CommandContext(ctx, editor[0], append(editor[1:], path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = c.stdin, c.stdout, c.stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", editor[0], err)
+	}
+	return nil
+}
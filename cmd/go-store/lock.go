@@ -0,0 +1,76 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"os/exec"
+
+	"barney.ci/go-store"
+)
+
+// lock runs the lock command, and returns the exit status of the command it
+// ran.
+func (c *cli) lock(ctx context.Context, args []string) (int, error) {
+	fset := flag.NewFlagSet("lock", flag.ContinueOnError)
+	fset.SetOutput(io.Discard)
+	shared := fset.Bool("s", false, "acquire a shared lock")
+	nonblock := fset.Bool("n", false, "fail rather than wait")
+	wait := fset.Duration("w", 0, "maximum duration to wait")
+	if err := fset.Parse(args); err != nil {
+		return 0, usageError(err.Error())
+	}
+	args = fset.Args()
+	if len(args) < 3 || args[1] != "--" {
+		return 0, usageError("lock requires a file and a command")
+	}
+	name, command := args[0], args[2:]
+
+	f, err := os.OpenFile(name, os.O_RDONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if *wait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *wait)
+		defer cancel()
+	}
+	switch {
+	case *nonblock && *shared:
+		err = store.TryRLock(f)
+	case *nonblock:
+		err = store.TryLock(f)
+	case *shared:
+		err = store.RLock(ctx, f)
+	default:
+		err = store.Lock(ctx, f)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// The command gets interrupted along with us, since it shares our
+	// terminal; keep holding the lock until it exits.
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = c.stdin, c.stdout, c.stderr
+	err = cmd.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if code := exitErr.ExitCode(); code >= 0 {
+			return code, nil
+		}
+		return 1, nil
+	}
+	return 0, err
+}
@@ -0,0 +1,107 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+// Command go-store lets shell scripts cooperate with programs that manage
+// files with package store, by taking the same locks and replacing files
+// with the same protocol.
+//
+// Usage:
+//
+//	go-store lock [-s] [-n] [-w timeout] file -- command [args...]
+//	go-store get file
+//	go-store set [-m mode] file [json]
+//	go-store edit [-m mode] file
+//
+// The lock command runs a command while holding a lock on file, which it
+// creates if needed, like flock(1); it exits with the status of the command.
+// With -s, the lock is shared rather than exclusive. With -n, it fails
+// rather than waiting for the lock, and with -w, it waits for at most the
+// specified duration. Interrupting go-store while it waits aborts it.
+//
+// The get command prints the JSON contents of file. The set command replaces
+// them with the specified JSON, or with the JSON read from the standard input.
+// The edit command opens them in $EDITOR, and stores the result unless file
+// changed in the meantime, in which case it starts over.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+)
+
+// usage is the synopsis of the commands.
+const usage = `usage:
+	go-store lock [-s] [-n] [-w timeout] file -- command [args...]
+	go-store get file
+	go-store set [-m mode] file [json]
+	go-store edit [-m mode] file
+`
+
+// A cli holds the standard streams of the command.
+type cli struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	c := &cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+	code := c.run(ctx, os.Args[1:])
+	stop()
+	os.Exit(code)
+}
+
+// run runs the command with the specified arguments, and returns its exit
+// status.
+func (c *cli) run(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(c.stderr, usage)
+		return 2
+	}
+
+	var err error
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "lock":
+		var code int
+		code, err = c.lock(ctx, args)
+		if err == nil {
+			return code
+		}
+	case "get":
+		err = c.get(ctx, args)
+	case "set":
+		err = c.set(ctx, args)
+	case "edit":
+		err = c.edit(ctx, args)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(c.stdout, usage)
+		return 0
+	default:
+		err = usageError(fmt.Sprintf("unknown command %q", cmd))
+	}
+
+	if err != nil {
+		fmt.Fprintf(c.stderr, "go-store: %v\n", err)
+		if _, ok := err.(usageError); ok {
+			fmt.Fprint(c.stderr, usage)
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// A usageError reports invalid arguments.
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
@@ -0,0 +1,125 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"barney.ci/go-store"
+)
+
+// runCLI runs the command with the specified arguments and standard input,
+// and returns its exit status and outputs.
+func runCLI(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	c := &cli{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr}
+	code := c.run(context.Background(), args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCLI(t *testing.T) {
+	t.Run("GetSet", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "state.json")
+
+		if code, _, stderr := runCLI(t, "", "get", path); code != 1 || !strings.Contains(stderr, "no such file") {
+			t.Fatalf("expected a missing file, got %d: %s", code, stderr)
+		}
+		if code, _, stderr := runCLI(t, "", "set", "-m", "0600", path, `{"n": 1}`); code != 0 {
+			t.Fatalf("set failed: %s", stderr)
+		}
+		if code, stdout, stderr := runCLI(t, "", "get", path); code != 0 || stdout != "{\"n\":1}\n" {
+			t.Fatalf("unexpected output %q: %s", stdout, stderr)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Fatalf("expected mode 0600, got %v", info.Mode().Perm())
+		}
+
+		if code, _, stderr := runCLI(t, `[1, 2]`, "set", path); code != 0 {
+			t.Fatalf("set failed: %s", stderr)
+		}
+		if _, stdout, _ := runCLI(t, "", "get", path); stdout != "[1,2]\n" {
+			t.Fatalf("unexpected output %q", stdout)
+		}
+		if code, _, stderr := runCLI(t, `{`, "set", path); code != 1 || !strings.Contains(stderr, "invalid JSON") {
+			t.Fatalf("expected invalid JSON, got %d: %s", code, stderr)
+		}
+	})
+
+	t.Run("Edit", func(t *testing.T) {
+		if _, err := exec.LookPath("sed"); err != nil {
+			t.Skip("sed is not available")
+		}
+		path := filepath.Join(t.TempDir(), "state.json")
+		if code, _, stderr := runCLI(t, "", "set", path, `{"n": 1}`); code != 0 {
+			t.Fatalf("set failed: %s", stderr)
+		}
+
+		t.Setenv("EDITOR", "sed -i.orig s/1/2/")
+		if code, _, stderr := runCLI(t, "", "edit", path); code != 0 {
+			t.Fatalf("edit failed: %s", stderr)
+		}
+		if _, stdout, _ := runCLI(t, "", "get", path); stdout != "{\"n\":2}\n" {
+			t.Fatalf("unexpected output %q", stdout)
+		}
+	})
+
+	t.Run("Lock", func(t *testing.T) {
+		sh, err := exec.LookPath("sh")
+		if err != nil {
+			t.Skip("sh is not available")
+		}
+		path := filepath.Join(t.TempDir(), "lock")
+
+		if code, _, stderr := runCLI(t, "", "lock", path, "--", sh, "-c", "exit 3"); code != 3 {
+			t.Fatalf("expected the status of the command, got %d: %s", code, stderr)
+		}
+		if code, stdout, _ := runCLI(t, "", "lock", "-s", path, "--", sh, "-c", "echo locked"); code != 0 || stdout != "locked\n" {
+			t.Fatalf("unexpected output %q", stdout)
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := store.Lock(context.Background(), f); err != nil {
+			t.Fatal(err)
+		}
+		if code, _, stderr := runCLI(t, "", "lock", "-n", path, "--", sh, "-c", "exit 0"); code != 1 {
+			t.Fatalf("expected the lock to fail, got %d: %s", code, stderr)
+		}
+		if code, _, stderr := runCLI(t, "", "lock", "-w", "10ms", path, "--", sh, "-c", "exit 0"); code != 1 || !strings.Contains(stderr, "deadline") {
+			t.Fatalf("expected the lock to time out, got %d: %s", code, stderr)
+		}
+	})
+
+	t.Run("Usage", func(t *testing.T) {
+		for _, args := range [][]string{
+			nil,
+			{"frobnicate"},
+			{"lock", "file"},
+			{"set", "-m", "999", "file", "{}"},
+			{"get"},
+		} {
+			if code, _, _ := runCLI(t, "", args...); code != 2 {
+				t.Errorf("%q: expected status 2, got %d", args, code)
+			}
+		}
+	})
+}
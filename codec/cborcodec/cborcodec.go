@@ -0,0 +1,20 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+// Package cborcodec provides stores that marshal values with CBOR, as
+// specified by RFC 8949.
+package cborcodec
+
+import (
+	"github.com/fxamacker/cbor/v2"
+
+	"barney.ci/go-store"
+)
+
+// New returns a Store that marshals values of type T with CBOR.
+func New[T any](opts ...store.Option) *store.Store[T] {
+	return store.New[T](cbor.NewEncoder, cbor.NewDecoder, opts...)
+}
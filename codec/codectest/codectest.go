@@ -0,0 +1,180 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+// Package codectest provides a conformance test suite for the encoders and
+// decoders passed to store.New.
+package codectest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"barney.ci/go-store"
+)
+
+// Value is the type of the values that Run round-trips through the codec.
+// Its fields are exported, and cover the kinds of values that codecs are
+// commonly expected to support.
+type Value struct {
+	String  string
+	Int     int64
+	Uint    uint32
+	Float   float64
+	Bool    bool
+	Bytes   []byte
+	Slice   []string
+	Map     map[string]int
+	Nested  *Nested
+	Structs []Nested
+}
+
+// Nested is a struct nested in Value.
+type Nested struct {
+	Name  string
+	Count int
+}
+
+// Run checks that the store returned by newStore round-trips values through
+// the file system, and reports malformed contents as store.DecodeError.
+//
+// A typical use is:
+//
+//	func TestCodec(t *testing.T) {
+//	    codectest.Run(t, func(opts ...store.Option) *store.Store[codectest.Value] {
+//	        return store.New[codectest.Value](mycodec.NewEncoder, mycodec.NewDecoder, opts...)
+//	    })
+//	}
+func Run(t *testing.T, newStore func(opts ...store.Option) *store.Store[Value]) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	values := map[string]Value{
+		"Zero": {},
+		"Full": {
+			String:  "value",
+			Int:     -42,
+			Uint:    42,
+			Float:   3.5,
+			Bool:    true,
+			Bytes:   []byte{0, 1, 2, 0xff},
+			Slice:   []string{"a", "b"},
+			Map:     map[string]int{"x": 1, "y": 2},
+			Nested:  &Nested{Name: "nested", Count: 1},
+			Structs: []Nested{{Name: "first"}, {Name: "second", Count: 2}},
+		},
+	}
+
+	for name, expected := range values {
+		expected := expected
+		t.Run("RoundTrip/"+name, func(t *testing.T) {
+			for _, opts := range [][]store.Option{
+				nil,
+				{store.WithMaxBytes(1 << 20)},
+				{store.WithChecksum()},
+			} {
+				st := newStore(opts...)
+				path := filepath.Join(t.TempDir(), "value")
+
+				if err := st.ForceStore(ctx, path, 0666, &expected); err != nil {
+					t.Fatal(err)
+				}
+				var val Value
+				if _, err := st.Load(ctx, path, &val); err != nil {
+					t.Fatal(err)
+				}
+				if !equal(val, expected) {
+					t.Fatalf("expected %+v, got %+v", expected, val)
+				}
+			}
+		})
+	}
+
+	t.Run("Overwrite", func(t *testing.T) {
+		st := newStore()
+		path := filepath.Join(t.TempDir(), "value")
+
+		// Decoding into a value that is already populated must not leave
+		// stale contents behind when the stored value is shorter.
+		long := Value{String: "a much longer string", Slice: []string{"a", "b", "c"}}
+		short := Value{String: "short", Slice: []string{"d"}}
+		for _, v := range []Value{long, short} {
+			if err := st.ForceStore(ctx, path, 0666, &v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var val Value
+		if _, err := st.Load(ctx, path, &val); err != nil {
+			t.Fatal(err)
+		}
+		if !equal(val, short) {
+			t.Fatalf("expected %+v, got %+v", short, val)
+		}
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		st := newStore()
+		dir := t.TempDir()
+
+		for name, contents := range map[string][]byte{
+			"empty":     nil,
+			"truncated": truncated(t, newStore(), dir),
+		} {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, contents, 0666); err != nil {
+				t.Fatal(err)
+			}
+			var val Value
+			_, err := st.Load(ctx, path, &val)
+			var derr *store.DecodeError
+			if !errors.As(err, &derr) {
+				t.Fatalf("%s: expected a DecodeError, got %v", name, err)
+			}
+		}
+	})
+}
+
+// truncated returns the encoding of a value, cut in half.
+func truncated(t *testing.T, st *store.Store[Value], dir string) []byte {
+	t.Helper()
+
+	path := filepath.Join(dir, "full")
+	v := Value{String: "a string long enough to be cut", Map: map[string]int{"x": 1}}
+	if err := st.ForceStore(context.Background(), path, 0666, &v); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data[:len(data)/2]
+}
+
+// equal compares values, treating nil and empty slices and maps as equal,
+// since codecs commonly do not distinguish them.
+func equal(a, b Value) bool {
+	normalize := func(v *Value) {
+		if len(v.Bytes) == 0 {
+			v.Bytes = nil
+		}
+		if len(v.Slice) == 0 {
+			v.Slice = nil
+		}
+		if len(v.Map) == 0 {
+			v.Map = nil
+		}
+		if len(v.Structs) == 0 {
+			v.Structs = nil
+		}
+	}
+	normalize(&a)
+	normalize(&b)
+	return reflect.DeepEqual(a, b)
+}
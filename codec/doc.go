@@ -0,0 +1,14 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+// Package codec groups the sub-packages that provide ready-made stores for
+// common encodings, along with codectest, which checks that custom codecs
+// behave as stores expect.
+//
+// Codecs for other encodings need no adapter as long as their encoders and
+// decoders have Encode(any) error and Decode(any) error methods: their
+// constructors can be passed to store.New directly, as cborcodec does.
+package codec
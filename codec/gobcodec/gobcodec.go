@@ -0,0 +1,19 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+// Package gobcodec provides stores that marshal values with encoding/gob.
+package gobcodec
+
+import (
+	"encoding/gob"
+
+	"barney.ci/go-store"
+)
+
+// New returns a Store that marshals values of type T with encoding/gob.
+func New[T any](opts ...store.Option) *store.Store[T] {
+	return store.New[T](gob.NewEncoder, gob.NewDecoder, opts...)
+}
@@ -0,0 +1,18 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package gobcodec_test
+
+import (
+	"testing"
+
+	"barney.ci/go-store/codec/codectest"
+	"barney.ci/go-store/codec/gobcodec"
+)
+
+func TestCodec(t *testing.T) {
+	codectest.Run(t, gobcodec.New[codectest.Value])
+}
@@ -0,0 +1,18 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+// Package msgpackcodec provides stores that marshal values with MessagePack.
+package msgpackcodec
+
+import (
+	"barney.ci/go-store"
+)
+
+// New returns a Store that marshals values of type T with MessagePack. It is
+// equivalent to store.NewMsgpack.
+func New[T any](opts ...store.Option) *store.Store[T] {
+	return store.NewMsgpack[T](opts...)
+}
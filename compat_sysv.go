@@ -0,0 +1,39 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build aix || solaris
+// +build aix solaris
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// AIX has no flock(2), and Solaris only has it since 11.4, so FlockLocks are
+// FcntlLocks on these systems, which the process arbitrates between its own
+// files.
+const systemEmulatesFlockLocks = true
+
+func flock(fd int, how int) error {
+	return unix.ENOTSUP
+}
+
+// linkat links oldpath to newpath, both relative to dir. linkat(2) is not
+// available on these systems, so the paths get resolved against the name of
+// dir instead.
+func linkat(dir *os.File, oldpath, newpath string) error {
+	if !filepath.IsAbs(oldpath) {
+		oldpath = filepath.Join(dir.Name(), oldpath)
+	}
+	if !filepath.IsAbs(newpath) {
+		newpath = filepath.Join(dir.Name(), newpath)
+	}
+	return os.Link(oldpath, newpath)
+}
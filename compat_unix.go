@@ -0,0 +1,30 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build unix && !aix && !solaris
+// +build unix,!aix,!solaris
+
+package store
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+const systemEmulatesFlockLocks = false
+
+func flock(fd int, how int) error {
+	return unix.Flock(fd, how)
+}
+
+func linkat(dir *os.File, oldpath, newpath string) error {
+	dirfd := int(dir.Fd())
+	if err := unix.Linkat(dirfd, oldpath, dirfd, newpath, 0); err != nil {
+		return &os.LinkError{Op: "linkat", Old: oldpath, New: newpath, Err: err}
+	}
+	return nil
+}
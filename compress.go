@@ -0,0 +1,66 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// A Compressor compresses the encoded contents of files, as configured with
+// WithCompression.
+//
+// Besides Gzip, other formats such as zstd can be used by implementing this
+// interface on top of a third-party implementation.
+type Compressor interface {
+	// Magic returns the bytes that compressed contents start with, which
+	// lets stores tell compressed contents from uncompressed ones.
+	Magic() []byte
+
+	// NewWriter returns a writer that compresses the contents written to
+	// it into w. Closing the writer must flush the compressed contents
+	// without closing w.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+
+	// NewReader returns a reader that decompresses the contents of r.
+	NewReader(r io.Reader) (io.Reader, error)
+}
+
+// Gzip is a Compressor that compresses contents with gzip at the default
+// compression level.
+var Gzip Compressor = gzipCompressor{}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Magic() []byte {
+	return []byte{0x1f, 0x8b}
+}
+
+func (gzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (gzipCompressor) NewReader(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// openCompressed returns a reader of the decompressed contents of r if they
+// are compressed with c, and a reader of the contents as-is otherwise.
+func openCompressed(r io.Reader, c Compressor) (io.Reader, error) {
+	magic := c.Magic()
+	br := bufio.NewReader(r)
+	head, err := br.Peek(len(magic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.Equal(head, magic) {
+		return br, nil
+	}
+	return c.NewReader(br)
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	type Test struct {
+		Example string
+	}
+
+	ctx := context.Background()
+	large := Test{Example: strings.Repeat("compressible ", 1000)}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		for _, opts := range [][]Option{
+			{WithCompression(Gzip)},
+			{WithCompression(Gzip), WithChecksum()},
+			{WithCompression(Gzip), WithEncryption(StaticKeys{Current: "k", Keys: map[string][]byte{"k": make([]byte, 16)}})},
+		} {
+			store := New[Test](json.NewEncoder, json.NewDecoder, opts...)
+			path := filepath.Join(t.TempDir(), "compressed.json")
+
+			if err := store.ForceStore(ctx, path, 0666, &large); err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size() >= int64(len(large.Example)/10) {
+				t.Fatalf("expected contents to be compressed, got %d bytes", info.Size())
+			}
+
+			var val Test
+			if _, err := store.Load(ctx, path, &val); err != nil {
+				t.Fatal(err)
+			}
+			if val.Example != large.Example {
+				t.Fatal("value does not survive a round trip")
+			}
+		}
+	})
+
+	t.Run("Uncompressed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "plain.json")
+		if err := New[Test](json.NewEncoder, json.NewDecoder).ForceStore(ctx, path, 0666, &large); err != nil {
+			t.Fatal(err)
+		}
+
+		store := New[Test](json.NewEncoder, json.NewDecoder, WithCompression(Gzip))
+		var val Test
+		if _, err := store.Load(ctx, path, &val); err != nil {
+			t.Fatal(err)
+		}
+		if val.Example != large.Example {
+			t.Fatal("uncompressed value failed to load")
+		}
+
+		// Storing migrates the file to the compressed format.
+		if err := store.ForceStore(ctx, path, 0666, &val); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(data, Gzip.Magic()) {
+			t.Fatal("expected the file to be compressed")
+		}
+	})
+}
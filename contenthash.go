@@ -0,0 +1,45 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"errors"
+	"hash/maphash"
+	"io"
+	"os"
+)
+
+// contentHashSeed seeds the content hashes of the process. Canaries never
+// outlive the process, so hashes need not be stable across processes.
+var contentHashSeed = maphash.MakeSeed()
+
+// contentHash is the canary of files of stores configured with
+// WithContentHash.
+type contentHash uint64
+
+func hashContents(data []byte) contentHash {
+	return contentHash(maphash.Bytes(contentHashSeed, data))
+}
+
+// fileContentHash returns the canary of the contents of the file at path,
+// which is nil if the file does not exist.
+func (store *Store[T]) fileContentHash(path string) (Canary, error) {
+	f, err := store.open(path, os.O_RDONLY, 0)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	defer closeFile(f)
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return hashContents(data), nil
+}
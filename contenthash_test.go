@@ -0,0 +1,82 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContentHash(t *testing.T) {
+	ctx := context.Background()
+	store := New[int](json.NewEncoder, json.NewDecoder, WithContentHash())
+
+	t.Run("InPlace", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "hash.json")
+		v := 1
+		if err := store.Store(ctx, path, 0666, &v, nil); err != nil {
+			t.Fatal(err)
+		}
+		canary, err := store.Load(ctx, path, &v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := canary.(contentHash); !ok {
+			t.Fatalf("expected a content hash canary, got %T", canary)
+		}
+
+		// Rewriting the file in place keeps its inode.
+		if err := os.WriteFile(path, []byte("2\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		v = 3
+		if err := store.Store(ctx, path, 0666, &v, canary); err != ErrRetry {
+			t.Fatalf("expected %v, got %v", ErrRetry, err)
+		}
+		if _, err := store.LoadIfChanged(ctx, path, canary, &v); err != nil {
+			t.Fatal(err)
+		}
+		if v != 2 {
+			t.Fatalf("expected 2, got %d", v)
+		}
+	})
+
+	t.Run("SameContents", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "hash.json")
+		v := 1
+		if err := store.Store(ctx, path, 0666, &v, nil); err != nil {
+			t.Fatal(err)
+		}
+		canary, err := store.Load(ctx, path, &v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.ForceStore(ctx, path, 0666, &v); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.LoadIfChanged(ctx, path, canary, &v); err != ErrNotModified {
+			t.Fatalf("expected %v, got %v", ErrNotModified, err)
+		}
+		if err := store.Store(ctx, path, 0666, &v, canary); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "hash.json")
+		v := 1
+		if err := store.Store(ctx, path, 0666, &v, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Store(ctx, path, 0666, &v, nil); err != ErrRetry {
+			t.Fatalf("expected %v, got %v", ErrRetry, err)
+		}
+	})
+}
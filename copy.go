@@ -0,0 +1,49 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// CopyTo atomically copies the contents of the file at srcPath to dstPath.
+//
+// CopyTo holds a shared lock on the source for the duration of the copy, which
+// guarantees that the copy is consistent, and replaces the destination with
+// the same atomicity guarantees as Store. This makes it suitable to take
+// snapshots of a file while it may be concurrently written to, for instance
+// for backups.
+//
+// Like ForceStore, CopyTo unconditionally overwrites the destination.
+func (store *Store[T]) CopyTo(ctx context.Context, srcPath, dstPath string, mode os.FileMode) (err error) {
+	ctx, span := store.startSpan(ctx, "CopyTo", srcPath)
+	defer func() { endSpan(span, err) }()
+
+	rdf, err := store.fs().OpenFile(srcPath, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer closeFile(rdf)
+
+	if err := store.fs().RLock(ctx, rdf); err != nil {
+		return err
+	}
+
+	err = ErrRetry
+	for err == ErrRetry {
+		err = store.replace(ctx, dstPath, mode, nil, true, func(w io.Writer) error {
+			if _, err := rdf.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			_, err := io.Copy(w, rdf)
+			return err
+		})
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestCopyTo(t *testing.T) {
+	type Test struct {
+		A, B int
+	}
+
+	store := New[Test](json.NewEncoder, json.NewDecoder)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.json")
+	dst := filepath.Join(dir, "dst.json")
+
+	if err := store.ForceStore(context.Background(), src, 0666, &Test{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Concurrently update the source, keeping A and B equal; snapshots
+	// must never observe them differing.
+	done := make(chan struct{})
+	var wait sync.WaitGroup
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			err := store.LoadAndStore(context.Background(), src, 0666, func(ctx context.Context, val *Test, err error) error {
+				val.A++
+				val.B++
+				return err
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		if err := store.CopyTo(context.Background(), src, dst, 0666); err != nil {
+			t.Fatal(err)
+		}
+		var val Test
+		if _, err := store.Load(context.Background(), dst, &val); err != nil {
+			t.Fatal(err)
+		}
+		if val.A != val.B {
+			t.Fatalf("inconsistent snapshot: %+v", val)
+		}
+	}
+
+	close(done)
+	wait.Wait()
+}
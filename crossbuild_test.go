@@ -0,0 +1,65 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// crossBuildTargets are the GOOS/GOARCH pairs that the package must build
+// for, including those whose system types differ in width from amd64.
+var crossBuildTargets = [][2]string{
+	{"linux", "386"},
+	{"linux", "arm"},
+	{"linux", "arm64"},
+	{"linux", "mips"},
+	{"linux", "mipsle"},
+	{"linux", "mips64"},
+	{"linux", "mips64le"},
+	{"linux", "ppc64le"},
+	{"linux", "riscv64"},
+	{"linux", "s390x"},
+	{"darwin", "amd64"},
+	{"darwin", "arm64"},
+	{"freebsd", "amd64"},
+	{"freebsd", "386"},
+	{"netbsd", "amd64"},
+	{"openbsd", "amd64"},
+	{"solaris", "amd64"},
+	{"illumos", "amd64"},
+	{"aix", "ppc64"},
+	{"windows", "amd64"},
+	{"windows", "386"},
+	{"plan9", "amd64"},
+	{"js", "wasm"},
+	{"wasip1", "wasm"},
+}
+
+func TestCrossBuild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("cross-building is slow")
+	}
+	gobin := filepath.Join(runtime.GOROOT(), "bin", "go")
+	if _, err := os.Stat(gobin); err != nil {
+		t.Skipf("go command not found: %v", err)
+	}
+
+	for _, target := range crossBuildTargets {
+		goos, goarch := target[0], target[1]
+		t.Run(goos+"/"+goarch, func(t *testing.T) {
+			cmd := exec.Command(gobin, "build", ".")
+			cmd.Env = append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch, "CGO_ENABLED=0")
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("%v\n%s", err, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strconv"
+)
+
+// A DirKey is a type that can be used as the key of a DirStore.
+type DirKey interface {
+	~string | ~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+// A DirStore represents a collection of values of type T indexed by keys of
+// type K, where each value is stored atomically into its own file under a
+// root directory.
+//
+// DirStore is a typed variant of KV: string keys are mapped to file names in
+// the same way, and integer keys are mapped to their decimal representation.
+// Like with KV, concurrent accesses to different keys never contend with one
+// another.
+type DirStore[K DirKey, T any] struct {
+	kv *KV[T]
+}
+
+// NewDirStore returns a DirStore that stores its values with the specified
+// store in the root directory, creating files with the specified mode.
+//
+// The root directory must exist.
+func NewDirStore[K DirKey, T any](store *Store[T], root string, mode os.FileMode) *DirStore[K, T] {
+	return &DirStore[K, T]{kv: NewKV(store, root, mode)}
+}
+
+// Get loads the value of the specified key into v.
+//
+// If the key does not exist, Get returns an error wrapping os.ErrNotExist.
+func (ds *DirStore[K, T]) Get(ctx context.Context, key K, v *T) error {
+	return ds.kv.Get(ctx, formatDirKey(key), v)
+}
+
+// Put unconditionally sets the value of the specified key to v.
+func (ds *DirStore[K, T]) Put(ctx context.Context, key K, v *T) error {
+	return ds.kv.Set(ctx, formatDirKey(key), v)
+}
+
+// Delete removes the specified key.
+//
+// If the key does not exist, Delete returns an error wrapping os.ErrNotExist.
+func (ds *DirStore[K, T]) Delete(ctx context.Context, key K) error {
+	return ds.kv.Delete(ctx, formatDirKey(key))
+}
+
+// LoadAndStore atomically updates the value of the specified key, with the
+// same semantics as Store.LoadAndStore.
+func (ds *DirStore[K, T]) LoadAndStore(ctx context.Context, key K, fn LoadAndStoreFunc[T]) error {
+	return ds.kv.Update(ctx, formatDirKey(key), fn)
+}
+
+// Range calls fn sequentially for each key and value present in the
+// DirStore. If fn returns false, Range stops the iteration.
+//
+// Like KV.Range, Range does not correspond to a consistent snapshot. Files
+// whose names do not map to a key of type K are skipped.
+func (ds *DirStore[K, T]) Range(ctx context.Context, fn func(key K, val *T) bool) error {
+	return ds.kv.Range(ctx, func(name string, val *T) bool {
+		key, ok := parseDirKey[K](name)
+		if !ok {
+			return true
+		}
+		return fn(key, val)
+	})
+}
+
+func formatDirKey[K DirKey](key K) string {
+	// Reflection rather than fmt, so that String methods of key types do not
+	// change the mapping.
+	v := reflect.ValueOf(key)
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	default:
+		return strconv.FormatUint(v.Uint(), 10)
+	}
+}
+
+func parseDirKey[K DirKey](s string) (K, bool) {
+	var key K
+	v := reflect.ValueOf(&key).Elem()
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return key, false
+		}
+		v.SetInt(n)
+	default:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return key, false
+		}
+		v.SetUint(n)
+	}
+	// Only accept canonical representations, so that every file maps to
+	// a distinct key.
+	return key, formatDirKey(key) == s
+}
@@ -0,0 +1,113 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+type testName string
+
+func (n testName) String() string { return "not the key" }
+
+func TestDirStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("IntKeys", func(t *testing.T) {
+		root := t.TempDir()
+		ds := NewDirStore[int64](New[string](json.NewEncoder, json.NewDecoder), root, 0666)
+
+		keys := []int64{-3, 0, 7, 1 << 40}
+		for _, key := range keys {
+			val := "value"
+			if err := ds.Put(ctx, key, &val); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Files that do not map to a canonical key are skipped.
+		for _, name := range []string{"007", "abc"} {
+			if err := os.WriteFile(filepath.Join(root, name), []byte(`"stray"`), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var got []int64
+		err := ds.Range(ctx, func(key int64, val *string) bool {
+			got = append(got, key)
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+		if len(got) != len(keys) {
+			t.Fatalf("expected keys %v, got %v", keys, got)
+		}
+		for i := range keys {
+			if got[i] != keys[i] {
+				t.Fatalf("expected keys %v, got %v", keys, got)
+			}
+		}
+
+		err = ds.LoadAndStore(ctx, 7, func(ctx context.Context, val *string, err error) error {
+			*val += "!"
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var val string
+		if err := ds.Get(ctx, 7, &val); err != nil {
+			t.Fatal(err)
+		}
+		if val != "value!" {
+			t.Fatalf("expected value!, got %q", val)
+		}
+
+		if err := ds.Delete(ctx, 7); err != nil {
+			t.Fatal(err)
+		}
+		if err := ds.Get(ctx, 7, &val); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected ErrNotExist, got %v", err)
+		}
+	})
+
+	t.Run("StringKeys", func(t *testing.T) {
+		root := t.TempDir()
+		ds := NewDirStore[testName](New[int](json.NewEncoder, json.NewDecoder), root, 0666)
+
+		val := 42
+		if err := ds.Put(ctx, "Some/Key", &val); err != nil {
+			t.Fatal(err)
+		}
+
+		// Keys map to the same files as with KV, regardless of their String
+		// method.
+		if _, err := os.Stat(filepath.Join(root, escapeKey("Some/Key"))); err != nil {
+			t.Fatal(err)
+		}
+
+		var got []testName
+		err := ds.Range(ctx, func(key testName, val *int) bool {
+			got = append(got, key)
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0] != "Some/Key" {
+			t.Fatalf("expected [Some/Key], got %v", got)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// electionTTL is the duration of the leases of leaders, which bounds how long
+// a leader that vanished without releasing its lease, such as one running on
+// another host, remains elected.
+const electionTTL = 10 * time.Second
+
+// ElectionCallbacks are the functions that Elect calls when the process gets
+// elected or deposed. Both are optional.
+type ElectionCallbacks struct {
+	// OnElected is called once the process becomes the leader, with a
+	// context that gets canceled once it stops being the leader. It must
+	// not block; the work of the leader belongs in goroutines that stop
+	// once ctx is done.
+	OnElected func(ctx context.Context)
+
+	// OnDeposed is called once the process stops being the leader, after
+	// the context passed to OnElected was canceled, with the error that
+	// caused it: either the error of the context passed to Elect, or an
+	// error telling why the lease of the leader was lost, such as one
+	// wrapping ErrLeaseLost.
+	OnDeposed func(err error)
+}
+
+// Elect campaigns for the leadership of the processes that call Elect with
+// the same path, until ctx is done, and returns the error of ctx, or the error
+// that prevented it from campaigning.
+//
+// At most one process is the leader at any time: the one that holds a lease
+// on the lock file of path, as obtained with AcquireLease. Leaders that lose
+// their lease get deposed and campaign again. Leaders that crash release their
+// lock, and their lease is not waited for unless they ran on another host, in
+// which case it needs to expire first.
+func (store *Store[T]) Elect(ctx context.Context, path string, callbacks ElectionCallbacks) error {
+	return store.elect(ctx, path, electionTTL, callbacks)
+}
+
+func (store *Store[T]) elect(ctx context.Context, path string, ttl time.Duration, callbacks ElectionCallbacks) error {
+	for {
+		l, err := store.AcquireLease(ctx, path, ttl)
+		if err != nil {
+			return err
+		}
+
+		leaderCtx, cancel := context.WithCancel(ctx)
+		if callbacks.OnElected != nil {
+			callbacks.OnElected(leaderCtx)
+		}
+
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-l.Done():
+			err = l.Err()
+		}
+		cancel()
+		if callbacks.OnDeposed != nil {
+			callbacks.OnDeposed(err)
+		}
+		l.Release()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestElect(t *testing.T) {
+	store := New[int](json.NewEncoder, json.NewDecoder)
+
+	// candidate campaigns in the background, and reports its elections and
+	// depositions on events.
+	type event struct {
+		id      int
+		elected bool
+		err     error
+	}
+	candidate := func(ctx context.Context, path string, id int, events chan<- event) <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			done <- store.elect(ctx, path, 150*time.Millisecond, ElectionCallbacks{
+				OnElected: func(ctx context.Context) {
+					events <- event{id: id, elected: true}
+				},
+				OnDeposed: func(err error) {
+					events <- event{id: id, err: err}
+				},
+			})
+		}()
+		return done
+	}
+
+	next := func(t *testing.T, events <-chan event) event {
+		t.Helper()
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for an election event")
+		}
+		panic("unreachable")
+	}
+
+	t.Run("Handover", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "leader")
+		events := make(chan event, 16)
+
+		ctx1, cancel1 := context.WithCancel(context.Background())
+		defer cancel1()
+		done1 := candidate(ctx1, path, 1, events)
+		if ev := next(t, events); ev.id != 1 || !ev.elected {
+			t.Fatalf("expected candidate 1 to be elected, got %+v", ev)
+		}
+
+		ctx2, cancel2 := context.WithCancel(context.Background())
+		defer cancel2()
+		done2 := candidate(ctx2, path, 2, events)
+
+		// Candidate 2 must not get elected while candidate 1 leads.
+		select {
+		case ev := <-events:
+			t.Fatalf("unexpected event %+v", ev)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		cancel1()
+		if ev := next(t, events); ev.id != 1 || ev.elected || !errors.Is(ev.err, context.Canceled) {
+			t.Fatalf("expected candidate 1 to be deposed, got %+v", ev)
+		}
+		if err := <-done1; !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected %v, got %v", context.Canceled, err)
+		}
+		if ev := next(t, events); ev.id != 2 || !ev.elected {
+			t.Fatalf("expected candidate 2 to be elected, got %+v", ev)
+		}
+
+		cancel2()
+		next(t, events)
+		<-done2
+	})
+
+	t.Run("LostLease", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "leader")
+		events := make(chan event, 16)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		done := candidate(ctx, path, 1, events)
+		if ev := next(t, events); !ev.elected {
+			t.Fatalf("expected to be elected, got %+v", ev)
+		}
+
+		if err := os.Remove(path + ".lock"); err != nil {
+			t.Fatal(err)
+		}
+		if ev := next(t, events); ev.elected || !errors.Is(ev.err, ErrLeaseLost) {
+			t.Fatalf("expected to be deposed, got %+v", ev)
+		}
+		if ev := next(t, events); !ev.elected {
+			t.Fatalf("expected to be elected again, got %+v", ev)
+		}
+
+		cancel()
+		next(t, events)
+		<-done
+	})
+}
@@ -0,0 +1,160 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrDecrypt is returned, wrapped in a DecodeError, when the contents of
+// a file written with WithEncryption cannot be decrypted, which means that
+// they were tampered with, damaged, or not encrypted at all.
+var ErrDecrypt = errors.New("decryption failed")
+
+// A KeyProvider supplies the keys used by stores configured with
+// WithEncryption. Keys must be 16, 24 or 32 bytes long, to select AES-128,
+// AES-192 or AES-256.
+//
+// Each key has an identifier, which is written in the clear along with the
+// contents it sealed. Rotating keys is a matter of changing the current key,
+// while still providing the previous keys for as long as files sealed with
+// them may be loaded.
+type KeyProvider interface {
+	// CurrentKey returns the key that new contents are sealed with, and
+	// its identifier, which must be at most 255 bytes long.
+	CurrentKey() (id string, key []byte, err error)
+
+	// Key returns the key with the specified identifier.
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider that provides a fixed set of keys.
+type StaticKeys struct {
+	// Current is the identifier of the key to seal new contents with.
+	Current string
+
+	// Keys maps key identifiers to keys.
+	Keys map[string][]byte
+}
+
+func (k StaticKeys) CurrentKey() (string, []byte, error) {
+	key, err := k.Key(k.Current)
+	return k.Current, key, err
+}
+
+func (k StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := k.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	return key, nil
+}
+
+// Sealed contents are made of a header holding a magic string, the version
+// of the format and the identifier of the key, followed by the random nonce
+// and the contents sealed with AES-GCM. The header is authenticated as
+// additional data.
+var sealMagic = [4]byte{0x89, 'G', 'S', 'X'}
+
+const sealVersion = 1
+
+// sealWriter buffers the contents written to it, and seals them to the
+// underlying writer on Close, since AEADs seal messages as a whole.
+type sealWriter struct {
+	w    io.Writer
+	keys KeyProvider
+	buf  bytes.Buffer
+}
+
+func newSealWriter(w io.Writer, keys KeyProvider) *sealWriter {
+	return &sealWriter{w: w, keys: keys}
+}
+
+func (w *sealWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *sealWriter) Close() error {
+	id, key, err := w.keys.CurrentKey()
+	if err != nil {
+		return err
+	}
+	if len(id) > 255 {
+		return fmt.Errorf("key identifier %q is too long", id)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	header := append(sealMagic[:], sealVersion, byte(len(id)))
+	header = append(header, id...)
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	out := make([]byte, 0, len(header)+len(nonce)+w.buf.Len()+aead.Overhead())
+	out = append(out, header...)
+	out = append(out, nonce...)
+	out = aead.Seal(out, nonce, w.buf.Bytes(), header)
+	_, err = w.w.Write(out)
+	return err
+}
+
+// openSealed reads sealed contents from r, and returns a reader of the
+// decrypted contents.
+func openSealed(r io.Reader, keys KeyProvider) (io.Reader, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	const fixedSize = len(sealMagic) + 2
+	if len(data) < fixedSize || !bytes.Equal(data[:len(sealMagic)], sealMagic[:]) || data[len(sealMagic)] != sealVersion {
+		return nil, ErrDecrypt
+	}
+	idLen := int(data[len(sealMagic)+1])
+	if len(data) < fixedSize+idLen {
+		return nil, ErrDecrypt
+	}
+	header, data := data[:fixedSize+idLen], data[fixedSize+idLen:]
+
+	key, err := keys.Key(string(header[fixedSize:]))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, data := data[:aead.NonceSize()], data[aead.NonceSize():]
+
+	plain, err := aead.Open(data[:0], nonce, data, header)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return bytes.NewReader(plain), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
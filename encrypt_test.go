@@ -0,0 +1,125 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryption(t *testing.T) {
+	type Secret struct {
+		Password string
+	}
+
+	ctx := context.Background()
+	keys := StaticKeys{
+		Current: "k1",
+		Keys: map[string][]byte{
+			"k1": bytes.Repeat([]byte{1}, 32),
+			"k2": bytes.Repeat([]byte{2}, 16),
+		},
+	}
+
+	for _, opts := range [][]Option{
+		{WithEncryption(keys)},
+		{WithEncryption(keys), WithChecksum()},
+	} {
+		store := New[Secret](json.NewEncoder, json.NewDecoder, opts...)
+
+		t.Run("RoundTrip", func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "secret.json")
+			if err := store.ForceStore(ctx, path, 0600, &Secret{Password: "hunter2"}); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(data, []byte("hunter2")) {
+				t.Fatal("secret was written in the clear")
+			}
+
+			var val Secret
+			if _, err := store.Load(ctx, path, &val); err != nil {
+				t.Fatal(err)
+			}
+			if val.Password != "hunter2" {
+				t.Fatalf("expected hunter2, got %q", val.Password)
+			}
+		})
+
+		t.Run("Rotation", func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "secret.json")
+			if err := store.ForceStore(ctx, path, 0600, &Secret{Password: "old"}); err != nil {
+				t.Fatal(err)
+			}
+
+			rotated := New[Secret](json.NewEncoder, json.NewDecoder, append(opts, WithEncryption(StaticKeys{
+				Current: "k2",
+				Keys:    keys.Keys,
+			}))...)
+			err := rotated.LoadAndStore(ctx, path, 0600, func(ctx context.Context, val *Secret, err error) error {
+				if err != nil {
+					return err
+				}
+				if val.Password != "old" {
+					t.Fatalf("expected old, got %q", val.Password)
+				}
+				val.Password = "new"
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Files sealed with the new key cannot be opened without it.
+			retired := New[Secret](json.NewEncoder, json.NewDecoder, append(opts, WithEncryption(StaticKeys{
+				Current: "k1",
+				Keys:    map[string][]byte{"k1": keys.Keys["k1"]},
+			}))...)
+			var val Secret
+			if _, err := retired.Load(ctx, path, &val); err == nil {
+				t.Fatal("expected loading without the new key to fail")
+			}
+		})
+
+		t.Run("Tampered", func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "secret.json")
+			if err := store.ForceStore(ctx, path, 0600, &Secret{Password: "hunter2"}); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			loader := store
+			if len(opts) > 1 {
+				// Strip the checksum envelope, so that the AEAD is the one
+				// catching the tampering.
+				data = data[envelopeHeaderSize : len(data)-envelopeFooterSize]
+				loader = New[Secret](json.NewEncoder, json.NewDecoder, WithEncryption(keys))
+			}
+			data[len(data)-1] ^= 1
+			if err := os.WriteFile(path, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			var val Secret
+			if _, err := loader.Load(ctx, path, &val); !errors.Is(err, ErrDecrypt) {
+				t.Fatalf("expected ErrDecrypt, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// ErrChecksum is returned, wrapped in a DecodeError, when the contents of
+// a file written with WithChecksum do not match their checksum, or are not
+// enveloped at all.
+var ErrChecksum = errors.New("checksum mismatch")
+
+// The envelope written by stores configured with WithChecksum is made of
+// a header holding a magic string and the version of the format, followed
+// by the encoded value, followed by the CRC-32C of the encoded value.
+var envelopeMagic = [4]byte{0x89, 'G', 'S', 'E'}
+
+const (
+	envelopeVersion    = 1
+	envelopeHeaderSize = len(envelopeMagic) + 1
+	envelopeFooterSize = 4
+)
+
+var envelopeCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+type envelopeWriter struct {
+	w   io.Writer
+	crc hash.Hash32
+}
+
+func newEnvelopeWriter(w io.Writer) (io.WriteCloser, error) {
+	header := append(envelopeMagic[:], envelopeVersion)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &envelopeWriter{w: w, crc: crc32.New(envelopeCRCTable)}, nil
+}
+
+func (w *envelopeWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.crc.Write(p[:n])
+	return n, err
+}
+
+// Close writes the checksum of the contents. It does not close the
+// underlying writer.
+func (w *envelopeWriter) Close() error {
+	_, err := w.w.Write(w.crc.Sum(nil))
+	return err
+}
+
+// openEnvelope reads the envelope from r, and returns a reader of its
+// contents once their checksum has been verified.
+func openEnvelope(r io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < envelopeHeaderSize+envelopeFooterSize ||
+		!bytes.Equal(data[:len(envelopeMagic)], envelopeMagic[:]) ||
+		data[len(envelopeMagic)] != envelopeVersion {
+		return nil, ErrChecksum
+	}
+
+	payload := data[envelopeHeaderSize : len(data)-envelopeFooterSize]
+	sum := binary.BigEndian.Uint32(data[len(data)-envelopeFooterSize:])
+	if crc32.Checksum(payload, envelopeCRCTable) != sum {
+		return nil, ErrChecksum
+	}
+	return bytes.NewReader(payload), nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	type Test struct {
+		Example string
+	}
+
+	ctx := context.Background()
+	store := New[Test](json.NewEncoder, json.NewDecoder, WithChecksum())
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "checksum.json")
+		if err := store.ForceStore(ctx, path, 0666, &Test{Example: "value"}); err != nil {
+			t.Fatal(err)
+		}
+
+		var val Test
+		if _, err := store.Load(ctx, path, &val); err != nil {
+			t.Fatal(err)
+		}
+		if val.Example != "value" {
+			t.Fatalf("expected value, got %q", val.Example)
+		}
+	})
+
+	t.Run("BitRot", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "checksum.json")
+		if err := store.ForceStore(ctx, path, 0666, &Test{Example: "value"}); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[envelopeHeaderSize+3] ^= 0x10
+		if err := os.WriteFile(path, data, 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		var val Test
+		_, err = store.Load(ctx, path, &val)
+		var derr *DecodeError
+		if !errors.Is(err, ErrChecksum) || !errors.As(err, &derr) {
+			t.Fatalf("expected a DecodeError wrapping ErrChecksum, got %v", err)
+		}
+	})
+
+	t.Run("NoEnvelope", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "checksum.json")
+		if err := os.WriteFile(path, []byte(`{"Example": "value"}`), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		var val Test
+		if _, err := store.Load(ctx, path, &val); !errors.Is(err, ErrChecksum) {
+			t.Fatalf("expected ErrChecksum, got %v", err)
+		}
+	})
+
+	t.Run("Recovery", func(t *testing.T) {
+		store := New[Test](json.NewEncoder, json.NewDecoder, WithChecksum(), WithRecovery())
+		path := filepath.Join(t.TempDir(), "checksum.json")
+		if err := store.ForceStore(ctx, path, 0666, &Test{Example: "value"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Truncate(path, 12); err != nil {
+			t.Fatal(err)
+		}
+
+		var val Test
+		if _, err := store.Load(ctx, path, &val); !errors.Is(err, ErrCorrupt) || !errors.Is(err, ErrChecksum) {
+			t.Fatalf("expected ErrCorrupt wrapping ErrChecksum, got %v", err)
+		}
+		if val.Example != "value" {
+			t.Fatalf("expected value, got %q", val.Example)
+		}
+	})
+}
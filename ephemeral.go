@@ -0,0 +1,197 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// An Ephemeral holds a single value of type T in an anonymous, memory-backed
+// file, with the same locking and compare-and-swap semantics as Store.
+//
+// Ephemeral is meant for short-lived state shared between goroutines of
+// a single process, where going through the file system would be wasteful.
+// On Linux, the value lives in a memfd (or, on older kernels, in an unnamed
+// O_TMPFILE on /dev/shm), and accesses are serialized with the regular
+// file locks of this package. On other systems, the value lives in an
+// in-memory buffer, and loads are serialized with stores as well as with
+// each other.
+//
+// Unlike Store, an Ephemeral overwrites its file in place under the exclusive
+// lock rather than atomically renaming a new file over it. Values are fully
+// encoded before the file gets touched, so encoding errors never corrupt
+// the contents, but an IO error in the middle of a write (for instance,
+// running out of memory) leaves the file truncated. The contents never
+// outlive the Ephemeral, or the process.
+type Ephemeral[T any] struct {
+	store *Store[T]
+	name  string
+	file  *ephemeralFile
+
+	// gen is the number of successful stores, and serves as the canary when
+	// the store does not have a canary function.
+	gen atomic.Uint64
+}
+
+// ephemeralHandle is a handle on the contents of an ephemeralFile, obtained
+// with a lock held. Closing the handle releases the lock.
+type ephemeralHandle interface {
+	io.ReadWriteSeeker
+	Truncate(size int64) error
+	Close() error
+}
+
+// NewEphemeral returns an Ephemeral that marshals its value with the store.
+// The name is only used for debugging purposes, and need not be unique.
+//
+// The returned Ephemeral must be closed once no longer in use.
+func (store *Store[T]) NewEphemeral(name string) (*Ephemeral[T], error) {
+	f, err := newEphemeralFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Ephemeral[T]{
+		store: store,
+		name:  name,
+		file:  f,
+	}, nil
+}
+
+// Close releases the resources associated with the Ephemeral. The stored
+// value is lost.
+func (e *Ephemeral[T]) Close() error {
+	return e.file.Close()
+}
+
+// Load unmarshals the current value into v.
+//
+// If no value was ever stored, Load returns an error wrapping os.ErrNotExist.
+func (e *Ephemeral[T]) Load(ctx context.Context, v *T) (canary Canary, err error) {
+	ctx, span := e.store.startSpan(ctx, "Ephemeral.Load", e.name)
+	defer func() { endSpan(span, err) }()
+
+	h, err := e.file.acquire(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer h.Close()
+
+	gen := e.gen.Load()
+	if gen == 0 {
+		return nil, &os.PathError{Op: "load", Path: e.name, Err: os.ErrNotExist}
+	}
+	if err := e.store.decode(h, e.name, v); err != nil {
+		return nil, err
+	}
+
+	if e.store.canaryFunc != nil {
+		return e.store.canaryFunc(v), nil
+	}
+	return gen, nil
+}
+
+// Store marshals v and overwrites the current value with the result, provided
+// that the value did not change since the Load that returned canary.
+// Otherwise, Store returns ErrRetry.
+func (e *Ephemeral[T]) Store(ctx context.Context, v *T, canary Canary) (err error) {
+	ctx, span := e.store.startSpan(ctx, "Ephemeral.Store", e.name)
+	defer func() { endSpan(span, err) }()
+
+	return e.storeValue(ctx, v, canary, false)
+}
+
+// ForceStore marshals v and unconditionally overwrites the current value with
+// the result.
+func (e *Ephemeral[T]) ForceStore(ctx context.Context, v *T) (err error) {
+	ctx, span := e.store.startSpan(ctx, "Ephemeral.ForceStore", e.name)
+	defer func() { endSpan(span, err) }()
+
+	return e.storeValue(ctx, v, nil, true)
+}
+
+// LoadAndStore atomically updates the value, with the same semantics as
+// Store.LoadAndStore.
+func (e *Ephemeral[T]) LoadAndStore(ctx context.Context, fn LoadAndStoreFunc[T]) error {
+	err := ErrRetry
+	for err == ErrRetry {
+		var value T
+
+		canary, lerr := e.Load(ctx, &value)
+		if err := fn(ctx, &value, lerr); err != nil {
+			if err == ErrNoChange {
+				return nil
+			}
+			return err
+		}
+		err = e.Store(ctx, &value, canary)
+	}
+	return err
+}
+
+func (e *Ephemeral[T]) storeValue(ctx context.Context, v *T, canary Canary, force bool) error {
+	var (
+		data bytes.Buffer
+		w    io.Writer = &data
+	)
+	if e.store.opts.maxBytes > 0 {
+		w = &limitedWriter{w: &data, n: e.store.opts.maxBytes}
+	}
+	if err := e.store.encode(w, e.name, v); err != nil {
+		return err
+	}
+
+	h, err := e.file.acquire(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	if !force {
+		changed, err := e.changed(h, canary)
+		if err != nil {
+			return err
+		}
+		if changed {
+			return ErrRetry
+		}
+	}
+
+	if err := h.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := h.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := data.WriteTo(h); err != nil {
+		return err
+	}
+	e.gen.Add(1)
+	return nil
+}
+
+// changed returns whether the current value no longer matches the canary.
+// It must be called with the exclusive lock held through h.
+func (e *Ephemeral[T]) changed(h ephemeralHandle, canary Canary) (bool, error) {
+	gen := e.gen.Load()
+	if e.store.canaryFunc == nil {
+		oldGen, _ := canary.(uint64)
+		return gen != oldGen, nil
+	}
+	if gen == 0 {
+		return canary != nil, nil
+	}
+
+	var cur T
+	if err := e.store.decode(h, e.name, &cur); err != nil {
+		return false, err
+	}
+	return e.store.canaryFunc(&cur) != canary, nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build !linux
+// +build !linux
+
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+// ephemeralFile is an in-memory buffer guarded by a lock that can be
+// canceled through a context. Both shared and exclusive acquisitions take
+// the same lock.
+type ephemeralFile struct {
+	name string
+	sem  chan struct{}
+	data []byte
+}
+
+func newEphemeralFile(name string) (*ephemeralFile, error) {
+	return &ephemeralFile{
+		name: name,
+		sem:  make(chan struct{}, 1),
+	}, nil
+}
+
+func (ef *ephemeralFile) acquire(ctx context.Context, _ bool) (ephemeralHandle, error) {
+	select {
+	case ef.sem <- struct{}{}:
+		return &memHandle{ef: ef}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (ef *ephemeralFile) Close() error {
+	return nil
+}
+
+type memHandle struct {
+	ef  *ephemeralFile
+	off int64
+}
+
+func (h *memHandle) Read(p []byte) (int, error) {
+	if h.off >= int64(len(h.ef.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, h.ef.data[h.off:])
+	h.off += int64(n)
+	return n, nil
+}
+
+func (h *memHandle) Write(p []byte) (int, error) {
+	end := h.off + int64(len(p))
+	if end > int64(len(h.ef.data)) {
+		data := make([]byte, end)
+		copy(data, h.ef.data)
+		h.ef.data = data
+	}
+	n := copy(h.ef.data[h.off:], p)
+	h.off += int64(n)
+	return n, nil
+}
+
+func (h *memHandle) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += h.off
+	case io.SeekEnd:
+		offset += int64(len(h.ef.data))
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: h.ef.name, Err: errors.New("negative position")}
+	}
+	h.off = offset
+	return offset, nil
+}
+
+func (h *memHandle) Truncate(size int64) error {
+	if size > int64(len(h.ef.data)) {
+		data := make([]byte, size)
+		copy(data, h.ef.data)
+		h.ef.data = data
+	}
+	h.ef.data = h.ef.data[:size]
+	return nil
+}
+
+func (h *memHandle) Close() error {
+	<-h.ef.sem
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+type ephemeralFile struct {
+	f *os.File
+}
+
+func newEphemeralFile(name string) (*ephemeralFile, error) {
+	fd, err := unix.MemfdCreate(name, unix.MFD_CLOEXEC)
+	if errors.Is(err, unix.ENOSYS) {
+		// memfd_create is only available since Linux 3.17; fall back to an
+		// unnamed file on tmpfs.
+		fd, err = unix.Open("/dev/shm", unix.O_TMPFILE|unix.O_RDWR|unix.O_CLOEXEC, 0600)
+		if err != nil {
+			return nil, &os.PathError{Op: "open", Path: "/dev/shm", Err: err}
+		}
+	} else if err != nil {
+		return nil, &os.PathError{Op: "memfd_create", Path: name, Err: err}
+	}
+	return &ephemeralFile{f: os.NewFile(uintptr(fd), name)}, nil
+}
+
+// acquire returns a locked handle on the file.
+//
+// flock(2) locks belong to open file descriptions, so each handle must
+// reopen the file, rather than dup its file descriptor, for the locks of
+// concurrent handles to exclude each other.
+func (ef *ephemeralFile) acquire(ctx context.Context, exclusive bool) (ephemeralHandle, error) {
+	path := fmt.Sprintf("/proc/self/fd/%d", ef.f.Fd())
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := RLock
+	if exclusive {
+		lock = Lock
+	}
+	if err := lock(ctx, f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (ef *ephemeralFile) Close() error {
+	return ef.f.Close()
+}
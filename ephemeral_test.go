@@ -0,0 +1,128 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestEphemeral(t *testing.T) {
+	type Test struct {
+		Counter int
+		Name    string
+	}
+
+	newEphemeral := func(t *testing.T, opts ...Option) *Ephemeral[Test] {
+		eph, err := New[Test](json.NewEncoder, json.NewDecoder, opts...).NewEphemeral(t.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { eph.Close() })
+		return eph
+	}
+
+	t.Run("NotExist", func(t *testing.T) {
+		eph := newEphemeral(t)
+
+		var val Test
+		if _, err := eph.Load(context.Background(), &val); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected Load to fail with ErrNotExist, got %v", err)
+		}
+	})
+
+	t.Run("Modify", func(t *testing.T) {
+		eph := newEphemeral(t)
+
+		if err := eph.ForceStore(context.Background(), &Test{Counter: 1, Name: "a fairly long name"}); err != nil {
+			t.Fatal(err)
+		}
+
+		var val Test
+		canary, err := eph.Load(context.Background(), &val)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The new value is shorter than the previous one, which catches
+		// stale trailing bytes.
+		if err := eph.Store(context.Background(), &Test{Counter: 2}, canary); err != nil {
+			t.Fatal(err)
+		}
+		if err := eph.Store(context.Background(), &Test{Counter: 3}, canary); err != ErrRetry {
+			t.Fatalf("expected Store with a stale canary to return ErrRetry, got %v", err)
+		}
+
+		val = Test{}
+		if _, err := eph.Load(context.Background(), &val); err != nil {
+			t.Fatal(err)
+		}
+		if expected := (Test{Counter: 2}); val != expected {
+			t.Fatalf("expected %+v, got %+v", expected, val)
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		eph := newEphemeral(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if err := eph.ForceStore(ctx, &Test{}); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected ForceStore to fail with context.Canceled, got %v", err)
+		}
+	})
+
+	stressEphemeral := func(t *testing.T, eph *Ephemeral[Test]) {
+		const (
+			workers    = 10
+			increments = 100
+		)
+
+		var wait sync.WaitGroup
+		wait.Add(workers)
+		for i := 0; i < workers; i++ {
+			go func() {
+				defer wait.Done()
+				for j := 0; j < increments; j++ {
+					err := eph.LoadAndStore(context.Background(), func(ctx context.Context, val *Test, err error) error {
+						if err != nil && !errors.Is(err, os.ErrNotExist) {
+							return err
+						}
+						val.Counter++
+						return nil
+					})
+					if err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}()
+		}
+		wait.Wait()
+
+		var val Test
+		if _, err := eph.Load(context.Background(), &val); err != nil {
+			t.Fatal(err)
+		}
+		if val.Counter != workers*increments {
+			t.Fatalf("expected counter to be %d, got %d", workers*increments, val.Counter)
+		}
+	}
+
+	t.Run("Stress", func(t *testing.T) {
+		stressEphemeral(t, newEphemeral(t))
+	})
+
+	t.Run("StressCanaryFunc", func(t *testing.T) {
+		stressEphemeral(t, newEphemeral(t, WithCanaryFunc(func(v *Test) any { return v.Counter })))
+	})
+}
@@ -6,6 +6,10 @@
 
 package store
 
+import (
+	"errors"
+)
+
 type likeError struct {
 	Err, Like error
 }
@@ -13,3 +17,68 @@ type likeError struct {
 func (e *likeError) Error() string {
 	return e.Err.Error()
 }
+
+// DecodeError is returned when the contents of a file fail to be decoded,
+// which usually means that the contents are malformed.
+//
+// IO errors that happen while reading the file are not wrapped in
+// a DecodeError, and are returned as-is.
+type DecodeError struct {
+	Path string
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return "decode " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// ErrCorrupt is matched by the errors returned when the contents of a file
+// are malformed, but could be recovered from its recovery copy.
+var ErrCorrupt = errors.New("file is corrupt")
+
+// CorruptError is returned by the load operations of stores configured with
+// WithRecovery, when the contents of a file fail to be decoded but its
+// recovery copy was decoded successfully.
+type CorruptError struct {
+	Path string
+
+	// Err is the error that decoding the file failed with.
+	Err error
+
+	// Recovered is a pointer to the value recovered from the recovery copy,
+	// which is also the value passed to the load operation.
+	Recovered any
+}
+
+func (e *CorruptError) Error() string {
+	return "corrupt " + e.Path + " (recovered from backup): " + e.Err.Error()
+}
+
+func (e *CorruptError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CorruptError) Is(target error) bool {
+	return target == ErrCorrupt
+}
+
+// EncodeError is returned when a value fails to be encoded.
+//
+// IO errors that happen while writing the file are not wrapped in
+// an EncodeError, and are returned as-is.
+type EncodeError struct {
+	Path string
+	Err  error
+}
+
+func (e *EncodeError) Error() string {
+	return "encode " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
@@ -79,3 +79,23 @@ func ExampleLock_context() {
 	cancel()
 	<-done
 }
+
+func ExampleAcquireLock() {
+	f, err := os.Open("/tmp")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	g, err := store.AcquireLock(context.Background(), f)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Release is idempotent, so it is safe to both defer it and call it
+	// explicitly to check its error.
+	defer g.Release()
+
+	if err := g.Release(); err != nil {
+		log.Fatal(err)
+	}
+}
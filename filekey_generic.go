@@ -0,0 +1,16 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build !unix && !windows
+// +build !unix,!windows
+
+package store
+
+// fileKey returns a key identifying the file underlying f, which is not
+// supported on this system.
+func fileKey(f OSFile) (any, error) {
+	return nil, ErrLockStyleUnsupported
+}
@@ -0,0 +1,27 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build windows
+// +build windows
+
+package store
+
+import "golang.org/x/sys/windows"
+
+type fileID struct {
+	volume    uint32
+	indexHigh uint32
+	indexLow  uint32
+}
+
+// fileKey returns a key identifying the file underlying f.
+func fileKey(f OSFile) (any, error) {
+	var info windows.ByHandleFileInformation
+	if err := windows.GetFileInformationByHandle(windows.Handle(f.Fd()), &info); err != nil {
+		return nil, wrapSyscallError("GetFileInformationByHandle", err)
+	}
+	return fileID{volume: info.VolumeSerialNumber, indexHigh: info.FileIndexHigh, indexLow: info.FileIndexLow}, nil
+}
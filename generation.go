@@ -0,0 +1,98 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// Files written by stores configured with WithGenerations are prefixed with
+// a magic string followed by their generation, as a big-endian uint64.
+var generationMagic = [4]byte{0x89, 'G', 'S', 'N'}
+
+const generationHeaderSize = len(generationMagic) + 8
+
+// generation is the canary of files that record their generation. It is
+// distinct from the FileCanary of the other files, so that the canaries of
+// files of either kind never compare equal.
+type generation uint64
+
+// readGeneration returns the generation recorded by the contents of f, if
+// any.
+func readGeneration(f io.ReaderAt) (gen uint64, ok bool, err error) {
+	var header [generationHeaderSize]byte
+	if _, err := f.ReadAt(header[:], 0); err != nil {
+		if err == io.EOF {
+			err = nil
+		}
+		return 0, false, err
+	}
+	if !bytes.Equal(header[:len(generationMagic)], generationMagic[:]) {
+		return 0, false, nil
+	}
+	return binary.BigEndian.Uint64(header[len(generationMagic):]), true, nil
+}
+
+// fileGeneration returns the generation recorded by the file at path, if
+// any.
+func (store *Store[T]) fileGeneration(path string) (uint64, bool, error) {
+	f, err := store.open(path, os.O_RDONLY, 0)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return 0, false, nil
+	case err != nil:
+		return 0, false, err
+	}
+	defer closeFile(f)
+	return readGeneration(f)
+}
+
+// writeGeneration writes the header recording the generation that follows
+// that of the file at path, whose lock must be held.
+//
+// Generations are the current time in nanoseconds, unless that is not past
+// the previous generation, so that they keep increasing even when the file
+// gets deleted and created again, or when the previous contents were
+// written by a machine whose clock is ahead.
+func (store *Store[T]) writeGeneration(w io.Writer, path string) error {
+	prev, ok, err := store.fileGeneration(path)
+	if err != nil {
+		return err
+	}
+	gen := uint64(time.Now().UnixNano())
+	if ok && gen <= prev {
+		gen = prev + 1
+	}
+	var header [generationHeaderSize]byte
+	copy(header[:], generationMagic[:])
+	binary.BigEndian.PutUint64(header[len(generationMagic):], gen)
+	_, err = w.Write(header[:])
+	return err
+}
+
+// skipGeneration returns a reader of the contents of r that follow their
+// generation header, if any.
+func skipGeneration(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(generationHeaderSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if bytes.HasPrefix(head, generationMagic[:]) {
+		if len(head) < generationHeaderSize {
+			return nil, io.ErrUnexpectedEOF
+		}
+		br.Discard(generationHeaderSize)
+	}
+	return br, nil
+}
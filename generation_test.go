@@ -0,0 +1,127 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerations(t *testing.T) {
+	ctx := context.Background()
+	store := New[int](json.NewEncoder, json.NewDecoder, WithGenerations())
+
+	load := func(t *testing.T, path string) (int, Canary) {
+		t.Helper()
+		var v int
+		canary, err := store.Load(ctx, path, &v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v, canary
+	}
+
+	t.Run("Canary", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "gen.json")
+		v := 1
+		if err := store.Store(ctx, path, 0666, &v, nil); err != nil {
+			t.Fatal(err)
+		}
+		_, canary1 := load(t, path)
+		if _, ok := canary1.(generation); !ok {
+			t.Fatalf("expected a generation canary, got %T", canary1)
+		}
+
+		v = 2
+		if err := store.Store(ctx, path, 0666, &v, canary1); err != nil {
+			t.Fatal(err)
+		}
+		got, canary2 := load(t, path)
+		if got != 2 {
+			t.Fatalf("expected 2, got %d", got)
+		}
+		if canary2.(generation) <= canary1.(generation) {
+			t.Fatalf("expected generation %d to be past %d", canary2, canary1)
+		}
+		if err := store.Store(ctx, path, 0666, &v, canary1); err != ErrRetry {
+			t.Fatalf("expected %v, got %v", ErrRetry, err)
+		}
+	})
+
+	t.Run("SameInode", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "gen.json")
+		v := 1
+		if err := store.Store(ctx, path, 0666, &v, nil); err != nil {
+			t.Fatal(err)
+		}
+		_, canary := load(t, path)
+
+		// Rewrite the file in place, which keeps its inode, like a new
+		// file that reuses the inode number of the old one.
+		other := filepath.Join(dir, "other.json")
+		v = 2
+		if err := store.Store(ctx, other, 0666, &v, nil); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(other)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		v = 3
+		if err := store.Store(ctx, path, 0666, &v, canary); err != ErrRetry {
+			t.Fatalf("expected %v, got %v", ErrRetry, err)
+		}
+	})
+
+	t.Run("Legacy", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "gen.json")
+		legacy := New[int](json.NewEncoder, json.NewDecoder)
+		v := 1
+		if err := legacy.Store(ctx, path, 0666, &v, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		got, canary := load(t, path)
+		if got != 1 {
+			t.Fatalf("expected 1, got %d", got)
+		}
+		if _, ok := canary.(FileCanary); !ok {
+			t.Fatalf("expected a file canary, got %T", canary)
+		}
+		v = 2
+		if err := store.Store(ctx, path, 0666, &v, canary); err != nil {
+			t.Fatal(err)
+		}
+		_, canary = load(t, path)
+		if _, ok := canary.(generation); !ok {
+			t.Fatalf("expected a generation canary, got %T", canary)
+		}
+	})
+
+	t.Run("Deleted", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "gen.json")
+		v := 1
+		if err := store.Store(ctx, path, 0666, &v, nil); err != nil {
+			t.Fatal(err)
+		}
+		_, canary := load(t, path)
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Store(ctx, path, 0666, &v, canary); err != ErrRetry {
+			t.Fatalf("expected %v, got %v", ErrRetry, err)
+		}
+	})
+}
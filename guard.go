@@ -0,0 +1,99 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// A Guard represents a lock held on a file, as returned by AcquireLock and
+// AcquireRLock.
+//
+// Releasing the lock through the guard rather than with Unlock guarantees
+// that the lock gets released exactly once, regardless of how many times
+// Release gets called. Guards that become unreachable without having been
+// released get their lock released, and are then reported to the leak hook
+// set with SetGuardLeakHook.
+type Guard struct {
+	f     OSFile
+	style LockStyle
+
+	once sync.Once
+	err  error
+}
+
+var guardLeakHook atomic.Value // func(name string)
+
+// SetGuardLeakHook sets a function to be called with the name of the locked
+// file whenever a Guard gets garbage-collected without having been released,
+// once its lock has been released. Passing nil removes the hook.
+//
+// The hook is called from the finalizer goroutine, and must not block.
+func SetGuardLeakHook(fn func(name string)) {
+	guardLeakHook.Store(fn)
+}
+
+// AcquireLock acquires an exclusive lock on the specified file, like Lock,
+// and returns a Guard that releases it.
+func AcquireLock(ctx context.Context, f OSFile) (*Guard, error) {
+	return FlockLocks.AcquireLock(ctx, f)
+}
+
+// AcquireRLock acquires a shared lock on the specified file, like RLock, and
+// returns a Guard that releases it.
+func AcquireRLock(ctx context.Context, f OSFile) (*Guard, error) {
+	return FlockLocks.AcquireRLock(ctx, f)
+}
+
+// AcquireLock is like the package-level AcquireLock function, but uses locks
+// of the specified style.
+func (style LockStyle) AcquireLock(ctx context.Context, f OSFile) (*Guard, error) {
+	if err := style.Lock(ctx, f); err != nil {
+		return nil, err
+	}
+	return newGuard(f, style), nil
+}
+
+// AcquireRLock is like the package-level AcquireRLock function, but uses
+// locks of the specified style.
+func (style LockStyle) AcquireRLock(ctx context.Context, f OSFile) (*Guard, error) {
+	if err := style.RLock(ctx, f); err != nil {
+		return nil, err
+	}
+	return newGuard(f, style), nil
+}
+
+func newGuard(f OSFile, style LockStyle) *Guard {
+	g := &Guard{f: f, style: style}
+	runtime.SetFinalizer(g, (*Guard).leaked)
+	return g
+}
+
+func (g *Guard) leaked() {
+	g.Release()
+	if fn, _ := guardLeakHook.Load().(func(string)); fn != nil {
+		fn(g.f.Name())
+	}
+}
+
+// File returns the file on which the lock is held.
+func (g *Guard) File() OSFile {
+	return g.f
+}
+
+// Release releases the lock. Only the first call releases the lock; later
+// calls return the same result without doing anything.
+func (g *Guard) Release() error {
+	g.once.Do(func() {
+		runtime.SetFinalizer(g, nil)
+		g.err = g.style.Unlock(g.f)
+	})
+	return g.err
+}
@@ -0,0 +1,100 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestGuard(t *testing.T) {
+
+	t.Run("Release", func(t *testing.T) {
+		locks := makeLockfiles(t, filepath.Join(t.TempDir(), "barney-ci-go-store-guard-test-1"), 2)
+
+		f1 := <-locks
+		if f1 == nil {
+			t.FailNow()
+		}
+		defer f1.Close()
+
+		f2 := <-locks
+		if f2 == nil {
+			t.FailNow()
+		}
+		defer f2.Close()
+
+		g, err := AcquireLock(context.Background(), f1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := TryLock(f2); err == nil {
+			t.Fatalf("TryLock succeeded on an acquired lock")
+		}
+		if err := g.Release(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Releasing again must not release locks acquired since.
+		if err := TryRLock(f1); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.Release(); err != nil {
+			t.Fatal(err)
+		}
+		if err := TryLock(f2); err == nil {
+			t.Fatalf("TryLock succeeded on an acquired lock")
+		}
+	})
+
+	t.Run("Leak", func(t *testing.T) {
+		locks := makeLockfiles(t, filepath.Join(t.TempDir(), "barney-ci-go-store-guard-test-2"), 2)
+
+		f1 := <-locks
+		if f1 == nil {
+			t.FailNow()
+		}
+		defer f1.Close()
+
+		f2 := <-locks
+		if f2 == nil {
+			t.FailNow()
+		}
+		defer f2.Close()
+
+		leaked := make(chan string, 1)
+		SetGuardLeakHook(func(name string) { leaked <- name })
+		defer SetGuardLeakHook(nil)
+
+		if _, err := AcquireRLock(context.Background(), f1); err != nil {
+			t.Fatal(err)
+		}
+
+		deadline := time.After(5 * time.Second)
+		for done := false; !done; {
+			runtime.GC()
+			select {
+			case name := <-leaked:
+				if name != f1.Name() {
+					t.Fatalf("expected leak of %q, got %q", f1.Name(), name)
+				}
+				done = true
+			case <-deadline:
+				t.Fatal("leaked guard was not reported")
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+
+		// The hook is only called once the leaked lock was released.
+		if err := TryLock(f2); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
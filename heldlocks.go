@@ -0,0 +1,183 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A HeldLock describes a lock held by the process, as listed by HeldLocks.
+type HeldLock struct {
+	// Path is the name of the locked file.
+	Path string
+
+	// Exclusive is true for exclusive locks, and false for shared locks.
+	Exclusive bool
+
+	// Goroutine is the id of the goroutine that acquired the lock, as
+	// reported in goroutine stack traces.
+	Goroutine uint64
+
+	// Acquired is the time at which the lock was acquired.
+	Acquired time.Time
+}
+
+// heldLocks holds the locks acquired by the lock functions of the package,
+// which stores use for the files of the operating system, until they get
+// released, either with Unlock or by closing their file, while lock tracking
+// is enabled.
+var heldLocks = struct {
+	sync.Mutex
+	files map[OSFile]HeldLock
+	// sweepAt is the number of files past which registering a lock drops
+	// the files that were closed without releasing their lock through the
+	// package.
+	sweepAt int
+}{files: map[OSFile]HeldLock{}, sweepAt: heldLocksMinSweep}
+
+// heldLocksMinSweep is the minimum number of files past which closed files
+// get dropped from heldLocks.
+const heldLocksMinSweep = 64
+
+// lockTracking is set by SetLockTracking.
+var lockTracking atomic.Bool
+
+// SetLockTracking enables or disables the tracking of the locks held by the
+// process, as listed by HeldLocks, DumpLocks and LocksHandler. It is
+// disabled by default, since tracking records the goroutine of every lock
+// acquired, which is meant for debugging.
+//
+// Only locks acquired while tracking is enabled get listed. Disabling it
+// forgets the locks tracked so far.
+func SetLockTracking(enabled bool) {
+	lockTracking.Store(enabled)
+	if !enabled {
+		heldLocks.Lock()
+		defer heldLocks.Unlock()
+		heldLocks.files = map[OSFile]HeldLock{}
+		heldLocks.sweepAt = heldLocksMinSweep
+	}
+}
+
+func registerLock(f OSFile, exclusive bool) {
+	if !lockTracking.Load() {
+		return
+	}
+	held := HeldLock{
+		Path:      f.Name(),
+		Exclusive: exclusive,
+		Goroutine: goroutineID(),
+		Acquired:  time.Now(),
+	}
+
+	heldLocks.Lock()
+	defer heldLocks.Unlock()
+	if prev, ok := heldLocks.files[f]; ok && prev.Exclusive == exclusive {
+		// Locking again is a no-op, which keeps the lock as it was.
+		return
+	}
+	heldLocks.files[f] = held
+
+	if len(heldLocks.files) >= heldLocks.sweepAt {
+		// Files closed without going through the package would otherwise
+		// stay around forever; sweeping whenever the table doubles keeps
+		// the cost amortized.
+		sweepHeldLocks()
+		heldLocks.sweepAt = 2 * len(heldLocks.files)
+		if heldLocks.sweepAt < heldLocksMinSweep {
+			heldLocks.sweepAt = heldLocksMinSweep
+		}
+	}
+}
+
+func unregisterLock(f OSFile) {
+	if !lockTracking.Load() {
+		return
+	}
+	heldLocks.Lock()
+	defer heldLocks.Unlock()
+	delete(heldLocks.files, f)
+}
+
+// sweepHeldLocks drops the files of heldLocks that were closed, which
+// released their lock. heldLocks must be locked.
+func sweepHeldLocks() {
+	for f := range heldLocks.files {
+		if fileClosed(f) {
+			delete(heldLocks.files, f)
+		}
+	}
+}
+
+// HeldLocks returns the locks currently held by the process through the lock
+// functions of the package, including those held by stores on the files of
+// the operating system, ordered by acquisition time. It returns nothing
+// unless SetLockTracking enabled lock tracking.
+func HeldLocks() []HeldLock {
+	heldLocks.Lock()
+	defer heldLocks.Unlock()
+
+	sweepHeldLocks()
+	locks := make([]HeldLock, 0, len(heldLocks.files))
+	for _, held := range heldLocks.files {
+		locks = append(locks, held)
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].Acquired.Before(locks[j].Acquired) })
+	return locks
+}
+
+// DumpLocks writes the locks currently held by the process, as returned by
+// HeldLocks, to w in a human-readable form, one per line. Along with a dump
+// of the goroutines of the process, this tells which goroutine holds the lock
+// that another one is stuck on, for instance when a process deadlocks on its
+// own files.
+func DumpLocks(w io.Writer) error {
+	now := time.Now()
+	var buf bytes.Buffer
+	for _, held := range HeldLocks() {
+		mode := "shared"
+		if held.Exclusive {
+			mode = "exclusive"
+		}
+		fmt.Fprintf(&buf, "%s: %s lock held by goroutine %d for %v (since %s)\n",
+			held.Path, mode, held.Goroutine, now.Sub(held.Acquired).Round(time.Millisecond),
+			held.Acquired.Format(time.RFC3339Nano))
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// LocksHandler returns an HTTP handler that serves the dump of DumpLocks as
+// plain text, to be registered next to the handlers of net/http/pprof.
+func LocksHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		DumpLocks(w)
+	})
+}
+
+// goroutineID returns the id of the calling goroutine, parsed from the header
+// of its stack trace, or 0 if it cannot be determined.
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
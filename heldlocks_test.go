@@ -0,0 +1,161 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// heldLock returns the lock held by the process on the file at path.
+func heldLock(path string) (HeldLock, bool) {
+	for _, held := range HeldLocks() {
+		if held.Path == path {
+			return held, true
+		}
+	}
+	return HeldLock{}, false
+}
+
+func TestHeldLocks(t *testing.T) {
+	ctx := context.Background()
+
+	SetLockTracking(true)
+	t.Cleanup(func() { SetLockTracking(false) })
+
+	t.Run("Unlock", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "lock")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		if err := RLock(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+		if held, ok := heldLock(path); !ok || held.Exclusive || held.Goroutine != goroutineID() {
+			t.Fatalf("expected a shared lock held by this goroutine, got %+v, %v", held, ok)
+		}
+		if err := Lock(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+		if held, ok := heldLock(path); !ok || !held.Exclusive {
+			t.Fatalf("expected an exclusive lock, got %+v, %v", held, ok)
+		}
+
+		if err := Unlock(f); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := heldLock(path); ok {
+			t.Fatal("expected the lock to be released")
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "lock")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := TryLock(f); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		if _, ok := heldLock(path); ok {
+			t.Fatal("expected the lock of the closed file to be released")
+		}
+	})
+
+	t.Run("Bounded", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "lock")
+		for i := 0; i < 10*heldLocksMinSweep; i++ {
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := Lock(ctx, f); err != nil {
+				t.Fatal(err)
+			}
+			// Closing the file without the package leaves its entry
+			// behind until the next sweep.
+			f.Close()
+		}
+
+		heldLocks.Lock()
+		n := len(heldLocks.files)
+		heldLocks.Unlock()
+		if n > heldLocksMinSweep {
+			t.Fatalf("expected closed files to be dropped, got %d entries", n)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		SetLockTracking(false)
+		defer SetLockTracking(true)
+
+		path := filepath.Join(t.TempDir(), "lock")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := Lock(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+
+		heldLocks.Lock()
+		n := len(heldLocks.files)
+		heldLocks.Unlock()
+		if n != 0 {
+			t.Fatalf("expected no lock to be tracked, got %d", n)
+		}
+	})
+
+	t.Run("Store", func(t *testing.T) {
+		store := New[int](json.NewEncoder, json.NewDecoder, WithStableLockFile())
+		path := filepath.Join(t.TempDir(), "state.json")
+		lockPath := path + ".lockfile"
+
+		err := store.LoadAndStoreExclusive(ctx, path, 0666, func(ctx context.Context, val *int, err error) error {
+			if _, ok := heldLock(lockPath); !ok {
+				t.Error("expected the lock file to be held")
+			}
+			*val = 1
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := heldLock(lockPath); ok {
+			t.Fatal("expected the lock file to be released")
+		}
+	})
+
+	t.Run("Dump", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "lock")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := Lock(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+
+		rec := httptest.NewRecorder()
+		LocksHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/locks", nil))
+		if body := rec.Body.String(); !strings.Contains(body, path+": exclusive lock held by goroutine ") {
+			t.Fatalf("expected the lock in the dump, got %q", body)
+		}
+	})
+}
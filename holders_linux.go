@@ -0,0 +1,123 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package store
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// LockHolder describes a process that either holds or waits on a lock.
+type LockHolder struct {
+	// PID is the process ID of the lock owner, or -1 if the kernel does not
+	// associate the lock with a process, which is the case for OFD locks.
+	PID int
+
+	// Kind is the kind of lock as reported by the kernel, for instance FLOCK,
+	// POSIX, or OFDLCK.
+	Kind string
+
+	// Exclusive is true if the lock is a write lock, and false if it is a
+	// shared read lock.
+	Exclusive bool
+
+	// Waiting is true if the process is blocked waiting to acquire the lock
+	// rather than holding it.
+	Waiting bool
+}
+
+// LockHolders returns the processes holding or waiting on a lock on the file
+// at the specified path, as reported by /proc/locks.
+//
+// This is meant as a debugging aid to answer "who is holding this lock?" on
+// a contended file; the result is inherently racy and only represents a
+// snapshot of the lock state at the time of the call.
+func LockHolders(path string) ([]LockHolder, error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(path, &stat); err != nil {
+		return nil, &os.PathError{Op: "stat", Path: path, Err: err}
+	}
+
+	f, err := os.Open("/proc/locks")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseProcLocks(f, unix.Major(uint64(stat.Dev)), unix.Minor(uint64(stat.Dev)), stat.Ino)
+}
+
+// parseProcLocks parses the contents of /proc/locks and returns the entries
+// that match the specified device and inode.
+//
+// Each line has the form:
+//
+//	1: FLOCK  ADVISORY  WRITE 1234 08:01:5678 0 EOF
+//	1: -> FLOCK  ADVISORY  WRITE 4321 08:01:5678 0 EOF
+//
+// where the arrow marks a process blocked on the lock above it, and the
+// device numbers are printed in hexadecimal.
+func parseProcLocks(r io.Reader, major, minor uint32, ino uint64) ([]LockHolder, error) {
+	var holders []LockHolder
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		fields = fields[1:]
+
+		var holder LockHolder
+		if fields[0] == "->" {
+			holder.Waiting = true
+			fields = fields[1:]
+		}
+		if len(fields) < 5 {
+			continue
+		}
+
+		id := strings.Split(fields[4], ":")
+		if len(id) != 3 {
+			continue
+		}
+		lmajor, err := strconv.ParseUint(id[0], 16, 32)
+		if err != nil {
+			continue
+		}
+		lminor, err := strconv.ParseUint(id[1], 16, 32)
+		if err != nil {
+			continue
+		}
+		lino, err := strconv.ParseUint(id[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		if uint32(lmajor) != major || uint32(lminor) != minor || lino != ino {
+			continue
+		}
+
+		pid, err := strconv.Atoi(fields[3])
+		if err != nil {
+			continue
+		}
+
+		holder.PID = pid
+		holder.Kind = fields[0]
+		holder.Exclusive = fields[2] == "WRITE"
+		holders = append(holders, holder)
+	}
+	return holders, scanner.Err()
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLockHolders(t *testing.T) {
+
+	t.Run("Parse", func(t *testing.T) {
+		const locks = `1: FLOCK  ADVISORY  WRITE 1234 08:01:5678 0 EOF
+1: -> FLOCK  ADVISORY  WRITE 4321 08:01:5678 0 EOF
+2: POSIX  ADVISORY  READ 1111 08:01:9999 0 EOF
+3: OFDLCK ADVISORY  READ -1 103:0a:5678 0 EOF
+`
+		holders, err := parseProcLocks(strings.NewReader(locks), 8, 1, 5678)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []LockHolder{
+			{PID: 1234, Kind: "FLOCK", Exclusive: true},
+			{PID: 4321, Kind: "FLOCK", Exclusive: true, Waiting: true},
+		}
+		if len(holders) != len(expected) {
+			t.Fatalf("expected %v, got %v", expected, holders)
+		}
+		for i := range expected {
+			if holders[i] != expected[i] {
+				t.Fatalf("expected %v, got %v", expected, holders)
+			}
+		}
+
+		holders, err = parseProcLocks(strings.NewReader(locks), 0x103, 0xa, 5678)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(holders) != 1 || holders[0] != (LockHolder{PID: -1, Kind: "OFDLCK"}) {
+			t.Fatalf("expected a single shared OFD lock, got %v", holders)
+		}
+	})
+
+	t.Run("Live", func(t *testing.T) {
+		if _, err := os.Stat("/proc/locks"); err != nil {
+			t.Skip("/proc/locks is unavailable:", err)
+		}
+
+		path := filepath.Join(t.TempDir(), "holders")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		if err := Lock(context.Background(), f); err != nil {
+			t.Fatal(err)
+		}
+
+		holders, err := LockHolders(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(holders) != 1 {
+			t.Fatalf("expected exactly one holder, got %v", holders)
+		}
+		if holders[0].PID != os.Getpid() || !holders[0].Exclusive || holders[0].Waiting {
+			t.Fatalf("expected an exclusive lock held by pid %d, got %v", os.Getpid(), holders[0])
+		}
+	})
+
+	t.Run("InProcess", func(t *testing.T) {
+		if _, err := os.Stat("/proc/locks"); err != nil {
+			t.Skip("/proc/locks is unavailable:", err)
+		}
+		SetInProcessLocking(true)
+		defer SetInProcessLocking(false)
+
+		path := filepath.Join(t.TempDir(), "holders")
+		for i := 0; i < 3; i++ {
+			f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if err := RLock(context.Background(), f); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		holders, err := LockHolders(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(holders) != 1 {
+			t.Fatalf("expected the shared locks to share one system lock, got %v", holders)
+		}
+	})
+}
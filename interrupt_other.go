@@ -0,0 +1,26 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build !unix
+// +build !unix
+
+package store
+
+import (
+	"os"
+)
+
+// setInterruptSignal does nothing, since locks are not interrupted with
+// signals on this system.
+func setInterruptSignal(sig os.Signal) error {
+	return nil
+}
+
+// restoreSignalHandling does nothing, since locks are not interrupted with
+// signals on this system.
+func restoreSignalHandling() error {
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build unix
+// +build unix
+
+package store
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+var interruptSignal = struct {
+	sync.Mutex
+	sig unix.Signal
+	// ready is set once SA_RESTART got disabled for sig, after which sig can
+	// no longer change until restored.
+	ready bool
+	// restart is whether SA_RESTART was set for sig before.
+	restart bool
+
+	// inUse is held for reading by the lock calls that rely on sig to get
+	// interrupted, and for writing while restoring it.
+	inUse sync.RWMutex
+}{
+	// Picked to match Go's goroutine preemption signal.
+	//
+	// The reason for this is that we share the same rationale; see
+	// https://cs.opensource.google/go/proposal/+/master:design/24543-non-cooperative-preemption.md
+	// for the full context, quoting the relevant part:
+	//
+	//     **Choosing a signal.** We have to choose a signal that is unlikely to
+	//     interfere with existing uses of signals or with debuggers.
+	//     There are no perfect choices, but there are some heuristics.
+	//
+	//     1) It should be a signal that's passed-through by debuggers by
+	//        default.
+	//        On Linux, this is SIGALRM, SIGURG, SIGCHLD, SIGIO, SIGVTALRM, SIGPROF,
+	//        and SIGWINCH, plus some glibc-internal signals.
+	//     2) It shouldn't be used internally by libc in mixed Go/C binaries
+	//        because libc may assume it's the only thing that can handle these
+	//        signals.
+	//        For example SIGCANCEL or SIGSETXID.
+	//     3) It should be a signal that can happen spuriously without
+	//        consequences.
+	//        For example, SIGALRM is a bad choice because the signal handler can't
+	//        tell if it was caused by the real process alarm or not (arguably this
+	//        means the signal is broken, but I digress).
+	//        SIGUSR1 and SIGUSR2 are also bad because those are often used in
+	//        meaningful ways by applications.
+	//     4) We need to deal with platforms without real-time signals (like
+	//        macOS), so those are out.
+	//
+	// On the last note, it makes no difference to use SIGRT_N over SIGURG for
+	// performance reasons -- the benchmarks end up the same.
+	sig: unix.SIGURG,
+}
+
+func setInterruptSignal(sig os.Signal) error {
+	s, ok := sig.(unix.Signal)
+	if !ok || s <= 0 || s == unix.SIGKILL || s == unix.SIGSTOP {
+		return fmt.Errorf("cannot interrupt locks with %v", sig)
+	}
+
+	interruptSignal.Lock()
+	defer interruptSignal.Unlock()
+
+	if interruptSignal.ready && s != interruptSignal.sig {
+		return ErrInterruptSignalInUse
+	}
+	interruptSignal.sig = s
+	return nil
+}
+
+// prepareInterruptSignal returns the signal that interrupts blocking locks,
+// disabling SA_RESTART for it the first time.
+//
+// Go installs its signal handler with SA_RESTART, which means we don't get
+// to handle EINTR; disable this for our signal, forever.
+//
+// While this seems we're breaking global state, because Go is expecting
+// all signal handlers to have SA_RESTART, the reality is that the Go authors
+// have to now explicitly make all of the stdlib code EINTR-resillient because
+// of CGo. Doing it lazily leaves the handlers alone in programs that never
+// block on locks.
+//
+// Further readings:
+// * https://github.com/golang/go/issues/20400
+// * https://github.com/golang/go/issues/44761
+func prepareInterruptSignal() (unix.Signal, error) {
+	interruptSignal.Lock()
+	defer interruptSignal.Unlock()
+
+	sig := interruptSignal.sig
+	if interruptSignal.ready {
+		return sig, nil
+	}
+
+	var act sigactiont
+	if err := sigaction(sig, nil, &act); err != nil {
+		return 0, err
+	}
+	restart := act.Flags&_SA_RESTART != 0
+	act.Flags &= ^_SA_RESTART
+	if err := sigaction(sig, &act, nil); err != nil {
+		return 0, err
+	}
+	interruptSignal.ready, interruptSignal.restart = true, restart
+	return sig, nil
+}
+
+// acquireInterruptSignal returns the signal that interrupts blocking locks,
+// which cannot be restored until the lock call is done with it and calls
+// releaseInterruptSignal.
+func acquireInterruptSignal() (unix.Signal, error) {
+	interruptSignal.inUse.RLock()
+	sig, err := prepareInterruptSignal()
+	if err != nil {
+		interruptSignal.inUse.RUnlock()
+		return 0, err
+	}
+	return sig, nil
+}
+
+func releaseInterruptSignal() {
+	interruptSignal.inUse.RUnlock()
+}
+
+func restoreSignalHandling() error {
+	interruptSignal.inUse.Lock()
+	defer interruptSignal.inUse.Unlock()
+	interruptSignal.Lock()
+	defer interruptSignal.Unlock()
+
+	if !interruptSignal.ready {
+		return nil
+	}
+	if interruptSignal.restart {
+		sig := interruptSignal.sig
+		var act sigactiont
+		if err := sigaction(sig, nil, &act); err != nil {
+			return err
+		}
+		act.Flags |= _SA_RESTART
+		if err := sigaction(sig, &act, nil); err != nil {
+			return err
+		}
+	}
+	interruptSignal.ready = false
+	return nil
+}
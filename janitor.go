@@ -0,0 +1,214 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CleanOrphans removes the lock and temporary files that writers of the files
+// in dir left behind, for instance because they crashed mid-write, and that
+// were last modified more than olderThan ago. It returns the number of files
+// that were removed.
+//
+// A file is only removed if CleanOrphans can acquire the lock that writers
+// hold while using it, which means that live writers are never disturbed,
+// regardless of olderThan. Stable lock files, as used with WithStableLockFile,
+// are never removed.
+//
+// The store must be configured like the stores that write to dir, so that
+// CleanOrphans can recognize their lock and temporary files.
+func (store *Store[T]) CleanOrphans(ctx context.Context, dir string, olderThan time.Duration) (int, error) {
+	auxdir := filepath.Dir(store.auxPath(filepath.Join(dir, "_"), "", ""))
+
+	entries, err := store.fs().ReadDir(auxdir)
+	if err != nil {
+		return 0, err
+	}
+
+	deadline := time.Now().Add(-olderThan)
+
+	removed := 0
+	for _, entry := range entries {
+		select {
+		case <-ctx.Done():
+			return removed, ctx.Err()
+		default:
+		}
+
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		var (
+			ok  bool
+			err error
+		)
+		name := filepath.Join(auxdir, entry.Name())
+		if base, isTemp := store.tempBase(entry.Name()); isTemp {
+			ok, err = store.cleanTemp(name, filepath.Join(dir, base), deadline)
+		} else if _, isLock := store.lockBase(entry.Name()); isLock && !store.opts.stableLockFile {
+			ok, err = store.cleanLock(name, deadline)
+		}
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			// Already gone.
+		case err != nil:
+			return removed, err
+		case ok:
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// cleanLock removes the lock file at name, if it is older than deadline and
+// no writer is using it.
+func (store *Store[T]) cleanLock(name string, deadline time.Time) (bool, error) {
+	b := store.fs()
+	lf, err := b.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return false, err
+	}
+	defer closeFile(lf)
+
+	if err := b.TryLock(lf); err != nil {
+		if errors.Is(err, ErrWouldBlock) {
+			err = nil
+		}
+		return false, err
+	}
+
+	// Check the age of the file while holding the lock, and make sure that
+	// the lock is held on the file that is still at that name.
+	if stale, err := isStale(lf, deadline); !stale || err != nil {
+		return false, err
+	}
+	if _, ko, err := deleted(b, lf); ko {
+		return false, err
+	}
+	return true, b.Remove(name)
+}
+
+// cleanTemp removes the temporary file at name of the file at path, if it is
+// older than deadline and no writer holds the lock file of path.
+func (store *Store[T]) cleanTemp(name, path string, deadline time.Time) (bool, error) {
+	b := store.fs()
+	lf, err := b.OpenFile(store.lockPath(path), os.O_WRONLY, 0)
+	switch {
+	case err == nil:
+		defer closeFile(lf)
+
+		if err := b.TryLock(lf); err != nil {
+			if errors.Is(err, ErrWouldBlock) {
+				err = nil
+			}
+			return false, err
+		}
+	case errors.Is(err, os.ErrNotExist):
+		// Without a lock file, there cannot be any writer.
+	default:
+		return false, err
+	}
+
+	tf, err := b.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return false, err
+	}
+	defer closeFile(tf)
+
+	if stale, err := isStale(tf, deadline); !stale || err != nil {
+		return false, err
+	}
+	return true, b.Remove(name)
+}
+
+func isStale(f File, deadline time.Time) (bool, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	return info.ModTime().Before(deadline), nil
+}
+
+// lockBase returns the base name of the file whose lock file is named name.
+func (store *Store[T]) lockBase(name string) (string, bool) {
+	prefix, suffix := store.lockAffixes()
+	return trimAffixes(name, prefix, suffix)
+}
+
+// tempBase returns the base name of the file whose temporary file is named
+// name.
+func (store *Store[T]) tempBase(name string) (string, bool) {
+	prefix, suffix := store.tempAffixes()
+	base, ok := trimAffixes(name, prefix, suffix)
+	if !ok {
+		return "", false
+	}
+
+	// Strip the random part of the name, which is made of 16 hex digits.
+	const randomLen = 1 + 16
+	if len(base) <= randomLen || base[len(base)-randomLen] != '.' {
+		return "", false
+	}
+	for _, c := range base[len(base)-randomLen+1:] {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return "", false
+		}
+	}
+	return base[:len(base)-randomLen], true
+}
+
+func trimAffixes(name, prefix, suffix string) (string, bool) {
+	if len(name) <= len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+	return name[len(prefix) : len(name)-len(suffix)], true
+}
+
+// A Janitor periodically removes the orphaned lock and temporary files of
+// a directory, as CleanOrphans does.
+type Janitor[T any] struct {
+	store     *Store[T]
+	dir       string
+	olderThan time.Duration
+	interval  time.Duration
+}
+
+// NewJanitor returns a Janitor that removes the orphaned files of dir older
+// than olderThan with the specified store, every interval.
+func NewJanitor[T any](store *Store[T], dir string, olderThan, interval time.Duration) *Janitor[T] {
+	return &Janitor[T]{
+		store:     store,
+		dir:       dir,
+		olderThan: olderThan,
+		interval:  interval,
+	}
+}
+
+// Run cleans the directory of the janitor immediately, then every interval,
+// until the context is done or cleaning fails.
+func (j *Janitor[T]) Run(ctx context.Context) error {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := j.store.CleanOrphans(ctx, j.dir, j.olderThan); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCleanOrphans(t *testing.T) {
+	old := time.Now().Add(-time.Hour)
+
+	create := func(t *testing.T, path string, mtime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte("partial"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exists := func(t *testing.T, path string) bool {
+		t.Helper()
+		_, err := os.Stat(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			t.Fatal(err)
+		}
+		return err == nil
+	}
+
+	t.Run("LockFiles", func(t *testing.T) {
+		dir := t.TempDir()
+		store := New[int](json.NewEncoder, json.NewDecoder)
+
+		if err := store.ForceStore(context.Background(), filepath.Join(dir, "live"), 0666, new(int)); err != nil {
+			t.Fatal(err)
+		}
+		create(t, filepath.Join(dir, "orphan.lock"), old)
+		create(t, filepath.Join(dir, "recent.lock"), time.Now())
+		create(t, filepath.Join(dir, "held.lock"), old)
+
+		held, err := os.OpenFile(filepath.Join(dir, "held.lock"), os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer held.Close()
+		if err := Lock(context.Background(), held); err != nil {
+			t.Fatal(err)
+		}
+
+		n, err := store.CleanOrphans(context.Background(), dir, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Fatalf("expected 1 file to be removed, got %d", n)
+		}
+		if exists(t, filepath.Join(dir, "orphan.lock")) {
+			t.Fatal("orphan.lock was not removed")
+		}
+		for _, name := range []string{"live", "recent.lock", "held.lock"} {
+			if !exists(t, filepath.Join(dir, name)) {
+				t.Fatalf("%s was removed", name)
+			}
+		}
+	})
+
+	t.Run("TempFiles", func(t *testing.T) {
+		dir := t.TempDir()
+		store := New[int](json.NewEncoder, json.NewDecoder, WithStableLockFile())
+
+		if err := store.ForceStore(context.Background(), filepath.Join(dir, "held"), 0666, new(int)); err != nil {
+			t.Fatal(err)
+		}
+		create(t, filepath.Join(dir, "orphan.0123456789abcdef.tmp"), old)
+		create(t, filepath.Join(dir, "held.0123456789abcdef.tmp"), old)
+		create(t, filepath.Join(dir, "notrandom.tmp"), old)
+
+		held, err := os.OpenFile(filepath.Join(dir, "held.lockfile"), os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer held.Close()
+		if err := Lock(context.Background(), held); err != nil {
+			t.Fatal(err)
+		}
+
+		n, err := store.CleanOrphans(context.Background(), dir, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Fatalf("expected 1 file to be removed, got %d", n)
+		}
+		if exists(t, filepath.Join(dir, "orphan.0123456789abcdef.tmp")) {
+			t.Fatal("orphaned temporary file was not removed")
+		}
+		for _, name := range []string{"held", "held.lockfile", "held.0123456789abcdef.tmp", "notrandom.tmp"} {
+			if !exists(t, filepath.Join(dir, name)) {
+				t.Fatalf("%s was removed", name)
+			}
+		}
+	})
+
+	t.Run("Janitor", func(t *testing.T) {
+		dir := t.TempDir()
+		store := New[int](json.NewEncoder, json.NewDecoder)
+		create(t, filepath.Join(dir, "orphan.lock"), old)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err := NewJanitor(store, dir, time.Minute, 10*time.Millisecond).Run(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the janitor to run until the deadline, got %v", err)
+		}
+		if exists(t, filepath.Join(dir, "orphan.lock")) {
+			t.Fatal("orphan.lock was not removed")
+		}
+	})
+}
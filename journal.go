@@ -0,0 +1,347 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+)
+
+// Records of a journal are framed with a header holding the length and the
+// CRC-32C of the encoded record, and a footer repeating the length, which
+// lets appenders check that the last record is intact without reading the
+// whole journal.
+const (
+	journalHeaderSize = 8
+	journalFooterSize = 4
+)
+
+var journalCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// A Journal represents an append-only sequence of records of type T stored
+// in a single file.
+//
+// Appending a record only writes that record, rather than rewriting the
+// whole file like Store does, which makes journals suitable for histories
+// of events. Appenders are serialized with the same lock file protocol as
+// the other operations of the store, check the size of the journal as its
+// canary, and write each record with a single write to the file opened with
+// os.O_APPEND. Compact rewrites the journal with the same atomic rename as
+// Store.
+//
+// Readers take no lock. Records that were only partially written, because
+// an append is in progress or the process crashed mid-append, are detected
+// with the CRC-32C framing of records and ignored; the next append truncates
+// them. With WithMaxBytes, the limit applies to each record.
+type Journal[T any] struct {
+	store *Store[T]
+	path  string
+	mode  os.FileMode
+}
+
+// NewJournal returns a Journal that encodes its records with the specified
+// store into the file at path, creating it with the specified mode.
+func NewJournal[T any](store *Store[T], path string, mode os.FileMode) *Journal[T] {
+	return &Journal[T]{store: store, path: path, mode: mode}
+}
+
+// Append appends v to the journal, and returns the size of the journal after
+// the append, which is the offset right past the new record.
+func (j *Journal[T]) Append(ctx context.Context, v *T) (size int64, err error) {
+	ctx, span := j.store.startSpan(ctx, "Append", j.path)
+	defer func() { endSpan(span, err) }()
+
+	return j.append(ctx, v, -1)
+}
+
+// AppendIf appends v to the journal like Append, but only if the size of
+// the journal is still the specified size, as returned by Append or Replay.
+// Otherwise, AppendIf returns ErrRetry, which indicates that other records
+// were appended in the meantime, or that the journal was compacted.
+func (j *Journal[T]) AppendIf(ctx context.Context, v *T, size int64) (newSize int64, err error) {
+	ctx, span := j.store.startSpan(ctx, "AppendIf", j.path)
+	defer func() { endSpan(span, err) }()
+
+	return j.append(ctx, v, size)
+}
+
+func (j *Journal[T]) append(ctx context.Context, v *T, expected int64) (int64, error) {
+	store := j.store
+
+	// Encode the record upfront, so that it can be written at once.
+	var buf bytes.Buffer
+	if err := j.encodeRecord(&buf, v); err != nil {
+		return 0, err
+	}
+	frame := buf.Bytes()
+
+	lf, _, err := j.acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer j.store.release(ctx, lf)
+
+	f, err := store.fs().OpenFile(j.path, os.O_RDWR|os.O_APPEND|os.O_CREATE, j.mode)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	end, err := j.end(ctx, f)
+	if err != nil {
+		return 0, err
+	}
+	if expected >= 0 && end != expected {
+		return 0, ErrRetry
+	}
+
+	// Appenders hold the lock, so only a crashed append can have left a
+	// partial record behind; truncate it so that the new record follows
+	// the last intact one.
+	if end != info.Size() {
+		if err := f.Truncate(end); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := f.Write(frame); err != nil {
+		return 0, err
+	}
+	if err := store.syncData(f); err != nil {
+		return 0, err
+	}
+	return end + int64(len(frame)), nil
+}
+
+// Replay calls fn with each record of the journal starting at offset from,
+// which must be 0 or a size returned by Append, AppendIf or Replay, along
+// with the offset of the record. It returns the size of the journal, which
+// lets callers replay only the new records on the next call.
+//
+// Replay takes no lock, and may run concurrently with appends and
+// compactions. A record that is still being appended fails its CRC-32C
+// check and ends the replay, and a compaction atomically replaces the
+// journal, so Replay only ever sees intact records of either version.
+//
+// A missing journal is replayed as an empty one. If fn returns an error,
+// Replay stops and returns it.
+func (j *Journal[T]) Replay(ctx context.Context, from int64, fn func(offset int64, v *T) error) (size int64, err error) {
+	ctx, span := j.store.startSpan(ctx, "Replay", j.path)
+	defer func() { endSpan(span, err) }()
+
+	f, err := j.store.fs().OpenFile(j.path, os.O_RDONLY, 0)
+	if errors.Is(err, os.ErrNotExist) && from == 0 {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer closeFile(f)
+
+	return j.scan(ctx, f, from, func(offset int64, payload []byte) error {
+		var v T
+		if err := j.store.decode(bytes.NewReader(payload), j.path, &v); err != nil {
+			return err
+		}
+		return fn(offset, &v)
+	})
+}
+
+// Compact rewrites the journal with the records returned by fn, which gets
+// called with all the records of the journal. The new journal atomically
+// replaces the old one, and appends wait for the compaction to finish.
+//
+// If fn returns an error, the journal is left untouched.
+func (j *Journal[T]) Compact(ctx context.Context, fn func(ctx context.Context, records []T) ([]T, error)) (err error) {
+	ctx, span := j.store.startSpan(ctx, "Compact", j.path)
+	defer func() { endSpan(span, err) }()
+
+	store := j.store
+
+	lf, lst, err := j.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer j.store.release(ctx, lf)
+
+	var records []T
+	f, err := store.fs().OpenFile(j.path, os.O_RDONLY, 0)
+	switch {
+	case err == nil:
+		_, err = j.scan(ctx, f, 0, func(offset int64, payload []byte) error {
+			var v T
+			if err := store.decode(bytes.NewReader(payload), j.path, &v); err != nil {
+				return err
+			}
+			records = append(records, v)
+			return nil
+		})
+		f.Close()
+		if err != nil {
+			return err
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+
+	records, err = fn(ctx, records)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for i := range records {
+		if err := j.encodeRecord(&buf, &records[i]); err != nil {
+			return err
+		}
+	}
+
+	return store.commit(ctx, lf, lst, j.path, j.mode, func(w io.Writer) error {
+		_, err := buf.WriteTo(w)
+		return err
+	})
+}
+
+// encodeRecord appends the framed encoding of v to buf.
+func (j *Journal[T]) encodeRecord(buf *bytes.Buffer, v *T) error {
+	start := buf.Len()
+	buf.Write(make([]byte, journalHeaderSize))
+
+	w := io.Writer(buf)
+	if j.store.opts.maxBytes > 0 {
+		w = &limitedWriter{w: buf, n: j.store.opts.maxBytes}
+	}
+	if err := j.store.encode(w, j.path, v); err != nil {
+		return err
+	}
+
+	n := buf.Len() - start - journalHeaderSize
+	if int64(n) > math.MaxUint32 {
+		return &EncodeError{Path: j.path, Err: ErrTooLarge}
+	}
+	frame := buf.Bytes()[start:]
+	binary.LittleEndian.PutUint32(frame[0:], uint32(n))
+	binary.LittleEndian.PutUint32(frame[4:], crc32.Checksum(frame[journalHeaderSize:], journalCRCTable))
+
+	var footer [journalFooterSize]byte
+	binary.LittleEndian.PutUint32(footer[:], uint32(n))
+	buf.Write(footer[:])
+	return nil
+}
+
+func (j *Journal[T]) acquire(ctx context.Context) (File, FileStat, error) {
+	for {
+		lf, lst, err := j.store.acquire(ctx, j.path, j.mode, nil, true)
+		if err != ErrRetry {
+			return lf, lst, err
+		}
+	}
+}
+
+// end returns the offset right past the last intact record of the journal.
+func (j *Journal[T]) end(ctx context.Context, f File) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+	if size == 0 {
+		return 0, nil
+	}
+
+	// Check the last record, which is the only one that can be partial.
+	var footer [journalFooterSize]byte
+	if size >= journalHeaderSize+journalFooterSize {
+		if _, err := f.ReadAt(footer[:], size-journalFooterSize); err != nil {
+			return 0, err
+		}
+		n := int64(binary.LittleEndian.Uint32(footer[:]))
+		if start := size - journalFooterSize - n - journalHeaderSize; start >= 0 {
+			r := bufio.NewReader(io.NewSectionReader(f, start, size-start))
+			if _, ok, err := readJournalRecord(r, size-start); err != nil {
+				return 0, err
+			} else if ok {
+				return size, nil
+			}
+		}
+	}
+
+	// The journal ends with a partial record; find the last intact one.
+	return j.scan(ctx, f, 0, func(int64, []byte) error { return nil })
+}
+
+// scan calls fn with the offset and encoded contents of each intact record
+// of the journal starting at offset from, and returns the offset right past
+// the last intact record.
+func (j *Journal[T]) scan(ctx context.Context, f File, from int64, fn func(offset int64, payload []byte) error) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+	if from > size {
+		return 0, &os.PathError{Op: "replay", Path: j.path, Err: os.ErrInvalid}
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(f, from, size-from))
+	offset := from
+	for {
+		select {
+		case <-ctx.Done():
+			return offset, ctx.Err()
+		default:
+		}
+
+		payload, ok, err := readJournalRecord(r, size-offset)
+		if err != nil || !ok {
+			return offset, err
+		}
+		if err := fn(offset, payload); err != nil {
+			return offset, err
+		}
+		offset += int64(journalHeaderSize + len(payload) + journalFooterSize)
+	}
+}
+
+// readJournalRecord reads the next record from r, which has remaining bytes
+// left. It returns false if there is no intact record to read.
+func readJournalRecord(r io.Reader, remaining int64) ([]byte, bool, error) {
+	var header [journalHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = nil
+		}
+		return nil, false, err
+	}
+	n := int64(binary.LittleEndian.Uint32(header[0:]))
+	if n > remaining-journalHeaderSize-journalFooterSize {
+		return nil, false, nil
+	}
+
+	buf := make([]byte, n+journalFooterSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = nil
+		}
+		return nil, false, err
+	}
+	payload := buf[:n]
+	if binary.LittleEndian.Uint32(buf[n:]) != uint32(n) || crc32.Checksum(payload, journalCRCTable) != binary.LittleEndian.Uint32(header[4:]) {
+		return nil, false, nil
+	}
+	return payload, true, nil
+}
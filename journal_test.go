@@ -0,0 +1,224 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	ctx := context.Background()
+
+	replay := func(t *testing.T, j *Journal[int], from int64) ([]int, int64) {
+		t.Helper()
+		var got []int
+		size, err := j.Replay(ctx, from, func(offset int64, v *int) error {
+			got = append(got, *v)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got, size
+	}
+
+	expect := func(t *testing.T, got []int, expected ...int) {
+		t.Helper()
+		if len(got) != len(expected) {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+		for i := range expected {
+			if got[i] != expected[i] {
+				t.Fatalf("expected %v, got %v", expected, got)
+			}
+		}
+	}
+
+	for _, stable := range []bool{false, true} {
+		var opts []Option
+		if stable {
+			opts = append(opts, WithStableLockFile())
+		}
+		store := New[int](json.NewEncoder, json.NewDecoder, opts...)
+
+		name := "Default"
+		if stable {
+			name = "StableLockFile"
+		}
+		t.Run(name, func(t *testing.T) {
+			t.Run("AppendReplay", func(t *testing.T) {
+				j := NewJournal(store, filepath.Join(t.TempDir(), "journal"), 0666)
+
+				got, size := replay(t, j, 0)
+				expect(t, got)
+
+				for i := 1; i <= 3; i++ {
+					v := i
+					if _, err := j.Append(ctx, &v); err != nil {
+						t.Fatal(err)
+					}
+				}
+				got, size = replay(t, j, 0)
+				expect(t, got, 1, 2, 3)
+
+				v := 4
+				newSize, err := j.AppendIf(ctx, &v, size)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := j.AppendIf(ctx, &v, size); err != ErrRetry {
+					t.Fatalf("expected ErrRetry, got %v", err)
+				}
+
+				got, end := replay(t, j, size)
+				expect(t, got, 4)
+				if end != newSize {
+					t.Fatalf("expected size %d, got %d", newSize, end)
+				}
+			})
+
+			t.Run("PartialRecord", func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "journal")
+				j := NewJournal(store, path, 0666)
+
+				for i := 1; i <= 2; i++ {
+					v := i
+					if _, err := j.Append(ctx, &v); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				// Simulate a crash in the middle of an append.
+				f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				f.Write([]byte{42, 0, 0, 0, 1, 2, 3, 4, '4'})
+				f.Close()
+
+				got, _ := replay(t, j, 0)
+				expect(t, got, 1, 2)
+
+				v := 3
+				if _, err := j.Append(ctx, &v); err != nil {
+					t.Fatal(err)
+				}
+				got, _ = replay(t, j, 0)
+				expect(t, got, 1, 2, 3)
+			})
+
+			t.Run("Concurrent", func(t *testing.T) {
+				j := NewJournal(store, filepath.Join(t.TempDir(), "journal"), 0666)
+
+				const total = 50
+				var wait sync.WaitGroup
+				for i := 0; i < total; i++ {
+					wait.Add(1)
+					go func(i int) {
+						defer wait.Done()
+						if i%10 == 0 {
+							// Concurrent compactions must not lose appends.
+							err := j.Compact(ctx, func(ctx context.Context, records []int) ([]int, error) {
+								return records, nil
+							})
+							if err != nil {
+								t.Error(err)
+							}
+						}
+						if _, err := j.Append(ctx, &i); err != nil {
+							t.Error(err)
+						}
+					}(i)
+				}
+				wait.Wait()
+
+				got, _ := replay(t, j, 0)
+				if len(got) != total {
+					t.Fatalf("expected %d records, got %d", total, len(got))
+				}
+			})
+
+			t.Run("ConcurrentReplay", func(t *testing.T) {
+				j := NewJournal(store, filepath.Join(t.TempDir(), "journal"), 0666)
+
+				const total = 200
+				done := make(chan error, 1)
+				go func() {
+					for i := 0; i < total; i++ {
+						v := i
+						if _, err := j.Append(ctx, &v); err != nil {
+							done <- err
+							return
+						}
+					}
+					done <- nil
+				}()
+
+				// Replays must only ever see an intact prefix of the
+				// records, however they interleave with appends.
+				var last int64
+				for finished := false; !finished; {
+					select {
+					case err := <-done:
+						if err != nil {
+							t.Fatal(err)
+						}
+						finished = true
+					default:
+					}
+					got, size := replay(t, j, 0)
+					for i, v := range got {
+						if v != i {
+							t.Fatalf("expected record %d to be %d, got %d", i, i, v)
+						}
+					}
+					if size < last {
+						t.Fatalf("expected size to be at least %d, got %d", last, size)
+					}
+					last = size
+				}
+				got, _ := replay(t, j, 0)
+				if len(got) != total {
+					t.Fatalf("expected %d records, got %d", total, len(got))
+				}
+			})
+
+			t.Run("Compact", func(t *testing.T) {
+				j := NewJournal(store, filepath.Join(t.TempDir(), "journal"), 0666)
+
+				for i := 1; i <= 5; i++ {
+					v := i
+					if _, err := j.Append(ctx, &v); err != nil {
+						t.Fatal(err)
+					}
+				}
+				err := j.Compact(ctx, func(ctx context.Context, records []int) ([]int, error) {
+					sum := 0
+					for _, v := range records {
+						sum += v
+					}
+					return []int{sum}, nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				v := 6
+				if _, err := j.Append(ctx, &v); err != nil {
+					t.Fatal(err)
+				}
+				got, _ := replay(t, j, 0)
+				expect(t, got, 15, 6)
+			})
+		})
+	}
+}
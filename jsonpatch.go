@@ -0,0 +1,413 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidPatch is matched by the errors returned by ApplyPatch when
+	// the patch is malformed, or does not apply to the document.
+	ErrInvalidPatch = errors.New("invalid patch")
+
+	// ErrPatchTest is matched by the errors returned by ApplyPatch when a
+	// test operation of a JSON Patch fails.
+	ErrPatchTest = errors.New("patch test failed")
+)
+
+// ApplyPatch applies the specified patch to the value in the file at path,
+// which gets created with the specified mode if it does not exist. The patch
+// is either a JSON Patch, as specified by RFC 6902, if it is a JSON array, or
+// a JSON Merge Patch, as specified by RFC 7386, otherwise. Either way, the
+// patch applies atomically: if any of its operations fails, the file is left
+// untouched.
+//
+// The patch applies to the JSON encoding of the value, which lets programs
+// modify values without knowing their type, including programs written in
+// other languages. This is mostly meant for stores using encoding/json as
+// their codec, but works with any codec as long as T round-trips through
+// encoding/json without losing anything.
+//
+// Like LoadAndStore, ApplyPatch applies the patch again to the new contents
+// of the file if it changed concurrently.
+func (store *Store[T]) ApplyPatch(ctx context.Context, path string, mode os.FileMode, patch []byte) (err error) {
+	ctx, span := store.startSpan(ctx, "ApplyPatch", path)
+	defer func() { endSpan(span, err) }()
+
+	var apply func(doc any) (any, error)
+	if bytes.HasPrefix(bytes.TrimLeft(patch, " \t\r\n"), []byte("[")) {
+		var ops []jsonPatchOp
+		if err := decodeJSON(patch, &ops); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		apply = func(doc any) (any, error) { return applyJSONPatch(doc, ops) }
+	} else {
+		var merge any
+		if err := decodeJSON(patch, &merge); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		apply = func(doc any) (any, error) { return applyMergePatch(doc, jsonCopy(merge)), nil }
+	}
+
+	return store.LoadAndStore(ctx, path, mode, func(ctx context.Context, val *T, err error) error {
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		b, err := json.Marshal(val)
+		if err != nil {
+			return err
+		}
+		var doc any
+		if err := decodeJSON(b, &doc); err != nil {
+			return err
+		}
+		if doc, err = apply(doc); err != nil {
+			return err
+		}
+		if b, err = json.Marshal(doc); err != nil {
+			return err
+		}
+		var patched T
+		if err := json.Unmarshal(b, &patched); err != nil {
+			return err
+		}
+		*val = patched
+		return nil
+	})
+}
+
+// decodeJSON decodes b into v, keeping numbers as they are.
+func decodeJSON(b []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// applyMergePatch applies the JSON Merge Patch patch to doc.
+func applyMergePatch(doc, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	obj, ok := doc.(map[string]any)
+	if !ok {
+		obj = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(obj, k)
+		} else {
+			obj[k] = applyMergePatch(obj[k], v)
+		}
+	}
+	return obj
+}
+
+// jsonPatchOp is an operation of a JSON Patch.
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch applies the operations of a JSON Patch to doc.
+func applyJSONPatch(doc any, ops []jsonPatchOp) (any, error) {
+	for _, op := range ops {
+		var err error
+		doc, err = op.apply(doc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+func (op *jsonPatchOp) apply(doc any) (any, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, op.error(err)
+	}
+
+	var value any
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, op.error(errors.New("missing value"))
+		}
+		if err := decodeJSON(op.Value, &value); err != nil {
+			return nil, op.error(err)
+		}
+	case "move", "copy":
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, op.error(err)
+		}
+		if value, err = jsonGet(doc, from); err != nil {
+			return nil, op.error(err)
+		}
+		if op.Op == "copy" {
+			value = jsonCopy(value)
+			break
+		}
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, op.error(errors.New("cannot move a value into itself"))
+		}
+		if doc, err = jsonRemove(doc, from); err != nil {
+			return nil, op.error(err)
+		}
+	case "remove":
+	default:
+		return nil, op.error(errors.New("unknown operation"))
+	}
+
+	switch op.Op {
+	case "add", "move", "copy":
+		doc, err = jsonAdd(doc, path, value)
+	case "remove":
+		doc, err = jsonRemove(doc, path)
+	case "replace":
+		if _, err = jsonGet(doc, path); err == nil {
+			doc, err = jsonSet(doc, path, value)
+		}
+	case "test":
+		var current any
+		if current, err = jsonGet(doc, path); err == nil && !jsonEqual(current, value) {
+			return nil, fmt.Errorf("%w: %q", ErrPatchTest, op.Path)
+		}
+	}
+	if err != nil {
+		return nil, op.error(err)
+	}
+	return doc, nil
+}
+
+func (op *jsonPatchOp) error(err error) error {
+	return fmt.Errorf("%w: %s %q: %v", ErrInvalidPatch, op.Op, op.Path, err)
+}
+
+// parseJSONPointer returns the reference tokens of the JSON pointer p.
+func parseJSONPointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if p[0] != '/' {
+		return nil, errors.New("pointer does not start with /")
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// jsonIndex parses the array index token of an array of n elements.
+func jsonIndex(token string, n int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || strconv.Itoa(i) != token {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if i >= n {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+// jsonChild returns the member of doc referenced by token.
+func jsonChild(doc any, token string) (any, error) {
+	switch d := doc.(type) {
+	case map[string]any:
+		v, ok := d[token]
+		if !ok {
+			return nil, fmt.Errorf("no member %q", token)
+		}
+		return v, nil
+	case []any:
+		i, err := jsonIndex(token, len(d))
+		if err != nil {
+			return nil, err
+		}
+		return d[i], nil
+	}
+	return nil, fmt.Errorf("cannot reference %q in a scalar", token)
+}
+
+// jsonGet returns the value of doc at the pointer made of tokens.
+func jsonGet(doc any, tokens []string) (any, error) {
+	for _, token := range tokens {
+		var err error
+		if doc, err = jsonChild(doc, token); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// jsonEdit calls fn with the parent of the value of doc at the pointer made of
+// tokens, which must not be empty, and the last token, and returns doc with
+// that parent replaced by the result of fn.
+func jsonEdit(doc any, tokens []string, fn func(parent any, token string) (any, error)) (any, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+	child, err := jsonChild(doc, tokens[0])
+	if err != nil {
+		return nil, err
+	}
+	if child, err = jsonEdit(child, tokens[1:], fn); err != nil {
+		return nil, err
+	}
+	switch d := doc.(type) {
+	case map[string]any:
+		d[tokens[0]] = child
+	case []any:
+		i, _ := jsonIndex(tokens[0], len(d))
+		d[i] = child
+	}
+	return doc, nil
+}
+
+// jsonAdd adds value to doc at the pointer made of tokens.
+func jsonAdd(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return jsonEdit(doc, tokens, func(parent any, token string) (any, error) {
+		switch p := parent.(type) {
+		case map[string]any:
+			p[token] = value
+			return p, nil
+		case []any:
+			if token == "-" {
+				return append(p, value), nil
+			}
+			i, err := jsonIndex(token, len(p)+1)
+			if err != nil {
+				return nil, err
+			}
+			p = append(p, nil)
+			copy(p[i+1:], p[i:])
+			p[i] = value
+			return p, nil
+		}
+		return nil, fmt.Errorf("cannot add %q to a scalar", token)
+	})
+}
+
+// jsonSet replaces the value of doc at the pointer made of tokens, which must
+// exist, with value.
+func jsonSet(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return jsonEdit(doc, tokens, func(parent any, token string) (any, error) {
+		switch p := parent.(type) {
+		case map[string]any:
+			p[token] = value
+		case []any:
+			i, err := jsonIndex(token, len(p))
+			if err != nil {
+				return nil, err
+			}
+			p[i] = value
+		}
+		return parent, nil
+	})
+}
+
+// jsonRemove removes the value of doc at the pointer made of tokens.
+func jsonRemove(doc any, tokens []string) (any, error) {
+	if len(tokens) == 0 {
+		return nil, errors.New("cannot remove the whole document")
+	}
+	return jsonEdit(doc, tokens, func(parent any, token string) (any, error) {
+		switch p := parent.(type) {
+		case map[string]any:
+			if _, ok := p[token]; !ok {
+				return nil, fmt.Errorf("no member %q", token)
+			}
+			delete(p, token)
+			return p, nil
+		case []any:
+			i, err := jsonIndex(token, len(p))
+			if err != nil {
+				return nil, err
+			}
+			return append(p[:i], p[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("cannot remove %q from a scalar", token)
+	})
+}
+
+// jsonEqual returns whether the decoded JSON values a and b are equal, with
+// numbers compared by value.
+func jsonEqual(a, b any) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fa, erra := a.Float64()
+		fb, errb := b.Float64()
+		if erra != nil || errb != nil {
+			return a == b
+		}
+		return fa == fb
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, va := range a {
+			vb, ok := b[k]
+			if !ok || !jsonEqual(va, vb) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// jsonCopy returns a deep copy of the decoded JSON value v.
+func jsonCopy(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(v))
+		for k, e := range v {
+			c[k] = jsonCopy(e)
+		}
+		return c
+	case []any:
+		c := make([]any, len(v))
+		for i, e := range v {
+			c[i] = jsonCopy(e)
+		}
+		return c
+	}
+	return v
+}
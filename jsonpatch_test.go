@@ -0,0 +1,106 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestApplyPatch(t *testing.T) {
+	ctx := context.Background()
+
+	type Config struct {
+		Name  string            `json:"name"`
+		Port  int               `json:"port"`
+		Hosts []string          `json:"hosts"`
+		Tags  map[string]string `json:"tags"`
+	}
+	initial := Config{Name: "api", Port: 80, Hosts: []string{"a", "c"}, Tags: map[string]string{"env": "prod", "team": "infra"}}
+
+	setup := func(t *testing.T) (*Store[Config], string) {
+		store := New[Config](json.NewEncoder, json.NewDecoder)
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := store.ForceStore(ctx, path, 0666, &initial); err != nil {
+			t.Fatal(err)
+		}
+		return store, path
+	}
+	load := func(t *testing.T, store *Store[Config], path string) Config {
+		var val Config
+		if _, err := store.Load(ctx, path, &val); err != nil {
+			t.Fatal(err)
+		}
+		return val
+	}
+
+	t.Run("MergePatch", func(t *testing.T) {
+		store, path := setup(t)
+		patch := `{"port": 8080, "tags": {"team": null, "tier": "1"}}`
+		if err := store.ApplyPatch(ctx, path, 0666, []byte(patch)); err != nil {
+			t.Fatal(err)
+		}
+		expected := Config{Name: "api", Port: 8080, Hosts: []string{"a", "c"}, Tags: map[string]string{"env": "prod", "tier": "1"}}
+		if val := load(t, store, path); !reflect.DeepEqual(val, expected) {
+			t.Fatalf("expected %+v, got %+v", expected, val)
+		}
+	})
+
+	t.Run("JSONPatch", func(t *testing.T) {
+		store, path := setup(t)
+		patch := `[
+			{"op": "test", "path": "/port", "value": 80.0},
+			{"op": "replace", "path": "/port", "value": 8080},
+			{"op": "add", "path": "/hosts/1", "value": "b"},
+			{"op": "add", "path": "/hosts/-", "value": "d"},
+			{"op": "remove", "path": "/tags/team"},
+			{"op": "copy", "from": "/tags/env", "path": "/tags/a~1b"},
+			{"op": "move", "from": "/hosts/0", "path": "/name"}
+		]`
+		if err := store.ApplyPatch(ctx, path, 0666, []byte(patch)); err != nil {
+			t.Fatal(err)
+		}
+		expected := Config{Name: "a", Port: 8080, Hosts: []string{"b", "c", "d"}, Tags: map[string]string{"env": "prod", "a/b": "prod"}}
+		if val := load(t, store, path); !reflect.DeepEqual(val, expected) {
+			t.Fatalf("expected %+v, got %+v", expected, val)
+		}
+	})
+
+	t.Run("Test", func(t *testing.T) {
+		store, path := setup(t)
+		patch := `[
+			{"op": "replace", "path": "/port", "value": 8080},
+			{"op": "test", "path": "/name", "value": "web"}
+		]`
+		if err := store.ApplyPatch(ctx, path, 0666, []byte(patch)); !errors.Is(err, ErrPatchTest) {
+			t.Fatalf("expected %v, got %v", ErrPatchTest, err)
+		}
+		if val := load(t, store, path); !reflect.DeepEqual(val, initial) {
+			t.Fatalf("expected the file to be left untouched, got %+v", val)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		store, path := setup(t)
+		for _, patch := range []string{
+			`{"port":`,
+			`[{"op": "remove", "path": "/tags/missing"}]`,
+			`[{"op": "add", "path": "/hosts/5", "value": "x"}]`,
+			`[{"op": "replace", "path": "port", "value": 1}]`,
+			`[{"op": "move", "from": "/tags", "path": "/tags/x"}]`,
+			`[{"op": "frobnicate", "path": "/port"}]`,
+		} {
+			if err := store.ApplyPatch(ctx, path, 0666, []byte(patch)); !errors.Is(err, ErrInvalidPatch) {
+				t.Errorf("%s: expected %v, got %v", patch, ErrInvalidPatch, err)
+			}
+		}
+	})
+}
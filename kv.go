@@ -0,0 +1,183 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidKey is returned by KV operations when called with an empty key.
+var ErrInvalidKey = errors.New("invalid key")
+
+// A KV represents a collection of values of type T indexed by string keys,
+// where each value is stored atomically into its own file under a root
+// directory.
+//
+// Each key is managed independently with the same locking and
+// compare-and-swap machinery as Store, which means that concurrent accesses
+// to different keys never contend with one another.
+//
+// Keys are escaped before being mapped to file names, so that any string
+// can safely be used as a key. Only lowercase ASCII letters, digits, '-'
+// and '_' are kept as-is; every other byte is percent-encoded, so that
+// keys never collide on case-insensitive filesystems nor with the lock
+// files of other keys.
+type KV[T any] struct {
+	store *Store[T]
+	root  string
+	mode  os.FileMode
+}
+
+// NewKV returns a KV that stores its values with the specified store in the
+// root directory, creating files with the specified mode.
+//
+// The root directory must exist.
+func NewKV[T any](store *Store[T], root string, mode os.FileMode) *KV[T] {
+	return &KV[T]{
+		store: store,
+		root:  root,
+		mode:  mode,
+	}
+}
+
+func (kv *KV[T]) path(key string) (string, error) {
+	if key == "" {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(kv.root, escapeKey(key)), nil
+}
+
+// Get loads the value of the specified key into v.
+//
+// If the key does not exist, Get returns an error wrapping os.ErrNotExist.
+func (kv *KV[T]) Get(ctx context.Context, key string, v *T) error {
+	path, err := kv.path(key)
+	if err != nil {
+		return err
+	}
+	_, err = kv.store.Load(ctx, path, v)
+	return err
+}
+
+// Set unconditionally sets the value of the specified key to v.
+func (kv *KV[T]) Set(ctx context.Context, key string, v *T) error {
+	path, err := kv.path(key)
+	if err != nil {
+		return err
+	}
+	return kv.store.ForceStore(ctx, path, kv.mode, v)
+}
+
+// Update atomically updates the value of the specified key, with the same
+// semantics as LoadAndStore.
+func (kv *KV[T]) Update(ctx context.Context, key string, fn LoadAndStoreFunc[T]) error {
+	path, err := kv.path(key)
+	if err != nil {
+		return err
+	}
+	return kv.store.LoadAndStore(ctx, path, kv.mode, fn)
+}
+
+// Delete removes the specified key.
+//
+// If the key does not exist, Delete returns an error wrapping os.ErrNotExist.
+func (kv *KV[T]) Delete(ctx context.Context, key string) error {
+	path, err := kv.path(key)
+	if err != nil {
+		return err
+	}
+	err = ErrRetry
+	for err == ErrRetry {
+		err = kv.store.remove(ctx, path, nil, true)
+	}
+	return err
+}
+
+// Range calls fn sequentially for each key and value present in the KV.
+// If fn returns false, Range stops the iteration.
+//
+// Range does not correspond to a consistent snapshot of the KV; keys that
+// get deleted while Range is in progress are skipped.
+func (kv *KV[T]) Range(ctx context.Context, fn func(key string, val *T) bool) error {
+	entries, err := kv.store.fs().ReadDir(kv.root)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		key, ok := unescapeKey(entry.Name())
+		if !ok {
+			// Not a key; most likely a lock file.
+			continue
+		}
+
+		var val T
+		if _, err := kv.store.Load(ctx, filepath.Join(kv.root, entry.Name()), &val); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		if !fn(key, &val) {
+			break
+		}
+	}
+	return nil
+}
+
+func keyByteIsSafe(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+}
+
+func escapeKey(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if keyByteIsSafe(c) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func unescapeKey(name string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case keyByteIsSafe(c):
+			b.WriteByte(c)
+		case c == '%' && i+2 < len(name) && isUpperHex(name[i+1]) && isUpperHex(name[i+2]):
+			b.WriteByte(unhex(name[i+1])<<4 | unhex(name[i+2]))
+			i += 2
+		default:
+			return "", false
+		}
+	}
+	return b.String(), name != ""
+}
+
+func isUpperHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'A' && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	if c >= 'A' {
+		return c - 'A' + 10
+	}
+	return c - '0'
+}
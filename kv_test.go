@@ -0,0 +1,123 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestKV(t *testing.T) {
+
+	kv := NewKV(New[int](json.NewEncoder, json.NewDecoder), t.TempDir(), 0666)
+	ctx := context.Background()
+
+	keys := []string{"simple", "with/slash", "../escape", "UPPER", "a.lock", "100%"}
+
+	t.Run("SetGet", func(t *testing.T) {
+		for i, key := range keys {
+			val := i
+			if err := kv.Set(ctx, key, &val); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i, key := range keys {
+			var val int
+			if err := kv.Get(ctx, key, &val); err != nil {
+				t.Fatal(err)
+			}
+			if val != i {
+				t.Fatalf("expected %q to be %d, got %d", key, i, val)
+			}
+		}
+
+		var val int
+		if err := kv.Get(ctx, "missing", &val); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected ErrNotExist, got %v", err)
+		}
+		if err := kv.Set(ctx, "", &val); err != ErrInvalidKey {
+			t.Fatalf("expected ErrInvalidKey, got %v", err)
+		}
+	})
+
+	t.Run("Range", func(t *testing.T) {
+		var got []string
+		err := kv.Range(ctx, func(key string, val *int) bool {
+			got = append(got, key)
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := append([]string(nil), keys...)
+		sort.Strings(expected)
+		sort.Strings(got)
+		if len(got) != len(expected) {
+			t.Fatalf("expected keys %q, got %q", expected, got)
+		}
+		for i := range expected {
+			if got[i] != expected[i] {
+				t.Fatalf("expected keys %q, got %q", expected, got)
+			}
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		const total = 100
+
+		var wait sync.WaitGroup
+		for i := 0; i < total; i++ {
+			wait.Add(1)
+			go func(key string) {
+				defer wait.Done()
+				err := kv.Update(ctx, key, func(ctx context.Context, val *int, err error) error {
+					*val++
+					return nil
+				})
+				if err != nil {
+					t.Error(err)
+				}
+			}(keys[i%2])
+		}
+		wait.Wait()
+
+		for i, key := range keys[:2] {
+			var val int
+			if err := kv.Get(ctx, key, &val); err != nil {
+				t.Fatal(err)
+			}
+			if val != i+total/2 {
+				t.Fatalf("expected %q to be %d, got %d", key, i+total/2, val)
+			}
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		for _, key := range keys {
+			if err := kv.Delete(ctx, key); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := kv.Delete(ctx, keys[0]); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected ErrNotExist, got %v", err)
+		}
+
+		entries, err := os.ReadDir(kv.root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 0 {
+			t.Fatalf("expected the root directory to be empty, got %v", entries)
+		}
+	})
+}
@@ -0,0 +1,221 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrLeaseLost is matched by the errors returned by Lease.Err once a lease
+// could not be renewed, either because it expired before its renewal, or
+// because another process took over the lock file, for instance after
+// breaking it with BreakStale.
+var ErrLeaseLost = errors.New("lease lost")
+
+// A Lease is an exclusive lock on the lock file of a path that expires unless
+// it keeps being renewed, as obtained with AcquireLease.
+//
+// Leases record a LockInfo whose Expires field tells when they expire into the
+// lock file, and renew it in the background. This makes them usable where the
+// locks of the operating system cannot be trusted, such as on network or FUSE
+// file systems that lose track of locks, or drop them with their clients:
+// AcquireLease waits for leases that remain recorded and unexpired even if
+// the lock file can be locked, and BreakStale breaks expired ones.
+type Lease struct {
+	b    Backend
+	f    File
+	info LockInfo
+	ttl  time.Duration
+
+	done    chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
+
+	mu  sync.Mutex
+	err error
+
+	release    sync.Once
+	releaseErr error
+}
+
+// AcquireLease acquires a lease on the lock file of the file at path, which
+// expires after ttl unless renewed, and which gets renewed every third of ttl
+// until released.
+//
+// Stores writing to path only wait for the lease to be released as long as
+// the lease holds the system lock of the lock file: unlike AcquireLease, they
+// do not check the recorded lease. Where system locks cannot be trusted, all
+// the writers of path must therefore hold a lease.
+//
+// If the lock file records the lease of another holder that has not expired
+// yet, AcquireLease waits for it to expire, unless that holder is known to be
+// gone, as reported by LockInfo.Stale.
+//
+// Holders of long-running critical sections should abort them once the
+// channel returned by Done is closed, which means that the lease was lost.
+func (store *Store[T]) AcquireLease(ctx context.Context, path string, ttl time.Duration) (l *Lease, err error) {
+	ctx, span := store.startSpan(ctx, "AcquireLease", path)
+	defer func() { endSpan(span, err) }()
+
+	if ttl <= 0 {
+		return nil, &os.PathError{Op: "lease", Path: path, Err: os.ErrInvalid}
+	}
+
+	b := store.fs()
+	lockPath := store.lockPath(path)
+	for {
+		f, err := store.open(lockPath, os.O_RDWR|os.O_CREATE, 0666)
+		if err != nil {
+			return nil, err
+		}
+		_, err = store.lockAndVerify(ctx, f, path, nil, true)
+		if err == ErrRetry {
+			closeFile(f)
+			continue
+		}
+		if err != nil {
+			closeFile(f)
+			return nil, err
+		}
+
+		// We hold the lock, but so might the holder of a lease that has
+		// not expired yet if locks are not to be trusted.
+		prev, err := readLockInfo(f)
+		if err == nil && !prev.Expires.IsZero() && !prev.Stale() {
+			closeFile(f)
+			timer := time.NewTimer(time.Until(prev.Expires))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+			continue
+		}
+
+		info := newLockInfo(store.opts.lockLabel)
+		info.Expires = info.Acquired.Add(ttl)
+		if _, err := writeLockInfo(f, info); err != nil {
+			closeFile(f)
+			return nil, err
+		}
+
+		l = &Lease{
+			b:       b,
+			f:       f,
+			info:    info,
+			ttl:     ttl,
+			done:    make(chan struct{}),
+			stop:    make(chan struct{}),
+			stopped: make(chan struct{}),
+		}
+		go l.renew()
+		return l, nil
+	}
+}
+
+// Done returns a channel that gets closed once the lease is lost or released.
+func (l *Lease) Done() <-chan struct{} {
+	return l.done
+}
+
+// Err returns nil while the lease is held, or once it was released. After
+// the lease was lost, it returns an error wrapping ErrLeaseLost, or the error
+// that prevented renewing the lease.
+func (l *Lease) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Release releases the lease. It returns the same error as Err if the lease
+// was lost before, which tells that another holder might have acquired it in
+// the meantime.
+func (l *Lease) Release() error {
+	l.release.Do(func() {
+		close(l.stop)
+		<-l.stopped
+
+		err := l.Err()
+		if err == nil {
+			// Clear the lease, so that the next holder does not wait for
+			// it to expire.
+			err = l.f.Truncate(0)
+		}
+		if cerr := closeFile(l.f); err == nil {
+			err = cerr
+		}
+		select {
+		case <-l.done:
+		default:
+			close(l.done)
+		}
+		l.releaseErr = err
+	})
+	return l.releaseErr
+}
+
+// renew renews the lease until it gets released or lost.
+func (l *Lease) renew() {
+	defer close(l.stopped)
+
+	interval := l.ttl / 3
+	if interval <= 0 {
+		interval = l.ttl
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		if err := l.renewOnce(); err != nil {
+			l.mu.Lock()
+			l.err = &os.PathError{Op: "renew", Path: l.f.Name(), Err: err}
+			l.mu.Unlock()
+			close(l.done)
+			return
+		}
+	}
+}
+
+// renewOnce extends the expiration of the lease, after verifying that it
+// did not expire yet, and that the lock file still records it.
+func (l *Lease) renewOnce() error {
+	if time.Now().After(l.info.Expires) {
+		return ErrLeaseLost
+	}
+	if _, ko, err := deleted(l.b, l.f); ko {
+		if err == nil {
+			err = ErrLeaseLost
+		}
+		return err
+	}
+	cur, err := readLockInfo(l.f)
+	switch {
+	case errors.Is(err, ErrNoLockInfo):
+		return ErrLeaseLost
+	case err != nil:
+		return err
+	case cur.Hostname != l.info.Hostname || cur.PID != l.info.PID || !cur.Acquired.Equal(l.info.Acquired):
+		return ErrLeaseLost
+	}
+
+	info := l.info
+	info.Expires = time.Now().Add(l.ttl)
+	if _, err := writeLockInfo(l.f, info); err != nil {
+		return err
+	}
+	l.info = info
+	return nil
+}
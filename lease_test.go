@@ -0,0 +1,141 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLease(t *testing.T) {
+	ctx := context.Background()
+	store := New[int](json.NewEncoder, json.NewDecoder, WithStableLockFile(), WithLockInfo("lease"))
+
+	t.Run("Exclusive", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "leader")
+
+		l, err := store.AcquireLease(ctx, path, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if _, err := store.AcquireLease(tctx, path, time.Second); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the lease to be held, got %v", err)
+		}
+
+		if err := l.Release(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-l.Done():
+		default:
+			t.Fatal("expected Done to be closed after Release")
+		}
+		if _, err := store.ReadLockInfo(path); !errors.Is(err, ErrNoLockInfo) {
+			t.Fatalf("expected the lease to be cleared, got %v", err)
+		}
+
+		l, err = store.AcquireLease(ctx, path, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := l.Release(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Renewal", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "leader")
+
+		l, err := store.AcquireLease(ctx, path, 100*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Release()
+
+		time.Sleep(300 * time.Millisecond)
+		if err := l.Err(); err != nil {
+			t.Fatal(err)
+		}
+		info, err := store.ReadLockInfo(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Label != "lease" || !info.Expires.After(time.Now()) {
+			t.Fatalf("expected an unexpired lease, got %+v", info)
+		}
+	})
+
+	t.Run("Lost", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "leader")
+
+		l, err := store.AcquireLease(ctx, path, 30*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Removing the lock file is what BreakStale does.
+		if err := os.Remove(path + ".lockfile"); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-l.Done():
+		case <-time.After(time.Second):
+			t.Fatal("expected the lease to be lost")
+		}
+		if err := l.Err(); !errors.Is(err, ErrLeaseLost) {
+			t.Fatalf("expected %v, got %v", ErrLeaseLost, err)
+		}
+		if err := l.Release(); !errors.Is(err, ErrLeaseLost) {
+			t.Fatalf("expected %v, got %v", ErrLeaseLost, err)
+		}
+	})
+
+	t.Run("Unexpired", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "leader")
+
+		// Record the lease of a remote holder whose lock got lost, which
+		// must be waited for even though the lock file is not locked.
+		info := newLockInfo("remote")
+		info.Hostname = "elsewhere"
+		info.Expires = time.Now().Add(50 * time.Millisecond)
+		if _, err := store.ReadLockInfo(path); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected no lock file, got %v", err)
+		}
+		f, err := os.Create(path + ".lockfile")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = writeLockInfo(f, info)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		l, err := store.AcquireLease(ctx, path, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Release()
+		if time.Now().Before(info.Expires) {
+			t.Fatal("expected AcquireLease to wait for the remote lease to expire")
+		}
+	})
+
+	t.Run("InvalidTTL", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "leader")
+		if _, err := store.AcquireLease(ctx, path, 0); !errors.Is(err, os.ErrInvalid) {
+			t.Fatalf("expected %v, got %v", os.ErrInvalid, err)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// LoadFS reads the contents of the named file of fsys and unmarshals it into
+// v, with the same decoder and transformations as Load. This allows loading
+// values from an embed.FS, a zip archive or an fstest.MapFS.
+//
+// Files of file systems that are known to be read-only are read without
+// locking them. Files that fsys opens as *os.File, as os.DirFS does, may be
+// written to concurrently by other stores, so LoadFS holds their shared lock
+// while reading them, like Load.
+//
+// Values of an older schema version are migrated in memory, but never written
+// back to fsys.
+func (store *Store[T]) LoadFS(ctx context.Context, fsys fs.FS, name string, v *T) (err error) {
+	ctx, span := store.startSpan(ctx, "LoadFS", name)
+	defer func() { endSpan(span, err) }()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+
+	if osf, ok := f.(*os.File); ok {
+		defer closeLocked(osf)
+
+		var start time.Time
+		if span != nil {
+			start = time.Now()
+		}
+		if err := store.opts.lockStyle.RLock(ctx, osf); err != nil {
+			return err
+		}
+		traceLockWait(span, start)
+	} else {
+		defer f.Close()
+	}
+
+	return store.decode(f, name, v)
+}
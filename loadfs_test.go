@@ -0,0 +1,94 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoadFS(t *testing.T) {
+	type Test struct {
+		Example string
+	}
+
+	ctx := context.Background()
+
+	fsys := fstest.MapFS{
+		"config/valid.json":     {Data: []byte(`{"Example":"embedded"}`)},
+		"config/malformed.json": {Data: []byte(`{"Example":`)},
+	}
+
+	t.Run("ReadOnly", func(t *testing.T) {
+		store := New[Test](json.NewEncoder, json.NewDecoder)
+
+		var val Test
+		if err := store.LoadFS(ctx, fsys, "config/valid.json", &val); err != nil {
+			t.Fatal(err)
+		}
+		if val.Example != "embedded" {
+			t.Fatalf("expected %q, got %q", "embedded", val.Example)
+		}
+
+		var derr *DecodeError
+		if err := store.LoadFS(ctx, fsys, "config/malformed.json", &val); !errors.As(err, &derr) {
+			t.Fatalf("expected a DecodeError, got %v", err)
+		}
+		if err := store.LoadFS(ctx, fsys, "config/missing.json", &val); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("expected ErrNotExist, got %v", err)
+		}
+	})
+
+	t.Run("Checksum", func(t *testing.T) {
+		dir := t.TempDir()
+		store := New[Test](json.NewEncoder, json.NewDecoder, WithChecksum())
+		if err := store.Store(ctx, filepath.Join(dir, "state.json"), 0666, &Test{Example: "summed"}, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		var val Test
+		if err := store.LoadFS(ctx, os.DirFS(dir), "state.json", &val); err != nil {
+			t.Fatal(err)
+		}
+		if val.Example != "summed" {
+			t.Fatalf("expected %q, got %q", "summed", val.Example)
+		}
+	})
+
+	t.Run("Locked", func(t *testing.T) {
+		dir := t.TempDir()
+		store := New[Test](json.NewEncoder, json.NewDecoder)
+		if err := store.Store(ctx, filepath.Join(dir, "state.json"), 0666, &Test{Example: "locked"}, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.Open(filepath.Join(dir, "state.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := Lock(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+
+		// Files of os.DirFS may be written to concurrently, so LoadFS
+		// must wait for the writer to release its lock.
+		timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		var val Test
+		if err := store.LoadFS(timeout, os.DirFS(dir), "state.json", &val); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected DeadlineExceeded, got %v", err)
+		}
+	})
+}
@@ -12,6 +12,8 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"sync/atomic"
+	"time"
 )
 
 var (
@@ -19,6 +21,14 @@ var (
 	errLockInterrupted = errors.New("lock was interrupted; not a user-facing error, report a bug if you see this")
 )
 
+// ErrLockStyleUnsupported is returned when locking a file with a LockStyle
+// that the system does not implement.
+var ErrLockStyleUnsupported = errors.New("lock style is not supported on this system")
+
+// ErrInterruptSignalInUse is returned by SetInterruptSignal when locks were
+// already interrupted with another signal.
+var ErrInterruptSignalInUse = errors.New("locks already get interrupted with another signal")
+
 // OSFile is an interface representing a file from which a file handle
 // may be obtained. *os.File implements it.
 type OSFile interface {
@@ -31,30 +41,140 @@ type lockFlag int
 const (
 	lockExcl lockFlag = 1 << iota
 	lockBlock
+	lockOFD
+	lockFcntl
+)
+
+// A LockStyle selects the kind of system locks used to lock files.
+//
+// The zero value is FlockLocks. Locks of different styles do not necessarily
+// exclude each other, so all processes accessing the same file must agree on
+// the style to use.
+type LockStyle int
+
+const (
+	// FlockLocks uses flock(2) locks on Unix-like systems, and LockFileEx on
+	// Windows. This is the default, and is used by the package-level
+	// functions.
+	//
+	// AIX and Solaris lack flock(2), so FlockLocks are the same as
+	// FcntlLocks there. On Plan 9, locks hold an exclusive-use file open
+	// next to the locked file, and shared locks exclude other processes.
+	FlockLocks LockStyle = iota
+
+	// OFDLocks uses open file description locks, i.e. fcntl(2) with
+	// F_OFD_SETLK and F_OFD_SETLKW. Like flock(2) locks, they are associated
+	// with the open file description rather than with the process, but
+	// converting between shared and exclusive locks is atomic, and they are
+	// enforced across clients on NFS.
+	//
+	// OFDLocks is only supported on Linux 3.15 and later.
+	OFDLocks
+
+	// FcntlLocks uses classic POSIX record locks, i.e. fcntl(2) with F_SETLK
+	// and F_SETLKW. Unlike flock(2) locks, they are enforced across clients
+	// on NFS, including NFSv3 through the NLM protocol.
+	//
+	// These locks are owned by the process, which means that the process
+	// must arbitrate between its own file descriptors: conflicting locks
+	// held through different files within the process exclude each other
+	// as with the other styles, but closing any file descriptor of a file
+	// releases all the locks the process holds on it. Files locked with
+	// FcntlLocks must therefore never be closed while another file of the
+	// process holds a lock on the same file; Store takes care of this for
+	// the files it opens.
+	//
+	// FcntlLocks is only supported on Unix-like systems.
+	FcntlLocks
 )
 
+func (style LockStyle) flags() lockFlag {
+	switch style {
+	case OFDLocks:
+		return lockOFD
+	case FcntlLocks:
+		return lockFcntl
+	default:
+		if systemEmulatesFlockLocks {
+			return lockFcntl
+		}
+		return 0
+	}
+}
+
+// Lock is like the package-level Lock function, but uses locks of the
+// specified style.
+func (style LockStyle) Lock(ctx context.Context, f OSFile) error {
+	return lockAcquired(ctx, f, true, wrapPathError("exclusive lock", f.Name(), interruptibleLock(ctx, f, style.flags()|lockExcl|lockBlock)))
+}
+
+// RLock is like the package-level RLock function, but uses locks of the
+// specified style.
+func (style LockStyle) RLock(ctx context.Context, f OSFile) error {
+	return lockAcquired(ctx, f, false, wrapPathError("shared lock", f.Name(), interruptibleLock(ctx, f, style.flags()|lockBlock)))
+}
+
+// TryLock is like the package-level TryLock function, but uses locks of the
+// specified style.
+func (style LockStyle) TryLock(f OSFile) error {
+	return lockAcquired(context.Background(), f, true, wrapPathError("exclusive lock (non-blocking)", f.Name(), interruptibleLock(context.Background(), f, style.flags()|lockExcl)))
+}
+
+// TryRLock is like the package-level TryRLock function, but uses locks of the
+// specified style.
+func (style LockStyle) TryRLock(f OSFile) error {
+	return lockAcquired(context.Background(), f, false, wrapPathError("shared lock (non-blocking)", f.Name(), interruptibleLock(context.Background(), f, style.flags())))
+}
+
+// Unlock is like the package-level Unlock function, but releases locks of the
+// specified style.
+func (style LockStyle) Unlock(f OSFile) error {
+	flags := style.flags()
+	if err := checkLockFlags(flags); err != nil {
+		return wrapPathError("unlock", f.Name(), err)
+	}
+	if (flags & lockFcntl) != 0 {
+		return lockReleased(f, wrapPathError("unlock", f.Name(), processUnlock(f)))
+	}
+	if !localLockHandOff(f) {
+		// f shares the system lock of another file of the process.
+		return lockReleased(f, nil)
+	}
+	return lockReleased(f, wrapPathError("unlock", f.Name(), unlock(f, flags)))
+}
+
+// checkLockFlags returns an error if the lock style selected by flags is
+// not supported on this system.
+func checkLockFlags(flags lockFlag) error {
+	if (flags&lockOFD) != 0 && !systemHasOFDLocks {
+		return ErrLockStyleUnsupported
+	}
+	if (flags&lockFcntl) != 0 && !systemHasFcntlLocks {
+		return ErrLockStyleUnsupported
+	}
+	return nil
+}
+
 // Lock acquires (or promotes an already acquired lock to) an exclusive lock,
 // i.e. a lock used for writing, on the specified file.
 //
 // Lock is not re-entrant. Calling Lock on an exclusive lock is a no-op.
 //
-// NOTE: On Windows, Lock always releases any lock that was previously held
-// when called. This means that callers must not assume that the lock is still
-// held if Lock returns with an error.
+// On Windows, promoting a shared lock keeps it held until the exclusive lock
+// is acquired, or if Lock fails. Since locks cannot be converted in place
+// there, Lock fails with an error if another handle of the same file is
+// promoting its shared lock at the same time, as neither promotion could
+// ever complete.
 func Lock(ctx context.Context, f OSFile) error {
-	return wrapPathError("exclusive lock", f.Name(), interruptibleLock(ctx, f, lockExcl|lockBlock))
+	return lockAcquired(ctx, f, true, wrapPathError("exclusive lock", f.Name(), interruptibleLock(ctx, f, FlockLocks.flags()|lockExcl|lockBlock)))
 }
 
 // RLock acquires (or demotes an already acquired lock to) a shared lock, i.e.
 // a lock used for reading, on the specified file.
 //
 // RLock is not re-entrant. Calling RLock on a shared lock is a no-op.
-//
-// NOTE: On Windows, RLock always releases any lock that was previously held
-// when called. This means that callers must not assume that the lock is still
-// held if RLock returns with an error.
 func RLock(ctx context.Context, f OSFile) error {
-	return wrapPathError("shared lock", f.Name(), interruptibleLock(ctx, f, lockBlock))
+	return lockAcquired(ctx, f, false, wrapPathError("shared lock", f.Name(), interruptibleLock(ctx, f, FlockLocks.flags()|lockBlock)))
 }
 
 // TryLock attempts to acquire (or promote an already acquired lock to) an exclusive lock,
@@ -62,23 +182,17 @@ func RLock(ctx context.Context, f OSFile) error {
 //
 // If the attempt would block, TryLock returns an error wrapping ErrWouldBlock.
 //
-// NOTE: On Windows, TryLock always releases any lock that was previously held
-// when called. This means that callers must not assume that the lock is still
-// held if TryLock returns with an error.
+// On Windows, TryLock keeps the shared lock that it fails to promote.
 func TryLock(f OSFile) error {
-	return wrapPathError("exclusive lock (non-blocking)", f.Name(), interruptibleLock(context.Background(), f, lockExcl))
+	return lockAcquired(context.Background(), f, true, wrapPathError("exclusive lock (non-blocking)", f.Name(), interruptibleLock(context.Background(), f, FlockLocks.flags()|lockExcl)))
 }
 
 // TryRLock attempts to acquire (or demote an already acquired lock to) a shared lock,
 // i.e. a lock used for reading.
 //
 // If the attempt would block, TryRLock returns an error wrapping ErrWouldBlock.
-//
-// NOTE: On Windows, TryRLock always releases any lock that was previously held
-// when called. This means that callers must not assume that the lock is still
-// held if TryRLock returns with an error.
 func TryRLock(f OSFile) error {
-	return wrapPathError("shared lock (non-blocking)", f.Name(), interruptibleLock(context.Background(), f, 0))
+	return lockAcquired(context.Background(), f, false, wrapPathError("shared lock (non-blocking)", f.Name(), interruptibleLock(context.Background(), f, FlockLocks.flags())))
 }
 
 // Unlock releases the lock on the specified file.
@@ -90,7 +204,85 @@ func TryRLock(f OSFile) error {
 // that the lock gets released automatically once all file descriptors are
 // closed.
 func Unlock(f OSFile) error {
-	return wrapPathError("unlock", f.Name(), unlock(f))
+	return FlockLocks.Unlock(f)
+}
+
+// CrossProcessLocking reports whether the locks of the package, and those
+// of stores using the files of the operating system, exclude other
+// processes. This is the case everywhere but on WebAssembly (js and wasip1),
+// where hosts offer no file locking: locks there only exclude the files of
+// the process from each other, and programs sharing stores between instances
+// must arrange for their exclusion by other means.
+func CrossProcessLocking() bool {
+	return systemHasCrossProcessLocks
+}
+
+// SetInterruptSignal sets the signal that interrupts the threads blocked on
+// locks when their context gets done, on Unix-like systems. The default is
+// SIGURG, which the Go runtime also uses to preempt goroutines.
+//
+// The first blocking lock disables SA_RESTART for the signal, until
+// RestoreSignalHandling reenables it, and the signal cannot change in the
+// meantime: SetInterruptSignal must be called before, typically from main,
+// and returns ErrInterruptSignalInUse otherwise. Programs that embed C
+// libraries installing their own handler for SIGURG should pick another
+// signal that the Go runtime ignores unless it is notified, such as a
+// real-time signal on Linux; signals that the program handles get delivered
+// spuriously.
+//
+// On other systems, SetInterruptSignal does nothing.
+func SetInterruptSignal(sig os.Signal) error {
+	return setInterruptSignal(sig)
+}
+
+// RestoreSignalHandling undoes the changes that the first blocking lock made
+// to the signal handlers of the process, i.e. reenables SA_RESTART for the
+// signal set by SetInterruptSignal, for programs that must not leave them
+// changed, such as shared libraries loaded into foreign processes before
+// they get unloaded. It waits for the blocking lock calls that may need the
+// signal to return. The next blocking lock changes the handlers again, unless
+// DisableSignalInterrupts was called, and SetInterruptSignal may pick another
+// signal in the meantime.
+//
+// On other systems than Unix-like ones, RestoreSignalHandling does nothing.
+func RestoreSignalHandling() error {
+	return restoreSignalHandling()
+}
+
+// signalInterruptsDisabled is set by DisableSignalInterrupts.
+var signalInterruptsDisabled atomic.Bool
+
+// DisableSignalInterrupts stops the package from interrupting the threads
+// blocked on locks with signals, for the lifetime of the process. Blocking
+// locks then wait in goroutines of their own, which the lock calls abandon
+// when their context gets done: each abandoned goroutine lingers until its
+// lock call returns, which may leave the file locked, so files whose lock
+// got canceled must be closed rather than locked again. In exchange, the
+// package never modifies the signal handlers of the process, which it
+// otherwise does on the first blocking lock; see SetInterruptSignal and
+// RestoreSignalHandling.
+//
+// DisableSignalInterrupts must be called before the first blocking lock to
+// leave the signal handlers untouched. It only matters on Unix-like systems.
+func DisableSignalInterrupts() {
+	signalInterruptsDisabled.Store(true)
+}
+
+// closeLocked closes a file on which a lock may be held, making sure that the
+// lock gets released on systems where closing the file is not enough.
+func closeLocked(f *os.File) error {
+	unregisterLock(f)
+	selfLockRelease(f)
+	systemLockForget(f)
+	localLockHandOff(f)
+	defer localLockRelease(f)
+	if !systemReleasesLocksOnClose {
+		_ = unlock(f, 0)
+	}
+	if processLocksHeld.Load() > 0 {
+		return processClose(f)
+	}
+	return f.Close()
 }
 
 func wrapSyscallError(op string, err error) error {
@@ -109,7 +301,23 @@ func wrapPathError(op, path string, err error) error {
 
 func interruptibleLock(ctx context.Context, f OSFile, flags lockFlag) error {
 
-	preLock(f, flags)
+	if err := checkLockFlags(flags); err != nil {
+		return err
+	}
+	return selfLockAcquire(f, flags, func() error {
+		switch {
+		case (flags & lockFcntl) != 0:
+			return processLockAcquire(ctx, f, flags)
+		case localLocksEnabled.Load():
+			return localLockAcquire(ctx, f, flags)
+		}
+		return systemLock(ctx, f, flags)
+	})
+}
+
+// systemLock acquires the system lock on f, interrupting the lock call if
+// the context gets done while it blocks.
+func systemLock(ctx context.Context, f OSFile, flags lockFlag) error {
 
 	select {
 	case <-ctx.Done():
@@ -117,45 +325,35 @@ func interruptibleLock(ctx context.Context, f OSFile, flags lockFlag) error {
 	default:
 	}
 
-	if !systemHasInterruptibleLocks {
+	if !systemHasBlockingLocks {
+		return pollLock(ctx, f, flags)
+	}
+
+	if systemHasContextLocks {
+		return lockContext(ctx, f, flags)
+	}
+
+	if !systemHasInterruptibleLocks || signalInterruptsDisabled.Load() {
 		return interruptibleLockFallback(ctx, f, flags)
 	}
 
 	if (flags & lockBlock) != 0 {
 		// If this call is blocking, we have to do extra work to handle the cancellation case.
+		//
+		// The lock is usually uncontended, so first try to take it without
+		// blocking, which saves pinning the thread and arming an interrupter.
+		switch err := lock(f, flags&^lockBlock); {
+		case err == nil:
+			return nil
+		case err != errLockInterrupted && !errors.Is(err, ErrWouldBlock):
+			return err
+		}
 
-		// This chan gets closed on function return later on
-		done := make(chan struct{})
-
-		// This chan gets closed when the cancel goroutine is done
-		canceldone := make(chan struct{})
-
-		// We _must_ start this goroutine out of the LockOSThread block, otherwise
-		// it'll just cancel itself in the go runtime, which panics
-		cancelchan := make(chan func() error, 1)
-		go func() {
-			cancelfn := <-cancelchan
-			defer close(canceldone)
-
-			select {
-			case <-done:
-			case <-ctx.Done():
-				// Double-check if we haven't already returned; we should only cancel
-				// should only be called when we're actually blocking on a lock.
-				select {
-				case <-done:
-					return
-				default:
-				}
-
-				err := cancelfn()
-				switch {
-				case err != nil:
-					panic(fmt.Errorf("Could not interrupt blocked lock call: %w", err))
-				}
-				return
-			}
-		}()
+		// We _must_ acquire the interrupter out of the LockOSThread block, since
+		// it may need to start its goroutine, and it would otherwise just cancel
+		// itself in the go runtime, which panics.
+		it := getInterrupter()
+		defer putInterrupter(it)
 
 		// Force the goroutine to stay on the same thread; this is necessary because
 		// we want to ensure the thread that executes the system call is the one
@@ -172,16 +370,13 @@ func interruptibleLock(ctx context.Context, f OSFile, flags lockFlag) error {
 		}
 		defer lockCloseThread(thread)
 
-		// Signal the cancel goroutine to no longer cancel the thread, and wait for it to
-		// exit _before_ unlocking the OS thread.
+		// Arm the interrupter for this thread. On return, signal it to no longer
+		// interrupt the thread, and wait for it to acknowledge _before_ unlocking
+		// the OS thread.
+		it.arm <- interruptRequest{ctx: ctx, thread: thread}
 		defer func() {
-			close(done)
-			<-canceldone
+			it.disarm <- struct{}{}
 		}()
-
-		cancelchan <- func() error {
-			return lockInterrupt(thread)
-		}
 	}
 
 	for {
@@ -202,17 +397,105 @@ func interruptibleLock(ctx context.Context, f OSFile, flags lockFlag) error {
 	}
 }
 
+// maxIdleInterrupters is the maximum number of idle interrupters kept around
+// for reuse by subsequent blocking lock calls.
+const maxIdleInterrupters = 16
+
+var idleInterrupters = make(chan *interrupter, maxIdleInterrupters)
+
+type interruptRequest struct {
+	ctx    context.Context
+	thread any
+}
+
+// An interrupter is a long-lived goroutine that interrupts a thread blocked
+// on a lock when the context of the lock call gets canceled.
+//
+// Interrupters are reused across lock calls, which saves the cost of starting
+// a goroutine and allocating its channels for every blocking lock call.
+type interrupter struct {
+	arm    chan interruptRequest
+	disarm chan struct{}
+}
+
+func getInterrupter() *interrupter {
+	select {
+	case it := <-idleInterrupters:
+		return it
+	default:
+	}
+
+	it := &interrupter{
+		arm:    make(chan interruptRequest),
+		disarm: make(chan struct{}),
+	}
+	go it.run()
+	return it
+}
+
+func putInterrupter(it *interrupter) {
+	select {
+	case idleInterrupters <- it:
+	default:
+		close(it.arm)
+	}
+}
+
+func (it *interrupter) run() {
+	for req := range it.arm {
+		select {
+		case <-it.disarm:
+			continue
+		case <-req.ctx.Done():
+		}
+
+		// Double-check if we haven't already returned; we should only interrupt
+		// the thread when we're actually blocking on a lock.
+		select {
+		case <-it.disarm:
+			continue
+		default:
+		}
+
+		if err := lockInterrupt(req.thread); err != nil {
+			panic(fmt.Errorf("Could not interrupt blocked lock call: %w", err))
+		}
+
+		// Wait for the lock call to acknowledge the interruption; until then,
+		// the thread must stay locked.
+		<-it.disarm
+	}
+}
+
 // interruptibleLockFallback falls back to a leaking goroutine approach
 // on systems that do not support lock interrupts. This isn't great, of course,
 // but allows the library to remain functional on these systems.
 func interruptibleLockFallback(ctx context.Context, f OSFile, flags lockFlag) error {
 	if (flags & lockBlock) == 0 {
-		return lock(f, flags)
+		// Signals may still interrupt non-blocking locks, which must then
+		// be retried like in systemLock rather than leak errLockInterrupted.
+		for {
+			err := lock(f, flags)
+			if err != errLockInterrupted {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+		}
 	}
 
 	done := make(chan error, 1)
 	go func() {
-		done <- lock(f, flags)
+		err := lock(f, flags)
+		// Signals interrupt the lock if SA_RESTART was disabled for them
+		// before signal interrupts got disabled.
+		for err == errLockInterrupted {
+			err = lock(f, flags)
+		}
+		done <- err
 	}()
 
 	select {
@@ -229,3 +512,33 @@ func interruptibleLockFallback(ctx context.Context, f OSFile, flags lockFlag) er
 		return err
 	}
 }
+
+// pollLock emulates blocking locks on systems that only support non-blocking
+// locks by retrying the lock with an exponential backoff until it either
+// succeeds or the context is done.
+func pollLock(ctx context.Context, f OSFile, flags lockFlag) error {
+	const (
+		minBackoff = time.Millisecond
+		maxBackoff = 100 * time.Millisecond
+	)
+
+	backoff := minBackoff
+	for {
+		err := lock(f, flags&^lockBlock)
+		if (flags&lockBlock) == 0 || !errors.Is(err, ErrWouldBlock) {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
@@ -0,0 +1,18 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build !windows
+// +build !windows
+
+package store
+
+import "context"
+
+const systemHasContextLocks = false
+
+func lockContext(ctx context.Context, f OSFile, flags lockFlag) error {
+	return lock(f, flags)
+}
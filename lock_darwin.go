@@ -15,14 +15,21 @@ import (
 
 var ErrWouldBlock = &likeError{Err: errWouldBlock, Like: unix.EWOULDBLOCK}
 
-// Darwin doesn't seem to provide a way to interrupt a lock properly; even if
-// were to send a Mach exception to the current Mach thread, this ends up not
-// playing well with the Go runtime, which isn't expecting this.
-const systemHasInterruptibleLocks = false
+const systemHasInterruptibleLocks = true
 
-func preLock(f OSFile, flags lockFlag) {}
+const (
+	systemHasBlockingLocks     = true
+	systemReleasesLocksOnClose = true
+	systemHasCrossProcessLocks = true
+)
+
+func systemLockForget(f OSFile) {}
 
 func lock(f OSFile, flags lockFlag) error {
+	if (flags & lockFcntl) != 0 {
+		return fcntlLock(f, flags)
+	}
+
 	var sysFlags int
 	if (flags & lockExcl) != 0 {
 		sysFlags |= unix.LOCK_EX
@@ -37,6 +44,9 @@ func lock(f OSFile, flags lockFlag) error {
 	switch {
 	case err == nil:
 		return nil
+	case err == unix.EINTR:
+		// See lock_unix.go; the caller retries unless its context is done.
+		return errLockInterrupted
 	case err == unix.EWOULDBLOCK:
 		return wrapSyscallError("flock", ErrWouldBlock)
 	default:
@@ -44,16 +54,29 @@ func lock(f OSFile, flags lockFlag) error {
 	}
 }
 
-func unlock(f OSFile) error {
+func unlock(f OSFile, flags lockFlag) error {
+	if (flags & lockFcntl) != 0 {
+		return fcntlUnlock(f)
+	}
 	return wrapSyscallError("flock", unix.Flock(int(f.Fd()), unix.LOCK_UN))
 }
 
+// Darwin has no tgkill, and its kill(2) only targets processes, so the thread
+// blocked on the lock gets interrupted with pthread_kill instead.
 func lockGetThread() (any, error) {
-	return nil, nil
+	sig, err := acquireInterruptSignal()
+	if err != nil {
+		return nil, err
+	}
+	thread := pthreadSelf()
+	return func() (uintptr, unix.Signal) { return thread, sig }, nil
 }
 
-func lockCloseThread(any) {}
+func lockCloseThread(any) {
+	releaseInterruptSignal()
+}
 
-func lockInterrupt(pidtid any) error {
-	return nil
+func lockInterrupt(thread any) error {
+	pthread, sig := thread.(func() (uintptr, unix.Signal))()
+	return pthreadKill(pthread, sig)
 }
@@ -0,0 +1,12 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build !unix
+// +build !unix
+
+package store
+
+const systemHasFcntlLocks = false
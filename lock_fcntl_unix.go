@@ -0,0 +1,76 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build unix
+// +build unix
+
+package store
+
+import (
+	"io"
+
+	"golang.org/x/sys/unix"
+)
+
+const systemHasFcntlLocks = true
+
+type fileID struct {
+	dev, ino uint64
+}
+
+// fileKey returns a key identifying the file underlying f.
+func fileKey(f OSFile) (any, error) {
+	var stat unix.Stat_t
+	if err := unix.Fstat(int(f.Fd()), &stat); err != nil {
+		return nil, wrapSyscallError("fstat", err)
+	}
+	return fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, nil
+}
+
+func fcntlLock(f OSFile, flags lockFlag) error {
+	return recordLock(f, flags, unix.F_SETLK, unix.F_SETLKW)
+}
+
+func fcntlUnlock(f OSFile) error {
+	return recordUnlock(f, unix.F_SETLK)
+}
+
+// recordLock locks the whole file f with fcntl(2), using the setlk or setlkw
+// command depending on whether the lock is blocking.
+func recordLock(f OSFile, flags lockFlag, setlk, setlkw int) error {
+	flk := unix.Flock_t{
+		Type:   unix.F_RDLCK,
+		Whence: io.SeekStart,
+	}
+	if (flags & lockExcl) != 0 {
+		flk.Type = unix.F_WRLCK
+	}
+	cmd := setlkw
+	if (flags & lockBlock) == 0 {
+		cmd = setlk
+	}
+
+	err := unix.FcntlFlock(f.Fd(), cmd, &flk)
+	switch {
+	case err == nil:
+		return nil
+	case err == unix.EINTR:
+		// See the flock(2) case in lock.
+		return errLockInterrupted
+	case err == unix.EAGAIN || err == unix.EACCES:
+		return wrapSyscallError("fcntl", ErrWouldBlock)
+	default:
+		return wrapSyscallError("fcntl", err)
+	}
+}
+
+func recordUnlock(f OSFile, setlk int) error {
+	flk := unix.Flock_t{
+		Type:   unix.F_UNLCK,
+		Whence: io.SeekStart,
+	}
+	return wrapSyscallError("fcntl", unix.FcntlFlock(f.Fd(), setlk, &flk))
+}
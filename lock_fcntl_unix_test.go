@@ -0,0 +1,147 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build unix
+// +build unix
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFcntlLocks(t *testing.T) {
+
+	openFiles := func(t *testing.T, name string, n int) []*os.File {
+		locks := makeLockfiles(t, filepath.Join(t.TempDir(), name), n)
+		files := make([]*os.File, n)
+		for i := range files {
+			files[i] = <-locks
+			if files[i] == nil {
+				t.FailNow()
+			}
+		}
+		return files
+	}
+
+	t.Run("Lock", func(t *testing.T) {
+		files := openFiles(t, "barney-ci-go-store-fcntl-test-1", 2)
+		f1, f2 := files[0], files[1]
+		defer closeLocked(f1)
+		defer closeLocked(f2)
+
+		// Locks held by the same process through different files must
+		// still exclude each other.
+		if err := FcntlLocks.Lock(context.Background(), f1); err != nil {
+			t.Fatal(err)
+		}
+		if err := FcntlLocks.TryRLock(f2); !errors.Is(err, ErrWouldBlock) {
+			t.Fatalf("expected TryRLock to fail with ErrWouldBlock, got %v", err)
+		}
+		if err := FcntlLocks.RLock(context.Background(), f1); err != nil {
+			t.Fatal(err)
+		}
+		if err := FcntlLocks.TryRLock(f2); err != nil {
+			t.Fatal(err)
+		}
+		if err := FcntlLocks.TryLock(f1); !errors.Is(err, ErrWouldBlock) {
+			t.Fatalf("expected TryLock to fail with ErrWouldBlock, got %v", err)
+		}
+		if err := FcntlLocks.Unlock(f2); err != nil {
+			t.Fatal(err)
+		}
+		if err := FcntlLocks.TryLock(f1); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Context", func(t *testing.T) {
+		files := openFiles(t, "barney-ci-go-store-fcntl-test-2", 2)
+		f1, f2 := files[0], files[1]
+		defer closeLocked(f1)
+		defer closeLocked(f2)
+
+		if err := FcntlLocks.Lock(context.Background(), f1); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, stop := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer stop()
+
+		if err := FcntlLocks.Lock(ctx, f2); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected lock to time out, got %v", err)
+		}
+
+		// Waiters get woken up once the lock gets released.
+		done := make(chan error, 1)
+		go func() {
+			done <- FcntlLocks.Lock(context.Background(), f2)
+		}()
+		time.Sleep(10 * time.Millisecond)
+		if err := FcntlLocks.Unlock(f1); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		files := openFiles(t, "barney-ci-go-store-fcntl-test-3", 3)
+		f1, f2, f3 := files[0], files[1], files[2]
+		defer closeLocked(f2)
+		defer closeLocked(f3)
+
+		if err := FcntlLocks.RLock(context.Background(), f1); err != nil {
+			t.Fatal(err)
+		}
+		if err := FcntlLocks.RLock(context.Background(), f2); err != nil {
+			t.Fatal(err)
+		}
+
+		// Closing f1 must not release the lock still held through f2.
+		if err := closeLocked(f1); err != nil {
+			t.Fatal(err)
+		}
+		if err := FcntlLocks.TryLock(f3); !errors.Is(err, ErrWouldBlock) {
+			t.Fatalf("expected TryLock to fail with ErrWouldBlock, got %v", err)
+		}
+
+		// OFD locks conflict with the record locks of the same process,
+		// which lets us check that the system lock is still held.
+		err := OFDLocks.TryLock(f3)
+		switch {
+		case errors.Is(err, ErrLockStyleUnsupported):
+		case !errors.Is(err, ErrWouldBlock):
+			t.Fatalf("expected OFD TryLock to fail with ErrWouldBlock, got %v", err)
+		}
+
+		if err := FcntlLocks.Unlock(f2); err != nil {
+			t.Fatal(err)
+		}
+		if err := FcntlLocks.TryLock(f3); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Store", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "num")
+		stress(t, New[int](json.NewEncoder, json.NewDecoder, WithLockStyle(FcntlLocks)), path)
+
+		processLocks.Lock()
+		n := len(processLocks.files)
+		processLocks.Unlock()
+		if n != 0 {
+			t.Fatalf("expected all process locks to be released, %d remain", n)
+		}
+	})
+}
@@ -0,0 +1,120 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build !unix && !windows && !plan9 && !js && !wasip1
+// +build !unix,!windows,!plan9,!js,!wasip1
+
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// This is a portable, best-effort lock implementation for systems that do not
+// have a native file locking primitive we know how to use.
+//
+// Within a process, locks are tracked in a lock table keyed by file name,
+// which supports the usual shared and exclusive semantics. Across processes,
+// the lock is materialized by a sentinel file, created with O_EXCL, for as
+// long as any file of the process holds a lock. Shared locks are therefore
+// exclusive between processes.
+//
+// Unlike native locks, the sentinel file survives the closing of the locked
+// file, or the termination of the process. Callers must unlock files
+// explicitly before closing them.
+
+var ErrWouldBlock = errWouldBlock
+
+const systemHasInterruptibleLocks = false
+
+const (
+	systemHasBlockingLocks     = false
+	systemReleasesLocksOnClose = false
+	systemHasCrossProcessLocks = true
+)
+
+const systemEmulatesFlockLocks = false
+
+type genericLock struct {
+	holders map[OSFile]lockFlag
+}
+
+var (
+	genericLocksMu sync.Mutex
+	genericLocks   = map[string]*genericLock{}
+)
+
+func genericLockKey(f OSFile) string {
+	name, err := filepath.Abs(f.Name())
+	if err != nil {
+		return f.Name()
+	}
+	return name
+}
+
+func systemLockForget(f OSFile) {}
+
+func lock(f OSFile, flags lockFlag) error {
+	genericLocksMu.Lock()
+	defer genericLocksMu.Unlock()
+
+	key := genericLockKey(f)
+	l := genericLocks[key]
+	if l == nil {
+		sentinel, err := os.OpenFile(key+".lck", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		switch {
+		case errors.Is(err, os.ErrExist):
+			return ErrWouldBlock
+		case err != nil:
+			return err
+		}
+		sentinel.Close()
+
+		l = &genericLock{holders: map[OSFile]lockFlag{}}
+		genericLocks[key] = l
+	}
+
+	for holder, held := range l.holders {
+		if holder == f {
+			continue
+		}
+		if (flags&lockExcl) != 0 || (held&lockExcl) != 0 {
+			return ErrWouldBlock
+		}
+	}
+	l.holders[f] = flags & lockExcl
+	return nil
+}
+
+func unlock(f OSFile, flags lockFlag) error {
+	genericLocksMu.Lock()
+	defer genericLocksMu.Unlock()
+
+	key := genericLockKey(f)
+	l := genericLocks[key]
+	if l == nil {
+		return nil
+	}
+	delete(l.holders, f)
+	if len(l.holders) > 0 {
+		return nil
+	}
+	delete(genericLocks, key)
+	return os.Remove(key + ".lck")
+}
+
+func lockGetThread() (any, error) {
+	return nil, nil
+}
+
+func lockCloseThread(any) {}
+
+func lockInterrupt(any) error {
+	return nil
+}
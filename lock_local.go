@@ -0,0 +1,270 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// When in-process locking is enabled, the files of the process that lock the
+// same file are arbitrated in the process before calling into the system,
+// like with FcntlLocks, and share a single system lock: the first file to
+// lock a file takes the system lock, and the files that then take shared
+// locks on the same file only take a reference on it. When the file holding
+// the system lock releases it while other files still hold shared locks, it
+// hands the system lock over to one of them first. Goroutines that contend
+// for the same file thus wait on each other in the process, and only one
+// file of the process holds or waits for a system lock on a given file at
+// any time.
+
+// A localLock tracks the files of the process that lock the same file.
+type localLock struct {
+	holders map[OSFile]lockFlag
+
+	// owner is the holder whose file holds the system lock, on behalf of
+	// all the holders. It is nil if the system lock was lost because the
+	// owner got closed outside of the package.
+	owner OSFile
+
+	// style holds the flags selecting the style of the system lock.
+	style lockFlag
+
+	// acquiring is set while the owner calls into the system to acquire
+	// or convert the system lock, during which the other files wait.
+	acquiring bool
+
+	// released gets closed and replaced every time a holder releases the
+	// lock, or the owner is done acquiring it.
+	released chan struct{}
+}
+
+// localKey identifies the locks of a file. Locks of different styles do not
+// exclude each other, and are tracked separately.
+type localKey struct {
+	file  any
+	style lockFlag
+}
+
+var localLocks = struct {
+	sync.Mutex
+	files map[localKey]*localLock
+	keys  map[OSFile]localKey
+}{files: map[localKey]*localLock{}, keys: map[OSFile]localKey{}}
+
+var (
+	// localLocksEnabled is set by SetInProcessLocking.
+	localLocksEnabled atomic.Bool
+
+	// localLocksHeld is the number of entries in localLocks.keys, which lets
+	// the release of locks skip the table when it is empty.
+	localLocksHeld atomic.Int64
+)
+
+// localLockPoll is how often goroutines waiting in the process for a lock
+// check whether its holders were closed without releasing it through the
+// package, which wakes nobody up.
+const localLockPoll = 10 * time.Millisecond
+
+// SetInProcessLocking enables or disables the arbitration of locks in the
+// process. It is disabled by default.
+//
+// While enabled, the lock functions of the package, and stores using the
+// files of the operating system, first arbitrate the locks of files of the
+// process that lock the same file between themselves, so that goroutines
+// contending for the same file wait on each other in the process, and the
+// process holds a single system lock per file, which its shared locks share.
+// This makes many goroutines contending for the same stores much cheaper,
+// while locks still exclude other processes as usual.
+//
+// Like with FcntlLocks, a file holding a shared lock must therefore not be
+// closed while other files of the process hold a shared lock on the same
+// file, unless it is first unlocked with the functions of the package, which
+// hand the system lock over to another file; Store takes care of this for the
+// files it opens. Locks released by closing their file otherwise are only
+// noticed after a short delay. In-process locking is only supported on
+// Unix-like systems and Windows, and has no effect on FcntlLocks, which are
+// always arbitrated in the process.
+func SetInProcessLocking(enabled bool) {
+	localLocksEnabled.Store(enabled)
+}
+
+// localLockAcquire acquires the lock of f with the specified flags, once it
+// no longer conflicts with the locks of other files of the process. f only
+// calls into the system if no other file of the process holds the system
+// lock, or to convert it.
+func localLockAcquire(ctx context.Context, f OSFile, flags lockFlag) error {
+	id, err := fileKey(f)
+	if err != nil {
+		return systemLock(ctx, f, flags)
+	}
+	key := localKey{file: id, style: flags & lockOFD}
+
+	localLocks.Lock()
+	for {
+		pl := localLocks.files[key]
+		if pl == nil {
+			pl = &localLock{
+				holders:  map[OSFile]lockFlag{},
+				style:    key.style,
+				released: make(chan struct{}),
+			}
+		}
+		if !pl.acquiring {
+			for holder := range pl.holders {
+				if holder != f && fileClosed(holder) {
+					localLockForget(holder)
+				}
+			}
+		}
+		// Forgetting about closed holders may have removed pl.
+		localLocks.files[key] = pl
+
+		if !pl.acquiring && !pl.conflicts(f, flags) {
+			prev, held := pl.holders[f]
+			owner := pl.owner
+			pl.holders[f] = flags & lockExcl
+			if !held {
+				localLocks.keys[f] = key
+				localLocksHeld.Add(1)
+			}
+			if owner != nil && owner != f {
+				// Without conflicts, the owner holds a shared system
+				// lock, which f shares.
+				localLocks.Unlock()
+				return nil
+			}
+			pl.owner = f
+			pl.acquiring = true
+			localLocks.Unlock()
+
+			err := systemLock(ctx, f, flags)
+
+			localLocks.Lock()
+			pl.acquiring = false
+			if err != nil {
+				if held {
+					pl.holders[f] = prev
+					pl.owner = owner
+				} else {
+					localLockForget(f)
+				}
+			}
+			close(pl.released)
+			pl.released = make(chan struct{})
+			localLocks.Unlock()
+			return err
+		}
+
+		released := pl.released
+		localLocks.Unlock()
+
+		if (flags & lockBlock) == 0 {
+			return ErrWouldBlock
+		}
+		timer := time.NewTimer(localLockPoll)
+		select {
+		case <-released:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		timer.Stop()
+		localLocks.Lock()
+	}
+}
+
+func (pl *localLock) conflicts(f OSFile, flags lockFlag) bool {
+	for holder, held := range pl.holders {
+		if holder == f {
+			continue
+		}
+		if (flags&lockExcl) != 0 || (held&lockExcl) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// localLockHandOff is called before the lock of f gets released, and reports
+// whether f holds a system lock to release. If f holds the system lock on
+// behalf of other files, it first hands it over to one of them.
+func localLockHandOff(f OSFile) bool {
+	if localLocksHeld.Load() == 0 {
+		return true
+	}
+	localLocks.Lock()
+	defer localLocks.Unlock()
+
+	key, ok := localLocks.keys[f]
+	if !ok {
+		return true
+	}
+	pl := localLocks.files[key]
+	if pl.owner != f {
+		return false
+	}
+	pl.handOff(f)
+	return true
+}
+
+// handOff makes another holder than f, which all hold shared locks, take the
+// system lock held by f, if any. localLocks must be locked.
+func (pl *localLock) handOff(f OSFile) {
+	for holder := range pl.holders {
+		if holder == f {
+			continue
+		}
+		// Since f holds a shared lock, taking another one cannot block.
+		err := errLockInterrupted
+		for err == errLockInterrupted {
+			err = lock(holder, pl.style)
+		}
+		if err == nil {
+			pl.owner = holder
+			return
+		}
+	}
+}
+
+// localLockRelease forgets about the lock held by f, if any, once its system
+// lock was released.
+func localLockRelease(f OSFile) {
+	if localLocksHeld.Load() == 0 {
+		return
+	}
+	localLocks.Lock()
+	defer localLocks.Unlock()
+	localLockForget(f)
+}
+
+// localLockForget removes f from the holders of the lock of its file, and
+// wakes up the goroutines waiting for it. If f was closed while it held the
+// system lock, another holder takes it back. localLocks must be locked.
+func localLockForget(f OSFile) {
+	key, ok := localLocks.keys[f]
+	if !ok {
+		return
+	}
+	delete(localLocks.keys, f)
+	localLocksHeld.Add(-1)
+
+	pl := localLocks.files[key]
+	delete(pl.holders, f)
+	if pl.owner == f {
+		pl.owner = nil
+		pl.handOff(f)
+	}
+	close(pl.released)
+	pl.released = make(chan struct{})
+	if len(pl.holders) == 0 {
+		delete(localLocks.files, key)
+	}
+}
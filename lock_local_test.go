@@ -0,0 +1,182 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build unix || windows
+// +build unix windows
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInProcessLocking(t *testing.T) {
+	ctx := context.Background()
+	SetInProcessLocking(true)
+	defer SetInProcessLocking(false)
+
+	// open opens the same file twice.
+	open := func(t *testing.T) (*os.File, *os.File) {
+		path := filepath.Join(t.TempDir(), "lock")
+		f1, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f1.Close() })
+		f2, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f2.Close() })
+		return f1, f2
+	}
+
+	t.Run("Exclusive", func(t *testing.T) {
+		f1, f2 := open(t)
+		if err := Lock(ctx, f1); err != nil {
+			t.Fatal(err)
+		}
+		if err := TryRLock(f2); !errors.Is(err, ErrWouldBlock) {
+			t.Fatalf("expected %v, got %v", ErrWouldBlock, err)
+		}
+
+		locked := make(chan error, 1)
+		go func() { locked <- Lock(ctx, f2) }()
+		select {
+		case err := <-locked:
+			t.Fatalf("expected Lock to block, got %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		if err := Unlock(f1); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-locked; err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Shared", func(t *testing.T) {
+		f1, f2 := open(t)
+		if err := RLock(ctx, f1); err != nil {
+			t.Fatal(err)
+		}
+		if err := RLock(ctx, f2); err != nil {
+			t.Fatal(err)
+		}
+		if err := TryLock(f1); !errors.Is(err, ErrWouldBlock) {
+			t.Fatalf("expected %v, got %v", ErrWouldBlock, err)
+		}
+	})
+
+	t.Run("HandOff", func(t *testing.T) {
+		for _, release := range []struct {
+			name string
+			fn   func(f *os.File) error
+		}{
+			{"Unlock", func(f *os.File) error { return Unlock(f) }},
+			{"Close", closeLocked},
+		} {
+			t.Run(release.name, func(t *testing.T) {
+				f1, f2 := open(t)
+				f3, err := os.Open(f1.Name())
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f3.Close()
+
+				if err := RLock(ctx, f1); err != nil {
+					t.Fatal(err)
+				}
+				if err := RLock(ctx, f2); err != nil {
+					t.Fatal(err)
+				}
+				if err := release.fn(f1); err != nil {
+					t.Fatal(err)
+				}
+
+				// Bypass the arbitration to check the system lock.
+				if err := lock(f3, lockExcl); !errors.Is(err, ErrWouldBlock) {
+					t.Fatalf("expected f2 to keep the system lock, got %v", err)
+				}
+				if err := Unlock(f2); err != nil {
+					t.Fatal(err)
+				}
+				if err := lock(f3, lockExcl); err != nil {
+					t.Fatalf("expected the system lock to be released, got %v", err)
+				}
+			})
+		}
+	})
+
+	t.Run("Context", func(t *testing.T) {
+		f1, f2 := open(t)
+		if err := Lock(ctx, f1); err != nil {
+			t.Fatal(err)
+		}
+		tctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if err := Lock(tctx, f2); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		f1, f2 := open(t)
+		if err := Lock(ctx, f1); err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			f1.Close()
+		}()
+		if err := Lock(ctx, f2); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Stress", func(t *testing.T) {
+		stress(t, New[int](json.NewEncoder, json.NewDecoder), filepath.Join(t.TempDir(), "num"))
+	})
+}
+
+func BenchmarkInProcessLocking(b *testing.B) {
+	incr := func(ctx context.Context, val *int, err error) error {
+		*val++
+		return nil
+	}
+
+	for _, tc := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"System", false},
+		{"InProcess", true},
+	} {
+		enabled := tc.enabled
+		b.Run(tc.name, func(b *testing.B) {
+			SetInProcessLocking(enabled)
+			defer SetInProcessLocking(false)
+
+			store := New[int](json.NewEncoder, json.NewDecoder, WithStableLockFile())
+			path := filepath.Join(b.TempDir(), "bench.json")
+			b.ReportAllocs()
+			b.SetParallelism(64)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := store.LoadAndStoreExclusive(context.Background(), path, 0666, incr); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
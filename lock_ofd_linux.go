@@ -0,0 +1,24 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package store
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+const systemHasOFDLocks = true
+
+func ofdLock(f OSFile, flags lockFlag) error {
+	return recordLock(f, flags, unix.F_OFD_SETLK, unix.F_OFD_SETLKW)
+}
+
+func ofdUnlock(f OSFile) error {
+	return recordUnlock(f, unix.F_OFD_SETLK)
+}
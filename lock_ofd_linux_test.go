@@ -0,0 +1,95 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOFDLocks(t *testing.T) {
+
+	t.Run("Lock", func(t *testing.T) {
+		locks := makeLockfiles(t, filepath.Join(t.TempDir(), "barney-ci-go-store-ofd-test-1"), 2)
+
+		f1 := <-locks
+		if f1 == nil {
+			t.FailNow()
+		}
+		defer f1.Close()
+
+		f2 := <-locks
+		if f2 == nil {
+			t.FailNow()
+		}
+		defer f2.Close()
+
+		if err := OFDLocks.Lock(context.Background(), f1); err != nil {
+			t.Fatal(err)
+		}
+		if err := OFDLocks.TryRLock(f2); !errors.Is(err, ErrWouldBlock) {
+			t.Fatalf("expected TryRLock to fail with ErrWouldBlock, got %v", err)
+		}
+
+		// Demoting is atomic, and lets other readers in.
+		if err := OFDLocks.RLock(context.Background(), f1); err != nil {
+			t.Fatal(err)
+		}
+		if err := OFDLocks.TryRLock(f2); err != nil {
+			t.Fatal(err)
+		}
+		if err := OFDLocks.TryLock(f1); !errors.Is(err, ErrWouldBlock) {
+			t.Fatalf("expected TryLock to fail with ErrWouldBlock, got %v", err)
+		}
+
+		if err := OFDLocks.Unlock(f2); err != nil {
+			t.Fatal(err)
+		}
+		if err := OFDLocks.TryLock(f1); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Context", func(t *testing.T) {
+		locks := makeLockfiles(t, filepath.Join(t.TempDir(), "barney-ci-go-store-ofd-test-2"), 2)
+
+		f1 := <-locks
+		if f1 == nil {
+			t.FailNow()
+		}
+		defer f1.Close()
+
+		f2 := <-locks
+		if f2 == nil {
+			t.FailNow()
+		}
+		defer f2.Close()
+
+		if err := OFDLocks.Lock(context.Background(), f1); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, stop := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer stop()
+
+		if err := OFDLocks.Lock(ctx, f2); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected lock to time out, got %v", err)
+		}
+	})
+
+	t.Run("Store", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "num")
+		stress(t, New[int](json.NewEncoder, json.NewDecoder, WithLockStyle(OFDLocks)), path)
+	})
+}
@@ -0,0 +1,20 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build !linux
+// +build !linux
+
+package store
+
+const systemHasOFDLocks = false
+
+func ofdLock(f OSFile, flags lockFlag) error {
+	return ErrLockStyleUnsupported
+}
+
+func ofdUnlock(f OSFile) error {
+	return ErrLockStyleUnsupported
+}
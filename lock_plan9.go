@@ -0,0 +1,157 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Plan 9 has no file locks, but file servers let exclusive-use files, i.e.
+// files with the DMEXCL bit, be open by a single client at a time. A lock on
+// a file is therefore materialized by holding open the exclusive-use file
+// named after it with a .lck suffix, for as long as any file of the process
+// holds a lock on it. Unlike the sentinel files of the generic
+// implementation, this lock goes away with the process, though file servers
+// may keep it for a while if the process dies without closing it.
+//
+// Within a process, locks are tracked in a lock table keyed by file name,
+// which supports the usual shared and exclusive semantics. Across processes,
+// shared locks are exclusive.
+
+var ErrWouldBlock = errWouldBlock
+
+const systemHasInterruptibleLocks = false
+
+const (
+	systemHasBlockingLocks     = false
+	systemReleasesLocksOnClose = false
+	systemHasCrossProcessLocks = true
+)
+
+const systemEmulatesFlockLocks = false
+
+type plan9Lock struct {
+	excl    *os.File
+	holders map[OSFile]lockFlag
+}
+
+var (
+	plan9LocksMu sync.Mutex
+	plan9Locks   = map[string]*plan9Lock{}
+)
+
+func plan9LockKey(f OSFile) string {
+	name, err := filepath.Abs(f.Name())
+	if err != nil {
+		return f.Name()
+	}
+	return name
+}
+
+// isExclusiveUse returns whether err is the error of file servers for opening
+// an exclusive-use file that is already open. Each file server words it its
+// own way.
+func isExclusiveUse(err error) bool {
+	msg := err.Error()
+	for _, s := range []string{"exclusive use file already open", "file in use", "file is locked", "exclusive lock"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// openExclusive opens the exclusive-use file at path, creating it if needed.
+func openExclusive(path string) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, os.ModeExclusive|0666)
+		switch {
+		case err != nil && isExclusiveUse(err):
+			return nil, ErrWouldBlock
+		case err != nil:
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if info.Mode()&os.ModeExclusive != 0 {
+			return f, nil
+		}
+		// The file predates us, or was created by someone unaware of the
+		// bit. Setting it only applies to later opens, so open it again.
+		err = f.Chmod(info.Mode() | os.ModeExclusive)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func systemLockForget(f OSFile) {}
+
+func lock(f OSFile, flags lockFlag) error {
+	plan9LocksMu.Lock()
+	defer plan9LocksMu.Unlock()
+
+	key := plan9LockKey(f)
+	l := plan9Locks[key]
+	if l == nil {
+		excl, err := openExclusive(key + ".lck")
+		if err != nil {
+			return err
+		}
+		l = &plan9Lock{excl: excl, holders: map[OSFile]lockFlag{}}
+		plan9Locks[key] = l
+	}
+
+	for holder, held := range l.holders {
+		if holder == f {
+			continue
+		}
+		if (flags&lockExcl) != 0 || (held&lockExcl) != 0 {
+			return ErrWouldBlock
+		}
+	}
+	l.holders[f] = flags & lockExcl
+	return nil
+}
+
+func unlock(f OSFile, flags lockFlag) error {
+	plan9LocksMu.Lock()
+	defer plan9LocksMu.Unlock()
+
+	key := plan9LockKey(f)
+	l := plan9Locks[key]
+	if l == nil {
+		return nil
+	}
+	delete(l.holders, f)
+	if len(l.holders) > 0 {
+		return nil
+	}
+	delete(plan9Locks, key)
+	if err := l.excl.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+func lockGetThread() (any, error) {
+	return nil, nil
+}
+
+func lockCloseThread(any) {}
+
+func lockInterrupt(any) error {
+	return nil
+}
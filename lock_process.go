@@ -0,0 +1,181 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// Classic POSIX record locks are owned by the process rather than by the
+// open file description: two file descriptors of the same process never
+// conflict, and closing any file descriptor of a file releases all the locks
+// that the process holds on it.
+//
+// To give them the same semantics as the other lock styles, the process
+// keeps track of which of its files hold a lock on which file, and arbitrates
+// conflicts between them itself. The system lock is only released once the
+// last holder unlocks, and closing a locked file with closeLocked is deferred
+// until then.
+
+type processLock struct {
+	holders map[OSFile]lockFlag
+
+	// pending holds the files whose close was deferred because other files
+	// still held the lock.
+	pending []*os.File
+
+	// released gets closed and replaced every time a holder releases the lock.
+	released chan struct{}
+}
+
+var processLocks = struct {
+	sync.Mutex
+	files map[any]*processLock
+}{files: map[any]*processLock{}}
+
+// processLocksHeld is the number of entries in processLocks.files, which
+// lets closeLocked skip looking up files when no process lock is held.
+var processLocksHeld atomic.Int64
+
+func (pl *processLock) conflicts(f OSFile, flags lockFlag) bool {
+	for holder, held := range pl.holders {
+		if holder == f {
+			continue
+		}
+		if (flags&lockExcl) != 0 || (held&lockExcl) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func processLockAcquire(ctx context.Context, f OSFile, flags lockFlag) error {
+	key, err := fileKey(f)
+	if err != nil {
+		return err
+	}
+
+	for {
+		processLocks.Lock()
+		pl := processLocks.files[key]
+		if pl == nil {
+			pl = &processLock{
+				holders:  map[OSFile]lockFlag{},
+				released: make(chan struct{}),
+			}
+			processLocks.files[key] = pl
+			processLocksHeld.Add(1)
+		}
+
+		if !pl.conflicts(f, flags) {
+			prev, held := pl.holders[f]
+			pl.holders[f] = flags & lockExcl
+			processLocks.Unlock()
+
+			err := systemLock(ctx, f, flags)
+			if err != nil {
+				processLocks.Lock()
+				if held {
+					pl.holders[f] = prev
+				} else {
+					processLockRelease(key, pl, f)
+				}
+				processLocks.Unlock()
+			}
+			return err
+		}
+
+		released := pl.released
+		processLocks.Unlock()
+
+		if (flags & lockBlock) == 0 {
+			return ErrWouldBlock
+		}
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// processLockRelease removes f from the holders of pl, and releases the
+// system lock if f was the last holder. processLocks must be locked.
+func processLockRelease(key any, pl *processLock, f OSFile) error {
+	delete(pl.holders, f)
+	close(pl.released)
+	pl.released = make(chan struct{})
+
+	if len(pl.holders) > 0 {
+		return nil
+	}
+
+	err := unlock(f, lockFcntl)
+	for _, pf := range pl.pending {
+		pf.Close()
+	}
+	delete(processLocks.files, key)
+	processLocksHeld.Add(-1)
+	return err
+}
+
+func processUnlock(f OSFile) error {
+	key, err := fileKey(f)
+	if err != nil {
+		return err
+	}
+
+	processLocks.Lock()
+	defer processLocks.Unlock()
+
+	pl := processLocks.files[key]
+	if pl == nil {
+		return unlock(f, lockFcntl)
+	}
+	if _, ok := pl.holders[f]; !ok {
+		// Unlocking a file that does not hold the lock is a no-op, like
+		// with the other lock styles.
+		return nil
+	}
+	return processLockRelease(key, pl, f)
+}
+
+// processClose closes f, deferring the close if other files of the process
+// hold a lock on the same file.
+func processClose(f *os.File) error {
+	key, err := fileKey(f)
+	if err != nil {
+		return f.Close()
+	}
+
+	processLocks.Lock()
+	defer processLocks.Unlock()
+
+	pl := processLocks.files[key]
+	if pl == nil {
+		return f.Close()
+	}
+	delete(pl.holders, f)
+	if len(pl.holders) > 0 {
+		close(pl.released)
+		pl.released = make(chan struct{})
+		pl.pending = append(pl.pending, f)
+		return nil
+	}
+	// f was the last holder; closing it releases the system lock.
+	err = f.Close()
+	for _, pf := range pl.pending {
+		pf.Close()
+	}
+	close(pl.released)
+	delete(processLocks.files, key)
+	processLocksHeld.Add(-1)
+	return err
+}
@@ -11,6 +11,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 )
@@ -180,6 +181,53 @@ func TestLock(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("ContextRepeated", func(t *testing.T) {
+		t.Parallel()
+
+		// Interrupters are reused across blocking lock calls; make sure that
+		// sequential cancellations keep working after reuse.
+		locks := makeLockfiles(t, filepath.Join(t.TempDir(), "barney-ci-go-store-lock-test-3"), 2)
+
+		f1 := <-locks
+		if f1 == nil {
+			t.FailNow()
+		}
+		defer f1.Close()
+
+		f2 := <-locks
+		if f2 == nil {
+			t.FailNow()
+		}
+		defer f2.Close()
+
+		if err := Lock(context.Background(), f1); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 2*maxIdleInterrupters; i++ {
+			ctx, stop := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			err := Lock(ctx, f2)
+			stop()
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("expected lock to time out, got %v", err)
+			}
+		}
+
+		if err := Unlock(f1); err != nil {
+			t.Fatal(err)
+		}
+		if err := Lock(context.Background(), f2); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestCrossProcessLocking(t *testing.T) {
+	wasm := runtime.GOOS == "js" || runtime.GOOS == "wasip1"
+	if CrossProcessLocking() == wasm {
+		t.Fatalf("expected CrossProcessLocking to be %v on %s", !wasm, runtime.GOOS)
+	}
 }
 
 func BenchmarkLock(b *testing.B) {
@@ -15,68 +15,24 @@ import (
 
 var ErrWouldBlock = &likeError{Err: errWouldBlock, Like: unix.EWOULDBLOCK}
 
-const systemHasInterruptibleLocks = true
+const systemHasInterruptibleLocks = systemHasThreadSignals
 
 const (
-	// Picked to match Go's goroutine preemption signal.
-	//
-	// The reason for this is that we share the same rationale; see
-	// https://cs.opensource.google/go/proposal/+/master:design/24543-non-cooperative-preemption.md
-	// for the full context, quoting the relevant part:
-	//
-	//     **Choosing a signal.** We have to choose a signal that is unlikely to
-	//     interfere with existing uses of signals or with debuggers.
-	//     There are no perfect choices, but there are some heuristics.
-	//
-	//     1) It should be a signal that's passed-through by debuggers by
-	//        default.
-	//        On Linux, this is SIGALRM, SIGURG, SIGCHLD, SIGIO, SIGVTALRM, SIGPROF,
-	//        and SIGWINCH, plus some glibc-internal signals.
-	//     2) It shouldn't be used internally by libc in mixed Go/C binaries
-	//        because libc may assume it's the only thing that can handle these
-	//        signals.
-	//        For example SIGCANCEL or SIGSETXID.
-	//     3) It should be a signal that can happen spuriously without
-	//        consequences.
-	//        For example, SIGALRM is a bad choice because the signal handler can't
-	//        tell if it was caused by the real process alarm or not (arguably this
-	//        means the signal is broken, but I digress).
-	//        SIGUSR1 and SIGUSR2 are also bad because those are often used in
-	//        meaningful ways by applications.
-	//     4) We need to deal with platforms without real-time signals (like
-	//        macOS), so those are out.
-	//
-	// On the last note, it makes no difference to use SIGRT_N over SIGURG for
-	// performance reasons -- the benchmarks end up the same.
-	signo = unix.SIGURG
+	systemHasBlockingLocks     = true
+	systemReleasesLocksOnClose = true
+	systemHasCrossProcessLocks = true
 )
 
-func init() {
-	// Go installs its signal handler with SA_RESTART, which means we don't get
-	// to handle EINTR; disable this for our signal, forever.
-	//
-	// While this seems we're breaking global state, because Go is expecting
-	// all signal handlers to have SA_RESTART, the reality is that the Go authors
-	// have to now explicitly make all of the stdlib code EINTR-resillient because
-	// of CGo.
-	//
-	// Further readings:
-	// * https://github.com/golang/go/issues/20400
-	// * https://github.com/golang/go/issues/44761
+func systemLockForget(f OSFile) {}
 
-	var act sigactiont
-	if err := sigaction(signo, nil, &act); err != nil {
-		panic(err)
-	}
-	act.Flags &= ^_SA_RESTART
-	if err := sigaction(signo, &act, nil); err != nil {
-		panic(err)
+func lock(f OSFile, flags lockFlag) error {
+	switch {
+	case (flags & lockOFD) != 0:
+		return ofdLock(f, flags)
+	case (flags & lockFcntl) != 0:
+		return fcntlLock(f, flags)
 	}
-}
-
-func preLock(f OSFile, flags lockFlag) {}
 
-func lock(f OSFile, flags lockFlag) error {
 	var sysFlags int
 	if (flags & lockExcl) != 0 {
 		sysFlags |= unix.LOCK_EX
@@ -87,11 +43,16 @@ func lock(f OSFile, flags lockFlag) error {
 		sysFlags |= unix.LOCK_NB
 	}
 
-	err := unix.Flock(int(f.Fd()), sysFlags)
+	err := flock(int(f.Fd()), sysFlags)
 	switch {
 	case err == nil:
 		return nil
 	case err == unix.EINTR:
+		// This happens both when a blocking lock gets interrupted on purpose,
+		// and when any unrelated signal gets delivered to the thread, which,
+		// since we disabled SA_RESTART for our signal, can also happen for non-blocking locks.
+		// In both cases, the caller retries the lock unless its context is
+		// done, so this must never be reported as ErrWouldBlock.
 		return errLockInterrupted
 	case err == unix.EWOULDBLOCK:
 		return wrapSyscallError("flock", ErrWouldBlock)
@@ -100,19 +61,31 @@ func lock(f OSFile, flags lockFlag) error {
 	}
 }
 
-func unlock(f OSFile) error {
-	return wrapSyscallError("flock", unix.Flock(int(f.Fd()), unix.LOCK_UN))
+func unlock(f OSFile, flags lockFlag) error {
+	switch {
+	case (flags & lockOFD) != 0:
+		return ofdUnlock(f)
+	case (flags & lockFcntl) != 0:
+		return fcntlUnlock(f)
+	}
+	return wrapSyscallError("flock", flock(int(f.Fd()), unix.LOCK_UN))
 }
 
 func lockGetThread() (any, error) {
+	sig, err := acquireInterruptSignal()
+	if err != nil {
+		return nil, err
+	}
 	pid := unix.Getpid()
 	tid := gettid()
-	return func() (int, int) { return pid, tid }, nil
+	return func() (int, int, unix.Signal) { return pid, tid, sig }, nil
 }
 
-func lockCloseThread(any) {}
+func lockCloseThread(any) {
+	releaseInterruptSignal()
+}
 
 func lockInterrupt(pidtid any) error {
-	pid, tid := pidtid.(func() (int, int))()
-	return tgkill(pid, tid, signo)
+	pid, tid, sig := pidtid.(func() (int, int, unix.Signal))()
+	return tgkill(pid, tid, sig)
 }
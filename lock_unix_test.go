@@ -0,0 +1,258 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build unix
+// +build unix
+
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestTryLockSignals(t *testing.T) {
+	locks := makeLockfiles(t, filepath.Join(t.TempDir(), "barney-ci-go-store-trylock-signals"), 3)
+
+	f1, f2, f3 := <-locks, <-locks, <-locks
+	if f1 == nil || f2 == nil || f3 == nil {
+		t.FailNow()
+	}
+	defer f1.Close()
+	defer f2.Close()
+	defer f3.Close()
+
+	if err := TryLock(f1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Bombard the process with an unrelated signal while locking.
+	done := make(chan struct{})
+	var wait sync.WaitGroup
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := unix.Kill(unix.Getpid(), unix.SIGURG); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	defer wait.Wait()
+	defer close(done)
+
+	for i := 0; i < 10000; i++ {
+		// A contended lock must always report ErrWouldBlock.
+		if err := TryLock(f2); !errors.Is(err, ErrWouldBlock) {
+			t.Fatalf("expected ErrWouldBlock, got %v", err)
+		}
+
+		// An uncontended lock must never fail.
+		if err := Unlock(f1); err != nil {
+			t.Fatal(err)
+		}
+		if err := TryRLock(f3); err != nil {
+			t.Fatalf("expected uncontended lock to succeed, got %v", err)
+		}
+		if err := Unlock(f3); err != nil {
+			t.Fatal(err)
+		}
+		if err := TryLock(f1); err != nil {
+			t.Fatalf("expected uncontended lock to succeed, got %v", err)
+		}
+	}
+}
+
+func TestLockCancelUnblocks(t *testing.T) {
+	if !systemHasInterruptibleLocks {
+		t.Skip("locks are not interruptible on this system")
+	}
+
+	locks := makeLockfiles(t, filepath.Join(t.TempDir(), "barney-ci-go-store-lock-cancel"), 3)
+
+	f1, f2, f3 := <-locks, <-locks, <-locks
+	if f1 == nil || f2 == nil || f3 == nil {
+		t.FailNow()
+	}
+	defer f1.Close()
+	defer f2.Close()
+	defer f3.Close()
+
+	if err := Lock(context.Background(), f1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, stop := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer stop()
+	if err := Lock(ctx, f2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected lock to time out, got %v", err)
+	}
+
+	// The canceled lock call must have actually stopped waiting, rather
+	// than leaving a system call behind that takes the lock once released.
+	if err := Unlock(f1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := TryLock(f3); err != nil {
+		t.Fatalf("expected the lock to be free, got %v", err)
+	}
+}
+
+func TestSetInterruptSignal(t *testing.T) {
+	if !systemHasInterruptibleLocks {
+		t.Skip("locks are not interruptible on this system")
+	}
+
+	// Locks may already have been interrupted by other tests; make sure
+	// they have, so that the signal cannot change under them.
+	sig, err := prepareInterruptSignal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetInterruptSignal(sig); err != nil {
+		t.Fatalf("expected setting the same signal to succeed, got %v", err)
+	}
+	if err := SetInterruptSignal(unix.SIGUSR2); !errors.Is(err, ErrInterruptSignalInUse) {
+		t.Fatalf("expected %v, got %v", ErrInterruptSignalInUse, err)
+	}
+	if err := SetInterruptSignal(unix.SIGKILL); err == nil || errors.Is(err, ErrInterruptSignalInUse) {
+		t.Fatalf("expected SIGKILL to be rejected, got %v", err)
+	}
+
+	var act sigactiont
+	if err := sigaction(sig, nil, &act); err != nil {
+		t.Fatal(err)
+	}
+	if act.Flags&_SA_RESTART != 0 {
+		t.Fatalf("expected SA_RESTART to be disabled for %v", sig)
+	}
+}
+
+// closableFile serializes Fd with Close, which lets tests close files that
+// abandoned lock calls still use.
+type closableFile struct {
+	mu sync.Mutex
+	*os.File
+}
+
+func (f *closableFile) Fd() uintptr {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.File.Fd()
+}
+
+func (f *closableFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.File.Close()
+}
+
+func TestDisableSignalInterrupts(t *testing.T) {
+	DisableSignalInterrupts()
+	t.Cleanup(func() { signalInterruptsDisabled.Store(false) })
+
+	locks := makeLockfiles(t, filepath.Join(t.TempDir(), "barney-ci-go-store-lock-nosignals"), 3)
+
+	f1, osf2, f3 := <-locks, <-locks, <-locks
+	if f1 == nil || osf2 == nil || f3 == nil {
+		t.FailNow()
+	}
+	defer f1.Close()
+	defer f3.Close()
+	f2 := &closableFile{File: osf2}
+
+	if err := Lock(context.Background(), f1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, stop := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer stop()
+	if err := Lock(ctx, f2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected lock to time out, got %v", err)
+	}
+
+	// The abandoned lock call takes the lock once released, until f2 gets
+	// closed.
+	if err := Unlock(f1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := f2.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := TryLock(f3); err != nil {
+		t.Fatalf("expected the lock to be free, got %v", err)
+	}
+}
+
+func TestRestoreSignalHandling(t *testing.T) {
+	if !systemHasInterruptibleLocks {
+		t.Skip("locks are not interruptible on this system")
+	}
+
+	restarts := func(sig unix.Signal) bool {
+		t.Helper()
+		var act sigactiont
+		if err := sigaction(sig, nil, &act); err != nil {
+			t.Fatal(err)
+		}
+		return act.Flags&_SA_RESTART != 0
+	}
+
+	sig, err := prepareInterruptSignal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restarts(sig) {
+		t.Fatalf("expected SA_RESTART to be disabled for %v", sig)
+	}
+	if err := RestoreSignalHandling(); err != nil {
+		t.Fatal(err)
+	}
+	if !restarts(sig) {
+		t.Fatalf("expected SA_RESTART to be restored for %v", sig)
+	}
+	if err := RestoreSignalHandling(); err != nil {
+		t.Fatalf("expected restoring twice to succeed, got %v", err)
+	}
+
+	// The next blocking lock disables it again, and gets interrupted.
+	locks := makeLockfiles(t, filepath.Join(t.TempDir(), "barney-ci-go-store-lock-restore"), 2)
+
+	f1, f2 := <-locks, <-locks
+	if f1 == nil || f2 == nil {
+		t.FailNow()
+	}
+	defer f1.Close()
+	defer f2.Close()
+
+	if err := Lock(context.Background(), f1); err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer stop()
+	if err := Lock(ctx, f2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected lock to time out, got %v", err)
+	}
+	if restarts(sig) {
+		t.Fatalf("expected SA_RESTART to be disabled again for %v", sig)
+	}
+}
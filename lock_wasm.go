@@ -0,0 +1,94 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build js || wasip1
+// +build js wasip1
+
+package store
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// WebAssembly hosts offer no file locking at all, and the sentinel files of
+// the generic implementation would outlive instances, which commonly get
+// killed rather than shut down. Locks are therefore only tracked in a lock
+// table of the process, keyed by file name, which supports the usual shared
+// and exclusive semantics between the files of the process, but does not
+// exclude other processes. CrossProcessLocking reports this to callers.
+
+var ErrWouldBlock = errWouldBlock
+
+const systemHasInterruptibleLocks = false
+
+const (
+	systemHasBlockingLocks     = false
+	systemReleasesLocksOnClose = false
+	systemHasCrossProcessLocks = false
+)
+
+const systemEmulatesFlockLocks = false
+
+var (
+	wasmLocksMu sync.Mutex
+	wasmLocks   = map[string]map[OSFile]lockFlag{}
+)
+
+func wasmLockKey(f OSFile) string {
+	name, err := filepath.Abs(f.Name())
+	if err != nil {
+		return f.Name()
+	}
+	return name
+}
+
+func systemLockForget(f OSFile) {}
+
+func lock(f OSFile, flags lockFlag) error {
+	wasmLocksMu.Lock()
+	defer wasmLocksMu.Unlock()
+
+	key := wasmLockKey(f)
+	holders := wasmLocks[key]
+	for holder, held := range holders {
+		if holder == f {
+			continue
+		}
+		if (flags&lockExcl) != 0 || (held&lockExcl) != 0 {
+			return ErrWouldBlock
+		}
+	}
+	if holders == nil {
+		holders = map[OSFile]lockFlag{}
+		wasmLocks[key] = holders
+	}
+	holders[f] = flags & lockExcl
+	return nil
+}
+
+func unlock(f OSFile, flags lockFlag) error {
+	wasmLocksMu.Lock()
+	defer wasmLocksMu.Unlock()
+
+	key := wasmLockKey(f)
+	holders := wasmLocks[key]
+	delete(holders, f)
+	if len(holders) == 0 {
+		delete(wasmLocks, key)
+	}
+	return nil
+}
+
+func lockGetThread() (any, error) {
+	return nil, nil
+}
+
+func lockCloseThread(any) {}
+
+func lockInterrupt(any) error {
+	return nil
+}
@@ -10,85 +10,306 @@
 package store
 
 import (
+	"context"
+	"errors"
+	"sync"
 	"syscall"
+	"time"
 
 	"golang.org/x/sys/windows"
 )
 
 var ErrWouldBlock = errWouldBlock
 
-var procCancelSynchronousIo = windows.MustLoadDLL("kernel32.dll").MustFindProc("CancelSynchronousIo")
+var procReOpenFile = windows.MustLoadDLL("kernel32.dll").MustFindProc("ReOpenFile")
 
-const systemHasInterruptibleLocks = true
+// Blocking locks are taken through overlapped lock requests, which contexts
+// cancel with CancelIoEx, rather than through interrupts.
+const (
+	systemHasInterruptibleLocks = false
+	systemHasContextLocks       = true
+)
+
+const (
+	systemHasBlockingLocks     = true
+	systemReleasesLocksOnClose = true
+	systemHasCrossProcessLocks = true
+)
+
+const systemEmulatesFlockLocks = false
+
+// Locks are held on the lock range of files, which spans all of their
+// contents. LockFileEx cannot convert locks in place, so the guard byte,
+// which follows the lock range, protects the promotions of shared locks to
+// exclusive locks: a promoting handle holds it exclusively while its lock
+// range is unlocked, and handles that acquire the lock range check that it
+// is not held before they return.
+const (
+	lockRangeLen = ^uint64(0) - 1
+	guardOffset  = lockRangeLen
+)
+
+// guardAttempts bounds the attempts of a promotion to acquire the guard byte
+// of a file. Handles acquiring the lock range only hold the guard briefly,
+// so failing that many times means that another handle is promoting its
+// shared lock, and waits for ours to be released.
+const guardAttempts = 10
 
-func cancelSynchronousIo(h windows.Handle) error {
-	r1, _, e1 := syscall.SyscallN(procCancelSynchronousIo.Addr(), uintptr(h))
-	if r1 == 0 {
-		return wrapSyscallError("CancelSynchronousIo", e1)
+// systemLocks records whether the locks held through each file are
+// exclusive, since Windows provides no way to query them.
+var systemLocks = struct {
+	sync.Mutex
+	files   map[OSFile]bool
+	sweepAt int
+}{files: map[OSFile]bool{}, sweepAt: 16}
+
+func heldLockMode(f OSFile) (exclusive, locked bool) {
+	systemLocks.Lock()
+	defer systemLocks.Unlock()
+	exclusive, locked = systemLocks.files[f]
+	return exclusive, locked
+}
+
+func setLockMode(f OSFile, exclusive bool) {
+	systemLocks.Lock()
+	defer systemLocks.Unlock()
+	systemLocks.files[f] = exclusive
+	if len(systemLocks.files) < systemLocks.sweepAt {
+		return
 	}
-	return nil
+	// Files closed without closeLocked released their locks without us
+	// knowing.
+	for file := range systemLocks.files {
+		if fileClosed(file) {
+			delete(systemLocks.files, file)
+		}
+	}
+	systemLocks.sweepAt = 2*len(systemLocks.files) + 16
 }
 
-func preLock(f OSFile, flags lockFlag) {
-	// The lock promotion and demotion logic is a bit weird. On windows, a handle may
-	// hold both a shared and an exclusive lock on the same file handle, and the handle has
-	// to be unlocked _twice_: the first call unlocks the exclusive lock, and the second the
-	// shared lock. Since we can't query the lock state, rather than performing some locking
-	// operations that leave us in the same state regardless of whether a shared/exclusive
-	// lock is currently held, we simply always unlock prior any operation.
-	//
-	// NOTE: it does mean that on windows, locking and cancelling the context will release the
-	// lock, and Try(R)Lock will release the lock even when it errors out. Too bad!
-
-	_ = unlock(f)
+func systemLockForget(f OSFile) {
+	systemLocks.Lock()
+	defer systemLocks.Unlock()
+	delete(systemLocks.files, f)
 }
 
-func lock(f OSFile, flags lockFlag) error {
-	var sysFlags uint32
+func lockRange(ctx context.Context, h windows.Handle, flags lockFlag, offset, length uint64) error {
+	sysFlags := uint32(windows.LOCKFILE_FAIL_IMMEDIATELY)
 	if (flags & lockExcl) != 0 {
 		sysFlags |= windows.LOCKFILE_EXCLUSIVE_LOCK
 	}
-	if (flags & lockBlock) == 0 {
-		sysFlags |= windows.LOCKFILE_FAIL_IMMEDIATELY
+
+	for {
+		overlapped := windows.Overlapped{Offset: uint32(offset), OffsetHigh: uint32(offset >> 32)}
+		err := windows.LockFileEx(h, sysFlags, 0, uint32(length), uint32(length>>32), &overlapped)
+		switch {
+		case err == nil:
+			return nil
+		case err != windows.ERROR_LOCK_VIOLATION:
+			return wrapSyscallError("LockFileEx", err)
+		case (flags & lockBlock) == 0:
+			return wrapSyscallError("LockFileEx", ErrWouldBlock)
+		}
+		if err := waitRange(ctx, h, sysFlags&^windows.LOCKFILE_FAIL_IMMEDIATELY, offset, length); err != nil {
+			return err
+		}
+	}
+}
+
+// waitRange waits until the range of the file of h can be locked with
+// sysFlags, or until ctx is done. Handles opened by os.OpenFile only support
+// synchronous I/O, whose lock requests cannot be canceled safely, so it
+// waits on a lock request made through a new handle of the file, opened for
+// overlapped I/O. Since locks belong to handles, and exclude even the other
+// handles of the process, it then releases that lock for the caller to take
+// it through h.
+func waitRange(ctx context.Context, h windows.Handle, sysFlags uint32, offset, length uint64) error {
+	waiter, err := reopenOverlapped(h)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(waiter)
+
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return wrapSyscallError("CreateEvent", err)
 	}
+	defer windows.CloseHandle(event)
 
-	var overlapped windows.Overlapped
-	err := windows.LockFileEx(windows.Handle(f.Fd()), sysFlags, 0, ^uint32(0), ^uint32(0), &overlapped)
+	overlapped := &windows.Overlapped{Offset: uint32(offset), OffsetHigh: uint32(offset >> 32), HEvent: event}
+	err = windows.LockFileEx(waiter, sysFlags, 0, uint32(length), uint32(length>>32), overlapped)
+	if err == windows.ERROR_IO_PENDING {
+		err = waitOverlapped(ctx, waiter, overlapped)
+	}
 	switch {
 	case err == nil:
-		return nil
-	case err == windows.ERROR_OPERATION_ABORTED:
-		return errLockInterrupted
-	case err == windows.ERROR_LOCK_VIOLATION && (flags&lockBlock) == 0:
-		return wrapSyscallError("LockFileEx", ErrWouldBlock)
+		return unlockRange(waiter, offset, length)
+	case err == windows.ERROR_OPERATION_ABORTED && ctx.Err() != nil:
+		return ctx.Err()
 	default:
 		return wrapSyscallError("LockFileEx", err)
 	}
 }
 
-func unlock(f OSFile) error {
-	var overlapped windows.Overlapped
-	return wrapSyscallError("UnlockFileEx", windows.UnlockFileEx(windows.Handle(f.Fd()), 0, ^uint32(0), ^uint32(0), &overlapped))
+// waitOverlapped waits for the overlapped operation on h to complete, and
+// cancels it if ctx is done first.
+func waitOverlapped(ctx context.Context, h windows.Handle, overlapped *windows.Overlapped) error {
+	done := make(chan struct{})
+	canceler := make(chan struct{})
+	go func() {
+		defer close(canceler)
+		select {
+		case <-ctx.Done():
+			// This fails with ERROR_NOT_FOUND if the operation completed
+			// in the meantime, which is fine.
+			_ = windows.CancelIoEx(h, overlapped)
+		case <-done:
+		}
+	}()
+
+	var n uint32
+	err := windows.GetOverlappedResult(h, overlapped, &n, true)
+	close(done)
+	// The canceler must be done with the operation before the caller
+	// closes h.
+	<-canceler
+	return err
 }
 
-func lockGetThread() (any, error) {
-	var thread windows.Handle
-	err := windows.DuplicateHandle(
-		windows.CurrentProcess(),
-		windows.CurrentThread(),
-		windows.CurrentProcess(),
-		&thread,
-		0, false, windows.DUPLICATE_SAME_ACCESS)
-	if err != nil {
-		return nil, wrapSyscallError("DuplicateHandle", err)
+// reopenOverlapped opens a new handle, for overlapped I/O, of the file of h.
+func reopenOverlapped(h windows.Handle) (windows.Handle, error) {
+	const share = windows.FILE_SHARE_READ | windows.FILE_SHARE_WRITE | windows.FILE_SHARE_DELETE
+
+	var err error
+	// LockFileEx needs either read or write access; files might only
+	// grant one of them.
+	for _, access := range []uint32{windows.GENERIC_READ, windows.GENERIC_WRITE} {
+		r1, _, e1 := syscall.SyscallN(procReOpenFile.Addr(), uintptr(h), uintptr(access), share, windows.FILE_FLAG_OVERLAPPED)
+		if windows.Handle(r1) != windows.InvalidHandle {
+			return windows.Handle(r1), nil
+		}
+		err = e1
+		if e1 != windows.ERROR_ACCESS_DENIED {
+			break
+		}
+	}
+	return windows.InvalidHandle, wrapSyscallError("ReOpenFile", err)
+}
+
+func unlockRange(h windows.Handle, offset, length uint64) error {
+	overlapped := windows.Overlapped{Offset: uint32(offset), OffsetHigh: uint32(offset >> 32)}
+	return wrapSyscallError("UnlockFileEx", windows.UnlockFileEx(h, 0, uint32(length), uint32(length>>32), &overlapped))
+}
+
+func lock(f OSFile, flags lockFlag) error {
+	return lockContext(context.Background(), f, flags)
+}
+
+func lockContext(ctx context.Context, f OSFile, flags lockFlag) error {
+	h := windows.Handle(f.Fd())
+	exclusive := (flags & lockExcl) != 0
+
+	held, locked := heldLockMode(f)
+	switch {
+	case locked && held == exclusive:
+		return nil
+	case locked && held:
+		// A handle may stack a shared lock on its own exclusive lock,
+		// and unlocking then releases the exclusive lock first, which
+		// demotes the lock without ever releasing it.
+		if err := lockRange(ctx, h, flags, 0, lockRangeLen); err != nil {
+			return err
+		}
+		if err := unlockRange(h, 0, lockRangeLen); err != nil {
+			return err
+		}
+		setLockMode(f, false)
+		return nil
+	case locked:
+		return promote(ctx, f, h, flags)
+	}
+
+	for {
+		if err := lockRange(ctx, h, flags, 0, lockRangeLen); err != nil {
+			return err
+		}
+		err := lockRange(ctx, h, 0, guardOffset, 1)
+		if err == nil {
+			_ = unlockRange(h, guardOffset, 1)
+			setLockMode(f, exclusive)
+			return nil
+		}
+
+		// Another handle is promoting its lock, and we might have taken
+		// the lock range from under it; give it back.
+		_ = unlockRange(h, 0, lockRangeLen)
+		if !errors.Is(err, ErrWouldBlock) {
+			return err
+		}
+		if (flags & lockBlock) == 0 {
+			return err
+		}
+		if err := lockRange(ctx, h, lockBlock, guardOffset, 1); err != nil {
+			return err
+		}
+		_ = unlockRange(h, guardOffset, 1)
 	}
-	return thread, nil
 }
 
-func lockCloseThread(thread any) {
-	windows.CloseHandle(thread.(windows.Handle))
+// promote promotes the shared lock held through f to an exclusive lock. If
+// it fails, the shared lock is kept.
+func promote(ctx context.Context, f OSFile, h windows.Handle, flags lockFlag) error {
+	for attempt := 1; ; attempt++ {
+		err := lockRange(ctx, h, lockExcl, guardOffset, 1)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrWouldBlock) || (flags&lockBlock) == 0 {
+			return err
+		}
+		if attempt == guardAttempts {
+			return wrapSyscallError("LockFileEx", windows.ERROR_POSSIBLE_DEADLOCK)
+		}
+		timer := time.NewTimer(time.Duration(attempt) * time.Millisecond)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	defer unlockRange(h, guardOffset, 1)
+
+	if err := unlockRange(h, 0, lockRangeLen); err != nil {
+		return err
+	}
+	err := lockRange(ctx, h, flags, 0, lockRangeLen)
+	if err == nil {
+		setLockMode(f, true)
+		return nil
+	}
+
+	// Take the shared lock back. Other handles give up the lock range
+	// while we hold the guard, so this can only wait for them to do so,
+	// which ctx must not cancel.
+	if rerr := lockRange(context.Background(), h, lockBlock, 0, lockRangeLen); rerr != nil {
+		systemLockForget(f)
+		return rerr
+	}
+	return err
 }
 
-func lockInterrupt(thread any) error {
-	return cancelSynchronousIo(thread.(windows.Handle))
+func unlock(f OSFile, flags lockFlag) error {
+	systemLockForget(f)
+	return unlockRange(windows.Handle(f.Fd()), 0, lockRangeLen)
+}
+
+func lockGetThread() (any, error) {
+	return nil, nil
+}
+
+func lockCloseThread(any) {}
+
+func lockInterrupt(any) error {
+	return nil
 }
@@ -0,0 +1,85 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build windows
+// +build windows
+
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestLockConversionWindows(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Promote", func(t *testing.T) {
+		locks := makeLockfiles(t, filepath.Join(t.TempDir(), "lock"), 3)
+		f1, f2, f3 := <-locks, <-locks, <-locks
+		if f1 == nil || f2 == nil || f3 == nil {
+			t.FailNow()
+		}
+		defer closeLocked(f1)
+		defer closeLocked(f2)
+		defer closeLocked(f3)
+
+		if err := RLock(ctx, f1); err != nil {
+			t.Fatal(err)
+		}
+		if err := RLock(ctx, f2); err != nil {
+			t.Fatal(err)
+		}
+		if err := TryLock(f1); !errors.Is(err, ErrWouldBlock) {
+			t.Fatalf("expected %v, got %v", ErrWouldBlock, err)
+		}
+		if err := Unlock(f2); err != nil {
+			t.Fatal(err)
+		}
+
+		// The failed promotion kept the shared lock.
+		if err := TryLock(f3); !errors.Is(err, ErrWouldBlock) {
+			t.Fatalf("expected %v, got %v", ErrWouldBlock, err)
+		}
+		if err := TryLock(f1); err != nil {
+			t.Fatal(err)
+		}
+		if err := TryRLock(f3); !errors.Is(err, ErrWouldBlock) {
+			t.Fatalf("expected %v, got %v", ErrWouldBlock, err)
+		}
+	})
+
+	t.Run("Demote", func(t *testing.T) {
+		locks := makeLockfiles(t, filepath.Join(t.TempDir(), "lock"), 2)
+		f1, f2 := <-locks, <-locks
+		if f1 == nil || f2 == nil {
+			t.FailNow()
+		}
+		defer closeLocked(f1)
+		defer closeLocked(f2)
+
+		if err := Lock(ctx, f1); err != nil {
+			t.Fatal(err)
+		}
+		if err := RLock(ctx, f1); err != nil {
+			t.Fatal(err)
+		}
+		if err := TryRLock(f2); err != nil {
+			t.Fatal(err)
+		}
+		if err := TryLock(f1); !errors.Is(err, ErrWouldBlock) {
+			t.Fatalf("expected %v, got %v", ErrWouldBlock, err)
+		}
+		if err := Unlock(f1); err != nil {
+			t.Fatal(err)
+		}
+		if err := Unlock(f1); err == nil {
+			t.Fatal("expected the lock to be released by a single Unlock")
+		}
+	})
+}
@@ -0,0 +1,148 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrNoLockInfo is matched by the errors returned by ReadLockInfo when the
+// lock file holds no information about its holder.
+var ErrNoLockInfo = errors.New("no lock information")
+
+// lockInfoMagic starts the lock files that hold a LockInfo, which tells them
+// apart from the lock files that double as temporary files.
+const lockInfoMagic = "#go-store lock\n"
+
+// processStart approximates the start time of the process.
+var processStart = time.Now()
+
+// A LockInfo describes the holder of a lock, as recorded in the lock file by
+// stores configured with WithLockInfo, by leases, or with WriteLockInfo.
+type LockInfo struct {
+	// Hostname is the name of the host that the holder runs on.
+	Hostname string `json:"hostname"`
+
+	// PID is the process id of the holder.
+	PID int `json:"pid"`
+
+	// Start is the time at which the holder process started, which tells
+	// it apart from later processes that reuse its process id.
+	Start time.Time `json:"start"`
+
+	// Acquired is the time at which the lock was acquired.
+	Acquired time.Time `json:"acquired"`
+
+	// Expires is the time at which the lock expires unless its holder
+	// renews it, or the zero time if the lock does not expire.
+	Expires time.Time `json:"expires"`
+
+	// Label is the label passed to WithLockInfo or WriteLockInfo.
+	Label string `json:"label,omitempty"`
+}
+
+// Stale reports whether the holder described by info is gone: either the lock
+// expired, or the holder ran on the local host and its process exited. Locks
+// held from other hosts are never stale unless they expire. Since process ids
+// get reused, the holder may also be mistaken for alive, but never for gone.
+func (info *LockInfo) Stale() bool {
+	if !info.Expires.IsZero() && time.Now().After(info.Expires) {
+		return true
+	}
+	host, err := os.Hostname()
+	if err != nil || host != info.Hostname {
+		return false
+	}
+	return !processAlive(info.PID)
+}
+
+// newLockInfo returns the LockInfo of the calling process.
+func newLockInfo(label string) LockInfo {
+	host, _ := os.Hostname()
+	return LockInfo{
+		Hostname: host,
+		PID:      os.Getpid(),
+		Start:    processStart,
+		Acquired: time.Now(),
+		Label:    label,
+	}
+}
+
+// WriteLockInfo records the LockInfo of the calling process, along with the
+// specified label, into f, which must be locked and open for writing. It
+// replaces the contents of f, and is meant for files that are only used as
+// locks.
+func WriteLockInfo(f *os.File, label string) error {
+	_, err := writeLockInfo(f, newLockInfo(label))
+	return err
+}
+
+// writeLockInfo replaces the contents of f with info, and returns the new
+// size of f.
+func writeLockInfo(f File, info LockInfo) (int64, error) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return 0, err
+	}
+	data = append([]byte(lockInfoMagic), append(data, '\n')...)
+
+	// Overwrite the previous contents before truncating what remains of
+	// them, so that concurrent readers never see an empty file.
+	if _, err := f.WriteAt(data, 0); err != nil {
+		return 0, err
+	}
+	if err := f.Truncate(int64(len(data))); err != nil {
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
+
+// ReadLockInfo returns the LockInfo recorded in the lock file at path, which
+// tells who holds the lock, or who last held it if it is not held anymore. It
+// fails with an error wrapping ErrNoLockInfo if the file holds none.
+func ReadLockInfo(path string) (*LockInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeLocked(f)
+	return readLockInfo(f)
+}
+
+// ReadLockInfo is like the package-level ReadLockInfo function, but reads the
+// lock file of the file at path, through the backend of the store.
+//
+// Lock files only hold a LockInfo while they are held by stores configured
+// with WithLockInfo, unless the store was configured with WithStableLockFile,
+// in which case the LockInfo of the last holder remains.
+func (store *Store[T]) ReadLockInfo(path string) (*LockInfo, error) {
+	f, err := store.open(store.lockPath(path), os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFile(f)
+	return readLockInfo(f)
+}
+
+func readLockInfo(f File) (*LockInfo, error) {
+	data, err := io.ReadAll(io.NewSectionReader(f, 0, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	// Only decode the first line, in case a concurrent writeLockInfo did not
+	// truncate the remains of the previous contents yet.
+	var info LockInfo
+	if !bytes.HasPrefix(data, []byte(lockInfoMagic)) || json.NewDecoder(bytes.NewReader(data[len(lockInfoMagic):])).Decode(&info) != nil {
+		return nil, &os.PathError{Op: "readlockinfo", Path: f.Name(), Err: ErrNoLockInfo}
+	}
+	return &info, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLockInfo(t *testing.T) {
+	ctx := context.Background()
+
+	checkInfo := func(t *testing.T, info *LockInfo, label string) {
+		t.Helper()
+		host, _ := os.Hostname()
+		if info.Hostname != host || info.PID != os.Getpid() || info.Label != label {
+			t.Fatalf("unexpected lock info %+v", info)
+		}
+		if !info.Start.Equal(processStart) || info.Acquired.Before(info.Start) {
+			t.Fatalf("unexpected times in lock info %+v", info)
+		}
+	}
+
+	t.Run("Held", func(t *testing.T) {
+		store := New[int](json.NewEncoder, json.NewDecoder, WithLockInfo("held"))
+		path := filepath.Join(t.TempDir(), "state.json")
+
+		err := store.LoadAndStoreExclusive(ctx, path, 0666, func(ctx context.Context, val *int, err error) error {
+			info, err := store.ReadLockInfo(path)
+			if err != nil {
+				return err
+			}
+			checkInfo(t, info, "held")
+			*val = 42
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The lock file doubles as the temporary file, so the information
+		// must not leak into the stored contents.
+		var val int
+		if _, err := store.Load(ctx, path, &val); err != nil {
+			t.Fatal(err)
+		}
+		if val != 42 {
+			t.Fatalf("expected 42, got %d", val)
+		}
+		if _, err := store.ReadLockInfo(path); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected the lock file to be gone, got %v", err)
+		}
+	})
+
+	t.Run("StableLockFile", func(t *testing.T) {
+		store := New[int](json.NewEncoder, json.NewDecoder, WithStableLockFile(), WithLockInfo("stable"))
+		path := filepath.Join(t.TempDir(), "state.json")
+
+		val := 1
+		if err := store.ForceStore(ctx, path, 0666, &val); err != nil {
+			t.Fatal(err)
+		}
+		info, err := store.ReadLockInfo(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkInfo(t, info, "stable")
+
+		info, err = ReadLockInfo(path + ".lockfile")
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkInfo(t, info, "stable")
+	})
+
+	t.Run("NoInfo", func(t *testing.T) {
+		store := New[int](json.NewEncoder, json.NewDecoder, WithStableLockFile())
+		path := filepath.Join(t.TempDir(), "state.json")
+
+		val := 1
+		if err := store.ForceStore(ctx, path, 0666, &val); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.ReadLockInfo(path); !errors.Is(err, ErrNoLockInfo) {
+			t.Fatalf("expected %v, got %v", ErrNoLockInfo, err)
+		}
+	})
+
+	t.Run("WriteLockInfo", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "lock")
+		if err := os.WriteFile(path, []byte("some longer previous contents"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := Lock(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteLockInfo(f, "manual"); err != nil {
+			t.Fatal(err)
+		}
+		info, err := ReadLockInfo(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkInfo(t, info, "manual")
+	})
+}
@@ -0,0 +1,131 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// LockOptions configure lock acquisitions that may block for long, so that
+// they get reported, and optionally give up.
+type LockOptions struct {
+	// Style is the style of locks to use.
+	Style LockStyle
+
+	// Timeout, if positive, bounds how long to wait for the lock, after
+	// which acquiring it fails with context.DeadlineExceeded.
+	Timeout time.Duration
+
+	// WarnAfter is how long to wait for the lock before calling OnWaiting,
+	// which then keeps getting called at the same interval until the lock
+	// is acquired.
+	WarnAfter time.Duration
+
+	// OnWaiting gets called, from another goroutine, while waiting for the
+	// lock of the file at path, with the time waited so far, and with the
+	// holder of the lock if it recorded itself, as with WithLockInfo, or
+	// nil otherwise. It is never called once acquiring the lock returned.
+	OnWaiting func(path string, waited time.Duration, holder *LockInfo)
+
+	// TracerProvider, if set, is used to emit an OpenTelemetry span for
+	// each lock acquisition, which records the path of the file and the
+	// time spent waiting for the lock, like WithTracerProvider does for
+	// the operations of stores.
+	TracerProvider trace.TracerProvider
+}
+
+// Lock is like the package-level Lock function, but uses locks of the style
+// of opts, and waits for them as configured by opts.
+func (opts LockOptions) Lock(ctx context.Context, f OSFile) (err error) {
+	ctx, span := opts.startSpan(ctx, "Lock", f.Name())
+	defer func() { endSpan(span, err) }()
+
+	start := time.Now()
+	err = opts.wait(ctx, f.Name(), lockFileHolder(f), func(ctx context.Context) error {
+		return opts.Style.Lock(ctx, f)
+	})
+	traceLockWait(span, start)
+	return err
+}
+
+// RLock is like the package-level RLock function, but uses locks of the style
+// of opts, and waits for them as configured by opts.
+func (opts LockOptions) RLock(ctx context.Context, f OSFile) (err error) {
+	ctx, span := opts.startSpan(ctx, "RLock", f.Name())
+	defer func() { endSpan(span, err) }()
+
+	start := time.Now()
+	err = opts.wait(ctx, f.Name(), lockFileHolder(f), func(ctx context.Context) error {
+		return opts.Style.RLock(ctx, f)
+	})
+	traceLockWait(span, start)
+	return err
+}
+
+// startSpan starts a span for the specified lock operation. It returns a nil
+// span when tracing is disabled.
+func (opts LockOptions) startSpan(ctx context.Context, op, path string) (context.Context, trace.Span) {
+	if opts.TracerProvider == nil {
+		return ctx, nil
+	}
+	tracer := opts.TracerProvider.Tracer(tracerName)
+	return tracer.Start(ctx, "store."+op, trace.WithAttributes(attribute.String("store.path", path)))
+}
+
+// lockFileHolder returns a function that reads the holder recorded in f.
+func lockFileHolder(f OSFile) func() *LockInfo {
+	return func() *LockInfo {
+		info, _ := ReadLockInfo(f.Name())
+		return info
+	}
+}
+
+// wait calls lock, and calls OnWaiting at every WarnAfter interval while it
+// blocks.
+func (opts LockOptions) wait(ctx context.Context, path string, holder func() *LockInfo, lock func(ctx context.Context) error) error {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	if opts.OnWaiting == nil || opts.WarnAfter <= 0 {
+		return lock(ctx)
+	}
+
+	start := time.Now()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(opts.WarnAfter)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			select {
+			case <-done:
+				return
+			default:
+			}
+			opts.OnWaiting(path, time.Since(start), holder())
+		}
+	}()
+
+	err := lock(ctx)
+	close(done)
+	wg.Wait()
+	return err
+}
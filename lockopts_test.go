@@ -0,0 +1,123 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockOptions(t *testing.T) {
+	ctx := context.Background()
+
+	// waits records the calls to OnWaiting.
+	type waits struct {
+		mu      sync.Mutex
+		holders []*LockInfo
+	}
+	onWaiting := func(w *waits) func(string, time.Duration, *LockInfo) {
+		return func(path string, waited time.Duration, holder *LockInfo) {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			w.holders = append(w.holders, holder)
+		}
+	}
+
+	t.Run("Timeout", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "lock")
+		holder, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer holder.Close()
+		if err := Lock(ctx, holder); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteLockInfo(holder, "holder"); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		var w waits
+		opts := LockOptions{Timeout: 100 * time.Millisecond, WarnAfter: 10 * time.Millisecond, OnWaiting: onWaiting(&w)}
+		if err := opts.Lock(ctx, f); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if len(w.holders) < 2 {
+			t.Fatalf("expected OnWaiting to be called repeatedly, got %d calls", len(w.holders))
+		}
+		if h := w.holders[0]; h == nil || h.PID != os.Getpid() || h.Label != "holder" {
+			t.Fatalf("expected the recorded holder, got %+v", h)
+		}
+	})
+
+	t.Run("Uncontended", func(t *testing.T) {
+		f, err := os.Create(filepath.Join(t.TempDir(), "lock"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		var w waits
+		opts := LockOptions{WarnAfter: time.Millisecond, OnWaiting: onWaiting(&w)}
+		if err := opts.RLock(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if len(w.holders) != 0 {
+			t.Fatal("expected OnWaiting not to be called")
+		}
+	})
+
+	t.Run("Store", func(t *testing.T) {
+		var w waits
+		holder := New[int](json.NewEncoder, json.NewDecoder, WithStableLockFile(), WithLockInfo("holder"))
+		store := New[int](json.NewEncoder, json.NewDecoder, WithStableLockFile(),
+			WithLockOptions(LockOptions{WarnAfter: 10 * time.Millisecond, OnWaiting: onWaiting(&w)}))
+		path := filepath.Join(t.TempDir(), "state.json")
+
+		stored := make(chan error, 1)
+		err := holder.LoadAndStoreExclusive(ctx, path, 0666, func(ctx context.Context, val *int, err error) error {
+			go func() {
+				v := 2
+				stored <- store.ForceStore(ctx, path, 0666, &v)
+			}()
+			time.Sleep(50 * time.Millisecond)
+			*val = 1
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := <-stored; err != nil {
+			t.Fatal(err)
+		}
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if len(w.holders) == 0 {
+			t.Fatal("expected OnWaiting to be called")
+		}
+		if h := w.holders[0]; h == nil || h.Label != "holder" {
+			t.Fatalf("expected the recorded holder, got %+v", h)
+		}
+	})
+}
@@ -0,0 +1,62 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// logFunc emits a debug event, with the attributes of args given as
+// alternating keys and values, like (*slog.Logger).DebugContext.
+type logFunc func(ctx context.Context, msg string, args ...any)
+
+// lockLog emits the debug events of the lock functions of the package; it is
+// set with SetLogger.
+var lockLog atomic.Pointer[logFunc]
+
+// debugLock emits a debug event of the lock functions of the package.
+func debugLock(ctx context.Context, msg string, args ...any) {
+	if logf := lockLog.Load(); logf != nil {
+		(*logf)(ctx, msg, args...)
+	}
+}
+
+// lockAcquired registers the lock acquired on f and emits a debug event for
+// it, unless err is non-nil, and returns err.
+func lockAcquired(ctx context.Context, f OSFile, exclusive bool, err error) error {
+	if err == nil {
+		registerLock(f, exclusive)
+		debugLock(ctx, "lock acquired", "path", f.Name(), "exclusive", exclusive)
+	}
+	return err
+}
+
+// lockReleased unregisters the lock released on f and emits a debug event for
+// it, unless err is non-nil, and returns err.
+func lockReleased(f OSFile, err error) error {
+	if err == nil {
+		unregisterLock(f)
+		selfLockRelease(f)
+		localLockRelease(f)
+		debugLock(context.Background(), "lock released", "path", f.Name())
+	}
+	return err
+}
+
+// debug emits a debug event of the store.
+func (store *Store[T]) debug(ctx context.Context, msg string, args ...any) {
+	if store.opts.logf != nil {
+		store.opts.logf(ctx, msg, args...)
+	}
+}
+
+// release closes the lock file lf, which releases its lock.
+func (store *Store[T]) release(ctx context.Context, lf File) error {
+	store.debug(ctx, "lock released", "path", lf.Name())
+	return closeFile(lf)
+}
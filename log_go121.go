@@ -0,0 +1,37 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build go1.21
+// +build go1.21
+
+package store
+
+import "log/slog"
+
+// WithLogger configures the store to emit debug events to the specified
+// logger: when it acquires and releases the locks of files, and when it
+// retries because the destination changed while waiting for its lock, or
+// because another process pulled the lock file from under it.
+//
+// By default, no events are emitted.
+func WithLogger(l *slog.Logger) Option {
+	return func(opts *options) {
+		opts.logf = l.DebugContext
+	}
+}
+
+// SetLogger sets the logger to which the lock functions of the package, such
+// as Lock, TryLock and Unlock, and their LockStyle variants, emit debug
+// events when they acquire and release locks. A nil logger disables them,
+// which is the default.
+func SetLogger(l *slog.Logger) {
+	if l == nil {
+		lockLog.Store(nil)
+		return
+	}
+	logf := logFunc(l.DebugContext)
+	lockLog.Store(&logf)
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build go1.21
+// +build go1.21
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// logRecorder records the messages of the events of a logger.
+type logRecorder struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (r *logRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.buf.Write(p)
+}
+
+func (r *logRecorder) logger() *slog.Logger {
+	return slog.New(slog.NewJSONHandler(r, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func (r *logRecorder) messages(t *testing.T) map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	msgs := make(map[string]int)
+	dec := json.NewDecoder(&r.buf)
+	for dec.More() {
+		var event struct {
+			Msg string `json:"msg"`
+		}
+		if err := dec.Decode(&event); err != nil {
+			t.Fatal(err)
+		}
+		msgs[event.Msg]++
+	}
+	return msgs
+}
+
+func TestLogger(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Store", func(t *testing.T) {
+		var rec logRecorder
+		store := New[int](json.NewEncoder, json.NewDecoder, WithLogger(rec.logger()))
+		other := New[int](json.NewEncoder, json.NewDecoder)
+		path := filepath.Join(t.TempDir(), "state.json")
+
+		attempts := 0
+		err := store.LoadAndStore(ctx, path, 0666, func(ctx context.Context, val *int, err error) error {
+			attempts++
+			if attempts == 1 {
+				// Change the destination under the store, so that it
+				// retries.
+				v := 1
+				if err := other.ForceStore(ctx, path, 0666, &v); err != nil {
+					return err
+				}
+			}
+			*val = 2
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msgs := rec.messages(t)
+		for _, msg := range []string{"lock acquired", "lock released", "destination changed while waiting for the lock", "retrying"} {
+			if msgs[msg] == 0 {
+				t.Errorf("expected a %q event, got %v", msg, msgs)
+			}
+		}
+		if msgs["lock acquired"] != msgs["lock released"] {
+			t.Errorf("expected every acquired lock to be released, got %v", msgs)
+		}
+	})
+
+	t.Run("Lock", func(t *testing.T) {
+		var rec logRecorder
+		SetLogger(rec.logger())
+		defer SetLogger(nil)
+
+		f, err := os.Create(filepath.Join(t.TempDir(), "lock"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := Lock(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+		if err := Unlock(f); err != nil {
+			t.Fatal(err)
+		}
+
+		msgs := rec.messages(t)
+		if msgs["lock acquired"] != 1 || msgs["lock released"] != 1 {
+			t.Fatalf("expected one lock acquired and released, got %v", msgs)
+		}
+	})
+}
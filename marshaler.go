@@ -0,0 +1,109 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"encoding"
+	"fmt"
+	"io"
+)
+
+// NewBinary returns a Store for values of a type T that marshals itself with
+// encoding.BinaryMarshaler and encoding.BinaryUnmarshaler. The contents of
+// files are the output of MarshalBinary as-is.
+//
+// Basic usage is:
+//
+//	st := store.NewBinary[netip.Addr]()
+func NewBinary[T any, PT interface {
+	*T
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}](opts ...Option) *Store[T] {
+	return New[T](newBinaryEncoder, newBinaryDecoder, opts...)
+}
+
+// NewText returns a Store for values of a type T that marshals itself with
+// encoding.TextMarshaler and encoding.TextUnmarshaler. The contents of files
+// are the output of MarshalText as-is.
+func NewText[T any, PT interface {
+	*T
+	encoding.TextMarshaler
+	encoding.TextUnmarshaler
+}](opts ...Option) *Store[T] {
+	return New[T](newTextEncoder, newTextDecoder, opts...)
+}
+
+type marshalerEncoder struct {
+	w    io.Writer
+	text bool
+}
+
+func newBinaryEncoder(w io.Writer) *marshalerEncoder {
+	return &marshalerEncoder{w: w}
+}
+
+func newTextEncoder(w io.Writer) *marshalerEncoder {
+	return &marshalerEncoder{w: w, text: true}
+}
+
+func (enc *marshalerEncoder) Encode(v any) error {
+	var (
+		data []byte
+		err  error
+	)
+	if enc.text {
+		m, ok := v.(encoding.TextMarshaler)
+		if !ok {
+			return fmt.Errorf("%T does not implement encoding.TextMarshaler", v)
+		}
+		data, err = m.MarshalText()
+	} else {
+		m, ok := v.(encoding.BinaryMarshaler)
+		if !ok {
+			return fmt.Errorf("%T does not implement encoding.BinaryMarshaler", v)
+		}
+		data, err = m.MarshalBinary()
+	}
+	if err != nil {
+		return err
+	}
+	_, err = enc.w.Write(data)
+	return err
+}
+
+type marshalerDecoder struct {
+	r    io.Reader
+	text bool
+}
+
+func newBinaryDecoder(r io.Reader) *marshalerDecoder {
+	return &marshalerDecoder{r: r}
+}
+
+func newTextDecoder(r io.Reader) *marshalerDecoder {
+	return &marshalerDecoder{r: r, text: true}
+}
+
+func (dec *marshalerDecoder) Decode(v any) error {
+	data, err := io.ReadAll(dec.r)
+	if err != nil {
+		return err
+	}
+	if dec.text {
+		u, ok := v.(encoding.TextUnmarshaler)
+		if !ok {
+			return fmt.Errorf("%T does not implement encoding.TextUnmarshaler", v)
+		}
+		return u.UnmarshalText(data)
+	}
+	u, ok := v.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return fmt.Errorf("%T does not implement encoding.BinaryUnmarshaler", v)
+	}
+	return u.UnmarshalBinary(data)
+}
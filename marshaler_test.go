@@ -0,0 +1,89 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMarshaler(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Binary", func(t *testing.T) {
+		store := NewBinary[time.Time]()
+		path := filepath.Join(t.TempDir(), "time")
+
+		expected := time.Date(2023, 5, 17, 12, 30, 0, 42, time.UTC)
+		if err := store.Store(ctx, path, 0666, &expected, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := expected.MarshalBinary()
+		if string(data) != string(raw) {
+			t.Fatalf("expected file to hold %q, got %q", raw, data)
+		}
+
+		var val time.Time
+		if _, err := store.Load(ctx, path, &val); err != nil {
+			t.Fatal(err)
+		}
+		if !val.Equal(expected) {
+			t.Fatalf("expected %v, got %v", expected, val)
+		}
+	})
+
+	t.Run("Text", func(t *testing.T) {
+		store := NewText[netip.Addr]()
+		path := filepath.Join(t.TempDir(), "addr")
+
+		expected := netip.MustParseAddr("2001:db8::1")
+		if err := store.Store(ctx, path, 0666, &expected, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "2001:db8::1" {
+			t.Fatalf("expected file to hold %q, got %q", "2001:db8::1", data)
+		}
+
+		var val netip.Addr
+		if _, err := store.Load(ctx, path, &val); err != nil {
+			t.Fatal(err)
+		}
+		if val != expected {
+			t.Fatalf("expected %v, got %v", expected, val)
+		}
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		store := NewText[netip.Addr]()
+		path := filepath.Join(t.TempDir(), "addr")
+
+		if err := os.WriteFile(path, []byte("not an address"), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		var val netip.Addr
+		var decodeErr *DecodeError
+		if _, err := store.Load(ctx, path, &val); !errors.As(err, &decodeErr) {
+			t.Fatalf("expected a DecodeError, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,514 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+// Package memstore provides an in-memory store.Backend, which lets tests of
+// code that uses stores run hermetically and in parallel, without touching the
+// file system or taking locks of the operating system.
+//
+// Basic usage is:
+//
+//	st := store.New[Type](json.NewEncoder, json.NewDecoder, store.WithBackend(memstore.New()))
+package memstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"barney.ci/go-store"
+)
+
+// errBadFile is returned when reading from a file that was opened write-only,
+// or writing to a file that was opened read-only.
+var errBadFile = errors.New("bad file descriptor")
+
+// An FS is an in-memory file system, which implements store.Backend.
+//
+// Directories are implicit: every directory exists, and holds the files whose
+// names are beneath it. Files can be renamed and hard-linked like on POSIX
+// file systems, and locks behave like flock(2) locks, except that they are
+// released by the FS itself rather than by the operating system.
+//
+// Stores using an FS share their files and locks with the other stores using
+// the same FS, and with no one else.
+type FS struct {
+	mu    sync.Mutex
+	files map[string]*inode
+	ino   uint64
+}
+
+// New returns a new, empty FS.
+func New() *FS {
+	return &FS{files: make(map[string]*inode)}
+}
+
+// An inode holds the contents and the locks of a file, which may have any
+// number of names.
+type inode struct {
+	ino     uint64
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+
+	// excl holds the exclusive lock of the file, and shared its shared
+	// locks. wake gets closed when any lock gets released.
+	excl   *file
+	shared map[*file]struct{}
+	wake   chan struct{}
+}
+
+// unlock releases the lock held by f, if any.
+func (n *inode) unlock(f *file) {
+	_, ok := n.shared[f]
+	if n.excl != f && !ok {
+		return
+	}
+	if n.excl == f {
+		n.excl = nil
+	}
+	delete(n.shared, f)
+	if n.wake != nil {
+		close(n.wake)
+		n.wake = nil
+	}
+}
+
+// A file is an open file of an FS.
+type file struct {
+	fsys   *FS
+	name   string
+	node   *inode
+	flag   int
+	off    int64
+	closed bool
+}
+
+func clean(name string) string {
+	return filepath.Clean(name)
+}
+
+// OpenFile opens the named file like os.OpenFile, honoring the access mode
+// and the os.O_CREATE, os.O_EXCL, os.O_TRUNC and os.O_APPEND flags.
+func (fsys *FS) OpenFile(name string, flag int, perm fs.FileMode) (store.File, error) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	n := fsys.files[clean(name)]
+	switch {
+	case n == nil && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case n == nil:
+		fsys.ino++
+		n = &inode{ino: fsys.ino, mode: perm & fs.ModePerm, modTime: time.Now()}
+		fsys.files[clean(name)] = n
+	case flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case flag&os.O_TRUNC != 0 && writable(flag):
+		n.data = nil
+		n.modTime = time.Now()
+	}
+	return &file{fsys: fsys, name: name, node: n, flag: flag}, nil
+}
+
+func readable(flag int) bool {
+	return flag&(os.O_RDONLY|os.O_WRONLY|os.O_RDWR) != os.O_WRONLY
+}
+
+func writable(flag int) bool {
+	return flag&(os.O_WRONLY|os.O_RDWR) != 0
+}
+
+// file returns the open file of fsys behind f.
+func (fsys *FS) file(op string, f store.File) (*file, error) {
+	mf, ok := f.(*file)
+	if !ok || mf.fsys != fsys {
+		return nil, &fs.PathError{Op: op, Path: f.Name(), Err: fs.ErrInvalid}
+	}
+	if mf.closed {
+		return nil, &fs.PathError{Op: op, Path: mf.name, Err: fs.ErrClosed}
+	}
+	return mf, nil
+}
+
+// Rename moves the file at the name of f to newname, replacing any file at
+// newname.
+func (fsys *FS) Rename(f store.File, newname string) error {
+	mf, err := fsys.file("rename", f)
+	if err != nil {
+		return err
+	}
+
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	n := fsys.files[clean(mf.name)]
+	if n == nil {
+		return &os.LinkError{Op: "rename", Old: mf.name, New: newname, Err: fs.ErrNotExist}
+	}
+	// Like rename(2), renaming a file over another name of the same file
+	// does nothing.
+	if fsys.files[clean(newname)] == n {
+		return nil
+	}
+	fsys.files[clean(newname)] = n
+	delete(fsys.files, clean(mf.name))
+	return nil
+}
+
+// Link creates newname as a hard link to the file at oldname.
+func (fsys *FS) Link(oldname, newname string) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	n := fsys.files[clean(oldname)]
+	if n == nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+	if fsys.files[clean(newname)] != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrExist}
+	}
+	fsys.files[clean(newname)] = n
+	return nil
+}
+
+// Remove removes the named file.
+func (fsys *FS) Remove(name string) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	if fsys.files[clean(name)] == nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(fsys.files, clean(name))
+	return nil
+}
+
+// Lstat returns the metadata of the named file.
+func (fsys *FS) Lstat(name string) (store.FileStat, error) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	n := fsys.files[clean(name)]
+	if n == nil {
+		return store.FileStat{}, &fs.PathError{Op: "lstat", Path: name, Err: fs.ErrNotExist}
+	}
+	return store.FileStat{Dev: 1, Ino: n.ino, Size: int64(len(n.data)), ModTime: n.modTime}, nil
+}
+
+// Fstat returns the metadata of f.
+func (fsys *FS) Fstat(f store.File) (store.FileStat, error) {
+	mf, err := fsys.file("fstat", f)
+	if err != nil {
+		return store.FileStat{}, err
+	}
+
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	return store.FileStat{Dev: 1, Ino: mf.node.ino, Size: int64(len(mf.node.data)), ModTime: mf.node.modTime}, nil
+}
+
+// ReadDir returns the entries of the named directory, sorted by name.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	dir := clean(name)
+	entries := make(map[string]fs.DirEntry)
+	for path, n := range fsys.files {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if i := strings.IndexRune(rel, filepath.Separator); i >= 0 {
+			entries[rel[:i]] = dirEntry{name: rel[:i], mode: fs.ModeDir | 0777}
+			continue
+		}
+		entries[rel] = dirEntry{name: rel, mode: n.mode, info: n.info(rel)}
+	}
+
+	list := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list, nil
+}
+
+// Lock acquires an exclusive lock on f.
+func (fsys *FS) Lock(ctx context.Context, f store.File) error {
+	return fsys.lock(ctx, f, true, true)
+}
+
+// RLock acquires a shared lock on f.
+func (fsys *FS) RLock(ctx context.Context, f store.File) error {
+	return fsys.lock(ctx, f, false, true)
+}
+
+// TryLock acquires an exclusive lock on f, or fails with an error wrapping
+// store.ErrWouldBlock if it is not available.
+func (fsys *FS) TryLock(f store.File) error {
+	return fsys.lock(context.Background(), f, true, false)
+}
+
+func (fsys *FS) lock(ctx context.Context, f store.File, exclusive, block bool) error {
+	mf, err := fsys.file("lock", f)
+	if err != nil {
+		return err
+	}
+
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	// Like with flock(2), converting a lock releases it first.
+	n := mf.node
+	n.unlock(mf)
+	for {
+		if mf.closed {
+			return &fs.PathError{Op: "lock", Path: mf.name, Err: fs.ErrClosed}
+		}
+		if n.excl == nil && (!exclusive || len(n.shared) == 0) {
+			if exclusive {
+				n.excl = mf
+			} else {
+				if n.shared == nil {
+					n.shared = make(map[*file]struct{})
+				}
+				n.shared[mf] = struct{}{}
+			}
+			return nil
+		}
+		if !block {
+			return &fs.PathError{Op: "lock", Path: mf.name, Err: store.ErrWouldBlock}
+		}
+
+		if n.wake == nil {
+			n.wake = make(chan struct{})
+		}
+		wake := n.wake
+		fsys.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			fsys.mu.Lock()
+			return ctx.Err()
+		case <-wake:
+		}
+		fsys.mu.Lock()
+	}
+}
+
+func (f *file) Name() string {
+	return f.name
+}
+
+// check returns an error if f is closed, or was not opened for the specified
+// access. The lock of the FS must be held.
+func (f *file) check(op string, access func(int) bool) error {
+	switch {
+	case f.closed:
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	case access != nil && !access(f.flag):
+		return &fs.PathError{Op: op, Path: f.name, Err: errBadFile}
+	}
+	return nil
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	n, err := f.readAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	n, err := f.readAt(p, off)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *file) readAt(p []byte, off int64) (int, error) {
+	if err := f.check("read", readable); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if off >= int64(len(f.node.data)) {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	return copy(p, f.node.data[off:]), nil
+}
+
+func (f *file) Write(p []byte) (int, error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	if f.flag&os.O_APPEND != 0 {
+		f.off = int64(len(f.node.data))
+	}
+	n, err := f.writeAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *file) WriteAt(p []byte, off int64) (int, error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	return f.writeAt(p, off)
+}
+
+func (f *file) writeAt(p []byte, off int64) (int, error) {
+	if err := f.check("write", writable); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrInvalid}
+	}
+	n := f.node
+	if end := off + int64(len(p)); end > int64(len(n.data)) {
+		n.data = append(n.data, make([]byte, end-int64(len(n.data)))...)
+	}
+	copy(n.data[off:], p)
+	n.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	if err := f.check("seek", nil); err != nil {
+		return 0, err
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	if err := f.check("stat", nil); err != nil {
+		return nil, err
+	}
+	return f.node.info(filepath.Base(f.name)), nil
+}
+
+func (f *file) Sync() error {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	return f.check("sync", nil)
+}
+
+func (f *file) Truncate(size int64) error {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	if err := f.check("truncate", writable); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &fs.PathError{Op: "truncate", Path: f.name, Err: fs.ErrInvalid}
+	}
+	n := f.node
+	if size <= int64(len(n.data)) {
+		n.data = n.data[:size:size]
+	} else {
+		n.data = append(n.data, make([]byte, size-int64(len(n.data)))...)
+	}
+	n.modTime = time.Now()
+	return nil
+}
+
+// Chmod changes the permissions of the file, which lets stores configured
+// with store.WithExactMode set them.
+func (f *file) Chmod(mode fs.FileMode) error {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	if err := f.check("chmod", nil); err != nil {
+		return err
+	}
+	f.node.mode = mode & fs.ModePerm
+	return nil
+}
+
+// Close closes the file, releasing its lock.
+func (f *file) Close() error {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	if err := f.check("close", nil); err != nil {
+		return err
+	}
+	f.closed = true
+	f.node.unlock(f)
+	return nil
+}
+
+func (n *inode) info(name string) fs.FileInfo {
+	return fileInfo{name: name, size: int64(len(n.data)), mode: n.mode, modTime: n.modTime}
+}
+
+// fileInfo describes a file of an FS.
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) Mode() fs.FileMode  { return fi.mode }
+func (fi fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi fileInfo) Sys() any           { return nil }
+
+// dirEntry is an entry of a directory of an FS.
+type dirEntry struct {
+	name string
+	mode fs.FileMode
+	info fs.FileInfo
+}
+
+func (e dirEntry) Name() string      { return e.name }
+func (e dirEntry) IsDir() bool       { return e.mode.IsDir() }
+func (e dirEntry) Type() fs.FileMode { return e.mode.Type() }
+
+func (e dirEntry) Info() (fs.FileInfo, error) {
+	if e.info == nil {
+		return fileInfo{name: e.name, mode: e.mode}, nil
+	}
+	return e.info, nil
+}
@@ -0,0 +1,183 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package memstore_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"barney.ci/go-store"
+	"barney.ci/go-store/backendtest"
+	"barney.ci/go-store/memstore"
+)
+
+func TestConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) store.Backend {
+		return memstore.New()
+	})
+}
+
+type Counter struct {
+	N int
+}
+
+func TestBackend(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("StoreLoad", func(t *testing.T) {
+		t.Parallel()
+
+		st := store.New[Counter](json.NewEncoder, json.NewDecoder, store.WithBackend(memstore.New()))
+
+		var val Counter
+		if _, err := st.Load(ctx, "counter.json", &val); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected ErrNotExist, got %v", err)
+		}
+		if err := st.Store(ctx, "counter.json", 0666, &Counter{N: 42}, nil); err != nil {
+			t.Fatal(err)
+		}
+		canary, err := st.Load(ctx, "counter.json", &val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val.N != 42 {
+			t.Fatalf("expected 42, got %d", val.N)
+		}
+		if _, err := os.Stat("counter.json"); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("store touched the file system: %v", err)
+		}
+
+		if _, err := st.LoadIfChanged(ctx, "counter.json", canary, &val); err != store.ErrNotModified {
+			t.Fatalf("expected ErrNotModified, got %v", err)
+		}
+		if err := st.Store(ctx, "counter.json", 0666, &Counter{N: 1}, nil); err != store.ErrRetry {
+			t.Fatalf("expected ErrRetry, got %v", err)
+		}
+		if err := st.Delete(ctx, "counter.json", canary); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := st.Load(ctx, "counter.json", &val); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected ErrNotExist, got %v", err)
+		}
+	})
+
+	t.Run("Isolation", func(t *testing.T) {
+		t.Parallel()
+
+		a := store.New[Counter](json.NewEncoder, json.NewDecoder, store.WithBackend(memstore.New()))
+		b := store.New[Counter](json.NewEncoder, json.NewDecoder, store.WithBackend(memstore.New()))
+
+		if err := a.Store(ctx, "counter.json", 0666, &Counter{N: 1}, nil); err != nil {
+			t.Fatal(err)
+		}
+		var val Counter
+		if _, err := b.Load(ctx, "counter.json", &val); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected ErrNotExist, got %v", err)
+		}
+	})
+
+	for _, tc := range []struct {
+		name string
+		opts []store.Option
+	}{
+		{name: "Concurrent"},
+		{name: "ConcurrentStableLockFile", opts: []store.Option{store.WithStableLockFile(), store.WithBackups(2)}},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			st := store.New[Counter](json.NewEncoder, json.NewDecoder, append(tc.opts, store.WithBackend(memstore.New()))...)
+
+			const workers, increments = 8, 50
+
+			var wg sync.WaitGroup
+			errs := make(chan error, workers)
+			for i := 0; i < workers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < increments; j++ {
+						err := st.LoadAndStore(ctx, "dir/counter.json", 0666, func(ctx context.Context, val *Counter, err error) error {
+							if err != nil && !errors.Is(err, os.ErrNotExist) {
+								return err
+							}
+							val.N++
+							return nil
+						})
+						if err != nil {
+							errs <- err
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Fatal(err)
+			}
+
+			var val Counter
+			if _, err := st.Load(ctx, "dir/counter.json", &val); err != nil {
+				t.Fatal(err)
+			}
+			if val.N != workers*increments {
+				t.Fatalf("expected %d, got %d", workers*increments, val.N)
+			}
+		})
+	}
+
+	t.Run("Backups", func(t *testing.T) {
+		t.Parallel()
+
+		st := store.New[Counter](json.NewEncoder, json.NewDecoder, store.WithBackend(memstore.New()), store.WithBackups(2))
+		for i := 1; i <= 3; i++ {
+			if err := st.ForceStore(ctx, "counter.json", 0666, &Counter{N: i}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for k, expected := range []int{3, 2, 1} {
+			var val Counter
+			if err := st.LoadVersion(ctx, "counter.json", k, &val); err != nil {
+				t.Fatal(err)
+			}
+			if val.N != expected {
+				t.Fatalf("version %d: expected %d, got %d", k, expected, val.N)
+			}
+		}
+	})
+
+	t.Run("KV", func(t *testing.T) {
+		t.Parallel()
+
+		st := store.New[Counter](json.NewEncoder, json.NewDecoder, store.WithBackend(memstore.New()))
+		kv := store.NewKV(st, "kv", 0666)
+		for _, key := range []string{"b", "a", "c"} {
+			if err := kv.Set(ctx, key, &Counter{N: int(key[0])}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var keys []string
+		err := kv.Range(ctx, func(key string, val *Counter) bool {
+			keys = append(keys, key)
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 3 || keys[0] != "a" || keys[1] != "b" || keys[2] != "c" {
+			t.Fatalf("expected [a b c], got %v", keys)
+		}
+	})
+
+}
@@ -0,0 +1,200 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// A MergeFunc reconciles concurrent changes to a file for LoadAndStoreMerge.
+// It is called with the value that mine was derived from as base, and the
+// value that replaced base in the file in the meantime as theirs, and must
+// update mine so that it applies the changes that it made to base on top of
+// theirs instead. It must not modify base nor theirs.
+//
+// If the function returns ErrNoChange, mine is not stored, and
+// LoadAndStoreMerge returns nil. ThreeWayMerge merges values field by field.
+type MergeFunc[T any] func(ctx context.Context, base, theirs, mine *T) error
+
+// LoadAndStoreMerge is like LoadAndStore, except that when the file changed
+// before the value returned by fn could be stored, it loads the new contents
+// of the file and reconciles them with that value by calling merge, rather
+// than calling fn again on the new contents. This means that fn gets called
+// exactly once, and that updates that commute, such as incrementing counters
+// or adding elements to sets, converge with cheap merges rather than full
+// retries.
+//
+// Retries after conflicts are governed by WithRetryPolicy and WithOnRetry,
+// like those of LoadAndStore.
+func (store *Store[T]) LoadAndStoreMerge(ctx context.Context, path string, mode os.FileMode, fn LoadAndStoreFunc[T], merge MergeFunc[T]) (err error) {
+	ctx, span := store.startSpan(ctx, "LoadAndStoreMerge", path)
+	defer func() { endSpan(span, err) }()
+
+	var base, mine T
+	canary, loadErr := store.loadTwice(ctx, path, &base, &mine)
+	if err := fn(ctx, &mine, loadErr); err != nil {
+		if err == ErrNoChange {
+			return nil
+		}
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := store.Store(ctx, path, mode, &mine, canary)
+		if err != ErrRetry {
+			return err
+		}
+		if span != nil {
+			span.SetAttributes(attribute.Int("store.retries", attempt))
+		}
+		if err := store.retry(ctx, path, attempt); err != nil {
+			return err
+		}
+
+		var theirs T
+		newCanary, err := store.Load(ctx, path, &theirs)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := merge(ctx, &base, &theirs, &mine); err != nil {
+			if err == ErrNoChange {
+				return nil
+			}
+			return err
+		}
+		// mine now derives from theirs, which is the base of the next
+		// merge, if any.
+		base, canary = theirs, newCanary
+	}
+}
+
+// loadTwice loads the file at path into both v1 and v2, which makes v1 a
+// snapshot of the contents that v2 holds before it gets modified.
+func (store *Store[T]) loadTwice(ctx context.Context, path string, v1, v2 *T) (Canary, error) {
+	for {
+		canary, err := store.Load(ctx, path, v1)
+		if err != nil && !errors.Is(err, ErrCorrupt) {
+			return canary, err
+		}
+		canary2, err2 := store.Load(ctx, path, v2)
+		if canary2 == canary {
+			return canary, err2
+		}
+		// The file changed between the loads; load both again.
+		var zero T
+		*v1, *v2 = zero, zero
+	}
+}
+
+// ErrMergeConflict is matched by the errors returned by ThreeWayMerge when
+// both sides changed the same value differently.
+var ErrMergeConflict = errors.New("conflicting changes")
+
+// ThreeWayMerge is a MergeFunc that merges the values of structured
+// documents, such as configuration files, field by field: fields that only
+// one side changed get its new value, and fields that both sides changed to
+// different values fail the merge with an error wrapping ErrMergeConflict,
+// which tells the JSON pointer of the field. Objects, including structs and
+// maps, get merged recursively, while arrays and other values are replaced
+// as a whole. If mine changed nothing that theirs did not change likewise,
+// ThreeWayMerge returns ErrNoChange.
+//
+// Values are compared and merged through their JSON encoding, regardless of
+// the codec of the store, which means that T must round-trip through
+// encoding/json without losing anything.
+func ThreeWayMerge[T any](ctx context.Context, base, theirs, mine *T) error {
+	var docs [3]any
+	for i, v := range []*T{base, theirs, mine} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if err := decodeJSON(b, &docs[i]); err != nil {
+			return err
+		}
+	}
+
+	merged, err := mergeJSON("", docs[0], docs[1], docs[2])
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(merged, docs[1]) {
+		return ErrNoChange
+	}
+	b, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	var v T
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*mine = v
+	return nil
+}
+
+// jsonPointerEscaper escapes the reference tokens of JSON pointers.
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// jsonAbsent stands for object members that are absent.
+type jsonAbsent struct{}
+
+// mergeJSON merges the decoded JSON documents mine and theirs, which both
+// derive from base, for the member at the specified JSON pointer.
+func mergeJSON(pointer string, base, theirs, mine any) (any, error) {
+	switch {
+	case reflect.DeepEqual(mine, base):
+		return theirs, nil
+	case reflect.DeepEqual(theirs, base), reflect.DeepEqual(theirs, mine):
+		return mine, nil
+	}
+
+	t, tok := theirs.(map[string]any)
+	m, mok := mine.(map[string]any)
+	b, bok := base.(map[string]any)
+	if _, absent := base.(jsonAbsent); absent {
+		// Both sides added the object; merge their members.
+		b, bok = map[string]any{}, true
+	}
+	if !tok || !mok || !bok {
+		return nil, fmt.Errorf("%w at %q", ErrMergeConflict, pointer)
+	}
+
+	merged := make(map[string]any, len(m))
+	member := func(obj map[string]any, k string) any {
+		if v, ok := obj[k]; ok {
+			return v
+		}
+		return jsonAbsent{}
+	}
+	for _, obj := range []map[string]any{b, t, m} {
+		for k := range obj {
+			if _, done := merged[k]; done {
+				continue
+			}
+			v, err := mergeJSON(pointer+"/"+jsonPointerEscaper.Replace(k), member(b, k), member(t, k), member(m, k))
+			if err != nil {
+				return nil, err
+			}
+			merged[k] = v
+		}
+	}
+	for k, v := range merged {
+		if _, absent := v.(jsonAbsent); absent {
+			delete(merged, k)
+		}
+	}
+	return merged, nil
+}
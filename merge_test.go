@@ -0,0 +1,228 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLoadAndStoreMerge(t *testing.T) {
+	ctx := context.Background()
+
+	incr := func(ctx context.Context, val *int, err error) error {
+		*val++
+		return nil
+	}
+	// addDelta applies the increments of mine on top of theirs.
+	var merges atomic.Int64
+	addDelta := func(ctx context.Context, base, theirs, mine *int) error {
+		merges.Add(1)
+		*mine = *theirs + (*mine - *base)
+		return nil
+	}
+
+	t.Run("Counter", func(t *testing.T) {
+		store := New[int](json.NewEncoder, json.NewDecoder, WithRetryPolicy(0, 0, 0))
+		path := filepath.Join(t.TempDir(), "counter.json")
+
+		const total = 100
+		var (
+			calls atomic.Int64
+			wg    sync.WaitGroup
+		)
+		for i := 0; i < total; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := store.LoadAndStoreMerge(ctx, path, 0666, func(ctx context.Context, val *int, err error) error {
+					calls.Add(1)
+					return incr(ctx, val, err)
+				}, addDelta)
+				if err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		var num int
+		if _, err := store.Load(ctx, path, &num); err != nil {
+			t.Fatal(err)
+		}
+		if num != total {
+			t.Fatalf("expected total to be %d, got %d", total, num)
+		}
+		if n := calls.Load(); n != total {
+			t.Fatalf("expected the callback to be called once per call, got %d calls", n)
+		}
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		store := New[int](json.NewEncoder, json.NewDecoder)
+		path := filepath.Join(t.TempDir(), "counter.json")
+		if err := store.ForceStore(ctx, path, 0666, new(int)); err != nil {
+			t.Fatal(err)
+		}
+
+		merges.Store(0)
+		err := store.LoadAndStoreMerge(ctx, path, 0666, func(ctx context.Context, val *int, err error) error {
+			// Another writer beats us to it.
+			v := 10
+			if err := store.ForceStore(ctx, path, 0666, &v); err != nil {
+				return err
+			}
+			*val += 2
+			return nil
+		}, addDelta)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var num int
+		if _, err := store.Load(ctx, path, &num); err != nil {
+			t.Fatal(err)
+		}
+		if num != 12 {
+			t.Fatalf("expected the changes to be merged, got %d", num)
+		}
+		if n := merges.Load(); n != 1 {
+			t.Fatalf("expected a single merge, got %d", n)
+		}
+	})
+
+	t.Run("NoChange", func(t *testing.T) {
+		store := New[int](json.NewEncoder, json.NewDecoder)
+		path := filepath.Join(t.TempDir(), "counter.json")
+		if err := store.ForceStore(ctx, path, 0666, new(int)); err != nil {
+			t.Fatal(err)
+		}
+
+		err := store.LoadAndStoreMerge(ctx, path, 0666, func(ctx context.Context, val *int, err error) error {
+			v := 10
+			if err := store.ForceStore(ctx, path, 0666, &v); err != nil {
+				return err
+			}
+			*val = 10
+			return nil
+		}, func(ctx context.Context, base, theirs, mine *int) error {
+			if *theirs == *mine {
+				return ErrNoChange
+			}
+			return addDelta(ctx, base, theirs, mine)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestThreeWayMerge(t *testing.T) {
+	ctx := context.Background()
+
+	type Config struct {
+		Name  string            `json:"name"`
+		Port  int               `json:"port"`
+		Hosts []string          `json:"hosts"`
+		Tags  map[string]string `json:"tags"`
+	}
+	base := Config{Name: "api", Port: 80, Hosts: []string{"a"}, Tags: map[string]string{"env": "prod"}}
+
+	t.Run("Disjoint", func(t *testing.T) {
+		theirs := base
+		theirs.Port = 8080
+		theirs.Tags = map[string]string{"env": "prod", "team": "infra"}
+		mine := base
+		mine.Hosts = []string{"a", "b"}
+		mine.Tags = map[string]string{"env": "prod", "tier": "1"}
+
+		if err := ThreeWayMerge(ctx, &base, &theirs, &mine); err != nil {
+			t.Fatal(err)
+		}
+		expected := Config{
+			Name:  "api",
+			Port:  8080,
+			Hosts: []string{"a", "b"},
+			Tags:  map[string]string{"env": "prod", "team": "infra", "tier": "1"},
+		}
+		if !reflect.DeepEqual(mine, expected) {
+			t.Fatalf("expected %+v, got %+v", expected, mine)
+		}
+	})
+
+	t.Run("Deleted", func(t *testing.T) {
+		theirs := base
+		theirs.Tags = map[string]string{}
+		mine := base
+		mine.Name = "web"
+
+		if err := ThreeWayMerge(ctx, &base, &theirs, &mine); err != nil {
+			t.Fatal(err)
+		}
+		if mine.Name != "web" || len(mine.Tags) != 0 {
+			t.Fatalf("expected the tag to be deleted, got %+v", mine)
+		}
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		theirs := base
+		theirs.Tags = map[string]string{"env": "staging"}
+		mine := base
+		mine.Tags = map[string]string{"env": "dev"}
+
+		err := ThreeWayMerge(ctx, &base, &theirs, &mine)
+		if !errors.Is(err, ErrMergeConflict) || !strings.Contains(err.Error(), `"/tags/env"`) {
+			t.Fatalf("expected a conflict on /tags/env, got %v", err)
+		}
+	})
+
+	t.Run("NoChange", func(t *testing.T) {
+		theirs := base
+		theirs.Port = 8080
+		mine := theirs
+
+		if err := ThreeWayMerge(ctx, &base, &theirs, &mine); err != ErrNoChange {
+			t.Fatalf("expected %v, got %v", ErrNoChange, err)
+		}
+	})
+
+	t.Run("Store", func(t *testing.T) {
+		store := New[Config](json.NewEncoder, json.NewDecoder)
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := store.ForceStore(ctx, path, 0666, &base); err != nil {
+			t.Fatal(err)
+		}
+
+		err := store.LoadAndStoreMerge(ctx, path, 0666, func(ctx context.Context, val *Config, err error) error {
+			theirs := base
+			theirs.Port = 8080
+			if err := store.ForceStore(ctx, path, 0666, &theirs); err != nil {
+				return err
+			}
+			val.Name = "web"
+			return nil
+		}, ThreeWayMerge[Config])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var val Config
+		if _, err := store.Load(ctx, path, &val); err != nil {
+			t.Fatal(err)
+		}
+		if val.Name != "web" || val.Port != 8080 {
+			t.Fatalf("expected both changes, got %+v", val)
+		}
+	})
+}
@@ -0,0 +1,20 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build !unix && !windows && !plan9
+// +build !unix,!windows,!plan9
+
+package store
+
+import (
+	"os"
+)
+
+// copyMetadata does nothing on this system, which has no notion of file
+// ownership.
+func copyMetadata(dir *os.File, path string, f *os.File) error {
+	return nil
+}
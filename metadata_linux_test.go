@@ -0,0 +1,125 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestPreserveMetadata(t *testing.T) {
+	ctx := context.Background()
+
+	for _, opts := range [][]Option{
+		{WithPreserveMetadata()},
+		{WithPreserveMetadata(), WithStableLockFile()},
+	} {
+		store := New[int](json.NewEncoder, json.NewDecoder, opts...)
+		path := filepath.Join(t.TempDir(), "state.json")
+
+		v := 1
+		if err := store.ForceStore(ctx, path, 0666, &v); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := unix.Setxattr(path, "user.example", []byte("preserved"), 0); err == unix.ENOTSUP {
+			t.Skip("extended attributes are not supported")
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		chowned := os.Geteuid() == 0
+		if chowned {
+			if err := os.Chown(path, 1234, 5678); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		v = 2
+		if err := store.ForceStore(ctx, path, 0666, &v); err != nil {
+			t.Fatal(err)
+		}
+
+		buf := make([]byte, 64)
+		n, err := unix.Getxattr(path, "user.example", buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != "preserved" {
+			t.Fatalf("expected the extended attribute to be preserved, got %q", buf[:n])
+		}
+
+		if chowned {
+			var st unix.Stat_t
+			if err := unix.Stat(path, &st); err != nil {
+				t.Fatal(err)
+			}
+			if st.Uid != 1234 || st.Gid != 5678 {
+				t.Fatalf("expected owner 1234:5678, got %d:%d", st.Uid, st.Gid)
+			}
+		}
+	}
+}
+
+func TestExactMode(t *testing.T) {
+	ctx := context.Background()
+
+	old := unix.Umask(0077)
+	defer unix.Umask(old)
+
+	for _, opts := range [][]Option{
+		nil,
+		{WithStableLockFile()},
+	} {
+		dir := t.TempDir()
+		v := 1
+
+		umasked := New[int](json.NewEncoder, json.NewDecoder, opts...)
+		path := filepath.Join(dir, "umasked.json")
+		if err := umasked.ForceStore(ctx, path, 0664, &v); err != nil {
+			t.Fatal(err)
+		}
+		if info, err := os.Stat(path); err != nil {
+			t.Fatal(err)
+		} else if info.Mode().Perm() != 0600 {
+			t.Fatalf("expected the umask to apply without WithExactMode, got %v", info.Mode())
+		}
+
+		exact := New[int](json.NewEncoder, json.NewDecoder, append(opts, WithExactMode())...)
+		path = filepath.Join(dir, "exact.json")
+		for i := 0; i < 2; i++ {
+			if err := exact.ForceStore(ctx, path, 0664, &v); err != nil {
+				t.Fatal(err)
+			}
+			if info, err := os.Stat(path); err != nil {
+				t.Fatal(err)
+			} else if info.Mode().Perm() != 0664 {
+				t.Fatalf("expected mode 0664, got %v", info.Mode())
+			}
+		}
+
+		if os.Geteuid() != 0 {
+			continue
+		}
+		owned := New[int](json.NewEncoder, json.NewDecoder, append(opts, WithOwner(1234, 5678))...)
+		path = filepath.Join(dir, "owned.json")
+		if err := owned.ForceStore(ctx, path, 0664, &v); err != nil {
+			t.Fatal(err)
+		}
+		var st unix.Stat_t
+		if err := unix.Stat(path, &st); err != nil {
+			t.Fatal(err)
+		}
+		if st.Uid != 1234 || st.Gid != 5678 {
+			t.Fatalf("expected owner 1234:5678, got %d:%d", st.Uid, st.Gid)
+		}
+	}
+}
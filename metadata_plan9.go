@@ -0,0 +1,48 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// copyMetadata copies the group of the file at path, resolved relative to
+// dir, to f. Plan 9 does not let the owner of files be changed. It does
+// nothing if there is no such file.
+func copyMetadata(dir *os.File, path string, f *os.File) error {
+	info, err := os.Stat(resolve(dir, path))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	}
+	ninfo, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	old, ok := info.Sys().(*syscall.Dir)
+	cur, nok := ninfo.Sys().(*syscall.Dir)
+	if !ok || !nok || old.Gid == cur.Gid {
+		return nil
+	}
+
+	var d syscall.Dir
+	d.Null()
+	d.Gid = old.Gid
+	buf := make([]byte, syscall.STATFIXLEN+len(d.Gid))
+	n, err := d.Marshal(buf)
+	if err == nil {
+		err = syscall.Fwstat(int(f.Fd()), buf[:n])
+	}
+	if err != nil {
+		return &os.PathError{Op: "wstat", Path: f.Name(), Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build unix
+// +build unix
+
+package store
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyMetadata copies the owner, group and extended attributes of the file
+// at path, resolved relative to dir, to f. It does nothing if there is no
+// such file.
+func copyMetadata(dir *os.File, path string, f *os.File) error {
+	old, err := openShared(dir, path, os.O_RDONLY|unix.O_NOFOLLOW, 0)
+	switch {
+	case errors.Is(err, os.ErrNotExist), errors.Is(err, unix.ELOOP):
+		// Nothing to preserve; symbolic links get replaced rather than
+		// followed.
+		return nil
+	case err != nil:
+		return err
+	}
+	defer old.Close()
+
+	var ost, nst unix.Stat_t
+	if err := unix.Fstat(int(old.Fd()), &ost); err != nil {
+		return &os.PathError{Op: "fstat", Path: path, Err: err}
+	}
+	if err := unix.Fstat(int(f.Fd()), &nst); err != nil {
+		return &os.PathError{Op: "fstat", Path: f.Name(), Err: err}
+	}
+	if ost.Uid != nst.Uid || ost.Gid != nst.Gid {
+		if err := unix.Fchown(int(f.Fd()), int(ost.Uid), int(ost.Gid)); err != nil {
+			return &os.PathError{Op: "fchown", Path: f.Name(), Err: err}
+		}
+	}
+	return copyXattrs(old, f)
+}
@@ -0,0 +1,56 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// copyMetadata copies the discretionary access control list of the file at
+// path, resolved relative to dir, to f. It does nothing if there is no such
+// file.
+func copyMetadata(dir *os.File, path string, f *os.File) error {
+	old, err := openShared(dir, path, os.O_RDONLY, 0)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	}
+	defer old.Close()
+
+	sd, err := windows.GetSecurityInfo(windows.Handle(old.Fd()), windows.SE_FILE_OBJECT, windows.DACL_SECURITY_INFORMATION)
+	if err != nil {
+		return &os.PathError{Op: "GetSecurityInfo", Path: path, Err: err}
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return &os.PathError{Op: "GetSecurityDescriptorDacl", Path: path, Err: err}
+	}
+	control, _, err := sd.Control()
+	if err != nil {
+		return &os.PathError{Op: "GetSecurityDescriptorControl", Path: path, Err: err}
+	}
+
+	// Keep inheriting from the parent directory only if the old file did.
+	info := windows.SECURITY_INFORMATION(windows.DACL_SECURITY_INFORMATION)
+	if control&windows.SE_DACL_PROTECTED != 0 {
+		info |= windows.PROTECTED_DACL_SECURITY_INFORMATION
+	} else {
+		info |= windows.UNPROTECTED_DACL_SECURITY_INFORMATION
+	}
+
+	// The handle of f lacks WRITE_DAC, so go through its name.
+	name := resolve(dir, f.Name())
+	if err := windows.SetNamedSecurityInfo(name, windows.SE_FILE_OBJECT, info, nil, nil, dacl, nil); err != nil {
+		return &os.PathError{Op: "SetNamedSecurityInfo", Path: f.Name(), Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrSchemaVersion is returned, wrapped in a DecodeError, when a file was
+// written with a schema version that the store cannot migrate.
+var ErrSchemaVersion = errors.New("unsupported schema version")
+
+// A Migration converts the contents of a file written with an older schema
+// version into a value of type T, as configured with WithMigrations. The
+// decode function decodes the contents into a value of the older type.
+type Migration[T any] func(decode func(v any) error) (T, error)
+
+// Values written by stores configured with WithMigrations are prefixed with
+// a magic string followed by their schema version, as a uvarint.
+var schemaMagic = [4]byte{0x89, 'G', 'S', 'V'}
+
+func writeSchemaVersion(w io.Writer, version int) error {
+	header := binary.AppendUvarint(append([]byte(nil), schemaMagic[:]...), uint64(version))
+	_, err := w.Write(header)
+	return err
+}
+
+// readSchemaVersion reads the schema version of the contents of r, and
+// returns a reader of the contents that follow it. Contents without schema
+// version are of version 0.
+func readSchemaVersion(r io.Reader) (int, io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(len(schemaMagic))
+	if err != nil && err != io.EOF {
+		return 0, nil, err
+	}
+	if !bytes.Equal(head, schemaMagic[:]) {
+		return 0, br, nil
+	}
+	br.Discard(len(schemaMagic))
+
+	version, err := binary.ReadUvarint(br)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return int(version), br, nil
+}
+
+// storeMigrated stores v, as migrated from the contents of the file at path,
+// if the file did not change since it was loaded.
+func (store *Store[T]) storeMigrated(ctx context.Context, path string, v *T, canary Canary) error {
+	if store.opts.objects != nil {
+		return store.store(ctx, path, 0, v, canary, false)
+	}
+
+	// Keep the permissions of the file, which new files get from the mode
+	// passed to the store.
+	f, err := store.open(path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return store.store(ctx, path, info.Mode().Perm(), v, canary, false)
+}
@@ -0,0 +1,122 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	type V0 struct {
+		Name string
+	}
+	type V1 struct {
+		First, Last string
+	}
+	type V2 struct {
+		First, Last string
+		Age         int
+	}
+
+	ctx := context.Background()
+
+	v1 := New[V1](json.NewEncoder, json.NewDecoder, WithMigrations(1, map[int]Migration[V1]{
+		0: func(decode func(any) error) (V1, error) {
+			var old V0
+			err := decode(&old)
+			return V1{First: old.Name}, err
+		},
+	}))
+	v2 := New[V2](json.NewEncoder, json.NewDecoder, WithMigrations(2, map[int]Migration[V2]{
+		0: func(decode func(any) error) (V2, error) {
+			var old V0
+			err := decode(&old)
+			return V2{First: old.Name}, err
+		},
+		1: func(decode func(any) error) (V2, error) {
+			var old V1
+			err := decode(&old)
+			return V2{First: old.First, Last: old.Last}, err
+		},
+	}))
+
+	t.Run("Unversioned", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "value.json")
+		if err := New[V0](json.NewEncoder, json.NewDecoder).ForceStore(ctx, path, 0640, &V0{Name: "Ada"}); err != nil {
+			t.Fatal(err)
+		}
+
+		var val V2
+		if _, err := v2.Load(ctx, path, &val); err != nil {
+			t.Fatal(err)
+		}
+		if val.First != "Ada" {
+			t.Fatalf("expected Ada, got %q", val.First)
+		}
+
+		// The migrated value was stored back with the latest version.
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(data, append(schemaMagic[:], 2)) {
+			t.Fatalf("expected the file to be migrated, got %q", data)
+		}
+		if info, err := os.Stat(path); err != nil {
+			t.Fatal(err)
+		} else if info.Mode().Perm() != 0640 {
+			t.Fatalf("expected mode 0640, got %v", info.Mode().Perm())
+		}
+	})
+
+	t.Run("Older", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "value.json")
+		if err := v1.ForceStore(ctx, path, 0666, &V1{First: "Ada", Last: "Lovelace"}); err != nil {
+			t.Fatal(err)
+		}
+
+		err := v2.LoadAndStore(ctx, path, 0666, func(ctx context.Context, val *V2, err error) error {
+			if err != nil {
+				return err
+			}
+			if val.Last != "Lovelace" {
+				t.Fatalf("expected Lovelace, got %q", val.Last)
+			}
+			val.Age = 36
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var val V2
+		if _, err := v2.Load(ctx, path, &val); err != nil {
+			t.Fatal(err)
+		}
+		if val.First != "Ada" || val.Last != "Lovelace" || val.Age != 36 {
+			t.Fatalf("unexpected value %+v", val)
+		}
+	})
+
+	t.Run("Newer", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "value.json")
+		if err := v2.ForceStore(ctx, path, 0666, &V2{First: "Ada"}); err != nil {
+			t.Fatal(err)
+		}
+
+		var val V1
+		if _, err := v1.Load(ctx, path, &val); !errors.Is(err, ErrSchemaVersion) {
+			t.Fatalf("expected ErrSchemaVersion, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,43 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"os"
+)
+
+// An UnmarshalFunc decodes data into v, like json.Unmarshal. It must not
+// retain data, or any part of it, after returning.
+type UnmarshalFunc func(data []byte, v any) error
+
+// decodeMapped memory-maps the file f at path and decodes its contents into v
+// with the unmarshal function of the store, without copying them. The
+// mapping is released before returning.
+func (store *Store[T]) decodeMapped(f *os.File, path string, v *T) error {
+	data, err := mmap(f)
+	if err != nil {
+		return err
+	}
+	defer munmap(data)
+
+	if err := store.opts.unmarshal(data, v); err != nil {
+		return &DecodeError{Path: path, Err: err}
+	}
+	return nil
+}
+
+// mappable reports whether the store can decode files straight from their
+// memory mapping, which requires an unmarshal function and contents that are
+// stored untransformed.
+func (store *Store[T]) mappable() bool {
+	return store.opts.unmarshal != nil &&
+		!store.opts.checksum &&
+		store.opts.keys == nil &&
+		store.opts.compressor == nil &&
+		!store.opts.versioned &&
+		!store.opts.generations
+}
@@ -0,0 +1,26 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build !unix && !windows
+// +build !unix,!windows
+
+package store
+
+import (
+	"io"
+	"os"
+)
+
+// mmap reads the contents of f into memory, since this system does not
+// support memory-mapping files.
+func mmap(f *os.File) ([]byte, error) {
+	return io.ReadAll(f)
+}
+
+// munmap releases a mapping returned by mmap.
+func munmap(data []byte) error {
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMmap(t *testing.T) {
+	ctx := context.Background()
+
+	type Test struct {
+		Name   string
+		Values []string
+	}
+
+	expected := Test{
+		Name:   "example",
+		Values: []string{strings.Repeat("x", 1<<20), "y"},
+	}
+
+	// countingUnmarshal returns an unmarshal function that counts its calls.
+	countingUnmarshal := func(calls *int) UnmarshalFunc {
+		return func(data []byte, v any) error {
+			*calls++
+			return json.Unmarshal(data, v)
+		}
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		var calls int
+		store := New[Test](json.NewEncoder, json.NewDecoder, WithMmap(countingUnmarshal(&calls)))
+		path := filepath.Join(t.TempDir(), "state.json")
+
+		if err := store.Store(ctx, path, 0666, &expected, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		var val Test
+		if _, err := store.Load(ctx, path, &val); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(val, expected) {
+			t.Fatalf("expected %.20v, got %.20v", expected, val)
+		}
+		if calls != 1 {
+			t.Fatalf("expected the unmarshal function to be called once, got %d calls", calls)
+		}
+
+		err := store.LoadAndStore(ctx, path, 0666, func(ctx context.Context, val *Test, err error) error {
+			if err != nil {
+				return err
+			}
+			val.Values = append(val.Values, "z")
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Load(ctx, path, &val); err != nil {
+			t.Fatal(err)
+		}
+		if len(val.Values) != 3 || val.Values[2] != "z" {
+			t.Fatalf("expected the update to be loaded, got %v values", len(val.Values))
+		}
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		store := New[Test](json.NewEncoder, json.NewDecoder, WithMmap(json.Unmarshal))
+		dir := t.TempDir()
+
+		for _, contents := range []string{"", "{\"Name\": "} {
+			path := filepath.Join(dir, "state.json")
+			if err := os.WriteFile(path, []byte(contents), 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			var val Test
+			var decodeErr *DecodeError
+			if _, err := store.Load(ctx, path, &val); !errors.As(err, &decodeErr) {
+				t.Fatalf("expected a DecodeError for %q, got %v", contents, err)
+			}
+		}
+	})
+
+	t.Run("Transformed", func(t *testing.T) {
+		var calls int
+		store := New[Test](json.NewEncoder, json.NewDecoder, WithMmap(countingUnmarshal(&calls)), WithChecksum())
+		path := filepath.Join(t.TempDir(), "state.json")
+
+		if err := store.Store(ctx, path, 0666, &expected, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		var val Test
+		if _, err := store.Load(ctx, path, &val); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(val, expected) {
+			t.Fatalf("expected %.20v, got %.20v", expected, val)
+		}
+		if calls != 0 {
+			t.Fatalf("expected checksummed contents to be read through the decoder, got %d calls", calls)
+		}
+	})
+}
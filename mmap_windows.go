@@ -0,0 +1,53 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// mmap maps the contents of f read-only into memory.
+func mmap(f *os.File) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil, nil
+	}
+	if int64(int(size)) != size {
+		return nil, &os.PathError{Op: "mmap", Path: f.Name(), Err: windows.ERROR_FILE_TOO_LARGE}
+	}
+
+	h, err := windows.CreateFileMapping(windows.Handle(f.Fd()), nil, windows.PAGE_READONLY, 0, 0, nil)
+	if err != nil {
+		return nil, &os.PathError{Op: "CreateFileMapping", Path: f.Name(), Err: err}
+	}
+	// The view keeps the mapping alive once created.
+	defer windows.CloseHandle(h)
+
+	addr, err := windows.MapViewOfFile(h, windows.FILE_MAP_READ, 0, 0, uintptr(size))
+	if err != nil {
+		return nil, &os.PathError{Op: "MapViewOfFile", Path: f.Name(), Err: err}
+	}
+	// The view is not managed by the Go heap, so reinterpreting its address
+	// as a pointer is safe.
+	ptr := *(*unsafe.Pointer)(unsafe.Pointer(&addr))
+	return unsafe.Slice((*byte)(ptr), int(size)), nil
+}
+
+// munmap releases a mapping returned by mmap.
+func munmap(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return wrapSyscallError("UnmapViewOfFile", windows.UnmapViewOfFile(uintptr(unsafe.Pointer(&data[0]))))
+}
@@ -0,0 +1,20 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// NewMsgpack returns a Store that marshals values of type T with MessagePack.
+//
+// Values are encoded and decoded incrementally to and from the underlying
+// file, so that large values do not need to be buffered in memory in their
+// entirety.
+func NewMsgpack[T any](opts ...Option) *Store[T] {
+	return New[T](msgpack.NewEncoder, msgpack.NewDecoder, opts...)
+}
@@ -0,0 +1,71 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMsgpack(t *testing.T) {
+
+	type Test struct {
+		Name   string
+		Labels map[string]map[string]int
+		Values []float64
+	}
+
+	store := NewMsgpack[Test]()
+	path := filepath.Join(t.TempDir(), "state.msgpack")
+
+	expected := Test{
+		Name: "example",
+		Labels: map[string]map[string]int{
+			"a": {"x": 1, "y": 2},
+			"b": {"z": 3},
+		},
+		Values: []float64{1.5, 2.5, 3.5},
+	}
+
+	if err := store.Store(context.Background(), path, 0666, &expected, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".lock"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the temporary file to have been renamed, got %v", err)
+	}
+
+	var val Test
+	canary, err := store.Load(context.Background(), path, &val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(val, expected) {
+		t.Fatalf("expected %v, got %v", expected, val)
+	}
+
+	// Storing with the canary of the current file must succeed, after which
+	// the old canary must be rejected.
+	val.Values = append(val.Values, 4.5)
+	if err := store.Store(context.Background(), path, 0666, &val, canary); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Store(context.Background(), path, 0666, &val, canary); err != ErrRetry {
+		t.Fatalf("expected ErrRetry on a stale canary, got %v", err)
+	}
+
+	var reloaded Test
+	if _, err := store.Load(context.Background(), path, &reloaded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reloaded, val) {
+		t.Fatalf("expected %v, got %v", val, reloaded)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// A FileMutex provides exclusive access to the value of type T stored in
+// a file.
+//
+// Unlike LoadAndStore, which optimistically retries when the file gets
+// modified concurrently, a FileMutex holds the exclusive lock of the file
+// from the moment the value gets loaded until it gets stored back, which
+// guarantees that the update never needs to be retried. In exchange,
+// concurrent writers of the file block for as long as the value is held,
+// while readers remain unaffected.
+type FileMutex[T any] struct {
+	store *Store[T]
+	path  string
+	mode  os.FileMode
+}
+
+// NewFileMutex returns a FileMutex guarding the value stored in the file at
+// path with the specified store. The file gets created with the specified
+// mode if it does not exist.
+func NewFileMutex[T any](store *Store[T], path string, mode os.FileMode) *FileMutex[T] {
+	return &FileMutex[T]{
+		store: store,
+		path:  path,
+		mode:  mode,
+	}
+}
+
+// Acquire locks the file and returns its current value, or a pointer to the
+// zero value of T if the file does not exist.
+//
+// The caller is then free to modify the value, and must call the returned
+// release function exactly once when done. If release is called with a nil
+// error, the value gets atomically stored back into the file, and the result
+// of that store is returned. Otherwise, the file remains untouched and the
+// error is returned as-is. In both cases, the lock is released.
+func (m *FileMutex[T]) Acquire(ctx context.Context) (val *T, release func(error) error, err error) {
+	ctx, span := m.store.startSpan(ctx, "FileMutex.Acquire", m.path)
+	defer func() { endSpan(span, err) }()
+
+	val = new(T)
+	lf, lst, loadErr, err := m.store.acquireAndLoad(ctx, m.path, m.mode, val)
+	if err != nil {
+		return nil, nil, err
+	}
+	if loadErr != nil && !errors.Is(loadErr, os.ErrNotExist) {
+		m.store.release(ctx, lf)
+		return nil, nil, loadErr
+	}
+
+	var once sync.Once
+	release = func(err error) error {
+		once.Do(func() {
+			defer m.store.release(ctx, lf)
+			if err != nil {
+				return
+			}
+
+			var write func(w io.Writer) error
+			if write, err = m.store.writer(m.path, val); err == nil {
+				err = m.store.commit(ctx, lf, lst, m.path, m.mode, write)
+			}
+		})
+		return err
+	}
+	return val, release, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestFileMutex(t *testing.T) {
+	store := New[int](json.NewEncoder, json.NewDecoder)
+
+	t.Run("Abort", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "num")
+		mu := NewFileMutex(store, path, 0666)
+
+		val, release, err := mu.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *val != 0 {
+			t.Fatalf("expected zero value for a missing file, got %d", *val)
+		}
+		*val = 42
+
+		errAbort := errors.New("abort")
+		if err := release(errAbort); err != errAbort {
+			t.Fatalf("expected release to return the abort error, got %v", err)
+		}
+
+		var num int
+		if _, err := store.Load(context.Background(), path, &num); err == nil {
+			t.Fatalf("expected aborted update to leave the file untouched, got %d", num)
+		}
+	})
+
+	t.Run("Stress", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "num")
+		mu := NewFileMutex(store, path, 0666)
+
+		const total = 1000
+
+		var wait sync.WaitGroup
+		for i := 0; i < total; i++ {
+			wait.Add(1)
+			go func() {
+				defer wait.Done()
+				val, release, err := mu.Acquire(context.Background())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				*val++
+				if err := release(nil); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wait.Wait()
+
+		var num int
+		if _, err := store.Load(context.Background(), path, &num); err != nil {
+			t.Fatal(err)
+		}
+		if num != total {
+			t.Fatalf("expected total to be %d, got %d", total, num)
+		}
+	})
+}
@@ -0,0 +1,22 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build !plan9
+// +build !plan9
+
+package store
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isNoFollowError returns whether err is the error of opening a symbolic link
+// with oNoFollow.
+func isNoFollowError(err error) bool {
+	// FreeBSD fails with EMLINK rather than ELOOP.
+	return errors.Is(err, syscall.ELOOP) || errors.Is(err, syscall.EMLINK)
+}
@@ -0,0 +1,196 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// An ObjectBackend stores files as the objects of an object store, such as
+// S3, which can only be read and replaced as a whole, and get updated with
+// preconditions on their version rather than under a lock.
+//
+// Versions are opaque strings, such as the ETags of S3, that change whenever
+// an object gets replaced. Stores configured with WithObjectBackend use them
+// as canaries.
+//
+// Object backends need not be remote: the boltstore module keeps objects in
+// a bbolt database, versioned by the sequence number of their bucket.
+type ObjectBackend interface {
+	// Get returns the contents of the named object, along with its
+	// version. It fails with an error wrapping fs.ErrNotExist if there is
+	// no such object, and with ErrNotModified if ifNoneMatch is not empty
+	// and matches the version of the object.
+	Get(ctx context.Context, name, ifNoneMatch string) (io.ReadCloser, string, error)
+
+	// Put replaces the named object with data, and returns its new version.
+	// Unless force is set, the object is only replaced if its version is
+	// ifMatch, or created if ifMatch is empty and the object does not
+	// exist; otherwise, Put fails with ErrRetry.
+	Put(ctx context.Context, name string, data []byte, ifMatch string, force bool) (string, error)
+
+	// Delete removes the named object. Unless force is set, the object is
+	// only removed if its version is ifMatch; otherwise, Delete fails with
+	// ErrRetry. It fails with an error wrapping fs.ErrNotExist if there is
+	// no such object and ifMatch is empty.
+	Delete(ctx context.Context, name, ifMatch string, force bool) error
+}
+
+// loadObject is the loadOnce of stores configured with WithObjectBackend.
+func (store *Store[T]) loadObject(ctx context.Context, path string, v *T, canary Canary, ifChanged bool) (Canary, bool, error) {
+	var ifNoneMatch string
+	if ifChanged && store.canaryFunc == nil {
+		ifNoneMatch, _ = canary.(string)
+	}
+	rc, version, err := store.opts.objects.Get(ctx, path, ifNoneMatch)
+	if err == ErrNotModified {
+		return canary, false, ErrNotModified
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer rc.Close()
+
+	if store.canaryFunc == nil {
+		migrated, err := store.decodeMigrating(rc, path, v)
+		if err != nil {
+			return nil, false, err
+		}
+		return version, migrated, nil
+	}
+
+	var nv T
+	migrated, err := store.decodeMigrating(rc, path, &nv)
+	if err != nil {
+		return nil, false, err
+	}
+	newCanary := store.canaryFunc(&nv)
+	if ifChanged && !migrated && newCanary == canary {
+		return canary, false, ErrNotModified
+	}
+	*v = nv
+	return newCanary, migrated, nil
+}
+
+// version returns the version of the object at path if it matches canary,
+// or ErrRetry otherwise. The version of a missing object is empty.
+func (store *Store[T]) version(ctx context.Context, path string, canary Canary) (string, error) {
+	if store.canaryFunc == nil {
+		version, _ := canary.(string)
+		return version, nil
+	}
+
+	rc, version, err := store.opts.objects.Get(ctx, path, "")
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if canary != nil {
+			return "", ErrRetry
+		}
+		return "", nil
+	case err != nil:
+		return "", err
+	}
+	defer rc.Close()
+
+	var v T
+	if err := store.decode(rc, path, &v); err != nil {
+		return "", err
+	}
+	if store.canaryFunc(&v) != canary {
+		return "", ErrRetry
+	}
+	return version, nil
+}
+
+// putObject is the replace of stores configured with WithObjectBackend.
+func (store *Store[T]) putObject(ctx context.Context, path string, canary Canary, force bool, write func(io.Writer) error) error {
+	var ifMatch string
+	if !force {
+		var err error
+		if ifMatch, err = store.version(ctx, path, canary); err != nil {
+			return err
+		}
+	}
+	return store.putVersion(ctx, path, ifMatch, force, write)
+}
+
+// putVersion replaces the object at path with the data written by the write
+// function, if its version is ifMatch or force is set.
+func (store *Store[T]) putVersion(ctx context.Context, path, ifMatch string, force bool, write func(io.Writer) error) error {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		return err
+	}
+	if span := store.traced(ctx); span != nil {
+		span.SetAttributes(attribute.Int64("store.bytes_written", int64(buf.Len())))
+	}
+	_, err := store.opts.objects.Put(ctx, path, buf.Bytes(), ifMatch, force)
+	return err
+}
+
+// deleteObject is the remove of stores configured with WithObjectBackend.
+func (store *Store[T]) deleteObject(ctx context.Context, path string, canary Canary, force bool) error {
+	var ifMatch string
+	if !force {
+		var err error
+		if ifMatch, err = store.version(ctx, path, canary); err != nil {
+			return err
+		}
+	}
+	return store.opts.objects.Delete(ctx, path, ifMatch, force)
+}
+
+// unsupportedBackend is the Backend of stores configured with
+// WithObjectBackend, which fails any operation on files.
+type unsupportedBackend struct{}
+
+func (unsupportedBackend) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return nil, &os.PathError{Op: "open", Path: name, Err: ErrUnsupported}
+}
+
+func (unsupportedBackend) Rename(f File, newname string) error {
+	return &os.LinkError{Op: "rename", Old: f.Name(), New: newname, Err: ErrUnsupported}
+}
+
+func (unsupportedBackend) Link(oldname, newname string) error {
+	return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: ErrUnsupported}
+}
+
+func (unsupportedBackend) Remove(name string) error {
+	return &os.PathError{Op: "remove", Path: name, Err: ErrUnsupported}
+}
+
+func (unsupportedBackend) Lstat(name string) (FileStat, error) {
+	return FileStat{}, &os.PathError{Op: "lstat", Path: name, Err: ErrUnsupported}
+}
+
+func (unsupportedBackend) Fstat(f File) (FileStat, error) {
+	return FileStat{}, &os.PathError{Op: "fstat", Path: f.Name(), Err: ErrUnsupported}
+}
+
+func (unsupportedBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	return nil, &os.PathError{Op: "readdir", Path: name, Err: ErrUnsupported}
+}
+
+func (unsupportedBackend) Lock(ctx context.Context, f File) error {
+	return &os.PathError{Op: "lock", Path: f.Name(), Err: ErrUnsupported}
+}
+
+func (unsupportedBackend) RLock(ctx context.Context, f File) error {
+	return &os.PathError{Op: "lock", Path: f.Name(), Err: ErrUnsupported}
+}
+
+func (unsupportedBackend) TryLock(f File) error {
+	return &os.PathError{Op: "lock", Path: f.Name(), Err: ErrUnsupported}
+}
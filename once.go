@@ -0,0 +1,71 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// A Once runs functions exactly once across all the processes that call Do
+// with the same path, like sync.Once does across goroutines.
+type Once struct {
+	store *Store[onceRecord]
+}
+
+// onceRecord is the contents of the state files of Once, which record the
+// completion of the function.
+type onceRecord struct {
+	Done     time.Time `json:"done"`
+	Hostname string    `json:"hostname"`
+	PID      int       `json:"pid"`
+}
+
+// NewOnce returns a Once that records completion into JSON state files, with
+// a store configured with the specified options.
+func NewOnce(opts ...Option) *Once {
+	return &Once{store: New[onceRecord](json.NewEncoder, json.NewDecoder, opts...)}
+}
+
+// Do calls fn unless the state file at path records that a previous call to
+// Do completed, and records its completion into the state file if fn
+// succeeds. Concurrent calls wait for the one that calls fn, and then return
+// without calling fn themselves.
+//
+// If fn fails, its error is returned and the state file remains untouched,
+// which means that the next call to Do calls fn again. The same goes if the
+// process exits while calling fn.
+func (o *Once) Do(ctx context.Context, path string, fn func(ctx context.Context) error) error {
+	var rec onceRecord
+	_, err := o.store.Load(ctx, path, &rec)
+	switch {
+	case err == nil && !rec.Done.IsZero():
+		return nil
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+
+	val, release, err := NewFileMutex(o.store, path, 0666).Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	if !val.Done.IsZero() {
+		release(ErrNoChange)
+		return nil
+	}
+	if err := fn(ctx); err != nil {
+		release(err)
+		return err
+	}
+
+	host, _ := os.Hostname()
+	*val = onceRecord{Done: time.Now(), Hostname: host, PID: os.Getpid()}
+	return release(nil)
+}
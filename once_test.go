@@ -0,0 +1,71 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestOnce(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Concurrent", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "setup.done")
+
+		var calls int32
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := NewOnce().Do(ctx, path, func(ctx context.Context) error {
+					atomic.AddInt32(&calls, 1)
+					return nil
+				})
+				if err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		if calls != 1 {
+			t.Fatalf("expected fn to be called once, got %d", calls)
+		}
+
+		// Late arrivals skip the work too.
+		err := NewOnce().Do(ctx, path, func(ctx context.Context) error {
+			t.Fatal("fn called after completion")
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "setup.done")
+		once := NewOnce()
+
+		errSetup := errors.New("setup failed")
+		if err := once.Do(ctx, path, func(ctx context.Context) error { return errSetup }); err != errSetup {
+			t.Fatalf("expected %v, got %v", errSetup, err)
+		}
+
+		var called bool
+		if err := once.Do(ctx, path, func(ctx context.Context) error { called = true; return nil }); err != nil {
+			t.Fatal(err)
+		}
+		if !called {
+			t.Fatal("expected fn to be called again after failing")
+		}
+	})
+}
@@ -0,0 +1,519 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// An Option configures the behavior of a Store.
+type Option func(*options)
+
+type options struct {
+	stableLockFile   bool
+	maxBytes         int64
+	tracer           trace.Tracer
+	canaryFunc       any
+	lockStyle        LockStyle
+	syncData         bool
+	syncDir          bool
+	lockDir          string
+	lockPrefix       string
+	lockSuffix       string
+	tempPrefix       string
+	tempSuffix       string
+	backups          int
+	recovery         bool
+	checksum         bool
+	keys             KeyProvider
+	compressor       Compressor
+	versioned        bool
+	schemaVersion    int
+	migrations       any
+	unmarshal        UnmarshalFunc
+	retryPolicy      bool
+	maxAttempts      int
+	backoff          time.Duration
+	jitter           time.Duration
+	onRetry          OnRetryFunc
+	noFollow         bool
+	preserveMetadata bool
+	exactMode        bool
+	chown            bool
+	uid              int
+	gid              int
+	backend          Backend
+	objects          ObjectBackend
+	lockInfo         bool
+	lockLabel        string
+	lockOptions      LockOptions
+	logf             logFunc
+	sharedLoads      bool
+	cloneFunc        any
+	generations      bool
+	contentHash      bool
+	alternateStream  bool
+}
+
+// WithStableLockFile configures the store to coordinate writers through
+// a separate lock file, path+".lockfile", that never gets renamed, and to
+// write the new contents into a distinct, randomly-named temporary file
+// before atomically renaming it to its destination.
+//
+// By default, the store uses path+".lock" both as the lock file and as the
+// temporary file, which means that the lock ends up being held on the
+// destination once renamed, and that concurrent writers waiting on the old
+// lock file need to retry. With a stable lock file, writers always lock the
+// same file, which avoids these spurious retries.
+//
+// On Linux, the temporary file is created unnamed with O_TMPFILE when the
+// filesystem supports it, and only gets linked into the directory right
+// before being renamed, so that writers that crash mid-write never leave
+// temporary files behind.
+//
+// All processes accessing the same file must agree on whether to use a stable
+// lock file, as the two modes do not exclude each other.
+func WithStableLockFile() Option {
+	return func(opts *options) {
+		opts.stableLockFile = true
+	}
+}
+
+// WithLockDir configures the store to create its lock files and temporary
+// files in dir, rather than next to the files they stand for. This is useful
+// when the directory holding the files is not writable, or to keep it free
+// of these auxiliary files.
+//
+// Since the store renames these files to their destination, dir must be on
+// the same filesystem as the files of the store; stores fail with an error
+// wrapping ErrCrossDevice otherwise. Relative paths are resolved like the
+// paths passed to the store.
+//
+// Lock files are named after the base name of their destination, so files
+// with the same base name in different directories share their lock file.
+// While this remains correct, it causes spurious contention, which means that
+// dir should only be shared by stores of a single directory.
+func WithLockDir(dir string) Option {
+	return func(opts *options) {
+		opts.lockDir = dir
+	}
+}
+
+// WithLockFileName configures the names of the lock files of the store. The
+// lock file of a file is named after the base name of the file, with the
+// specified prefix and suffix.
+//
+// An empty suffix selects the default suffix, ".lock", or ".lockfile" with
+// WithStableLockFile. All processes accessing the same file must agree on
+// the name of its lock file.
+func WithLockFileName(prefix, suffix string) Option {
+	return func(opts *options) {
+		opts.lockPrefix = prefix
+		opts.lockSuffix = suffix
+	}
+}
+
+// WithTempFileName configures the names of the temporary files that the store
+// creates with WithStableLockFile. Temporary files are named after the base
+// name of their destination followed by a random string, with the specified
+// prefix and suffix.
+//
+// An empty suffix selects the default suffix, ".tmp".
+func WithTempFileName(prefix, suffix string) Option {
+	return func(opts *options) {
+		opts.tempPrefix = prefix
+		opts.tempSuffix = suffix
+	}
+}
+
+// WithNoFollow configures the store to refuse to operate on files that are
+// symbolic links: loads fail to open them, and stores fail to replace them,
+// with an error wrapping ErrSymlink. Lock files that are symbolic links are
+// refused as well, so that a store never writes through a link that another
+// user planted.
+//
+// This protects privileged processes that write to directories writable by
+// other users, such as /tmp, from symbolic link attacks.
+func WithNoFollow() Option {
+	return func(opts *options) {
+		opts.noFollow = true
+	}
+}
+
+// WithPreserveMetadata configures the store to carry the metadata of files
+// over to the new contents that replace them. Since stores replace files
+// with new ones rather than overwriting them, this metadata is otherwise
+// lost, and new files are owned by the writing process.
+//
+// On Unix systems, the owner and group of files are preserved, which
+// requires the privilege to change them, as are their extended attributes
+// on Linux and Darwin, which include POSIX ACLs and SELinux labels. On
+// Windows, their discretionary access control list is preserved. Stores fail
+// if the metadata cannot be copied, and leave the file untouched.
+func WithPreserveMetadata() Option {
+	return func(opts *options) {
+		opts.preserveMetadata = true
+	}
+}
+
+// WithExactMode configures the store to set the permissions of the files it
+// writes to exactly the mode passed to Store, regardless of the umask of the
+// process, which otherwise clears some of its bits. The permissions are set
+// before the new contents replace the file, so that they are never observable
+// with other permissions.
+//
+// With WithPreserveMetadata, the mode takes precedence over the preserved
+// permissions. On Windows, only the read-only attribute is affected.
+func WithExactMode() Option {
+	return func(opts *options) {
+		opts.exactMode = true
+	}
+}
+
+// WithOwner configures the store to change the owner and group of the files
+// it writes to uid and gid before the new contents replace the file. Like
+// os.Chown, a uid or gid of -1 leaves it unchanged. Changing the owner
+// generally requires privileges, and is not supported on Windows.
+//
+// With WithPreserveMetadata, the specified owner takes precedence over the
+// preserved one.
+func WithOwner(uid, gid int) Option {
+	return func(opts *options) {
+		opts.chown = true
+		opts.uid = uid
+		opts.gid = gid
+	}
+}
+
+// WithSyncData configures the store to flush the contents of new files to
+// stable storage before renaming them to their destination.
+//
+// Without it, a power loss shortly after a store may leave the destination
+// empty or partially written, even though the store succeeded, as the rename
+// may reach the disk before the data does. With it, the destination holds
+// either the old or the new contents. On Darwin, the data is flushed with
+// F_FULLFSYNC, which also flushes the disk caches.
+func WithSyncData() Option {
+	return func(opts *options) {
+		opts.syncData = true
+	}
+}
+
+// WithSyncDir configures the store to flush the directory containing the
+// destination to stable storage after renaming new files to it, so that
+// stores are durable once they return.
+//
+// Without it, a power loss shortly after a store may revert the destination
+// to its old contents. Combined with WithSyncData, a successful store
+// survives a power loss. WithSyncDir has no effect on Windows, where NTFS
+// journals renames itself.
+func WithSyncDir() Option {
+	return func(opts *options) {
+		opts.syncDir = true
+	}
+}
+
+// WithBackups configures the store to keep up to n previous versions of each
+// file it writes, as path+".1" for the most recent one, path+".2" for the one
+// before, and so on. LoadVersion loads these versions.
+//
+// Backups are rotated while holding the lock of the file, right before the
+// new contents replace it. The current version is hard-linked rather than
+// copied, so keeping backups only costs a few renames per store, but requires
+// a filesystem that supports hard links.
+func WithBackups(n int) Option {
+	return func(opts *options) {
+		opts.backups = n
+	}
+}
+
+// WithRecovery configures the store to keep a recovery copy of each file it
+// writes, as path+".bak", and to fall back to it when the contents of the
+// file cannot be decoded, for instance because it was truncated or mangled
+// by a faulty disk or another program.
+//
+// When it falls back to the recovery copy, Load fills in the value with the
+// recovered contents and returns a *CorruptError, which matches ErrCorrupt
+// with errors.Is. The returned canary is still the canary of the corrupt
+// file, so that the recovered value can be stored back over it.
+//
+// The recovery copy is a separate file holding the same contents as the file
+// after the last successful store, which doubles the amount of data written
+// by stores.
+func WithRecovery() Option {
+	return func(opts *options) {
+		opts.recovery = true
+	}
+}
+
+// WithChecksum configures the store to wrap the encoded contents of files in
+// an envelope holding a format version and the CRC-32C of the contents, and
+// to verify the checksum when loading files. Loading a file whose contents
+// do not match their checksum fails with a DecodeError wrapping ErrChecksum,
+// rather than with whatever error the decoder makes of the damaged contents.
+//
+// With this option, contents are fully read in memory and verified before
+// being decoded. All processes accessing the same file must agree on whether
+// to use checksums, as files without an envelope fail to load.
+func WithChecksum() Option {
+	return func(opts *options) {
+		opts.checksum = true
+	}
+}
+
+// WithEncryption configures the store to seal the encoded contents of files
+// with AES-GCM, using keys from the specified provider, and to open them
+// when loading files. Loading a file that cannot be opened fails with
+// a DecodeError wrapping ErrDecrypt.
+//
+// The identifier of the key is stored in the clear along with the sealed
+// contents, which lets the provider rotate keys. With this option, contents
+// are fully buffered in memory, since they are sealed and opened as a whole.
+// When combined with WithChecksum, the checksum covers the sealed contents.
+func WithEncryption(keys KeyProvider) Option {
+	return func(opts *options) {
+		opts.keys = keys
+	}
+}
+
+// WithCompression configures the store to compress the encoded contents of
+// files with the specified compressor, such as Gzip, and to decompress them
+// when loading files.
+//
+// Loading sniffs the contents for the magic bytes of the compressor, so that
+// files that were written without compression still load, which allows
+// enabling compression on existing files. When combined with WithEncryption,
+// contents are compressed before being sealed.
+func WithCompression(c Compressor) Option {
+	return func(opts *options) {
+		opts.compressor = c
+	}
+}
+
+// WithMigrations configures the store to record the schema version of the
+// values it writes along with their contents, and to migrate the contents of
+// files written with older schema versions when loading them.
+//
+// The current schema version is version. Files recorded with an older
+// version are decoded with the migration registered for that version, which
+// converts them to a value of type T; files written before the store
+// recorded schema versions have version 0. Load and LoadIfChanged then store
+// the migrated value back under the lock of the file, so that migrations
+// only run once per file. Files with a version that is newer than version,
+// or that has no registered migration, fail to load with a DecodeError
+// wrapping ErrSchemaVersion.
+//
+// The type T of migrations must match the type of the store, otherwise New
+// panics.
+func WithMigrations[T any](version int, migrations map[int]Migration[T]) Option {
+	return func(opts *options) {
+		opts.versioned = true
+		opts.schemaVersion = version
+		opts.migrations = migrations
+	}
+}
+
+// WithMmap configures the store to decode files by memory-mapping them
+// read-only while holding their shared lock, and passing the mapping to the
+// specified unmarshal function, such as json.Unmarshal, rather than reading
+// them through the decoder of the store. This saves copying the contents of
+// large files, and lets unmarshal functions that support it decode them
+// without copying.
+//
+// The mapping is released as soon as unmarshal returns, which means that
+// unmarshal must not retain any part of its input; the decoded value must
+// not alias it either. Stores that transform contents with WithChecksum,
+// WithEncryption, WithCompression or WithMigrations still read files through
+// their decoder. On systems that cannot map files, the contents are read
+// into memory instead.
+func WithMmap(unmarshal UnmarshalFunc) Option {
+	return func(opts *options) {
+		opts.unmarshal = unmarshal
+	}
+}
+
+// WithRetryPolicy configures how LoadAndStore retries when the file changed
+// concurrently. LoadAndStore makes at most maxAttempts attempts, after which
+// it returns ErrRetry; zero means no limit. Between attempts, it waits for
+// backoff, doubling after each retry up to 64 times backoff, plus a random
+// delay of up to jitter, so that contending writers do not retry in lockstep.
+// Zero backoff and jitter make LoadAndStore retry immediately.
+//
+// By default, LoadAndStore retries indefinitely, with a backoff of
+// DefaultRetryBackoff and a jitter of DefaultRetryJitter.
+func WithRetryPolicy(maxAttempts int, backoff, jitter time.Duration) Option {
+	return func(opts *options) {
+		opts.retryPolicy = true
+		opts.maxAttempts = maxAttempts
+		opts.backoff = backoff
+		opts.jitter = jitter
+	}
+}
+
+// WithOnRetry configures LoadAndStore to call fn before each retry, which
+// lets callers count retries, or abort them by returning an error.
+func WithOnRetry(fn OnRetryFunc) Option {
+	return func(opts *options) {
+		opts.onRetry = fn
+	}
+}
+
+// WithLockStyle configures the store to lock files with the specified style
+// of locks rather than with FlockLocks.
+//
+// All processes accessing the same file must agree on the lock style, as
+// locks of different styles do not necessarily exclude each other. If the
+// style is not supported on the system, operations on the store fail with
+// an error wrapping ErrLockStyleUnsupported.
+func WithLockStyle(style LockStyle) Option {
+	return func(opts *options) {
+		opts.lockStyle = style
+	}
+}
+
+// WithLockInfo configures the store to record a LockInfo describing the
+// process, along with the specified label, into lock files once it holds
+// them, so that ReadLockInfo can tell who holds them, for instance to
+// diagnose a lock that remains held for too long.
+//
+// Unless the store was configured with WithStableLockFile, the information
+// goes away along with the lock file once the store completes.
+func WithLockInfo(label string) Option {
+	return func(opts *options) {
+		opts.lockInfo = true
+		opts.lockLabel = label
+	}
+}
+
+// WithLockOptions configures the store to wait for the exclusive locks of
+// lock files as configured by opts: to report the waits that last longer than
+// opts.WarnAfter to opts.OnWaiting, with the holder recorded by stores
+// configured with WithLockInfo, and to give up after opts.Timeout. The style
+// of opts is ignored in favor of the one configured with WithLockStyle.
+func WithLockOptions(opts LockOptions) Option {
+	return func(o *options) {
+		o.lockOptions = opts
+	}
+}
+
+// WithBackend configures the store to operate on the files of the specified
+// backend rather than on the file system of the operating system.
+//
+// Features that depend on the operating system degrade gracefully on backends
+// other than OSBackend: temporary files are always named, files get polled
+// rather than watched, and WithMmap, WithPreserveMetadata and WithLockStyle
+// have no effect. See Backend for the optional features of backends.
+func WithBackend(b Backend) Option {
+	return func(opts *options) {
+		opts.backend = b
+	}
+}
+
+// WithObjectBackend configures the store to keep files as the objects of the
+// specified object store, such as the one of package s3store, rather than on
+// a file system.
+//
+// Objects are replaced with conditional writes rather than under locks, and
+// their versions serve as canaries unless the store was created with
+// WithCanaryFunc. LoadAndStore therefore keeps its compare-and-swap
+// semantics, but operations that lock, list or rename files, such as
+// LoadAndStoreExclusive, Rename, Swap, CopyTo, KV.Range, transactions,
+// mutexes and leases, fail with an error wrapping ErrUnsupported. WithBackups,
+// WithRecovery and WithSyncDir have no effect.
+func WithObjectBackend(b ObjectBackend) Option {
+	return func(opts *options) {
+		opts.objects = b
+	}
+}
+
+// WithMaxBytes limits the size of encoded values to n bytes. Storing a value
+// whose encoding exceeds the limit fails with an error wrapping ErrTooLarge,
+// and leaves the file system untouched.
+//
+// With this option, values are fully encoded in memory before being written
+// to the file system, rather than streamed to it.
+func WithMaxBytes(n int64) Option {
+	return func(opts *options) {
+		opts.maxBytes = n
+	}
+}
+
+// WithCanaryFunc configures the store to derive canaries from the contents of
+// the stored values with fn, rather than from the identity of the file.
+//
+// This allows applications that embed their own revision in the stored value
+// to implement compare-and-swap on that revision, which also makes it reliable
+// on filesystems where the identity of files cannot be trusted.
+//
+// The values returned by fn must be comparable. Stores then decode the
+// current contents of the file while holding the exclusive lock, and fail
+// with ErrRetry if the canary of that value differs from the canary returned
+// by Load.
+//
+// The type T of fn must match the type of the store, otherwise New panics.
+func WithCanaryFunc[T any](fn func(*T) any) Option {
+	return func(opts *options) {
+		opts.canaryFunc = fn
+	}
+}
+
+// WithGenerations configures the store to record a generation number at the
+// start of the files it writes, which increases every time the file gets
+// stored, and to use it as the canary of the file rather than a FileCanary.
+// Inode numbers get reused, quickly so on tmpfs and some network
+// filesystems, and modification times are not always precise enough to tell
+// apart files of the same size, which can let a file that got replaced twice
+// in between a Load and a Store look unchanged; generations do not.
+//
+// Files without a generation, such as those written before enabling the
+// option, still load, with a FileCanary as their canary, and get
+// a generation the next time they are stored. However, stores without this
+// option fail to load files with a generation. WithCanaryFunc takes
+// precedence over this option.
+func WithGenerations() Option {
+	return func(opts *options) {
+		opts.generations = true
+	}
+}
+
+// WithContentHash configures the store to derive canaries from a hash of the
+// contents of files, as written to the file system, rather than from their
+// metadata. This makes compare-and-swap reliable on filesystems whose
+// inode numbers and other metadata cannot be trusted, such as some FUSE, SMB
+// and overlay filesystems, without changing the format of the files.
+//
+// Files are then fully read in memory before being decoded, and stores read
+// the current contents of the file again while holding the exclusive lock to
+// check that they did not change. Storing contents identical to the previous
+// ones does not change the canary. WithCanaryFunc takes precedence over this
+// option, and this option over WithGenerations.
+func WithContentHash() Option {
+	return func(opts *options) {
+		opts.contentHash = true
+	}
+}
+
+// WithAlternateDataStream configures the store to stage the new contents of
+// files in an alternate data stream of the file itself, path+":staging",
+// rather than in a sibling file, on Windows. The new contents then replace
+// the old ones without the need for a file on the same volume, and without
+// leaving temporary files behind in the directory.
+//
+// This only works on file systems that support alternate data streams, such
+// as NTFS, and for files that already exist and that no other process has
+// open, as renaming the stream fails otherwise. The store falls back to
+// staging the contents in a sibling file when it cannot use the stream, and
+// on other systems. Files replaced that way keep their identity, which means
+// that their canaries only change along with their size and modification
+// time. The option is ignored with WithBackups.
+func WithAlternateDataStream() Option {
+	return func(opts *options) {
+		opts.alternateStream = true
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+// Patch updates the fields named by mask of the value in the file at path to
+// those of partial, leaving the other fields as they are in the file. Fields
+// named by mask that partial lacks get removed. The file gets created with
+// the specified mode if it does not exist, with the fields of mask only.
+//
+// Fields are top-level members of the JSON encodings of T and partial,
+// regardless of the codec of the store, which lets callers update documents
+// of types they only know a few fields of: partial is typically a map, or a
+// struct with the fields of mask only. T must round-trip through
+// encoding/json without losing anything; to keep fields of documents that T
+// does not know about, T must be a map type.
+//
+// Like LoadAndStoreExclusive, Patch holds the exclusive lock of the file from
+// before it loads until after it stores the patched value.
+func (store *Store[T]) Patch(ctx context.Context, path string, mode os.FileMode, mask []string, partial any) (err error) {
+	ctx, span := store.startSpan(ctx, "Patch", path)
+	defer func() { endSpan(span, err) }()
+
+	fields, err := jsonObject(partial)
+	if err != nil {
+		return err
+	}
+
+	return store.LoadAndStoreExclusive(ctx, path, mode, func(ctx context.Context, val *T, err error) error {
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		doc, err := jsonObject(val)
+		if err != nil {
+			return err
+		}
+		for _, k := range mask {
+			if v, ok := fields[k]; ok {
+				doc[k] = v
+			} else {
+				delete(doc, k)
+			}
+		}
+
+		b, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		var patched T
+		if err := json.Unmarshal(b, &patched); err != nil {
+			return err
+		}
+		*val = patched
+		return nil
+	})
+}
+
+// jsonObject returns the members of the JSON encoding of v, which must be an
+// object, or null.
+func jsonObject(v any) (map[string]json.RawMessage, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		obj = map[string]json.RawMessage{}
+	}
+	return obj, nil
+}
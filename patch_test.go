@@ -0,0 +1,71 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPatch(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Struct", func(t *testing.T) {
+		type Config struct {
+			Name  string            `json:"name"`
+			Port  int               `json:"port"`
+			Debug bool              `json:"debug"`
+			Tags  map[string]string `json:"tags"`
+		}
+		store := New[Config](json.NewEncoder, json.NewDecoder)
+		path := filepath.Join(t.TempDir(), "config.json")
+		err := store.ForceStore(ctx, path, 0666, &Config{Name: "api", Port: 80, Debug: true, Tags: map[string]string{"env": "prod"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		partial := struct {
+			Port int `json:"port"`
+		}{Port: 8080}
+		if err := store.Patch(ctx, path, 0666, []string{"port", "debug"}, partial); err != nil {
+			t.Fatal(err)
+		}
+
+		var val Config
+		if _, err := store.Load(ctx, path, &val); err != nil {
+			t.Fatal(err)
+		}
+		expected := Config{Name: "api", Port: 8080, Tags: map[string]string{"env": "prod"}}
+		if !reflect.DeepEqual(val, expected) {
+			t.Fatalf("expected %+v, got %+v", expected, val)
+		}
+	})
+
+	t.Run("Map", func(t *testing.T) {
+		store := New[map[string]any](json.NewEncoder, json.NewDecoder)
+		path := filepath.Join(t.TempDir(), "config.json")
+
+		if err := store.Patch(ctx, path, 0666, []string{"a"}, map[string]any{"a": 1, "b": 2}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Patch(ctx, path, 0666, []string{"c"}, map[string]any{"c": "x"}); err != nil {
+			t.Fatal(err)
+		}
+
+		var val map[string]any
+		if _, err := store.Load(ctx, path, &val); err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]any{"a": 1.0, "c": "x"}
+		if !reflect.DeepEqual(val, expected) {
+			t.Fatalf("expected %v, got %v", expected, val)
+		}
+	})
+}
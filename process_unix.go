@@ -0,0 +1,20 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build unix
+// +build unix
+
+package store
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// processAlive reports whether a process with the specified id runs on the
+// local host. Processes that we are not allowed to signal count as alive.
+func processAlive(pid int) bool {
+	return pid > 0 && unix.Kill(pid, 0) != unix.ESRCH
+}
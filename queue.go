@@ -0,0 +1,201 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrQueueEmpty is returned by Queue.TryClaim when no item can be claimed.
+var ErrQueueEmpty = errors.New("queue is empty")
+
+// A Queue is a persistent queue of values of type T, shared by producers and
+// consumers in any number of processes, where each item is stored atomically
+// into its own file under a spool directory.
+//
+// Consumers claim items by locking their file, and hold them until they
+// either acknowledge them with Ack, which removes them, or give them back
+// with Nack. The items of consumers that crash get released along with their
+// locks, which makes them available to other consumers again, so every item
+// gets processed at least once.
+//
+// Items get claimed in the order in which they were put, as far as the clocks
+// of producers agree.
+type Queue[T any] struct {
+	store *Store[T]
+	dir   string
+	mode  os.FileMode
+}
+
+// NewQueue returns a Queue that stores its items with the specified store in
+// the spool directory dir, creating files with the specified mode.
+//
+// The spool directory must exist.
+func NewQueue[T any](store *Store[T], dir string, mode os.FileMode) *Queue[T] {
+	return &Queue[T]{
+		store: store,
+		dir:   dir,
+		mode:  mode,
+	}
+}
+
+// A QueueItem is an item claimed from a Queue. Exactly one of Ack or Nack
+// must be called once done with it.
+type QueueItem[T any] struct {
+	// ID identifies the item within its queue.
+	ID string
+
+	// Value is the value of the item.
+	Value T
+
+	q *Queue[T]
+	f File
+}
+
+// Put appends v to the queue.
+func (q *Queue[T]) Put(ctx context.Context, v *T) error {
+	for {
+		var random [8]byte
+		if _, err := rand.Read(random[:]); err != nil {
+			return err
+		}
+		id := fmt.Sprintf("%016x-%s", time.Now().UnixNano(), hex.EncodeToString(random[:]))
+		err := q.store.StoreExclusive(ctx, filepath.Join(q.dir, id), q.mode, v)
+		if !errors.Is(err, os.ErrExist) {
+			return err
+		}
+	}
+}
+
+// Claim claims the oldest item of the queue that no other consumer holds,
+// waiting for one to be available until the context is done.
+func (q *Queue[T]) Claim(ctx context.Context) (*QueueItem[T], error) {
+	const (
+		minBackoff = time.Millisecond
+		maxBackoff = 100 * time.Millisecond
+	)
+
+	backoff := minBackoff
+	for {
+		item, err := q.claim(ctx)
+		if err != ErrQueueEmpty {
+			return item, err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// TryClaim is like Claim, but fails with ErrQueueEmpty rather than waiting
+// if no item is available.
+func (q *Queue[T]) TryClaim(ctx context.Context) (*QueueItem[T], error) {
+	return q.claim(ctx)
+}
+
+func (q *Queue[T]) claim(ctx context.Context) (*QueueItem[T], error) {
+	b := q.store.fs()
+	entries, err := b.ReadDir(q.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !isQueueID(entry.Name()) {
+			// Not an item; most likely a lock file.
+			continue
+		}
+		path := filepath.Join(q.dir, entry.Name())
+
+		f, err := q.store.open(path, os.O_RDONLY, 0)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			continue
+		case err != nil:
+			return nil, err
+		}
+		err = b.TryLock(f)
+		if err == nil {
+			// The item may have been acknowledged right before we
+			// locked it.
+			var ko bool
+			_, ko, err = deleted(b, f)
+			if ko && err == nil {
+				err = ErrWouldBlock
+			}
+		}
+		switch {
+		case errors.Is(err, ErrWouldBlock):
+			closeFile(f)
+			continue
+		case err != nil:
+			closeFile(f)
+			return nil, err
+		}
+
+		item := &QueueItem[T]{ID: entry.Name(), q: q, f: f}
+		if _, err := q.store.decodeOrRecover(f, path, &item.Value); err != nil {
+			closeFile(f)
+			return nil, err
+		}
+		return item, nil
+	}
+	return nil, ErrQueueEmpty
+}
+
+// isQueueID reports whether name is the ID of a queue item, which consists
+// of the time at which it was put and of a random number, both in hex.
+func isQueueID(name string) bool {
+	if len(name) != 33 || name[16] != '-' {
+		return false
+	}
+	_, err1 := hex.DecodeString(name[:16])
+	_, err2 := hex.DecodeString(name[17:])
+	return err1 == nil && err2 == nil
+}
+
+// Ack acknowledges the item, which removes it from the queue.
+func (item *QueueItem[T]) Ack() error {
+	store := item.q.store
+	path := item.f.Name()
+	err := store.fs().Remove(path)
+	if cerr := closeFile(item.f); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	// Items never get written again once put, so nothing else can be
+	// waiting on their lock file, which only remains if it is stable.
+	if err := store.fs().Remove(store.lockPath(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return store.syncDir(path)
+}
+
+// Nack gives the item back to the queue, where other consumers can claim it
+// again.
+func (item *QueueItem[T]) Nack() error {
+	return closeFile(item.f)
+}
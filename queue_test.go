@@ -0,0 +1,161 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"Default", nil},
+		{"StableLockFile", []Option{WithStableLockFile()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			newQueue := func(dir string) *Queue[int] {
+				return NewQueue(New[int](json.NewEncoder, json.NewDecoder, tc.opts...), dir, 0666)
+			}
+
+			t.Run("Order", func(t *testing.T) {
+				dir := t.TempDir()
+				q := newQueue(dir)
+				for i := 1; i <= 3; i++ {
+					if err := q.Put(ctx, &i); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				first, err := q.TryClaim(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				second, err := newQueue(dir).TryClaim(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if first.Value != 1 || second.Value != 2 {
+					t.Fatalf("expected items 1 and 2, got %d and %d", first.Value, second.Value)
+				}
+
+				// Giving the first item back makes it available again,
+				// ahead of the third one.
+				if err := first.Nack(); err != nil {
+					t.Fatal(err)
+				}
+				again, err := q.TryClaim(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if again.Value != 1 || again.ID != first.ID {
+					t.Fatalf("expected item 1 again, got %d", again.Value)
+				}
+
+				for _, item := range []*QueueItem[int]{again, second} {
+					if err := item.Ack(); err != nil {
+						t.Fatal(err)
+					}
+				}
+				third, err := q.Claim(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if third.Value != 3 {
+					t.Fatalf("expected item 3, got %d", third.Value)
+				}
+				if err := third.Ack(); err != nil {
+					t.Fatal(err)
+				}
+
+				if _, err := q.TryClaim(ctx); err != ErrQueueEmpty {
+					t.Fatalf("expected %v, got %v", ErrQueueEmpty, err)
+				}
+				tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+				defer cancel()
+				if _, err := q.Claim(tctx); err != context.DeadlineExceeded {
+					t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+				}
+
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(entries) != 0 {
+					t.Fatalf("expected an empty spool directory, got %v", entries)
+				}
+			})
+
+			t.Run("Concurrent", func(t *testing.T) {
+				dir := t.TempDir()
+				const n = 20
+
+				var (
+					mu   sync.Mutex
+					seen []int
+					wg   sync.WaitGroup
+				)
+				for i := 0; i < 4; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						q := newQueue(dir)
+						for {
+							mu.Lock()
+							done := len(seen) == n
+							mu.Unlock()
+							if done {
+								return
+							}
+							tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+							item, err := q.Claim(tctx)
+							cancel()
+							if err == context.DeadlineExceeded {
+								continue
+							}
+							if err != nil {
+								t.Error(err)
+								return
+							}
+							mu.Lock()
+							seen = append(seen, item.Value)
+							mu.Unlock()
+							if err := item.Ack(); err != nil {
+								t.Error(err)
+								return
+							}
+						}
+					}()
+				}
+
+				q := newQueue(dir)
+				for i := 0; i < n; i++ {
+					if err := q.Put(ctx, &i); err != nil {
+						t.Fatal(err)
+					}
+				}
+				wg.Wait()
+
+				sort.Ints(seen)
+				for i, v := range seen {
+					if v != i {
+						t.Fatalf("expected every item exactly once, got %v", seen)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// A RateLimiter is a token bucket shared by all the processes using the same
+// file, which lets short-lived processes share a rate budget: the bucket
+// holds up to burst tokens, gets refilled at rate tokens per second, and each
+// event consumes a token.
+//
+// The bucket is updated while holding the exclusive lock of the file, and
+// refilled according to the time observed once the lock is held, so time
+// spent waiting for the lock never counts towards the refill of other
+// processes, and the limiter never admits more than its budget as long as
+// the clocks of the processes agree.
+type RateLimiter struct {
+	store *Store[bucket]
+	path  string
+	rate  float64
+	burst float64
+}
+
+// bucket is the contents of the files of rate limiters.
+type bucket struct {
+	Tokens float64   `json:"tokens"`
+	Time   time.Time `json:"time"`
+}
+
+// NewRateLimiter returns a RateLimiter backed by the JSON file at path, which
+// allows rate events per second with bursts of up to burst events, with a
+// store configured with the specified options. The bucket starts full.
+func NewRateLimiter(path string, rate float64, burst int, opts ...Option) *RateLimiter {
+	return &RateLimiter{
+		store: New[bucket](json.NewEncoder, json.NewDecoder, opts...),
+		path:  path,
+		rate:  rate,
+		burst: float64(burst),
+	}
+}
+
+// refill updates b to the specified time, loading it with the tokens accrued
+// since it was last updated. Clocks going backwards accrue nothing.
+func (rl *RateLimiter) refill(b *bucket, err error, now time.Time) error {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		*b = bucket{Tokens: rl.burst, Time: now}
+		return nil
+	case err != nil:
+		return err
+	}
+	if elapsed := now.Sub(b.Time); elapsed > 0 {
+		b.Tokens += elapsed.Seconds() * rl.rate
+		b.Time = now
+	}
+	if b.Tokens > rl.burst {
+		b.Tokens = rl.burst
+	}
+	return nil
+}
+
+// Allow reports whether an event may happen now, in which case it consumes
+// a token.
+func (rl *RateLimiter) Allow(ctx context.Context) (bool, error) {
+	var allowed bool
+	err := rl.store.LoadAndStoreExclusive(ctx, rl.path, 0666, func(ctx context.Context, b *bucket, err error) error {
+		if err := rl.refill(b, err, time.Now()); err != nil {
+			return err
+		}
+		if b.Tokens < 1 {
+			return ErrNoChange
+		}
+		b.Tokens--
+		allowed = true
+		return nil
+	})
+	return allowed, err
+}
+
+// Wait waits until an event may happen. It reserves a token right away, even
+// if the bucket is empty, and then waits for the bucket to refill up to that
+// token, which keeps waiters in order without polling the file. If the
+// context would be done before then, Wait fails right away without reserving
+// anything; if it gets done while waiting, the token remains consumed.
+func (rl *RateLimiter) Wait(ctx context.Context) error {
+	var delay time.Duration
+	err := rl.store.LoadAndStoreExclusive(ctx, rl.path, 0666, func(ctx context.Context, b *bucket, err error) error {
+		now := time.Now()
+		if err := rl.refill(b, err, now); err != nil {
+			return err
+		}
+		if b.Tokens < 1 {
+			if rl.rate <= 0 {
+				return &os.PathError{Op: "wait", Path: rl.path, Err: ErrWouldBlock}
+			}
+			delay = time.Duration((1 - b.Tokens) / rl.rate * float64(time.Second))
+			if deadline, ok := ctx.Deadline(); ok && deadline.Before(now.Add(delay)) {
+				return context.DeadlineExceeded
+			}
+		}
+		b.Tokens--
+		return nil
+	})
+	if err != nil || delay <= 0 {
+		return err
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Allow", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "budget")
+
+		// Distinct limiters share the budget of the file.
+		for i, expected := range []bool{true, true, false} {
+			allowed, err := NewRateLimiter(path, 1, 2).Allow(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allowed != expected {
+				t.Fatalf("event %d: expected %v, got %v", i, expected, allowed)
+			}
+		}
+	})
+
+	t.Run("Wait", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "budget")
+		rl := NewRateLimiter(path, 20, 1)
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			if err := rl.Wait(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// The first event uses the burst, and the next two wait 50ms each.
+		if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+			t.Fatalf("expected Wait to wait for the refill, took %v", elapsed)
+		}
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "budget")
+		rl := NewRateLimiter(path, 1, 1)
+		if err := rl.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if err := rl.Wait(tctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Fatalf("expected Wait to fail right away, took %v", elapsed)
+		}
+
+		// Nothing was reserved, so the bucket refills as usual.
+		var b bucket
+		if _, err := rl.store.Load(ctx, path, &b); err != nil {
+			t.Fatal(err)
+		}
+		if b.Tokens < 0 {
+			t.Fatalf("expected no reservation, got %v tokens", b.Tokens)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+)
+
+// A RefCount is a reference counter shared by processes, such as the users of
+// a shared resource, stored in a file. The process that releases the last
+// reference cleans the resource up.
+//
+// References are not released when their holder crashes, so the resource
+// then remains until it gets cleaned up by other means.
+type RefCount struct {
+	mutex *FileMutex[int64]
+	path  string
+}
+
+// NewRefCount returns a RefCount stored in the JSON file at path, with a store
+// configured with the specified options. The file gets created once the
+// first reference gets acquired.
+func NewRefCount(path string, opts ...Option) *RefCount {
+	store := New[int64](json.NewEncoder, json.NewDecoder, opts...)
+	return &RefCount{mutex: NewFileMutex(store, path, 0666), path: path}
+}
+
+// Incr acquires a reference, and returns the resulting number of references.
+// Since Decr cleans up while holding the lock of the file, Incr waits for the
+// cleanup to complete, after which the caller may set up the resource again.
+func (r *RefCount) Incr(ctx context.Context) (int64, error) {
+	n, release, err := r.mutex.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	*n++
+	return *n, release(nil)
+}
+
+// Decr releases a reference, and returns the resulting number of references.
+// If none remains, it calls cleanup before releasing the lock of the file,
+// which guarantees that no other process acquires a reference in the meantime.
+//
+// If cleanup fails, Decr returns its error and leaves the reference in place,
+// so that the caller can try again. Releasing a reference while there are
+// none fails with an error wrapping os.ErrInvalid.
+func (r *RefCount) Decr(ctx context.Context, cleanup func(ctx context.Context) error) (int64, error) {
+	n, release, err := r.mutex.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if *n <= 0 {
+		return *n, release(&os.PathError{Op: "decr", Path: r.path, Err: os.ErrInvalid})
+	}
+	*n--
+	if *n == 0 && cleanup != nil {
+		if err := cleanup(ctx); err != nil {
+			return *n + 1, release(err)
+		}
+	}
+	return *n, release(nil)
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestRefCount(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Cleanup", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "users")
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := NewRefCount(path).Incr(ctx); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		var cleanups int
+		cleanup := func(ctx context.Context) error {
+			cleanups++
+			return nil
+		}
+		for i := 7; i >= 0; i-- {
+			n, err := NewRefCount(path).Decr(ctx, cleanup)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(i) {
+				t.Fatalf("expected %d references, got %d", i, n)
+			}
+		}
+		if cleanups != 1 {
+			t.Fatalf("expected one cleanup, got %d", cleanups)
+		}
+	})
+
+	t.Run("CleanupError", func(t *testing.T) {
+		rc := NewRefCount(filepath.Join(t.TempDir(), "users"))
+		if _, err := rc.Incr(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		errBusy := errors.New("resource busy")
+		if n, err := rc.Decr(ctx, func(ctx context.Context) error { return errBusy }); err != errBusy || n != 1 {
+			t.Fatalf("expected the reference to remain, got %d, %v", n, err)
+		}
+		if n, err := rc.Decr(ctx, nil); err != nil || n != 0 {
+			t.Fatalf("expected no references, got %d, %v", n, err)
+		}
+	})
+
+	t.Run("Underflow", func(t *testing.T) {
+		rc := NewRefCount(filepath.Join(t.TempDir(), "users"))
+		if _, err := rc.Decr(ctx, nil); !errors.Is(err, os.ErrInvalid) {
+			t.Fatalf("expected %v, got %v", os.ErrInvalid, err)
+		}
+	})
+}
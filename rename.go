@@ -0,0 +1,233 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Rename atomically moves the file at oldPath to newPath, provided that
+// neither file changed since the Loads that returned oldCanary and newCanary.
+// Otherwise, Rename returns ErrRetry. A nil canary stands for a file that did
+// not exist.
+//
+// Rename holds the exclusive locks of both paths for the duration of the
+// move, which means that concurrent stores to either path either complete
+// before the move, or observe its result.
+//
+// If newPath already exists, Rename replaces it if overwrite is true, and
+// fails with an error wrapping os.ErrExist otherwise, in which case
+// newCanary is ignored.
+func (store *Store[T]) Rename(ctx context.Context, oldPath, newPath string, oldCanary, newCanary Canary, overwrite bool) error {
+	if filepath.Clean(oldPath) == filepath.Clean(newPath) {
+		return nil
+	}
+
+	// Acquire the locks in the same order as transactions do, to avoid
+	// deadlocking with them and with a concurrent Rename in the opposite
+	// direction.
+	paths := []string{oldPath, newPath}
+	order, err := lockOrder(paths)
+	if err != nil {
+		return err
+	}
+	lfs := make([]File, len(paths))
+	defer func() {
+		for _, lf := range lfs {
+			if lf != nil {
+				store.release(ctx, lf)
+			}
+		}
+	}()
+	for _, i := range order {
+		switch {
+		case i == 1 && !overwrite:
+			lfs[i], err = store.acquireLatest(ctx, paths[i])
+		case i == 1:
+			lfs[i], _, err = store.acquire(ctx, paths[i], 0666, newCanary, false)
+		default:
+			lfs[i], _, err = store.acquire(ctx, paths[i], 0666, oldCanary, false)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	b := store.fs()
+	rdf, err := b.OpenFile(oldPath, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer closeFile(rdf)
+
+	if !overwrite {
+		_, err := b.Lstat(newPath)
+		switch {
+		case err == nil:
+			return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: os.ErrExist}
+		case !errors.Is(err, os.ErrNotExist):
+			return err
+		}
+	}
+
+	if err := b.Rename(rdf, newPath); err != nil {
+		return err
+	}
+	if err := store.syncDir(newPath); err != nil {
+		return err
+	}
+	if filepath.Dir(oldPath) != filepath.Dir(newPath) {
+		if err := store.syncDir(oldPath); err != nil {
+			return err
+		}
+	}
+
+	// Remove both lock files, which forces concurrent stores waiting on
+	// them to retry.
+	err = b.Remove(lfs[0].Name())
+	if uerr := b.Remove(lfs[1].Name()); err == nil {
+		err = uerr
+	}
+	return err
+}
+
+// acquireLatest acquires the lock file of path regardless of the contents of
+// path, retrying when a concurrent store replaces the lock file while it waits
+// on it.
+func (store *Store[T]) acquireLatest(ctx context.Context, path string) (File, error) {
+	for {
+		lf, _, err := store.acquire(ctx, path, 0666, nil, true)
+		if err != ErrRetry {
+			return lf, err
+		}
+	}
+}
+
+// linkNoReplace renames f to the path to by hard-linking it to to, which fails
+// if to already exists, then unlinking its old name. It stands in for
+// renameNoReplace on systems that lack an atomic rename that does not replace
+// its destination.
+func linkNoReplace(dir *os.File, f OSFile, to string) error {
+	if err := link(dir, f.Name(), to); err != nil {
+		return err
+	}
+	return unlink(dir, f.Name())
+}
+
+// renameNoReplace renames f to the path to with the backend of the store, but
+// fails with an error wrapping os.ErrExist if to already exists.
+func (store *Store[T]) renameNoReplace(f File, to string) error {
+	b := store.fs()
+	if r, ok := b.(NoReplaceRenamer); ok {
+		return r.RenameNoReplace(f, to)
+	}
+	if err := b.Link(f.Name(), to); err != nil {
+		return err
+	}
+	return b.Remove(f.Name())
+}
+
+// Swap atomically exchanges the files at pathA and pathB, which must both
+// exist, so that each path holds the former contents of the other.
+//
+// Like Rename, Swap holds the exclusive locks of both paths for the duration
+// of the exchange, and exchanges whatever the files hold once it gets them.
+//
+// On Linux, the files are exchanged with renameat2(RENAME_EXCHANGE), which
+// readers observe as a single atomic step. Elsewhere, or on filesystems that
+// do not support it, each path is replaced in turn with a hard link to the
+// other file, so that both paths exist throughout, but readers that do not
+// lock the files may briefly see the same contents at both paths.
+func (store *Store[T]) Swap(ctx context.Context, pathA, pathB string) error {
+	if filepath.Clean(pathA) == filepath.Clean(pathB) {
+		return nil
+	}
+
+	paths := []string{pathA, pathB}
+	order, err := lockOrder(paths)
+	if err != nil {
+		return err
+	}
+	for _, i := range order {
+		lf, err := store.acquireLatest(ctx, paths[i])
+		if err != nil {
+			return err
+		}
+		defer store.release(ctx, lf)
+	}
+
+	err = ErrUnsupported
+	if x, ok := store.fs().(Exchanger); ok {
+		err = x.Exchange(pathA, pathB)
+	}
+	if errors.Is(err, ErrUnsupported) {
+		err = store.swapLinked(pathA, pathB)
+	}
+	if err != nil {
+		return err
+	}
+	if err := store.syncDir(pathA); err != nil {
+		return err
+	}
+	if filepath.Dir(pathA) != filepath.Dir(pathB) {
+		return store.syncDir(pathB)
+	}
+	return nil
+}
+
+// swapLinked exchanges the files at pathA and pathB by hard-linking both to
+// temporary names, then renaming each link over the other path. If the second
+// rename fails, pathA gets its former contents back; should that fail too,
+// the error names the temporary file that keeps them. The locks of both paths
+// must be held.
+func (store *Store[T]) swapLinked(pathA, pathB string) error {
+	tempA, err := store.tempName(pathA)
+	if err != nil {
+		return err
+	}
+	tempB, err := store.tempName(pathB)
+	if err != nil {
+		return err
+	}
+
+	b := store.fs()
+	if err := b.Link(pathA, tempA); err != nil {
+		return err
+	}
+	if err := b.Link(pathB, tempB); err != nil {
+		b.Remove(tempA)
+		return err
+	}
+	defer b.Remove(tempB)
+
+	if err := renamePath(b, tempB, pathA); err != nil {
+		b.Remove(tempA)
+		return err
+	}
+	if err := renamePath(b, tempA, pathB); err != nil {
+		// Both paths now hold the contents of pathB, and tempA is the
+		// only link left to those of pathA.
+		if rerr := renamePath(b, tempA, pathA); rerr != nil {
+			return &os.LinkError{Op: "swap", Old: tempA, New: pathB, Err: err}
+		}
+		return err
+	}
+	return nil
+}
+
+// renamePath renames the file at from to the path to with the backend b.
+func renamePath(b Backend, from, to string) error {
+	f, err := b.OpenFile(from, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return b.Rename(f, to)
+}
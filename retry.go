@@ -0,0 +1,81 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+// The retry policy of stores not configured with WithRetryPolicy. Losing
+// writers back off for long enough to let the winner complete, rather than
+// hammering the lock file it holds.
+const (
+	DefaultRetryBackoff = 100 * time.Microsecond
+	DefaultRetryJitter  = time.Millisecond
+)
+
+// maxBackoffShift caps the exponential growth of retry delays, so that they
+// never exceed 64 times the base backoff.
+const maxBackoffShift = 6
+
+// An OnRetryFunc is called by LoadAndStore before retrying, after attempt
+// attempts on the file at path failed with ErrRetry. Returning an error aborts
+// LoadAndStore with that error.
+type OnRetryFunc func(ctx context.Context, path string, attempt int) error
+
+// retry prepares for another attempt of LoadAndStore on the file at path,
+// after attempt attempts failed. It calls the OnRetry hook, and waits for the
+// backoff configured with WithRetryPolicy. It returns ErrRetry if no attempt
+// is left.
+func (store *Store[T]) retry(ctx context.Context, path string, attempt int) error {
+	if store.opts.maxAttempts > 0 && attempt >= store.opts.maxAttempts {
+		return ErrRetry
+	}
+	if store.opts.onRetry != nil {
+		if err := store.opts.onRetry(ctx, path, attempt); err != nil {
+			return err
+		}
+	}
+
+	delay := store.retryDelay(attempt)
+	store.debug(ctx, "retrying", "path", path, "attempt", attempt, "delay", delay)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryDelay returns how long to wait after attempt attempts failed.
+func (store *Store[T]) retryDelay(attempt int) time.Duration {
+	shift := attempt - 1
+	if shift > maxBackoffShift {
+		shift = maxBackoffShift
+	}
+	backoff, jitter := store.opts.backoff, store.opts.jitter
+	if !store.opts.retryPolicy {
+		backoff, jitter = DefaultRetryBackoff, DefaultRetryJitter
+	}
+	delay := backoff << shift
+
+	if jitter > 0 {
+		var random [8]byte
+		if _, err := rand.Read(random[:]); err == nil {
+			delay += time.Duration(binary.LittleEndian.Uint64(random[:]) % uint64(jitter))
+		}
+	}
+	return delay
+}
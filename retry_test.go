@@ -0,0 +1,118 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	// contend returns a LoadAndStoreFunc that modifies the file behind the
+	// back of LoadAndStore, which makes every attempt fail with ErrRetry.
+	contend := func(path string, calls *int) LoadAndStoreFunc[int] {
+		other := New[int](json.NewEncoder, json.NewDecoder)
+		return func(ctx context.Context, val *int, err error) error {
+			*calls++
+			v := *calls
+			return other.ForceStore(ctx, path, 0666, &v)
+		}
+	}
+
+	t.Run("MaxAttempts", func(t *testing.T) {
+		var attempts []int
+		store := New[int](json.NewEncoder, json.NewDecoder,
+			WithRetryPolicy(3, 0, 0),
+			WithOnRetry(func(ctx context.Context, path string, attempt int) error {
+				attempts = append(attempts, attempt)
+				return nil
+			}))
+		path := filepath.Join(t.TempDir(), "state.json")
+
+		var calls int
+		if err := store.LoadAndStore(ctx, path, 0666, contend(path, &calls)); err != ErrRetry {
+			t.Fatalf("expected %v, got %v", ErrRetry, err)
+		}
+		if calls != 3 {
+			t.Fatalf("expected 3 attempts, got %d", calls)
+		}
+		if expected := []int{1, 2}; !reflect.DeepEqual(attempts, expected) {
+			t.Fatalf("expected OnRetry to be called with %v, got %v", expected, attempts)
+		}
+	})
+
+	t.Run("Abort", func(t *testing.T) {
+		errAbort := errors.New("too much contention")
+		store := New[int](json.NewEncoder, json.NewDecoder,
+			WithOnRetry(func(ctx context.Context, path string, attempt int) error {
+				if attempt == 2 {
+					return errAbort
+				}
+				return nil
+			}))
+		path := filepath.Join(t.TempDir(), "state.json")
+
+		var calls int
+		if err := store.LoadAndStore(ctx, path, 0666, contend(path, &calls)); err != errAbort {
+			t.Fatalf("expected %v, got %v", errAbort, err)
+		}
+		if calls != 2 {
+			t.Fatalf("expected 2 attempts, got %d", calls)
+		}
+	})
+
+	t.Run("Backoff", func(t *testing.T) {
+		const backoff = 10 * time.Millisecond
+		store := New[int](json.NewEncoder, json.NewDecoder, WithRetryPolicy(3, backoff, backoff))
+		path := filepath.Join(t.TempDir(), "state.json")
+
+		var calls int
+		start := time.Now()
+		if err := store.LoadAndStore(ctx, path, 0666, contend(path, &calls)); err != ErrRetry {
+			t.Fatalf("expected %v, got %v", ErrRetry, err)
+		}
+		// The retries wait for backoff, then twice backoff, plus jitter.
+		if elapsed := time.Since(start); elapsed < 3*backoff {
+			t.Fatalf("expected retries to take at least %v, took %v", 3*backoff, elapsed)
+		}
+	})
+
+	t.Run("Default", func(t *testing.T) {
+		store := New[int](json.NewEncoder, json.NewDecoder)
+		for attempt := 1; attempt <= 3; attempt++ {
+			min := DefaultRetryBackoff << (attempt - 1)
+			if delay := store.retryDelay(attempt); delay < min || delay >= min+DefaultRetryJitter {
+				t.Fatalf("attempt %d: expected a delay between %v and %v, got %v", attempt, min, min+DefaultRetryJitter, delay)
+			}
+		}
+
+		store = New[int](json.NewEncoder, json.NewDecoder, WithRetryPolicy(0, 0, 0))
+		if delay := store.retryDelay(1); delay != 0 {
+			t.Fatalf("expected no delay, got %v", delay)
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		store := New[int](json.NewEncoder, json.NewDecoder, WithRetryPolicy(0, time.Hour, 0))
+		path := filepath.Join(t.TempDir(), "state.json")
+
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		var calls int
+		if err := store.LoadAndStore(ctx, path, 0666, contend(path, &calls)); err != context.DeadlineExceeded {
+			t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+	})
+}
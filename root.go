@@ -0,0 +1,63 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrOutsideRoot is returned, wrapped in an *os.PathError, when a store
+// operating in a Root is passed a path that resolves outside of the root,
+// for instance through ".." components or symbolic links.
+var ErrOutsideRoot = errors.New("path escapes from the root")
+
+// ErrRootUnsupported is returned, wrapped in an *os.PathError, by OpenRoot on
+// systems that cannot confine paths to a directory.
+var ErrRootUnsupported = errors.New("roots are not supported on this system")
+
+// A Root is a directory that confines the paths of the stores operating in
+// it, like os.Root. Paths are resolved relative to the root, and operations
+// on paths that resolve outside of it fail with an error wrapping
+// ErrOutsideRoot, which makes roots safe to use with paths that are
+// influenced by untrusted parties.
+//
+// Roots are supported on Linux 5.6 and later, where paths are resolved with
+// openat2(RESOLVE_BENEATH), so that symbolic links cannot escape the root
+// either.
+type Root struct {
+	f *os.File
+}
+
+// OpenRoot opens the directory at name as a Root.
+func OpenRoot(name string) (*Root, error) {
+	f, err := openRoot(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Root{f: f}, nil
+}
+
+// Name returns the name of the directory, as passed to OpenRoot.
+func (r *Root) Name() string {
+	return r.f.Name()
+}
+
+// Close closes the root. Stores operating in the root must no longer be
+// used afterwards.
+func (r *Root) Close() error {
+	closeRoot(r.f)
+	return r.f.Close()
+}
+
+// InRoot returns a copy of the store that operates in the specified root.
+// This is like InDir, except that paths that resolve outside of the root are
+// rejected. The root must remain open for as long as the returned store is in
+// use.
+func (store *Store[T]) InRoot(root *Root) *Store[T] {
+	return store.InDir(root.f)
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package store
+
+import (
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// roots holds the directories opened by OpenRoot. Paths resolved relative to
+// these directories get resolved beneath them.
+var roots sync.Map
+
+func openRoot(name string) (*os.File, error) {
+	f, err := os.OpenFile(name, os.O_RDONLY|unix.O_DIRECTORY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// Probe for openat2, which appeared in Linux 5.6.
+	fd, err := openBeneath(int(f.Fd()), ".", unix.O_PATH|unix.O_DIRECTORY, 0)
+	if err != nil {
+		f.Close()
+		if err == unix.ENOSYS {
+			err = ErrRootUnsupported
+		}
+		return nil, &os.PathError{Op: "openat2", Path: name, Err: err}
+	}
+	unix.Close(fd)
+
+	roots.Store(f, struct{}{})
+	return f, nil
+}
+
+func closeRoot(f *os.File) {
+	roots.Delete(f)
+}
+
+// isRoot returns whether dir was opened by OpenRoot.
+func isRoot(dir *os.File) bool {
+	_, ok := roots.Load(dir)
+	return ok
+}
+
+// openBeneath opens the file at path, resolved beneath the directory dirfd
+// with openat2(RESOLVE_BENEATH). Paths that escape the directory fail with
+// ErrOutsideRoot.
+func openBeneath(dirfd int, path string, flag int, perm uint32) (int, error) {
+	how := unix.OpenHow{
+		Flags:   uint64(flag | unix.O_CLOEXEC),
+		Resolve: unix.RESOLVE_BENEATH | unix.RESOLVE_NO_MAGICLINKS,
+	}
+	// The kernel rejects modes without O_CREAT or O_TMPFILE.
+	if flag&unix.O_CREAT != 0 || flag&unix.O_TMPFILE == unix.O_TMPFILE {
+		how.Mode = uint64(perm)
+	}
+	for {
+		fd, err := unix.Openat2(dirfd, path, &how)
+		switch err {
+		case unix.EAGAIN:
+			// A concurrent rename raced with the resolution of path.
+			continue
+		case unix.EXDEV:
+			return -1, ErrOutsideRoot
+		}
+		return fd, err
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build !linux
+// +build !linux
+
+package store
+
+import (
+	"os"
+)
+
+func openRoot(name string) (*os.File, error) {
+	return nil, &os.PathError{Op: "openroot", Path: name, Err: ErrRootUnsupported}
+}
+
+func closeRoot(f *os.File) {}
@@ -0,0 +1,105 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRoot(t *testing.T) {
+	ctx := context.Background()
+
+	type Test struct {
+		Example string
+	}
+
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.json"), []byte(`{"Example": "secret"}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.json"), filepath.Join(dir, "secret.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := OpenRoot(dir)
+	if errors.Is(err, ErrRootUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	for _, opts := range [][]Option{
+		nil,
+		{WithStableLockFile()},
+	} {
+		store := New[Test](json.NewEncoder, json.NewDecoder, opts...).InRoot(root)
+
+		t.Run("Inside", func(t *testing.T) {
+			for _, path := range []string{"state.json", "sub/state.json", "sub/../other.json"} {
+				if err := store.ForceStore(ctx, path, 0666, &Test{Example: path}); err != nil {
+					t.Fatal(err)
+				}
+				var val Test
+				if _, err := store.Load(ctx, path, &val); err != nil {
+					t.Fatal(err)
+				}
+				if val.Example != path {
+					t.Fatalf("expected %v, got %v", path, val.Example)
+				}
+				if _, err := os.Stat(filepath.Join(dir, path)); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+
+		t.Run("Outside", func(t *testing.T) {
+			for _, path := range []string{
+				"../state.json",
+				"sub/../../state.json",
+				filepath.Join(outside, "state.json"),
+				"escape/state.json",
+				"secret.json",
+			} {
+				var val Test
+				if _, err := store.Load(ctx, path, &val); !errors.Is(err, ErrOutsideRoot) {
+					t.Fatalf("expected loading %v to fail with ErrOutsideRoot, got %v", path, err)
+				}
+				if path == "secret.json" {
+					// Storing replaces the symbolic link itself, which is
+					// harmless.
+					continue
+				}
+				if err := store.ForceStore(ctx, path, 0666, &val); !errors.Is(err, ErrOutsideRoot) {
+					t.Fatalf("expected storing %v to fail with ErrOutsideRoot, got %v", path, err)
+				}
+			}
+
+			entries, err := os.ReadDir(outside)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("expected the outside directory to be untouched, got %v entries", len(entries))
+			}
+		})
+	}
+}
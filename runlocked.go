@@ -0,0 +1,63 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"os"
+	"os/exec"
+)
+
+// RunLocked acquires an exclusive lock on the file at path, creating it if
+// needed, runs cmd while holding the lock, and releases it once cmd exits.
+// It returns the error of Lock or of running cmd.
+//
+// The locked file is inherited by the command, as the last of cmd.ExtraFiles
+// on Unix systems and as one of the additional inherited handles on Windows,
+// so that external tools run under the same mutual exclusion as the programs
+// that lock the file with this package. With flock(2) locks, the lock remains
+// held until the command and any of its children that kept the descriptor
+// exit, even if the calling process dies first.
+func RunLocked(ctx context.Context, path string, cmd *exec.Cmd) error {
+	return FlockLocks.RunLocked(ctx, path, cmd)
+}
+
+// RunLocked is like the package-level RunLocked function, but uses locks of
+// the specified style. Only FlockLocks and OFDLocks are held by the
+// descriptor that the command inherits; process-associated locks, such as
+// FcntlLocks, are only held by the calling process.
+func (style LockStyle) RunLocked(ctx context.Context, path string, cmd *exec.Cmd) error {
+	wait, err := style.startLocked(ctx, path, cmd)
+	if err != nil {
+		return err
+	}
+	return wait()
+}
+
+// startLocked acquires the lock of RunLocked and starts cmd. The returned
+// function waits for cmd to exit, then releases the lock.
+func (style LockStyle) startLocked(ctx context.Context, path string, cmd *exec.Cmd) (wait func() error, err error) {
+	// Write locks of fcntl(2) need a descriptor open for writing.
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := style.Lock(ctx, f); err != nil {
+		closeLocked(f)
+		return nil, err
+	}
+	inheritFile(cmd, f)
+	if err := cmd.Start(); err != nil {
+		closeLocked(f)
+		return nil, err
+	}
+	return func() error {
+		defer closeLocked(f)
+		return cmd.Wait()
+	}, nil
+}
@@ -0,0 +1,21 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build !windows
+// +build !windows
+
+package store
+
+import (
+	"os"
+	"os/exec"
+)
+
+// inheritFile makes cmd inherit the descriptor of f, which the child gets
+// without FD_CLOEXEC.
+func inheritFile(cmd *exec.Cmd, f *os.File) {
+	cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+}
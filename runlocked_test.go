@@ -0,0 +1,109 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunLocked(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not available")
+	}
+	ctx := context.Background()
+
+	styles := []struct {
+		name  string
+		style LockStyle
+	}{
+		{"Flock", FlockLocks},
+		{"OFD", OFDLocks},
+		{"Fcntl", FcntlLocks},
+	}
+	for _, tc := range styles {
+		style := tc.style
+		t.Run(tc.name, func(t *testing.T) {
+			if err := checkLockFlags(style.flags()); err != nil {
+				t.Skip(err)
+			}
+			path := filepath.Join(t.TempDir(), "lock")
+
+			t.Run("Held", func(t *testing.T) {
+				stdinr, stdinw, err := os.Pipe()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer stdinw.Close()
+				stdoutr, stdoutw, err := os.Pipe()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer stdoutr.Close()
+
+				// The command reports whether it inherited the lock file,
+				// then waits for its standard input to be closed.
+				cmd := exec.Command(sh, "-c", `if [ -e /dev/fd/3 ]; then echo inherited; else echo ready; fi; read x || true`)
+				cmd.Stdin, cmd.Stdout = stdinr, stdoutw
+
+				wait, err := style.startLocked(ctx, path, cmd)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// The child has its own copies now.
+				stdinr.Close()
+				stdoutw.Close()
+
+				line, err := bufio.NewReader(stdoutr).ReadString('\n')
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := os.Stat("/dev/fd/0"); err == nil && line != "inherited\n" {
+					t.Errorf("expected the command to inherit the lock file, got %q", line)
+				}
+
+				f, err := os.OpenFile(path, os.O_RDWR, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer closeLocked(f)
+				if err := style.TryLock(f); !errors.Is(err, ErrWouldBlock) {
+					t.Fatalf("expected ErrWouldBlock while the command runs, got %v", err)
+				}
+
+				stdinw.Close()
+				if err := wait(); err != nil {
+					t.Fatal(err)
+				}
+				if err := style.TryLock(f); err != nil {
+					t.Fatalf("expected the lock to be released, got %v", err)
+				}
+			})
+
+			t.Run("ExitStatus", func(t *testing.T) {
+				err := style.RunLocked(ctx, path, exec.Command(sh, "-c", "exit 3"))
+				var exitErr *exec.ExitError
+				if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+					t.Fatalf("expected exit status 3, got %v", err)
+				}
+			})
+		})
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "lock")
+		if err := RunLocked(ctx, path, exec.Command(sh, "-c", "exit 0")); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,24 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build windows
+// +build windows
+
+package store
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// inheritFile makes cmd inherit the handle of f.
+func inheritFile(cmd *exec.Cmd, f *os.File) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.AdditionalInheritedHandles = append(cmd.SysProcAttr.AdditionalInheritedHandles, syscall.Handle(f.Fd()))
+}
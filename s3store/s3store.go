@@ -0,0 +1,232 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+// Package s3store provides a store.ObjectBackend that keeps files as the
+// objects of an S3 bucket, using their ETags as canaries and conditional
+// requests in place of locks.
+//
+// Basic usage is:
+//
+//	bucket := &s3store.Bucket{
+//	    URL:    "https://my-bucket.s3.us-east-1.amazonaws.com",
+//	    Region: "us-east-1",
+//	    Credentials: s3store.Credentials{
+//	        AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+//	        SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+//	    },
+//	}
+//	st := store.New[Type](json.NewEncoder, json.NewDecoder, store.WithObjectBackend(bucket))
+//
+// Stores rely on the bucket honoring If-Match and If-None-Match on PUT and
+// DELETE requests to detect concurrent updates; object stores that ignore
+// them silently lose updates.
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"barney.ci/go-store"
+)
+
+// Credentials are the AWS credentials used to sign requests.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// SessionToken is the token of temporary credentials, if any.
+	SessionToken string
+}
+
+// A Bucket is an S3 bucket, which implements store.ObjectBackend.
+//
+// The names of files are the keys of objects, relative to Prefix. A Bucket
+// must not be modified once in use.
+type Bucket struct {
+	// URL is the URL of the bucket, either virtual-hosted, such as
+	// https://bucket.s3.region.amazonaws.com, or path-style, such as
+	// https://s3.region.amazonaws.com/bucket.
+	URL string
+
+	// Region is the region of the bucket, which requests are signed for.
+	Region string
+
+	// Prefix is prepended to the names of files to form the keys of their
+	// objects, for instance "configs/".
+	Prefix string
+
+	// Credentials sign the requests. Requests are anonymous if
+	// Credentials.AccessKeyID is empty.
+	Credentials Credentials
+
+	// Client sends the requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// An Error is an error response of S3.
+type Error struct {
+	// Op is the operation that failed: "get", "put" or "delete".
+	Op string
+
+	// Key is the key of the object.
+	Key string
+
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+
+	// Code and Message come from the body of the response, if any.
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *Error) Error() string {
+	msg := e.Code
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return fmt.Sprintf("s3 %s %s: %d %s", e.Op, e.Key, e.StatusCode, msg)
+}
+
+// Get implements store.ObjectBackend.
+func (b *Bucket) Get(ctx context.Context, name, ifNoneMatch string) (io.ReadCloser, string, error) {
+	header := make(http.Header)
+	if ifNoneMatch != "" {
+		header.Set("If-None-Match", ifNoneMatch)
+	}
+	resp, err := b.do(ctx, http.MethodGet, name, header, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, resp.Header.Get("ETag"), nil
+	case http.StatusNotModified:
+		resp.Body.Close()
+		return nil, "", store.ErrNotModified
+	}
+	return nil, "", b.fail("get", name, resp)
+}
+
+// Put implements store.ObjectBackend.
+func (b *Bucket) Put(ctx context.Context, name string, data []byte, ifMatch string, force bool) (string, error) {
+	header := make(http.Header)
+	switch {
+	case force:
+	case ifMatch == "":
+		header.Set("If-None-Match", "*")
+	default:
+		header.Set("If-Match", ifMatch)
+	}
+	resp, err := b.do(ctx, http.MethodPut, name, header, data)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode/100 != 2 {
+		return "", b.fail("put", name, resp)
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// Delete implements store.ObjectBackend.
+func (b *Bucket) Delete(ctx context.Context, name, ifMatch string, force bool) error {
+	header := make(http.Header)
+	switch {
+	case force:
+	case ifMatch == "":
+		// There is nothing to delete if the object is missing, and
+		// otherwise, it changed since it was loaded.
+		rc, _, err := b.Get(ctx, name, "")
+		if err != nil {
+			var perr *fs.PathError
+			if errors.As(err, &perr) {
+				perr.Op = "delete"
+			}
+			return err
+		}
+		rc.Close()
+		return store.ErrRetry
+	default:
+		header.Set("If-Match", ifMatch)
+	}
+	resp, err := b.do(ctx, http.MethodDelete, name, header, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return b.fail("delete", name, resp)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// fail closes the body of the unsuccessful response resp, and returns the
+// corresponding error.
+func (b *Bucket) fail(op, name string, resp *http.Response) error {
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		// S3 responds with 409 Conflict when a concurrent conditional
+		// write to the same object wins the race.
+		return store.ErrRetry
+	}
+
+	e := &Error{Op: op, Key: b.Prefix + name, StatusCode: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	_ = xml.Unmarshal(body, e)
+	return e
+}
+
+// do sends a signed request for the object of the specified file.
+func (b *Bucket) do(ctx context.Context, method, name string, header http.Header, body []byte) (*http.Response, error) {
+	u, err := b.objectURL(name)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	if b.Credentials.AccessKeyID != "" {
+		sign(req, body, b.Credentials, b.Region, time.Now().UTC())
+	}
+
+	client := b.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// objectURL returns the URL of the object of the specified file.
+func (b *Bucket) objectURL(name string) (*url.URL, error) {
+	u, err := url.Parse(b.URL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + b.Prefix + name
+	u.RawPath = escapePath(u.Path)
+	return u, nil
+}
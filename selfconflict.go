@@ -0,0 +1,166 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// ErrSelfConflict is returned when acquiring a lock would block on a lock
+// that the calling goroutine holds on the same file through another file,
+// and which therefore never gets released, if self-conflict detection was
+// enabled with SetSelfConflictDetection.
+var ErrSelfConflict = errors.New("lock conflicts with a lock held by the same goroutine")
+
+// Except for FcntlLocks, locks are owned by open file descriptions: two
+// files of the process that lock the same file conflict with each other like
+// files of different processes do, which makes a goroutine that locks a file
+// it already locked through another file hang forever.
+//
+// When self-conflict detection is enabled, the process keeps track of which
+// of its files hold a lock on which file, and which goroutine acquired it, so
+// that such conflicts fail with ErrSelfConflict.
+
+type selfHolder struct {
+	exclusive bool
+	goroutine uint64
+}
+
+var selfLocks = struct {
+	sync.Mutex
+	files map[any]map[OSFile]selfHolder
+	keys  map[OSFile]any
+}{files: map[any]map[OSFile]selfHolder{}, keys: map[OSFile]any{}}
+
+var (
+	// selfLocksEnabled is set by SetSelfConflictDetection.
+	selfLocksEnabled atomic.Bool
+
+	// selfLocksHeld is the number of entries in selfLocks.keys, which lets
+	// the release of locks skip the table when it is empty.
+	selfLocksHeld atomic.Int64
+)
+
+// SetSelfConflictDetection enables or disables the detection of conflicts
+// between the locks that a goroutine holds on the same file through distinct
+// files. It is disabled by default.
+//
+// While enabled, the blocking lock functions of the package, and stores using
+// the files of the operating system, fail with an error wrapping
+// ErrSelfConflict instead of hanging when the calling goroutine already holds
+// a conflicting lock on the same file through another file. Conflicts with
+// locks held by other goroutines are waited on as usual.
+//
+// Locks handed over to another goroutine are still considered held by the
+// goroutine that acquired them. Detection is only supported on Unix-like
+// systems and Windows.
+func SetSelfConflictDetection(enabled bool) {
+	selfLocksEnabled.Store(enabled)
+}
+
+// selfLockAcquire acquires the lock of f with the specified flags by calling
+// lock, unless it conflicts with a lock held by the calling goroutine.
+func selfLockAcquire(f OSFile, flags lockFlag, lock func() error) error {
+	if !selfLocksEnabled.Load() {
+		return lock()
+	}
+	key, err := fileKey(f)
+	if err != nil {
+		return lock()
+	}
+	me := goroutineID()
+
+	selfLocks.Lock()
+	conflict := (flags&lockBlock) != 0 && selfLockConflicts(key, f, flags, me)
+	selfLocks.Unlock()
+	if conflict {
+		return ErrSelfConflict
+	}
+
+	if err := lock(); err != nil {
+		return err
+	}
+
+	selfLocks.Lock()
+	defer selfLocks.Unlock()
+	holders := selfLocks.files[key]
+	if holders == nil {
+		holders = map[OSFile]selfHolder{}
+		selfLocks.files[key] = holders
+	}
+	if _, held := holders[f]; !held {
+		selfLocks.keys[f] = key
+		selfLocksHeld.Add(1)
+	}
+	holders[f] = selfHolder{exclusive: (flags & lockExcl) != 0, goroutine: me}
+	return nil
+}
+
+// selfLockConflicts returns whether the lock of f with the specified flags
+// conflicts with a lock that the goroutine me holds on the file identified by
+// key through another file, forgetting about the holders that were closed.
+// selfLocks must be locked.
+func selfLockConflicts(key any, f OSFile, flags lockFlag, me uint64) bool {
+	for holder, held := range selfLocks.files[key] {
+		if holder == f {
+			continue
+		}
+		if fileClosed(holder) {
+			// The file was closed, which released its lock.
+			selfLockForget(holder)
+			continue
+		}
+		if held.goroutine == me && ((flags&lockExcl) != 0 || held.exclusive) {
+			return true
+		}
+	}
+	return false
+}
+
+// selfLockRelease forgets about the lock held by f, if any.
+func selfLockRelease(f OSFile) {
+	if selfLocksHeld.Load() == 0 {
+		return
+	}
+	selfLocks.Lock()
+	defer selfLocks.Unlock()
+	selfLockForget(f)
+}
+
+// selfLockForget removes f from the holders of the lock of its file.
+// selfLocks must be locked.
+func selfLockForget(f OSFile) {
+	key, ok := selfLocks.keys[f]
+	if !ok {
+		return
+	}
+	delete(selfLocks.keys, f)
+	selfLocksHeld.Add(-1)
+
+	holders := selfLocks.files[key]
+	delete(holders, f)
+	if len(holders) == 0 {
+		delete(selfLocks.files, key)
+	}
+}
+
+// fileClosed returns whether f is known to be closed. Unlike checking the
+// result of Fd, it is safe to call while another goroutine closes f.
+func fileClosed(f OSFile) bool {
+	sc, ok := f.(syscall.Conn)
+	if !ok {
+		return false
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return true
+	}
+	return rc.Control(func(uintptr) {}) != nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build unix || windows
+// +build unix windows
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSelfConflict(t *testing.T) {
+	ctx := context.Background()
+	SetSelfConflictDetection(true)
+	defer SetSelfConflictDetection(false)
+
+	// open opens the same file twice.
+	open := func(t *testing.T) (*os.File, *os.File) {
+		path := filepath.Join(t.TempDir(), "lock")
+		f1, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f1.Close() })
+		f2, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f2.Close() })
+		return f1, f2
+	}
+
+	t.Run("Conflict", func(t *testing.T) {
+		f1, f2 := open(t)
+		if err := RLock(ctx, f1); err != nil {
+			t.Fatal(err)
+		}
+		if err := RLock(ctx, f2); err != nil {
+			t.Fatal(err)
+		}
+		if err := Lock(ctx, f2); !errors.Is(err, ErrSelfConflict) {
+			t.Fatalf("expected %v, got %v", ErrSelfConflict, err)
+		}
+		if err := TryLock(f2); !errors.Is(err, ErrWouldBlock) {
+			t.Fatalf("expected %v, got %v", ErrWouldBlock, err)
+		}
+
+		if err := Unlock(f1); err != nil {
+			t.Fatal(err)
+		}
+		if err := Lock(ctx, f2); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		f1, f2 := open(t)
+		if err := Lock(ctx, f1); err != nil {
+			t.Fatal(err)
+		}
+		f1.Close()
+		if err := Lock(ctx, f2); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("OtherGoroutine", func(t *testing.T) {
+		f1, f2 := open(t)
+		if err := Lock(ctx, f1); err != nil {
+			t.Fatal(err)
+		}
+
+		errc := make(chan error, 1)
+		go func() {
+			tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+			defer cancel()
+			errc <- Lock(tctx, f2)
+		}()
+		if err := <-errc; !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+	})
+
+	t.Run("Store", func(t *testing.T) {
+		store := New[int](json.NewEncoder, json.NewDecoder)
+		path := filepath.Join(t.TempDir(), "state.json")
+
+		var nested error
+		err := store.LoadAndStoreExclusive(ctx, path, 0666, func(ctx context.Context, val *int, err error) error {
+			v := 2
+			nested = store.ForceStore(ctx, path, 0666, &v)
+			*val = 1
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !errors.Is(nested, ErrSelfConflict) {
+			t.Fatalf("expected %v, got %v", ErrSelfConflict, nested)
+		}
+	})
+}
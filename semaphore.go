@@ -0,0 +1,80 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// A Semaphore lets at most a fixed number of holders, in any number of
+// processes, hold it at the same time.
+//
+// The semaphore is a file with one slot per holder, which holders lock with
+// byte-range locks on Linux and Windows. Elsewhere, each slot is a distinct
+// file named after the semaphore and the index of the slot. The locks of
+// holders get released when they exit, so the slots of processes that crash
+// never leak.
+type Semaphore struct {
+	path string
+	n    int
+}
+
+// NewSemaphore returns a Semaphore with n slots, backed by the file at path,
+// which gets created if it does not exist.
+func NewSemaphore(path string, n int) *Semaphore {
+	return &Semaphore{path: path, n: n}
+}
+
+// Acquire waits for a slot of the semaphore to be free, and holds it until
+// the returned release function gets called, or until the context is done.
+func (s *Semaphore) Acquire(ctx context.Context) (release func() error, err error) {
+	const (
+		minBackoff = time.Millisecond
+		maxBackoff = 100 * time.Millisecond
+	)
+
+	backoff := minBackoff
+	for {
+		release, err := s.TryAcquire()
+		if !errors.Is(err, ErrWouldBlock) {
+			return release, err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// TryAcquire is like Acquire, but fails with an error wrapping ErrWouldBlock
+// rather than waiting if all the slots are held.
+func (s *Semaphore) TryAcquire() (release func() error, err error) {
+	if s.n < 1 {
+		return nil, &os.PathError{Op: "acquire", Path: s.path, Err: os.ErrInvalid}
+	}
+	for slot := 0; slot < s.n; slot++ {
+		f, err := lockSlot(s.path, slot)
+		switch {
+		case err == nil:
+			return func() error { return closeLocked(f) }, nil
+		case !errors.Is(err, ErrWouldBlock):
+			return nil, err
+		}
+	}
+	return nil, &os.PathError{Op: "acquire", Path: s.path, Err: ErrWouldBlock}
+}
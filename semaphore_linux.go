@@ -0,0 +1,43 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package store
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockSlot opens the semaphore file at path, and locks the byte at the offset
+// of the slot with an open file description lock, without blocking. Unlike
+// classic record locks, these are held by the file rather than by the
+// process, so the slots of a process exclude each other.
+func lockSlot(path string, slot int) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	flk := unix.Flock_t{
+		Type:   unix.F_WRLCK,
+		Whence: io.SeekStart,
+		Start:  int64(slot),
+		Len:    1,
+	}
+	err = unix.FcntlFlock(f.Fd(), unix.F_OFD_SETLK, &flk)
+	if err == unix.EAGAIN || err == unix.EACCES {
+		err = ErrWouldBlock
+	}
+	if err != nil {
+		f.Close()
+		return nil, wrapPathError("lock slot", path, wrapSyscallError("fcntl", err))
+	}
+	return f, nil
+}
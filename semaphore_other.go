@@ -0,0 +1,29 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package store
+
+import (
+	"os"
+	"strconv"
+)
+
+// lockSlot opens the file of the slot of the semaphore at path, and locks it
+// without blocking.
+func lockSlot(path string, slot int) (*os.File, error) {
+	f, err := os.OpenFile(path+"."+strconv.Itoa(slot), os.O_RDONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err := TryLock(f); err != nil {
+		closeLocked(f)
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSemaphore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Slots", func(t *testing.T) {
+		sem := NewSemaphore(filepath.Join(t.TempDir(), "builders"), 2)
+
+		release1, err := sem.Acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release2, err := sem.TryAcquire()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := sem.TryAcquire(); !errors.Is(err, ErrWouldBlock) {
+			t.Fatalf("expected %v, got %v", ErrWouldBlock, err)
+		}
+		tctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if _, err := sem.Acquire(tctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+
+		if err := release1(); err != nil {
+			t.Fatal(err)
+		}
+		release3, err := sem.TryAcquire()
+		if err != nil {
+			t.Fatal(err)
+		}
+		release2()
+		release3()
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "builders")
+
+		var holders, maxHolders int32
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				release, err := NewSemaphore(path, 3).Acquire(ctx)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				n := atomic.AddInt32(&holders, 1)
+				for {
+					max := atomic.LoadInt32(&maxHolders)
+					if n <= max || atomic.CompareAndSwapInt32(&maxHolders, max, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				atomic.AddInt32(&holders, -1)
+				if err := release(); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		if maxHolders > 3 {
+			t.Fatalf("expected at most 3 holders, got %d", maxHolders)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		sem := NewSemaphore(filepath.Join(t.TempDir(), "builders"), 0)
+		if _, err := sem.Acquire(ctx); !errors.Is(err, os.ErrInvalid) {
+			t.Fatalf("expected %v, got %v", os.ErrInvalid, err)
+		}
+	})
+}
@@ -0,0 +1,32 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockSlot opens the semaphore file at path, and locks the byte at the offset
+// of the slot, without blocking.
+func lockSlot(path string, slot int) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	overlapped := windows.Overlapped{Offset: uint32(slot)}
+	err = windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &overlapped)
+	if err == windows.ERROR_LOCK_VIOLATION {
+		err = ErrWouldBlock
+	}
+	if err != nil {
+		f.Close()
+		return nil, wrapPathError("lock slot", path, wrapSyscallError("LockFileEx", err))
+	}
+	return f, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"sync"
+)
+
+// ErrSequenceExhausted is returned by Sequence.Next once all the IDs that fit
+// in an uint64 were handed out.
+var ErrSequenceExhausted = errors.New("sequence exhausted")
+
+// A Sequence allocates IDs that are unique across all the processes sharing
+// the same file, which records the next ID to allocate. IDs start at 1.
+//
+// Sequences may reserve IDs in batches, which saves updating the file for
+// every ID. The IDs allocated by a Sequence are then still increasing, but
+// interleave with the batches of other processes, and the IDs left in the
+// batch of a process when it exits are never allocated. Without batches, IDs
+// are strictly increasing across all processes.
+//
+// A Sequence is safe for concurrent use by multiple goroutines.
+type Sequence struct {
+	store *Store[uint64]
+	path  string
+	batch uint64
+
+	mu          sync.Mutex
+	next, limit uint64
+}
+
+// NewSequence returns a Sequence backed by the JSON file at path, which
+// reserves batch IDs at a time, or one if batch is zero, with a store
+// configured with the specified options.
+func NewSequence(path string, batch uint64, opts ...Option) *Sequence {
+	if batch == 0 {
+		batch = 1
+	}
+	return &Sequence{
+		store: New[uint64](json.NewEncoder, json.NewDecoder, opts...),
+		path:  path,
+		batch: batch,
+	}
+}
+
+// Next returns the next ID of the sequence, reserving a new batch of IDs in
+// the file if the current one is exhausted.
+func (s *Sequence) Next(ctx context.Context) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.next < s.limit {
+		s.next++
+		return s.next - 1, nil
+	}
+
+	var start, limit uint64
+	err := s.store.LoadAndStore(ctx, s.path, 0666, func(ctx context.Context, val *uint64, err error) error {
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		start = *val
+		if start == 0 {
+			start = 1
+		}
+		if start > math.MaxUint64-s.batch {
+			return &os.PathError{Op: "next", Path: s.path, Err: ErrSequenceExhausted}
+		}
+		limit = start + s.batch
+		*val = limit
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.next, s.limit = start+1, limit
+	return start, nil
+}
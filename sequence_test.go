@@ -0,0 +1,92 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestSequence(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name  string
+		batch uint64
+	}{
+		{"Single", 0},
+		{"Batched", 10},
+	} {
+		batch := tc.batch
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "ids")
+
+			var (
+				mu   sync.Mutex
+				seen = make(map[uint64]bool)
+				wg   sync.WaitGroup
+			)
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					seq := NewSequence(path, batch)
+					var last uint64
+					for j := 0; j < 25; j++ {
+						id, err := seq.Next(ctx)
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						if id <= last {
+							t.Errorf("expected increasing IDs, got %d after %d", id, last)
+						}
+						last = id
+
+						mu.Lock()
+						if seen[id] {
+							t.Errorf("ID %d allocated twice", id)
+						}
+						seen[id] = true
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+
+			if batch == 0 {
+				for id := uint64(1); id <= 100; id++ {
+					if !seen[id] {
+						t.Fatalf("expected IDs 1 to 100, missing %d", id)
+					}
+				}
+			}
+		})
+	}
+
+	t.Run("Exhausted", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ids")
+		if err := os.WriteFile(path, []byte("18446744073709551615\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewSequence(path, 1).Next(ctx); !errors.Is(err, ErrSequenceExhausted) {
+			t.Fatalf("expected %v, got %v", ErrSequenceExhausted, err)
+		}
+
+		if err := os.WriteFile(path, []byte("18446744073709551614\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if id, err := NewSequence(path, 1).Next(ctx); err != nil || id != math.MaxUint64-1 {
+			t.Fatalf("expected the last ID, got %d, %v", id, err)
+		}
+	})
+}
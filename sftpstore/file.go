@@ -0,0 +1,263 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package sftpstore
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"io/fs"
+	"path"
+	"sync"
+	"time"
+)
+
+// A file is a remote file opened by an FS, which implements store.File.
+type file struct {
+	fsys   *FS
+	name   string
+	path   string
+	handle string
+
+	mu     sync.Mutex
+	off    int64
+	lock   string
+	closed bool
+}
+
+func (f *file) Name() string {
+	return f.name
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err := f.readAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	var n int
+	for n < len(p) {
+		m, err := f.readAt(p[n:], off+int64(n))
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// readAt reads at most maxData bytes into p, in a single request.
+func (f *file) readAt(p []byte, off int64) (int, error) {
+	if len(p) > maxData {
+		p = p[:maxData]
+	}
+	d, err := f.fsys.c.expect(fxpData, fxpRead, func(b *buffer) {
+		b.string(f.handle)
+		b.uint64(uint64(off))
+		b.uint32(uint32(len(p)))
+	})
+	if err == io.EOF {
+		return 0, io.EOF
+	}
+	if err != nil {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	data := d.string()
+	if d.err != nil {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: d.err}
+	}
+	return copy(p, data), nil
+}
+
+func (f *file) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n, err := f.WriteAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *file) WriteAt(p []byte, off int64) (int, error) {
+	var n int
+	for n < len(p) {
+		chunk := p[n:]
+		if len(chunk) > maxData {
+			chunk = chunk[:maxData]
+		}
+		_, err := f.fsys.c.expect(fxpStatus, fxpWrite, func(b *buffer) {
+			b.string(f.handle)
+			b.uint64(uint64(off + int64(n)))
+			b.string(string(chunk))
+		})
+		if err != nil {
+			return n, &fs.PathError{Op: "write", Path: f.name, Err: err}
+		}
+		n += len(chunk)
+	}
+	return n, nil
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		a, err := f.fstat()
+		if err != nil {
+			return 0, &fs.PathError{Op: "seek", Path: f.name, Err: err}
+		}
+		offset += int64(a.size)
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	a, err := f.fstat()
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: f.name, Err: err}
+	}
+	return &fileInfo{name: path.Base(f.path), a: a}, nil
+}
+
+func (f *file) fstat() (attrs, error) {
+	d, err := f.fsys.c.expect(fxpAttrs, fxpFstat, func(b *buffer) {
+		b.string(f.handle)
+	})
+	if err != nil {
+		return attrs{}, err
+	}
+	a := d.attrs()
+	return a, d.err
+}
+
+func (f *file) setstat(a attrs) error {
+	_, err := f.fsys.c.expect(fxpStatus, fxpFsetstat, func(b *buffer) {
+		b.string(f.handle)
+		b.attrs(a)
+	})
+	return err
+}
+
+// Sync flushes the file to stable storage with the fsync@openssh.com
+// extension, if the server supports it, and does nothing otherwise.
+func (f *file) Sync() error {
+	if !f.fsys.c.exts[extFsync] {
+		return nil
+	}
+	err := f.fsys.c.extended(extFsync, func(b *buffer) {
+		b.string(f.handle)
+	})
+	if err != nil {
+		return &fs.PathError{Op: "sync", Path: f.name, Err: err}
+	}
+	return nil
+}
+
+func (f *file) Truncate(size int64) error {
+	if err := f.setstat(attrs{flags: attrSize, size: uint64(size)}); err != nil {
+		return &fs.PathError{Op: "truncate", Path: f.name, Err: err}
+	}
+	return nil
+}
+
+// Chmod changes the permissions of the file, which stores do when they
+// create files.
+func (f *file) Chmod(mode fs.FileMode) error {
+	if err := f.setstat(attrs{flags: attrPermissions, perm: uint32(mode.Perm())}); err != nil {
+		return &fs.PathError{Op: "chmod", Path: f.name, Err: err}
+	}
+	return nil
+}
+
+// Close closes the file, and releases its lock.
+func (f *file) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+
+	err := f.unlock()
+	if cerr := f.fsys.closeHandle(f.handle); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return &fs.PathError{Op: "close", Path: f.name, Err: err}
+	}
+	return nil
+}
+
+// tag sets the access time of the file to a random time in the future, which
+// gives it a new identity. Unlike reads, writes preserve it, and servers do not
+// update access times in the future unless mounted with strictatime.
+func (f *file) tag() error {
+	a, err := f.fstat()
+	if err != nil {
+		return err
+	}
+	var r [4]byte
+	if _, err := rand.Read(r[:]); err != nil {
+		return err
+	}
+	atime := uint32(time.Now().Unix()) + 1<<29 + binary.BigEndian.Uint32(r[:])%(1<<29)
+	return f.setstat(attrs{flags: attrACModTime, atime: atime, mtime: a.mtime})
+}
+
+// unlock releases the lock of the file, if any, by removing its sentinel.
+func (f *file) unlock() error {
+	if f.lock == "" {
+		return nil
+	}
+	err := f.fsys.remove(f.lock)
+	f.lock = ""
+	return err
+}
+
+// A fileInfo describes a remote file.
+type fileInfo struct {
+	name string
+	a    attrs
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return int64(fi.a.size) }
+func (fi *fileInfo) Mode() fs.FileMode  { return fileMode(fi.a.perm) }
+func (fi *fileInfo) ModTime() time.Time { return time.Unix(int64(fi.a.mtime), 0) }
+func (fi *fileInfo) IsDir() bool        { return fi.Mode().IsDir() }
+func (fi *fileInfo) Sys() any           { return nil }
+
+// fileMode converts the POSIX mode perm to a FileMode.
+func fileMode(perm uint32) fs.FileMode {
+	mode := fs.FileMode(perm & 0777)
+	switch perm & 0170000 {
+	case 0040000:
+		mode |= fs.ModeDir
+	case 0120000:
+		mode |= fs.ModeSymlink
+	case 0100000:
+	default:
+		mode |= fs.ModeIrregular
+	}
+	return mode
+}
@@ -0,0 +1,358 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package sftpstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+
+	"barney.ci/go-store"
+)
+
+// Packet types of version 3 of the SFTP protocol, as specified by
+// draft-ietf-secsh-filexfer-02.
+const (
+	fxpInit          = 1
+	fxpVersion       = 2
+	fxpOpen          = 3
+	fxpClose         = 4
+	fxpRead          = 5
+	fxpWrite         = 6
+	fxpLstat         = 7
+	fxpFstat         = 8
+	fxpFsetstat      = 10
+	fxpOpendir       = 11
+	fxpReaddir       = 12
+	fxpRemove        = 13
+	fxpRename        = 18
+	fxpStatus        = 101
+	fxpHandle        = 102
+	fxpData          = 103
+	fxpName          = 104
+	fxpAttrs         = 105
+	fxpExtended      = 200
+	fxpExtendedReply = 201
+)
+
+// Flags of SSH_FXP_OPEN.
+const (
+	fxfRead   = 0x01
+	fxfWrite  = 0x02
+	fxfAppend = 0x04
+	fxfCreat  = 0x08
+	fxfTrunc  = 0x10
+	fxfExcl   = 0x20
+)
+
+// Flags of file attributes.
+const (
+	attrSize        = 0x01
+	attrUIDGID      = 0x02
+	attrPermissions = 0x04
+	attrACModTime   = 0x08
+	attrExtended    = 0x80000000
+)
+
+// Status codes of SSH_FXP_STATUS.
+const (
+	fxOK               = 0
+	fxEOF              = 1
+	fxNoSuchFile       = 2
+	fxPermissionDenied = 3
+	fxFailure          = 4
+	fxOpUnsupported    = 8
+)
+
+// Extensions of OpenSSH.
+const (
+	extPosixRename = "posix-rename@openssh.com"
+	extHardlink    = "hardlink@openssh.com"
+	extFsync       = "fsync@openssh.com"
+)
+
+const (
+	// maxData is the largest amount of data read or written per request,
+	// which all servers must support.
+	maxData = 32 << 10
+
+	// maxPacket bounds the size of the packets accepted from servers.
+	maxPacket = 256 << 10
+)
+
+// A StatusError is a failure reported by the SFTP server.
+//
+// Errors of the server are wrapped in *fs.PathError or *os.LinkError values.
+// They match fs.ErrNotExist, fs.ErrPermission and store.ErrUnsupported
+// according to their code.
+type StatusError struct {
+	Code    uint32
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("sftp: %s (status %d)", e.Message, e.Code)
+	}
+	return fmt.Sprintf("sftp: status %d", e.Code)
+}
+
+func (e *StatusError) Is(target error) bool {
+	switch e.Code {
+	case fxNoSuchFile:
+		return target == fs.ErrNotExist
+	case fxPermissionDenied:
+		return target == fs.ErrPermission
+	case fxOpUnsupported:
+		return target == store.ErrUnsupported
+	}
+	return false
+}
+
+// isFailure reports whether err is the generic failure that OpenSSH reports
+// for most errors, including EEXIST.
+func isFailure(err error) bool {
+	var serr *StatusError
+	return errors.As(err, &serr) && serr.Code == fxFailure
+}
+
+var errBadPacket = errors.New("sftp: malformed packet")
+
+// attrs are the attributes of a file.
+type attrs struct {
+	flags        uint32
+	size         uint64
+	uid, gid     uint32
+	perm         uint32
+	atime, mtime uint32
+}
+
+// A buffer encodes packets.
+type buffer []byte
+
+func (b *buffer) byte(v byte)     { *b = append(*b, v) }
+func (b *buffer) uint32(v uint32) { *b = binary.BigEndian.AppendUint32(*b, v) }
+func (b *buffer) uint64(v uint64) { *b = binary.BigEndian.AppendUint64(*b, v) }
+
+func (b *buffer) string(s string) {
+	b.uint32(uint32(len(s)))
+	*b = append(*b, s...)
+}
+
+func (b *buffer) attrs(a attrs) {
+	b.uint32(a.flags &^ attrExtended)
+	if a.flags&attrSize != 0 {
+		b.uint64(a.size)
+	}
+	if a.flags&attrUIDGID != 0 {
+		b.uint32(a.uid)
+		b.uint32(a.gid)
+	}
+	if a.flags&attrPermissions != 0 {
+		b.uint32(a.perm)
+	}
+	if a.flags&attrACModTime != 0 {
+		b.uint32(a.atime)
+		b.uint32(a.mtime)
+	}
+}
+
+// A decoder decodes packets. Decoding errors are sticky, and reported by err.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil || len(d.b) < n {
+		d.err = errBadPacket
+		return make([]byte, n)
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) byte() byte     { return d.next(1)[0] }
+func (d *decoder) uint32() uint32 { return binary.BigEndian.Uint32(d.next(4)) }
+func (d *decoder) uint64() uint64 { return binary.BigEndian.Uint64(d.next(8)) }
+
+func (d *decoder) string() string {
+	n := d.uint32()
+	if n > uint32(len(d.b)) {
+		d.err = errBadPacket
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+func (d *decoder) attrs() attrs {
+	a := attrs{flags: d.uint32()}
+	if a.flags&attrSize != 0 {
+		a.size = d.uint64()
+	}
+	if a.flags&attrUIDGID != 0 {
+		a.uid = d.uint32()
+		a.gid = d.uint32()
+	}
+	if a.flags&attrPermissions != 0 {
+		a.perm = d.uint32()
+	}
+	if a.flags&attrACModTime != 0 {
+		a.atime = d.uint32()
+		a.mtime = d.uint32()
+	}
+	if a.flags&attrExtended != 0 {
+		for n := d.uint32(); n > 0 && d.err == nil; n-- {
+			d.string()
+			d.string()
+		}
+	}
+	return a
+}
+
+// readPacket reads a packet from r, and returns its type and payload.
+func readPacket(r io.Reader) (byte, *decoder, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[:4])
+	if n < 1 || n > maxPacket {
+		return 0, nil, errBadPacket
+	}
+	payload := make([]byte, n-1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return hdr[4], &decoder{b: payload}, nil
+}
+
+// writePacket writes a packet of the specified type and payload to w.
+func writePacket(w io.Writer, typ byte, payload []byte) error {
+	pkt := make(buffer, 0, 5+len(payload))
+	pkt.uint32(uint32(1 + len(payload)))
+	pkt.byte(typ)
+	pkt = append(pkt, payload...)
+	_, err := w.Write(pkt)
+	return err
+}
+
+// A client is the client side of an SFTP session. It sends one request at a
+// time.
+type client struct {
+	mu   sync.Mutex
+	r    io.Reader
+	w    io.WriteCloser
+	id   uint32
+	exts map[string]bool
+	err  error
+}
+
+func newClient(r io.Reader, w io.WriteCloser) (*client, error) {
+	c := &client{r: r, w: w, exts: make(map[string]bool)}
+
+	var b buffer
+	b.uint32(3)
+	if err := writePacket(w, fxpInit, b); err != nil {
+		return nil, err
+	}
+	typ, d, err := readPacket(r)
+	if err != nil {
+		return nil, err
+	}
+	if typ != fxpVersion {
+		return nil, errBadPacket
+	}
+	if v := d.uint32(); d.err == nil && v != 3 {
+		return nil, fmt.Errorf("sftp: unsupported protocol version %d", v)
+	}
+	for len(d.b) > 0 && d.err == nil {
+		name := d.string()
+		d.string()
+		c.exts[name] = true
+	}
+	return c, d.err
+}
+
+// call sends a request of the specified type, whose payload follows its
+// request id, and returns the response. Responses with an error status are
+// returned as a *StatusError, and the end of files and directories as io.EOF.
+func (c *client) call(typ byte, fill func(*buffer)) (byte, *decoder, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The session cannot recover from a request that was partially sent or
+	// a response that was partially received.
+	if c.err != nil {
+		return 0, nil, c.err
+	}
+
+	c.id++
+	var b buffer
+	b.uint32(c.id)
+	fill(&b)
+	if err := writePacket(c.w, typ, b); err != nil {
+		c.err = err
+		return 0, nil, err
+	}
+	rtyp, d, err := readPacket(c.r)
+	if err == nil && d.uint32() != c.id {
+		err = errBadPacket
+	}
+	if err == nil {
+		err = d.err
+	}
+	if err != nil {
+		c.err = err
+		return 0, nil, err
+	}
+
+	if rtyp == fxpStatus {
+		code, msg := d.uint32(), d.string()
+		switch {
+		case d.err != nil:
+			return 0, nil, d.err
+		case code == fxOK:
+			return rtyp, d, nil
+		case code == fxEOF:
+			return 0, nil, io.EOF
+		}
+		return 0, nil, &StatusError{Code: code, Message: msg}
+	}
+	return rtyp, d, nil
+}
+
+// expect is like call, but fails unless the response has type want.
+func (c *client) expect(want, typ byte, fill func(*buffer)) (*decoder, error) {
+	rtyp, d, err := c.call(typ, fill)
+	if err == nil && rtyp != want {
+		err = errBadPacket
+	}
+	return d, err
+}
+
+// extended sends a request for the specified extension, whose response is a
+// status. It fails with store.ErrUnsupported if the server does not support
+// the extension.
+func (c *client) extended(ext string, fill func(*buffer)) error {
+	if !c.exts[ext] {
+		return store.ErrUnsupported
+	}
+	_, err := c.expect(fxpStatus, fxpExtended, func(b *buffer) {
+		b.string(ext)
+		fill(b)
+	})
+	return err
+}
+
+func (c *client) close() error {
+	return c.w.Close()
+}
@@ -0,0 +1,291 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package sftpstore
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A server is a minimal SFTP server operating on the local file system,
+// which behaves like the sftp-server of OpenSSH for the requests that an FS
+// sends.
+type server struct {
+	mu      sync.Mutex
+	files   map[string]*os.File
+	dirs    map[string][]fs.FileInfo
+	handles int
+
+	// atimes are the access times set by clients, which are kept apart
+	// since they cannot be read back portably.
+	atimes []atime
+
+	// busy, if set, makes exclusive creations of the files it returns true
+	// for fail as if they existed, which emulates files created and removed
+	// by other clients in between requests.
+	busy func(name string) bool
+}
+
+type atime struct {
+	info  fs.FileInfo
+	atime uint32
+}
+
+// serve serves the requests read from r until r is closed.
+func (s *server) serve(r io.Reader, w io.WriteCloser) {
+	defer w.Close()
+
+	s.files = make(map[string]*os.File)
+	s.dirs = make(map[string][]fs.FileInfo)
+	defer func() {
+		for _, f := range s.files {
+			f.Close()
+		}
+	}()
+
+	for {
+		typ, d, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		if typ == fxpInit {
+			var b buffer
+			b.uint32(3)
+			for _, ext := range []string{extPosixRename, extHardlink, extFsync} {
+				b.string(ext)
+				b.string("1")
+			}
+			writePacket(w, fxpVersion, b)
+			continue
+		}
+
+		id := d.uint32()
+		var b buffer
+		b.uint32(id)
+		rtyp := s.handle(typ, d, &b)
+		if d.err != nil {
+			return
+		}
+		if err := writePacket(w, rtyp, b); err != nil {
+			return
+		}
+	}
+}
+
+// handle handles a request, and writes its response after its id into b.
+func (s *server) handle(typ byte, d *decoder, b *buffer) byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	switch typ {
+	case fxpOpen:
+		name, pflags, a := d.string(), d.uint32(), d.attrs()
+		var flag int
+		switch pflags & (fxfRead | fxfWrite) {
+		case fxfRead:
+			flag = os.O_RDONLY
+		case fxfWrite:
+			flag = os.O_WRONLY
+		default:
+			flag = os.O_RDWR
+		}
+		for sflag, oflag := range map[uint32]int{fxfAppend: os.O_APPEND, fxfCreat: os.O_CREATE, fxfTrunc: os.O_TRUNC, fxfExcl: os.O_EXCL} {
+			if pflags&sflag != 0 {
+				flag |= oflag
+			}
+		}
+		perm := fs.FileMode(0666)
+		if a.flags&attrPermissions != 0 {
+			perm = fs.FileMode(a.perm & 0777)
+		}
+		if flag&os.O_EXCL != 0 && s.busy != nil && s.busy(name) {
+			return status(b, fxFailure)
+		}
+		var f *os.File
+		if f, err = os.OpenFile(name, flag, perm); err == nil {
+			b.string(s.newHandle(f, nil))
+			return fxpHandle
+		}
+
+	case fxpOpendir:
+		var entries []fs.DirEntry
+		if entries, err = os.ReadDir(d.string()); err == nil {
+			infos := make([]fs.FileInfo, 0, len(entries))
+			for _, entry := range entries {
+				if info, err := entry.Info(); err == nil {
+					infos = append(infos, info)
+				}
+			}
+			b.string(s.newHandle(nil, infos))
+			return fxpHandle
+		}
+
+	case fxpReaddir:
+		handle := d.string()
+		infos, ok := s.dirs[handle]
+		switch {
+		case !ok:
+			err = fs.ErrInvalid
+		case len(infos) == 0:
+			return status(b, fxEOF)
+		default:
+			s.dirs[handle] = nil
+			b.uint32(uint32(len(infos)))
+			for _, info := range infos {
+				b.string(info.Name())
+				b.string(info.Name())
+				b.attrs(s.attrs(info))
+			}
+			return fxpName
+		}
+
+	case fxpClose:
+		handle := d.string()
+		if f, ok := s.files[handle]; ok {
+			err = f.Close()
+			delete(s.files, handle)
+		}
+		delete(s.dirs, handle)
+
+	case fxpRead:
+		f, off, n := s.files[d.string()], d.uint64(), d.uint32()
+		buf := make([]byte, n)
+		var m int
+		if m, err = f.ReadAt(buf, int64(off)); m > 0 {
+			b.string(string(buf[:m]))
+			return fxpData
+		}
+		if err == io.EOF {
+			return status(b, fxEOF)
+		}
+
+	case fxpWrite:
+		f, off, data := s.files[d.string()], d.uint64(), d.string()
+		_, err = f.WriteAt([]byte(data), int64(off))
+
+	case fxpLstat, fxpFstat:
+		var info fs.FileInfo
+		if typ == fxpLstat {
+			info, err = os.Lstat(d.string())
+		} else {
+			info, err = s.files[d.string()].Stat()
+		}
+		if err == nil {
+			b.attrs(s.attrs(info))
+			return fxpAttrs
+		}
+
+	case fxpFsetstat:
+		f, a := s.files[d.string()], d.attrs()
+		if a.flags&attrSize != 0 {
+			err = f.Truncate(int64(a.size))
+		}
+		if err == nil && a.flags&attrPermissions != 0 {
+			err = f.Chmod(fs.FileMode(a.perm & 0777))
+		}
+		if err == nil && a.flags&attrACModTime != 0 {
+			// OpenSSH sets the times of the file descriptor, which
+			// os.File cannot do, so the times of files that were
+			// renamed away only get recorded below.
+			err = os.Chtimes(f.Name(), time.Unix(int64(a.atime), 0), time.Unix(int64(a.mtime), 0))
+			if errors.Is(err, fs.ErrNotExist) {
+				err = nil
+			}
+		}
+		if err == nil && a.flags&attrACModTime != 0 {
+			var info fs.FileInfo
+			if info, err = f.Stat(); err == nil {
+				s.atimes = append(s.atimes, atime{info: info, atime: a.atime})
+			}
+		}
+
+	case fxpRemove:
+		err = os.Remove(d.string())
+
+	case fxpRename:
+		// Like OpenSSH, never replace the destination.
+		oldpath, newpath := d.string(), d.string()
+		if err = os.Link(oldpath, newpath); err == nil {
+			err = os.Remove(oldpath)
+		}
+
+	case fxpExtended:
+		switch d.string() {
+		case extPosixRename:
+			err = os.Rename(d.string(), d.string())
+		case extHardlink:
+			err = os.Link(d.string(), d.string())
+		case extFsync:
+			err = s.files[d.string()].Sync()
+		default:
+			return status(b, fxOpUnsupported)
+		}
+
+	default:
+		return status(b, fxOpUnsupported)
+	}
+
+	// Like OpenSSH, report most errors, including EEXIST, as failures.
+	switch {
+	case err == nil:
+		return status(b, fxOK)
+	case errors.Is(err, fs.ErrNotExist):
+		return status(b, fxNoSuchFile)
+	case errors.Is(err, fs.ErrPermission):
+		return status(b, fxPermissionDenied)
+	}
+	return status(b, fxFailure)
+}
+
+func (s *server) newHandle(f *os.File, infos []fs.FileInfo) string {
+	s.handles++
+	handle := strconv.Itoa(s.handles)
+	if f != nil {
+		s.files[handle] = f
+	} else {
+		s.dirs[handle] = infos
+	}
+	return handle
+}
+
+func status(b *buffer, code uint32) byte {
+	b.uint32(code)
+	b.string("")
+	b.string("")
+	return fxpStatus
+}
+
+func (s *server) attrs(info fs.FileInfo) attrs {
+	perm := uint32(info.Mode().Perm())
+	switch {
+	case info.Mode().IsDir():
+		perm |= 0040000
+	case info.Mode()&fs.ModeSymlink != 0:
+		perm |= 0120000
+	case info.Mode().IsRegular():
+		perm |= 0100000
+	}
+	a := attrs{
+		flags: attrSize | attrPermissions | attrACModTime,
+		size:  uint64(info.Size()),
+		perm:  perm,
+		atime: uint32(info.ModTime().Unix()),
+		mtime: uint32(info.ModTime().Unix()),
+	}
+	for _, at := range s.atimes {
+		if os.SameFile(at.info, info) {
+			a.atime = at.atime
+		}
+	}
+	return a
+}
@@ -0,0 +1,506 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+// Package sftpstore provides a store.Backend that operates on the files of a
+// remote host over SFTP, which lets stores manage state files on hosts that
+// are only reachable over SSH.
+//
+// The package implements the client side of version 3 of the SFTP protocol,
+// along with the posix-rename@openssh.com, hardlink@openssh.com and
+// fsync@openssh.com extensions of OpenSSH, and leaves establishing the SSH
+// session to the caller. With golang.org/x/crypto/ssh, basic usage is:
+//
+//	session, err := conn.NewSession()
+//	...
+//	w, _ := session.StdinPipe()
+//	r, _ := session.StdoutPipe()
+//	if err := session.RequestSubsystem("sftp"); err != nil {
+//	    ...
+//	}
+//	fsys, err := sftpstore.New(r, w, "/var/lib/app")
+//	...
+//	st := store.New[Type](json.NewEncoder, json.NewDecoder, store.WithBackend(fsys))
+//
+// SFTP has neither file locks nor file identities, which stores rely on.
+// Locks are emulated with sentinel files created next to the locked files,
+// with a ".lck" suffix; the sentinels of processes that crash while holding
+// locks must be removed by hand, or by Store.BreakStale if the stores were
+// configured with store.WithLockInfo. The identity of files is derived from their
+// size and times, and exclusive locks set the access time of files to a
+// random time in the future, which keeps the identity of the files written by
+// stores unique. All processes updating the same files must therefore go
+// through this package, and the remote file system must not be mounted with
+// strictatime.
+package sftpstore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"barney.ci/go-store"
+)
+
+// sentinelSuffix is the suffix of the names of lock sentinels. Exclusive locks
+// of a file are held by creating its name plus the suffix, and shared locks by
+// creating its name plus the suffix, a dot and a random token.
+const sentinelSuffix = ".lck"
+
+// The interval between attempts to acquire a lock grows from minPoll to
+// maxPoll.
+const (
+	minPoll = time.Millisecond
+	maxPoll = 100 * time.Millisecond
+)
+
+// An FS is the file system of a remote host, as served over SFTP, which
+// implements store.Backend and store.NoReplaceRenamer.
+type FS struct {
+	c    *client
+	root string
+}
+
+// New starts an SFTP session with the server that reads requests from w and
+// writes responses to r, typically the stdin and stdout of the "sftp"
+// subsystem of an SSH session.
+//
+// Relative names of files are resolved against root, or against the initial
+// working directory of the server if root is empty.
+func New(r io.Reader, w io.WriteCloser, root string) (*FS, error) {
+	c, err := newClient(r, w)
+	if err != nil {
+		return nil, err
+	}
+	return &FS{c: c, root: filepath.ToSlash(root)}, nil
+}
+
+// Close ends the SFTP session.
+func (fsys *FS) Close() error {
+	return fsys.c.close()
+}
+
+// path returns the remote path of the named file.
+func (fsys *FS) path(name string) string {
+	name = filepath.ToSlash(name)
+	if path.IsAbs(name) {
+		return path.Clean(name)
+	}
+	return path.Join(fsys.root, name)
+}
+
+// OpenFile implements store.Backend.
+func (fsys *FS) OpenFile(name string, flag int, perm fs.FileMode) (store.File, error) {
+	var pflags uint32
+	switch flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	case os.O_RDONLY:
+		pflags = fxfRead
+	case os.O_WRONLY:
+		pflags = fxfWrite
+	case os.O_RDWR:
+		pflags = fxfRead | fxfWrite
+	}
+	for _, f := range []struct {
+		os   int
+		sftp uint32
+	}{
+		{os.O_APPEND, fxfAppend},
+		{os.O_CREATE, fxfCreat},
+		{os.O_TRUNC, fxfTrunc},
+		{os.O_EXCL, fxfExcl},
+	} {
+		if flag&f.os != 0 {
+			pflags |= f.sftp
+		}
+	}
+	var a attrs
+	if flag&os.O_CREATE != 0 {
+		a = attrs{flags: attrPermissions, perm: uint32(perm.Perm())}
+	}
+
+	p := fsys.path(name)
+	d, err := fsys.c.expect(fxpHandle, fxpOpen, func(b *buffer) {
+		b.string(p)
+		b.uint32(pflags)
+		b.attrs(a)
+	})
+	if err != nil {
+		if flag&os.O_EXCL != 0 && isFailure(err) && fsys.exists(p) {
+			err = fs.ErrExist
+		}
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	handle := d.string()
+	if d.err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: d.err}
+	}
+	return &file{fsys: fsys, name: name, path: p, handle: handle}, nil
+}
+
+// exists reports whether there is a file at the remote path p, to tell apart
+// the failures that OpenSSH reports for existing files.
+func (fsys *FS) exists(p string) bool {
+	_, err := fsys.lstat(p)
+	return err == nil
+}
+
+// Rename implements store.Backend. It requires the posix-rename@openssh.com
+// extension.
+func (fsys *FS) Rename(f store.File, newname string) error {
+	sf, err := fsys.file("rename", f)
+	if err != nil {
+		return err
+	}
+	err = fsys.c.extended(extPosixRename, func(b *buffer) {
+		b.string(sf.path)
+		b.string(fsys.path(newname))
+	})
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: f.Name(), New: newname, Err: err}
+	}
+	return nil
+}
+
+// RenameNoReplace implements store.NoReplaceRenamer, with the rename of the
+// base protocol, which never replaces files on OpenSSH servers.
+func (fsys *FS) RenameNoReplace(f store.File, newname string) error {
+	sf, err := fsys.file("rename", f)
+	if err != nil {
+		return err
+	}
+	np := fsys.path(newname)
+	_, err = fsys.c.expect(fxpStatus, fxpRename, func(b *buffer) {
+		b.string(sf.path)
+		b.string(np)
+	})
+	if isFailure(err) && fsys.exists(np) {
+		err = fs.ErrExist
+	}
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: f.Name(), New: newname, Err: err}
+	}
+	return nil
+}
+
+// Link implements store.Backend. It requires the hardlink@openssh.com
+// extension.
+func (fsys *FS) Link(oldname, newname string) error {
+	np := fsys.path(newname)
+	err := fsys.c.extended(extHardlink, func(b *buffer) {
+		b.string(fsys.path(oldname))
+		b.string(np)
+	})
+	if isFailure(err) && fsys.exists(np) {
+		err = fs.ErrExist
+	}
+	if err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+// Remove implements store.Backend.
+func (fsys *FS) Remove(name string) error {
+	if err := fsys.remove(fsys.path(name)); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (fsys *FS) remove(p string) error {
+	_, err := fsys.c.expect(fxpStatus, fxpRemove, func(b *buffer) {
+		b.string(p)
+	})
+	return err
+}
+
+// Lstat implements store.Backend.
+func (fsys *FS) Lstat(name string) (store.FileStat, error) {
+	a, err := fsys.lstat(fsys.path(name))
+	if err != nil {
+		return store.FileStat{}, &fs.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	return fileStat(a), nil
+}
+
+func (fsys *FS) lstat(p string) (attrs, error) {
+	d, err := fsys.c.expect(fxpAttrs, fxpLstat, func(b *buffer) {
+		b.string(p)
+	})
+	if err != nil {
+		return attrs{}, err
+	}
+	a := d.attrs()
+	return a, d.err
+}
+
+// Fstat implements store.Backend.
+func (fsys *FS) Fstat(f store.File) (store.FileStat, error) {
+	sf, err := fsys.file("fstat", f)
+	if err != nil {
+		return store.FileStat{}, err
+	}
+	a, err := sf.fstat()
+	if err != nil {
+		return store.FileStat{}, &fs.PathError{Op: "fstat", Path: f.Name(), Err: err}
+	}
+	return fileStat(a), nil
+}
+
+// fileStat returns the metadata of a file with the attributes a. Files have
+// no identity in SFTP, so it is derived from their size and times.
+func fileStat(a attrs) store.FileStat {
+	h := fnv.New64a()
+	binary.Write(h, binary.BigEndian, []uint64{a.size, uint64(a.atime), uint64(a.mtime)})
+	ino := h.Sum64()
+	if ino == 0 {
+		ino = 1
+	}
+	return store.FileStat{
+		Ino:     ino,
+		Size:    int64(a.size),
+		ModTime: time.Unix(int64(a.mtime), 0),
+		Symlink: fileMode(a.perm)&fs.ModeSymlink != 0,
+	}
+}
+
+// ReadDir implements store.Backend. The lock sentinels are left out.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	infos, err := fsys.list(fsys.path(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		if isSentinel(info.name) {
+			continue
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// list returns the entries of the directory at the remote path p, besides
+// "." and "..".
+func (fsys *FS) list(p string) ([]*fileInfo, error) {
+	d, err := fsys.c.expect(fxpHandle, fxpOpendir, func(b *buffer) {
+		b.string(p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	handle := d.string()
+	if d.err != nil {
+		return nil, d.err
+	}
+	defer fsys.closeHandle(handle)
+
+	var infos []*fileInfo
+	for {
+		d, err := fsys.c.expect(fxpName, fxpReaddir, func(b *buffer) {
+			b.string(handle)
+		})
+		if err == io.EOF {
+			return infos, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for n := d.uint32(); n > 0 && d.err == nil; n-- {
+			name := d.string()
+			d.string() // long name
+			a := d.attrs()
+			if name != "." && name != ".." {
+				infos = append(infos, &fileInfo{name: name, a: a})
+			}
+		}
+		if d.err != nil {
+			return nil, d.err
+		}
+	}
+}
+
+func (fsys *FS) closeHandle(handle string) error {
+	_, err := fsys.c.expect(fxpStatus, fxpClose, func(b *buffer) {
+		b.string(handle)
+	})
+	return err
+}
+
+// isSentinel reports whether name is the name of a lock sentinel.
+func isSentinel(name string) bool {
+	return strings.HasSuffix(name, sentinelSuffix) || strings.Contains(name, sentinelSuffix+".")
+}
+
+// Lock implements store.Backend, with an exclusive sentinel, which can only
+// be created while there is no other sentinel for the file.
+func (fsys *FS) Lock(ctx context.Context, f store.File) error {
+	return fsys.lock(ctx, f, true, true)
+}
+
+// RLock implements store.Backend, with a shared sentinel, which can only be
+// held while there is no exclusive sentinel for the file.
+func (fsys *FS) RLock(ctx context.Context, f store.File) error {
+	return fsys.lock(ctx, f, false, true)
+}
+
+// TryLock implements store.Backend.
+func (fsys *FS) TryLock(f store.File) error {
+	return fsys.lock(context.Background(), f, true, false)
+}
+
+// BreakLock implements store.LockBreaker, by removing the exclusive sentinel
+// of the named file. Shared sentinels are left alone.
+func (fsys *FS) BreakLock(name string) error {
+	err := fsys.remove(fsys.path(name) + sentinelSuffix)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return &fs.PathError{Op: "breaklock", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (fsys *FS) lock(ctx context.Context, f store.File, excl, wait bool) error {
+	sf, err := fsys.file("lock", f)
+	if err != nil {
+		return err
+	}
+
+	// Like with flock(2), converting a lock releases it first.
+	if err := sf.unlock(); err != nil {
+		return &fs.PathError{Op: "lock", Path: f.Name(), Err: err}
+	}
+
+	delay := minPoll
+	for {
+		held, err := fsys.tryLock(sf, excl)
+		if err != nil {
+			return &fs.PathError{Op: "lock", Path: f.Name(), Err: err}
+		}
+		if held && excl {
+			err = sf.tag()
+		}
+		if err != nil {
+			sf.unlock()
+			return &fs.PathError{Op: "lock", Path: f.Name(), Err: err}
+		}
+		if held {
+			return nil
+		}
+		if !wait {
+			return &fs.PathError{Op: "lock", Path: f.Name(), Err: store.ErrWouldBlock}
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if delay *= 2; delay > maxPoll {
+			delay = maxPoll
+		}
+	}
+}
+
+// tryLock attempts to lock f once. Both kinds of locks create their sentinel
+// before checking for conflicting ones, and back off if there are any, so
+// that conflicting locks are never held together.
+func (fsys *FS) tryLock(f *file, excl bool) (bool, error) {
+	sentinel := f.path + sentinelSuffix
+	if !excl {
+		var token [8]byte
+		if _, err := rand.Read(token[:]); err != nil {
+			return false, err
+		}
+		sentinel += "." + hex.EncodeToString(token[:])
+	}
+
+	created, err := fsys.createSentinel(sentinel)
+	if err != nil || !created {
+		return false, err
+	}
+
+	var conflict bool
+	if excl {
+		var infos []*fileInfo
+		infos, err = fsys.list(path.Dir(f.path))
+		prefix := path.Base(f.path) + sentinelSuffix + "."
+		for _, info := range infos {
+			conflict = conflict || strings.HasPrefix(info.name, prefix)
+		}
+	} else {
+		conflict = fsys.exists(f.path + sentinelSuffix)
+	}
+	if err != nil || conflict {
+		fsys.remove(sentinel)
+		return false, err
+	}
+	f.lock = sentinel
+	return true, nil
+}
+
+// createSentinel creates the sentinel at the remote path p, which records its
+// holder, and reports whether it did not exist.
+func (fsys *FS) createSentinel(p string) (bool, error) {
+	d, err := fsys.c.expect(fxpHandle, fxpOpen, func(b *buffer) {
+		b.string(p)
+		b.uint32(fxfWrite | fxfCreat | fxfExcl)
+		b.attrs(attrs{flags: attrPermissions, perm: 0644})
+	})
+	switch {
+	case isFailure(err) && fsys.exists(path.Dir(p)):
+		// Servers fail to create existing files with a generic failure.
+		// The sentinel may be gone already if its holder just removed it,
+		// but it was held either way, and the caller polls again.
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	handle := d.string()
+	if d.err != nil {
+		return false, d.err
+	}
+
+	host, _ := os.Hostname()
+	holder := fmt.Sprintf("%s %d\n", host, os.Getpid())
+	_, err = fsys.c.expect(fxpStatus, fxpWrite, func(b *buffer) {
+		b.string(handle)
+		b.uint64(0)
+		b.string(holder)
+	})
+	if cerr := fsys.closeHandle(handle); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fsys.remove(p)
+		return false, err
+	}
+	return true, nil
+}
+
+// file returns f as a file of fsys.
+func (fsys *FS) file(op string, f store.File) (*file, error) {
+	sf, ok := f.(*file)
+	if !ok || sf.fsys != fsys {
+		return nil, &fs.PathError{Op: op, Path: f.Name(), Err: fs.ErrInvalid}
+	}
+	return sf, nil
+}
@@ -0,0 +1,217 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package sftpstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"barney.ci/go-store"
+	"barney.ci/go-store/backendtest"
+)
+
+// newFS returns an FS served by a local server from a new temporary
+// directory, which it also returns.
+func newFS(t *testing.T) (*FS, string) {
+	return newFSWith(t, new(server))
+}
+
+// newFSWith is like newFS, but serves the FS with srv.
+func newFSWith(t *testing.T, srv *server) (*FS, string) {
+	dir := t.TempDir()
+
+	reqr, reqw := io.Pipe()
+	respr, respw := io.Pipe()
+	go srv.serve(reqr, respw)
+
+	fsys, err := New(respr, reqw, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fsys.Close() })
+	return fsys, dir
+}
+
+func TestConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) store.Backend {
+		fsys, _ := newFS(t)
+		return fsys
+	})
+}
+
+type Counter struct {
+	N int
+}
+
+func TestFS(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("StoreLoad", func(t *testing.T) {
+		fsys, dir := newFS(t)
+		st := store.New[Counter](json.NewEncoder, json.NewDecoder, store.WithBackend(fsys))
+
+		if err := st.Store(ctx, "counter.json", 0640, &Counter{N: 42}, nil); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "counter.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "{\"N\":42}\n" {
+			t.Fatalf("unexpected contents %q", data)
+		}
+		info, err := os.Stat(filepath.Join(dir, "counter.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0640 {
+			t.Fatalf("expected mode 0640, got %v", info.Mode().Perm())
+		}
+
+		var val Counter
+		canary, err := st.Load(ctx, "counter.json", &val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val.N != 42 {
+			t.Fatalf("expected 42, got %d", val.N)
+		}
+
+		// Replacing the file within the same second, with contents of the
+		// same size, still changes its canary.
+		if err := st.Store(ctx, "counter.json", 0640, &Counter{N: 43}, canary); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.Store(ctx, "counter.json", 0640, &Counter{N: 44}, canary); err != store.ErrRetry {
+			t.Fatalf("expected ErrRetry, got %v", err)
+		}
+		if err := st.StoreExclusive(ctx, "counter.json", 0640, &Counter{N: 1}); !errors.Is(err, fs.ErrExist) {
+			t.Fatalf("expected ErrExist, got %v", err)
+		}
+	})
+
+	t.Run("Sentinels", func(t *testing.T) {
+		fsys, dir := newFS(t)
+
+		f, err := fsys.OpenFile("file", os.O_RDWR|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fsys.Lock(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "file.lck")); err != nil {
+			t.Fatalf("expected a sentinel: %v", err)
+		}
+		entries, err := fsys.ReadDir(".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Name() != "file" {
+			t.Fatalf("expected the sentinel to be hidden, got %v", entries)
+		}
+
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "file.lck")); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("expected the sentinel to be removed, got %v", err)
+		}
+	})
+
+	t.Run("Contention", func(t *testing.T) {
+		// The sentinel gets created and removed by other clients between
+		// each attempt to create it and the following check, which must
+		// make the lock wait rather than fail.
+		var attempts int
+		fsys, _ := newFSWith(t, &server{busy: func(name string) bool {
+			attempts++
+			return filepath.Base(name) == "file.lck" && attempts <= 5
+		}})
+
+		f, err := fsys.OpenFile("file", os.O_RDWR|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := fsys.TryLock(f); !errors.Is(err, store.ErrWouldBlock) {
+			t.Fatalf("expected ErrWouldBlock, got %v", err)
+		}
+		if err := fsys.Lock(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("BreakStale", func(t *testing.T) {
+		fsys, dir := newFS(t)
+		st := store.New[Counter](json.NewEncoder, json.NewDecoder, store.WithBackend(fsys), store.WithLockInfo("sftp"))
+
+		// Leave behind the lock file and the sentinel of a holder whose
+		// lease expired.
+		info, err := json.Marshal(store.LockInfo{Hostname: "elsewhere", PID: 1, Expires: time.Now().Add(-time.Second)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "counter.json.lock"), append([]byte("#go-store lock\n"), info...), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "counter.json.lock.lck"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		if err := st.Store(tctx, "counter.json", 0666, &Counter{N: 1}, nil); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the lock to be held, got %v", err)
+		}
+
+		broken, err := st.BreakStale(ctx, "counter.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !broken {
+			t.Fatal("expected the lock to be broken")
+		}
+		if err := st.Store(ctx, "counter.json", 0666, &Counter{N: 1}, nil); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Name() != "counter.json" {
+			t.Fatalf("expected only counter.json to remain, got %v", entries)
+		}
+	})
+
+	t.Run("Large", func(t *testing.T) {
+		fsys, _ := newFS(t)
+		st := store.New[[]byte](json.NewEncoder, json.NewDecoder, store.WithBackend(fsys))
+
+		data := make([]byte, 3*maxData+1)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		if err := st.Store(ctx, "blob.json", 0666, &data, nil); err != nil {
+			t.Fatal(err)
+		}
+		var got []byte
+		if _, err := st.Load(ctx, "blob.json", &got); err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(data) {
+			t.Fatal("contents differ")
+		}
+	})
+}
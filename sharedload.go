@@ -0,0 +1,106 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"sync"
+)
+
+// loadGroup lets concurrent loads of the same file share a single decode.
+type loadGroup[T any] struct {
+	clone func(*T) T
+
+	mu    sync.Mutex
+	calls map[loadKey]*loadCall[T]
+}
+
+// loadKey identifies a file by its device and inode, which no other file
+// shares for as long as the decode of the file holds it open.
+type loadKey struct {
+	dev, ino uint64
+}
+
+// loadCall is a decode in progress, or completed.
+type loadCall[T any] struct {
+	done     chan struct{}
+	shared   bool
+	val      T
+	migrated bool
+	err      error
+}
+
+func newLoadGroup[T any](clone func(*T) T) *loadGroup[T] {
+	if clone == nil {
+		clone = func(v *T) T { return *v }
+	}
+	return &loadGroup[T]{clone: clone, calls: map[loadKey]*loadCall[T]{}}
+}
+
+// do sets v to the value decoded by decode from the file identified by st,
+// unless another goroutine is already decoding that file, in which case it
+// waits for that decode and sets v to a clone of its value instead.
+func (g *loadGroup[T]) do(ctx context.Context, st FileStat, v *T, decode func(*T) (bool, error)) (bool, error) {
+	key := loadKey{dev: st.Dev, ino: st.Ino}
+
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		c.shared = true
+		g.mu.Unlock()
+
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+		*v = g.clone(&c.val)
+		return c.migrated, c.err
+	}
+	c := &loadCall[T]{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.migrated, c.err = decode(&c.val)
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	shared := c.shared
+	g.mu.Unlock()
+	close(c.done)
+
+	if shared {
+		*v = g.clone(&c.val)
+	} else {
+		// Nobody else got to see the value.
+		*v = c.val
+	}
+	return c.migrated, c.err
+}
+
+// WithSharedLoads configures the store to let concurrent calls to Load and
+// LoadIfChanged that read the same file share a single decode of its
+// contents: a call that finds the file being decoded by another waits for
+// that decode, and gets a copy of its result made with clone. The value
+// passed to Load is then replaced rather than decoded into.
+//
+// Calls share decodes of the same file only, as identified by its canary;
+// they never get the contents of a file that was replaced before they opened
+// it. Decodes are not shared by stores configured with WithCanaryFunc or
+// WithObjectBackend, whose canaries only get known by decoding.
+//
+// Values shared by calls must not be modified by any of them, unless clone
+// makes deep copies of the values it gets. If clone is nil, values are
+// copied shallowly, which is enough for values that hold no pointers, maps
+// or slices.
+//
+// The type T of clone must match the type of the store, otherwise New panics.
+func WithSharedLoads[T any](clone func(*T) T) Option {
+	return func(opts *options) {
+		opts.sharedLoads = true
+		opts.cloneFunc = clone
+	}
+}
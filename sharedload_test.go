@@ -0,0 +1,88 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSharedLoads(t *testing.T) {
+	ctx := context.Background()
+
+	var decodes atomic.Int64
+	newDecoder := func(r io.Reader) *json.Decoder {
+		decodes.Add(1)
+		// Give the other loads the time to join.
+		time.Sleep(50 * time.Millisecond)
+		return json.NewDecoder(r)
+	}
+	clone := func(v *map[string]int) map[string]int {
+		c := make(map[string]int, len(*v))
+		for k, n := range *v {
+			c[k] = n
+		}
+		return c
+	}
+	store := New[map[string]int](json.NewEncoder, newDecoder, WithSharedLoads(clone))
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	if err := store.ForceStore(ctx, path, 0666, &map[string]int{"a": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Concurrent", func(t *testing.T) {
+		decodes.Store(0)
+
+		const loads = 8
+		vals := make([]map[string]int, loads)
+		var wg sync.WaitGroup
+		for i := range vals {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if _, err := store.Load(ctx, path, &vals[i]); err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		if n := decodes.Load(); n >= loads {
+			t.Fatalf("expected loads to share decodes, got %d decodes", n)
+		}
+		vals[0]["a"] = 2
+		for i, val := range vals[1:] {
+			if val["a"] != 1 {
+				t.Fatalf("load %d: expected a copy of the value, got %v", i+1, val)
+			}
+		}
+	})
+
+	t.Run("Replaced", func(t *testing.T) {
+		var val map[string]int
+		canary, err := store.Load(ctx, path, &val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.ForceStore(ctx, path, 0666, &map[string]int{"a": 3}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.LoadIfChanged(ctx, path, canary, &val); err != nil {
+			t.Fatal(err)
+		}
+		if val["a"] != 3 {
+			t.Fatalf("expected the new contents, got %v", val)
+		}
+	})
+}
@@ -10,31 +10,75 @@
 package store
 
 import (
-	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
 
 	"golang.org/x/sys/unix"
 )
 
+type saflag uint32
+
+const (
+	_SA_RESTART saflag = 0x2
+)
+
+// sigactiont has the layout of the C struct sigaction. The sigaction system
+// call expects the address of the signal trampoline of libc along with the
+// handler, which only libc knows, so system calls go through libc on Darwin.
 type sigactiont struct {
 	Handler uintptr
-	Tramp   uintptr
 	Mask    uint32
 	Flags   saflag
 }
 
-func gettid() int {
-	// Darwin doesn't have a Gettid wrapper, but the syscall exists.
-	tid, _, errno := unix.RawSyscall(unix.SYS_GETTID, 0, 0, 0)
+var libc_sigaction_trampoline_addr uintptr
+
+//go:cgo_import_dynamic libc_sigaction sigaction "/usr/lib/libSystem.B.dylib"
+
+func sigaction(signum unix.Signal, act, old *sigactiont) error {
+	_, _, errno := syscall_rawSyscall(libc_sigaction_trampoline_addr,
+		uintptr(signum),
+		uintptr(unsafe.Pointer(act)),
+		uintptr(unsafe.Pointer(old)))
+
+	runtime.KeepAlive(act)
+	runtime.KeepAlive(old)
 	if errno != 0 {
-		panic(fmt.Sprintf("gettid(2) should always succeed; got errno %d: %v", errno, errno))
+		return &os.SyscallError{Syscall: "sigaction", Err: errno}
 	}
-	return int(tid)
+	return nil
 }
 
-// On macOS, tgkill does not exist, and this wrapper simply calls kill(tid, signal).
-//
-// The reason why Linux needs tgkill and Darwin doesn't is because Linux will
-// aggressively reuse thread IDs among processes, while Darwin is more conservative.
-func tgkill(_, tid int, signal unix.Signal) error {
-	return unix.Kill(tid, unix.Signal(signal))
+var (
+	libc_pthread_self_trampoline_addr uintptr
+	libc_pthread_kill_trampoline_addr uintptr
+)
+
+//go:cgo_import_dynamic libc_pthread_self pthread_self "/usr/lib/libSystem.B.dylib"
+//go:cgo_import_dynamic libc_pthread_kill pthread_kill "/usr/lib/libSystem.B.dylib"
+
+// pthreadSelf returns the pthread_t of the calling thread, which must be
+// locked to its goroutine for the result to stay meaningful.
+func pthreadSelf() uintptr {
+	thread, _, _ := syscall_rawSyscall(libc_pthread_self_trampoline_addr, 0, 0, 0)
+	return thread
 }
+
+// pthreadKill sends signal to thread. Unlike kill(2), which Darwin only
+// supports for processes, it targets a single thread.
+func pthreadKill(thread uintptr, signal unix.Signal) error {
+	// pthread_kill returns its error rather than setting errno.
+	r1, _, _ := syscall_rawSyscall(libc_pthread_kill_trampoline_addr, thread, uintptr(signal), 0)
+	if r1 != 0 {
+		return &os.SyscallError{Syscall: "pthread_kill", Err: syscall.Errno(r1)}
+	}
+	return nil
+}
+
+// Implemented in the runtime package (runtime/sys_darwin.go), like for
+// golang.org/x/sys/unix.
+//
+//go:linkname syscall_rawSyscall syscall.rawSyscall
+func syscall_rawSyscall(fn, a1, a2, a3 uintptr) (r1, r2 uintptr, err syscall.Errno)
@@ -0,0 +1,30 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build darwin && arm64
+// +build darwin,arm64
+
+#include "textflag.h"
+
+// Trampolines to the functions of libc, as called by syscall_rawSyscall.
+
+TEXT libc_sigaction_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_sigaction(SB)
+
+GLOBL	·libc_sigaction_trampoline_addr(SB), RODATA, $8
+DATA	·libc_sigaction_trampoline_addr(SB)/8, $libc_sigaction_trampoline<>(SB)
+
+TEXT libc_pthread_self_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_pthread_self(SB)
+
+GLOBL	·libc_pthread_self_trampoline_addr(SB), RODATA, $8
+DATA	·libc_pthread_self_trampoline_addr(SB)/8, $libc_pthread_self_trampoline<>(SB)
+
+TEXT libc_pthread_kill_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_pthread_kill(SB)
+
+GLOBL	·libc_pthread_kill_trampoline_addr(SB), RODATA, $8
+DATA	·libc_pthread_kill_trampoline_addr(SB)/8, $libc_pthread_kill_trampoline<>(SB)
@@ -0,0 +1,65 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build freebsd
+// +build freebsd
+
+package store
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const systemHasThreadSignals = true
+
+type saflag int32
+
+const (
+	_SA_RESTART saflag = 0x2
+)
+
+type sigactiont struct {
+	Handler uintptr
+	Flags   saflag
+	Mask    [4]uint32
+}
+
+func sigaction(signum unix.Signal, act, old *sigactiont) error {
+	_, _, errno := unix.RawSyscall(unix.SYS_SIGACTION,
+		uintptr(signum),
+		uintptr(unsafe.Pointer(act)),
+		uintptr(unsafe.Pointer(old)))
+
+	runtime.KeepAlive(act)
+	runtime.KeepAlive(old)
+	if errno != 0 {
+		return &os.SyscallError{Syscall: "sigaction", Err: errno}
+	}
+	return nil
+}
+
+func gettid() int {
+	var tid int
+	_, _, errno := unix.RawSyscall(unix.SYS_THR_SELF, uintptr(unsafe.Pointer(&tid)), 0, 0)
+	if errno != 0 {
+		panic(fmt.Sprintf("thr_self(2) should always succeed; got errno %d: %v", errno, errno))
+	}
+	return int(tid)
+}
+
+// FreeBSD has no tgkill, but thr_kill2 does the same.
+func tgkill(pid, tid int, signal unix.Signal) error {
+	_, _, errno := unix.RawSyscall(unix.SYS_THR_KILL2, uintptr(pid), uintptr(tid), uintptr(signal))
+	if errno != 0 {
+		return &os.SyscallError{Syscall: "thr_kill2", Err: errno}
+	}
+	return nil
+}
@@ -17,6 +17,8 @@ import (
 	"golang.org/x/sys/unix"
 )
 
+const systemHasThreadSignals = true
+
 type saflag uint64
 
 const (
@@ -0,0 +1,74 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build netbsd && (amd64 || arm64)
+// +build netbsd
+// +build amd64 arm64
+
+package store
+
+import (
+	"os"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const systemHasThreadSignals = true
+
+type saflag int32
+
+const (
+	_SA_RESTART saflag = 0x2
+)
+
+type sigactiont struct {
+	Handler uintptr
+	Mask    [4]uint32
+	Flags   saflag
+}
+
+// netbsd_sigreturn_tramp_addr is the address of a signal trampoline like the
+// one of the runtime, which NetBSD requires along with signal handlers, but
+// does not report for existing ones.
+var netbsd_sigreturn_tramp_addr uintptr
+
+// sigtrampVersion is the version of the ABI of the signal trampoline,
+// __SIGTRAMP_SIGINFO_VERSION.
+const sigtrampVersion = 2
+
+func sigaction(signum unix.Signal, act, old *sigactiont) error {
+	_, _, errno := unix.RawSyscall6(unix.SYS___SIGACTION_SIGTRAMP,
+		uintptr(signum),
+		uintptr(unsafe.Pointer(act)),
+		uintptr(unsafe.Pointer(old)),
+		netbsd_sigreturn_tramp_addr,
+		sigtrampVersion,
+		0)
+
+	runtime.KeepAlive(act)
+	runtime.KeepAlive(old)
+	if errno != 0 {
+		return &os.SyscallError{Syscall: "__sigaction_sigtramp", Err: errno}
+	}
+	return nil
+}
+
+func gettid() int {
+	tid, _, _ := unix.RawSyscall(unix.SYS__LWP_SELF, 0, 0, 0)
+	return int(tid)
+}
+
+// NetBSD has no tgkill, but _lwp_kill targets the threads, or LWPs, of the
+// calling process.
+func tgkill(_, tid int, signal unix.Signal) error {
+	_, _, errno := unix.RawSyscall(unix.SYS__LWP_KILL, uintptr(tid), uintptr(signal), 0)
+	if errno != 0 {
+		return &os.SyscallError{Syscall: "_lwp_kill", Err: errno}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build netbsd && amd64
+// +build netbsd,amd64
+
+#include "textflag.h"
+
+// Same as runtime·sigreturn_tramp; the kernel passes the address of the
+// ucontext in R15.
+TEXT sigreturn_tramp<>(SB),NOSPLIT,$-8
+	MOVQ	R15, DI
+	MOVQ	$308, AX	// SYS_setcontext
+	SYSCALL
+	MOVQ	$-1, DI
+	MOVL	$1, AX		// SYS_exit
+	SYSCALL
+
+GLOBL	·netbsd_sigreturn_tramp_addr(SB), RODATA, $8
+DATA	·netbsd_sigreturn_tramp_addr(SB)/8, $sigreturn_tramp<>(SB)
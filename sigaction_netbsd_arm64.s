@@ -0,0 +1,21 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build netbsd && arm64
+// +build netbsd,arm64
+
+#include "textflag.h"
+
+// Same as runtime·sigreturn_tramp; the kernel passes the address of the
+// ucontext in R28.
+TEXT sigreturn_tramp<>(SB),NOSPLIT,$-8
+	MOVD	g, R0
+	SVC	$308	// SYS_setcontext
+	MOVD	$0, R0
+	MOVD	R0, (R0)	// crash
+
+GLOBL	·netbsd_sigreturn_tramp_addr(SB), RODATA, $8
+DATA	·netbsd_sigreturn_tramp_addr(SB)/8, $sigreturn_tramp<>(SB)
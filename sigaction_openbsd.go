@@ -0,0 +1,81 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build openbsd && (amd64 || arm64)
+// +build openbsd
+// +build amd64 arm64
+
+package store
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const systemHasThreadSignals = true
+
+type saflag int32
+
+const (
+	_SA_RESTART saflag = 0x2
+)
+
+type sigactiont struct {
+	Handler uintptr
+	Mask    uint32
+	Flags   saflag
+}
+
+// OpenBSD only allows system calls from libc, so they go through trampolines
+// to its functions, like in golang.org/x/sys/unix.
+var (
+	libc_sigaction_trampoline_addr uintptr
+	libc_getthrid_trampoline_addr  uintptr
+	libc_thrkill_trampoline_addr   uintptr
+)
+
+//go:cgo_import_dynamic libc_sigaction sigaction "libc.so"
+//go:cgo_import_dynamic libc_getthrid getthrid "libc.so"
+//go:cgo_import_dynamic libc_thrkill thrkill "libc.so"
+
+func sigaction(signum unix.Signal, act, old *sigactiont) error {
+	_, _, errno := syscall_rawSyscall(libc_sigaction_trampoline_addr,
+		uintptr(signum),
+		uintptr(unsafe.Pointer(act)),
+		uintptr(unsafe.Pointer(old)))
+
+	runtime.KeepAlive(act)
+	runtime.KeepAlive(old)
+	if errno != 0 {
+		return &os.SyscallError{Syscall: "sigaction", Err: errno}
+	}
+	return nil
+}
+
+func gettid() int {
+	tid, _, _ := syscall_rawSyscall(libc_getthrid_trampoline_addr, 0, 0, 0)
+	return int(tid)
+}
+
+// OpenBSD has no tgkill, but thrkill targets the threads of the calling
+// process.
+func tgkill(_, tid int, signal unix.Signal) error {
+	_, _, errno := syscall_rawSyscall(libc_thrkill_trampoline_addr, uintptr(tid), uintptr(signal), 0)
+	if errno != 0 {
+		return &os.SyscallError{Syscall: "thrkill", Err: errno}
+	}
+	return nil
+}
+
+// Implemented in the runtime package (runtime/sys_openbsd3.go), like for
+// golang.org/x/sys/unix.
+//
+//go:linkname syscall_rawSyscall syscall.rawSyscall
+func syscall_rawSyscall(fn, a1, a2, a3 uintptr) (r1, r2 uintptr, err syscall.Errno)
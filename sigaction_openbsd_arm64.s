@@ -0,0 +1,30 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build openbsd && arm64
+// +build openbsd,arm64
+
+#include "textflag.h"
+
+// Trampolines to the functions of libc, as called by syscall_rawSyscall.
+
+TEXT libc_sigaction_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_sigaction(SB)
+
+GLOBL	·libc_sigaction_trampoline_addr(SB), RODATA, $8
+DATA	·libc_sigaction_trampoline_addr(SB)/8, $libc_sigaction_trampoline<>(SB)
+
+TEXT libc_getthrid_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_getthrid(SB)
+
+GLOBL	·libc_getthrid_trampoline_addr(SB), RODATA, $8
+DATA	·libc_getthrid_trampoline_addr(SB)/8, $libc_getthrid_trampoline<>(SB)
+
+TEXT libc_thrkill_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_thrkill(SB)
+
+GLOBL	·libc_thrkill_trampoline_addr(SB), RODATA, $8
+DATA	·libc_thrkill_trampoline_addr(SB)/8, $libc_thrkill_trampoline<>(SB)
@@ -0,0 +1,85 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build solaris
+// +build solaris
+
+package store
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const systemHasThreadSignals = true
+
+type saflag int32
+
+const (
+	_SA_RESTART saflag = 0x4
+)
+
+type sigactiont struct {
+	Flags   saflag
+	_       [4]byte
+	Handler uintptr
+	Mask    [4]uint32
+}
+
+// Solaris system calls go through libc, like in golang.org/x/sys/unix.
+type libcFunc uintptr
+
+//go:cgo_import_dynamic libc_sigaction sigaction "libc.so"
+//go:cgo_import_dynamic libc_thr_self thr_self "libc.so"
+//go:cgo_import_dynamic libc_thr_kill thr_kill "libc.so"
+
+//go:linkname procsigaction libc_sigaction
+//go:linkname procthr_self libc_thr_self
+//go:linkname procthr_kill libc_thr_kill
+
+var (
+	procsigaction,
+	procthr_self,
+	procthr_kill libcFunc
+)
+
+// Implemented in runtime/syscall_solaris.go.
+func rawSysvicall6(trap, nargs, a1, a2, a3, a4, a5, a6 uintptr) (r1, r2 uintptr, err syscall.Errno)
+
+func sigaction(signum unix.Signal, act, old *sigactiont) error {
+	_, _, errno := rawSysvicall6(uintptr(unsafe.Pointer(&procsigaction)), 3,
+		uintptr(signum),
+		uintptr(unsafe.Pointer(act)),
+		uintptr(unsafe.Pointer(old)),
+		0, 0, 0)
+
+	runtime.KeepAlive(act)
+	runtime.KeepAlive(old)
+	if errno != 0 {
+		return &os.SyscallError{Syscall: "sigaction", Err: errno}
+	}
+	return nil
+}
+
+func gettid() int {
+	tid, _, _ := rawSysvicall6(uintptr(unsafe.Pointer(&procthr_self)), 0, 0, 0, 0, 0, 0, 0)
+	return int(tid)
+}
+
+// Solaris has no tgkill, but thr_kill targets the threads of the calling
+// process.
+func tgkill(_, tid int, signal unix.Signal) error {
+	// thr_kill returns its error rather than setting errno.
+	r1, _, _ := rawSysvicall6(uintptr(unsafe.Pointer(&procthr_kill)), 2, uintptr(tid), uintptr(signal), 0, 0, 0, 0)
+	if r1 != 0 {
+		return &os.SyscallError{Syscall: "thr_kill", Err: syscall.Errno(r1)}
+	}
+	return nil
+}
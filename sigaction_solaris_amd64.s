@@ -0,0 +1,15 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build solaris && amd64
+// +build solaris,amd64
+
+#include "textflag.h"
+
+// Implemented in runtime/syscall_solaris.go, like for golang.org/x/sys/unix.
+
+TEXT ·rawSysvicall6(SB),NOSPLIT,$0-88
+	JMP	syscall·rawSysvicall6(SB)
@@ -4,35 +4,43 @@
 // in the LICENSE file.
 //
 
-//go:build unix && !linux
-// +build unix,!linux
+//go:build unix && !linux && !darwin && !freebsd && !solaris && !(netbsd && (amd64 || arm64)) && !(openbsd && (amd64 || arm64))
+// +build unix
+// +build !linux
+// +build !darwin
+// +build !freebsd
+// +build !solaris
+// +build !netbsd !amd64,!arm64
+// +build !openbsd !amd64,!arm64
 
 package store
 
 import (
-	"os"
-	"runtime"
-	"unsafe"
-
 	"golang.org/x/sys/unix"
 )
 
+// Other Unix systems lack a way for us to interrupt a thread, or to make its
+// system calls interruptible, so locks fall back to leaking goroutines.
+const systemHasThreadSignals = false
+
 type saflag uint32
 
 const (
 	_SA_RESTART saflag = 0x2
 )
 
+type sigactiont struct {
+	Flags saflag
+}
+
 func sigaction(signum unix.Signal, act, old *sigactiont) error {
-	_, _, errno := unix.RawSyscall(unix.SYS_SIGACTION,
-		uintptr(signum),
-		uintptr(unsafe.Pointer(act)),
-		uintptr(unsafe.Pointer(old)))
-
-	runtime.KeepAlive(act)
-	runtime.KeepAlive(old)
-	if errno != 0 {
-		return &os.SyscallError{Syscall: "sigaction", Err: errno}
-	}
-	return nil
+	return ErrUnsupported
+}
+
+func gettid() int {
+	return 0
+}
+
+func tgkill(pid, tid int, signal unix.Signal) error {
+	return ErrUnsupported
 }
@@ -0,0 +1,61 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"time"
+)
+
+// A Snapshot holds a value loaded by LoadSnapshot, along with the metadata of
+// the file that it was loaded from.
+type Snapshot[T any] struct {
+	// Value is the value unmarshaled from the file.
+	Value T
+
+	// Canary is the canary of the file, as returned by Load.
+	Canary Canary
+
+	// Size, ModTime and Mode are the size in bytes, modification time and
+	// mode of the file. They are zero for files of stores configured with
+	// WithObjectBackend.
+	Size    int64
+	ModTime time.Time
+	Mode    os.FileMode
+}
+
+// LoadSnapshot is like Load, except that it returns the loaded value along
+// with the metadata of the file, as observed while loading it. This lets
+// callers serve the value with validators, such as the ETag and
+// Last-Modified headers of HTTP responses, that match it exactly, which
+// separate calls to os.Stat cannot guarantee.
+func (store *Store[T]) LoadSnapshot(ctx context.Context, path string) (snap *Snapshot[T], err error) {
+	ctx, span := store.startSpan(ctx, "LoadSnapshot", path)
+	defer func() { endSpan(span, err) }()
+
+	var info os.FileInfo
+	snap = new(Snapshot[T])
+	snap.Canary, err = store.load(ctx, path, &snap.Value, nil, false, &info)
+	if info != nil {
+		snap.Size, snap.ModTime, snap.Mode = info.Size(), info.ModTime(), info.Mode()
+	}
+	if err != nil && snap.Canary == nil {
+		return nil, err
+	}
+	return snap, err
+}
+
+// ETag returns a strong HTTP entity tag derived from the canary of the
+// snapshot, which changes whenever the canary does.
+func (snap *Snapshot[T]) ETag() string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%T:%v", snap.Canary, snap.Canary)
+	return fmt.Sprintf(`"%016x"`, h.Sum64())
+}
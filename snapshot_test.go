@@ -0,0 +1,61 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSnapshot(t *testing.T) {
+	ctx := context.Background()
+	store := New[int](json.NewEncoder, json.NewDecoder)
+	path := filepath.Join(t.TempDir(), "snap.json")
+
+	if _, err := store.LoadSnapshot(ctx, path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected %v, got %v", os.ErrNotExist, err)
+	}
+
+	v := 42
+	if err := store.Store(ctx, path, 0640, &v, nil); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := store.LoadSnapshot(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Value != 42 {
+		t.Fatalf("expected 42, got %d", snap.Value)
+	}
+	if snap.Size != info.Size() || !snap.ModTime.Equal(info.ModTime()) || snap.Mode != info.Mode() {
+		t.Fatalf("expected the metadata of %v, got %+v", info, snap)
+	}
+	if err := store.Store(ctx, path, 0640, &v, snap.Canary); err != nil {
+		t.Fatal(err)
+	}
+
+	snap2, err := store.LoadSnapshot(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap2.ETag() == snap.ETag() {
+		t.Fatalf("expected the entity tag to change, got %s twice", snap.ETag())
+	}
+	if snap3, err := store.LoadSnapshot(ctx, path); err != nil {
+		t.Fatal(err)
+	} else if snap3.ETag() != snap2.ETag() {
+		t.Fatalf("expected the entity tag %s to be stable, got %s", snap2.ETag(), snap3.ETag())
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+// IsStale reports whether the lock file of the file at path records a holder
+// that is gone, as reported by LockInfo.Stale. Lock files that do not exist or
+// that hold no LockInfo are never stale.
+//
+// Locks of the operating system get released when their holder exits, so a
+// stale lock file is usually not locked anymore. Stale lock files still hold
+// on network file systems that lose track of their locks, or on backends such
+// as the one of package sftpstore whose locks do not get released when their
+// holder crashes; BreakStale reclaims them.
+func (store *Store[T]) IsStale(path string) (bool, error) {
+	info, err := store.ReadLockInfo(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist), errors.Is(err, ErrNoLockInfo):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return info.Stale(), nil
+}
+
+// BreakStale removes the lock file of the file at path if it is stale, as
+// reported by IsStale, and reports whether it did. Stores waiting on the lock
+// file then start over with a new one.
+//
+// BreakStale only removes the lock file once it holds its exclusive lock, and
+// has verified that it still records the same holder; if the lock is still
+// held, for instance by a child process that inherited it, it leaves it alone.
+// On backends that implement LockBreaker, it first breaks the lock, after
+// waiting for concurrent calls to BreakStale on the same path, so that none of
+// them breaks the lock of a holder that took over in the meantime.
+func (store *Store[T]) BreakStale(ctx context.Context, path string) (bool, error) {
+	b := store.fs()
+	lockPath := store.lockPath(path)
+
+	breaker, isBreaker := b.(LockBreaker)
+	if isBreaker {
+		bf, err := store.lockBreak(ctx, lockPath)
+		if err != nil {
+			return false, err
+		}
+		defer func() {
+			b.Remove(bf.Name())
+			closeFile(bf)
+		}()
+	}
+
+	lf, err := store.open(lockPath, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer closeFile(lf)
+
+	info, err := readLockInfo(lf)
+	switch {
+	case errors.Is(err, ErrNoLockInfo):
+		return false, nil
+	case err != nil:
+		return false, err
+	case !info.Stale():
+		return false, nil
+	}
+
+	err = b.TryLock(lf)
+	if isBreaker && errors.Is(err, ErrWouldBlock) {
+		if err := breaker.BreakLock(lockPath); err != nil {
+			return false, err
+		}
+		err = b.TryLock(lf)
+	}
+	switch {
+	case errors.Is(err, ErrWouldBlock):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	// Now that we hold the lock, the lock file cannot change anymore; make
+	// sure that it is still the one we judged stale.
+	if _, ko, err := deleted(b, lf); ko {
+		return false, err
+	}
+	again, err := readLockInfo(lf)
+	switch {
+	case errors.Is(err, ErrNoLockInfo):
+		return false, nil
+	case err != nil:
+		return false, err
+	case again.Hostname != info.Hostname || again.PID != info.PID || !again.Acquired.Equal(info.Acquired):
+		return false, nil
+	}
+
+	if err := b.Remove(lockPath); err != nil {
+		return false, err
+	}
+	return true, store.syncDir(lockPath)
+}
+
+// lockBreak acquires the exclusive lock of the file that serializes the calls
+// to BreakStale on the specified lock file. Like lock files that are not
+// stable, it gets removed by its holder, so callers retry until they lock
+// a file that is still in place.
+func (store *Store[T]) lockBreak(ctx context.Context, lockPath string) (File, error) {
+	b := store.fs()
+	for {
+		f, err := store.open(lockPath+".break", os.O_WRONLY|os.O_CREATE, 0666)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.Lock(ctx, f); err != nil {
+			closeFile(f)
+			return nil, err
+		}
+		_, ko, err := deleted(b, f)
+		if !ko {
+			return f, nil
+		}
+		closeFile(f)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStale(t *testing.T) {
+	ctx := context.Background()
+	store := New[int](json.NewEncoder, json.NewDecoder, WithStableLockFile())
+
+	// writeInfo writes info into the lock file of path, as if its holder
+	// had recorded it.
+	writeInfo := func(t *testing.T, path string, info LockInfo) {
+		t.Helper()
+		data, err := json.Marshal(info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path+".lockfile", append([]byte(lockInfoMagic), data...), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkStale := func(t *testing.T, path string, expected bool) {
+		t.Helper()
+		stale, err := store.IsStale(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stale != expected {
+			t.Fatalf("expected IsStale to return %v", expected)
+		}
+	}
+
+	checkBreak := func(t *testing.T, path string, expected bool) {
+		t.Helper()
+		broken, err := store.BreakStale(ctx, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if broken != expected {
+			t.Fatalf("expected BreakStale to return %v", expected)
+		}
+		if _, err := os.Stat(path + ".lockfile"); expected && !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected the lock file to be removed, got %v", err)
+		}
+	}
+
+	t.Run("Missing", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "state.json")
+		checkStale(t, path, false)
+		checkBreak(t, path, false)
+	})
+
+	t.Run("Alive", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "state.json")
+		writeInfo(t, path, newLockInfo("alive"))
+		checkStale(t, path, false)
+		checkBreak(t, path, false)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "state.json")
+		info := newLockInfo("expired")
+		info.Hostname = "elsewhere"
+		info.Expires = time.Now().Add(-time.Second)
+		writeInfo(t, path, info)
+		checkStale(t, path, true)
+		checkBreak(t, path, true)
+
+		val := 1
+		if err := store.ForceStore(ctx, path, 0666, &val); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("OtherHost", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "state.json")
+		info := newLockInfo("remote")
+		info.Hostname = "elsewhere"
+		info.PID = -1
+		writeInfo(t, path, info)
+		checkStale(t, path, false)
+	})
+
+	t.Run("DeadProcess", func(t *testing.T) {
+		exe, err := os.Executable()
+		if err != nil {
+			t.Skip(err)
+		}
+		cmd := exec.Command(exe, "-test.run=^$")
+		if err := cmd.Run(); err != nil {
+			t.Skip(err)
+		}
+		if processAlive(cmd.Process.Pid) {
+			t.Skip("cannot tell whether processes are alive")
+		}
+
+		path := filepath.Join(t.TempDir(), "state.json")
+		info := newLockInfo("dead")
+		info.PID = cmd.Process.Pid
+		writeInfo(t, path, info)
+		checkStale(t, path, true)
+		checkBreak(t, path, true)
+	})
+
+	t.Run("Held", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "state.json")
+		info := newLockInfo("held")
+		info.Expires = time.Now().Add(-time.Second)
+		writeInfo(t, path, info)
+
+		// The lock is still held, for instance by a child that inherited
+		// it from the holder, so it must not be broken.
+		f, err := os.Open(path + ".lockfile")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := Lock(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+		checkStale(t, path, true)
+		checkBreak(t, path, false)
+	})
+}
@@ -7,14 +7,76 @@
 package store
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var ErrRetry = errors.New("the operation needs to be retried")
 
+// ErrNotModified is returned by LoadIfChanged when the file did not change.
+var ErrNotModified = errors.New("the file was not modified")
+
+// ErrNoChange can be returned by the callback of LoadAndStore to indicate that
+// it did not modify the value, in which case LoadAndStore returns nil without
+// writing the file.
+var ErrNoChange = errors.New("the value was not changed")
+
+// A Canary identifies the state of a file as observed by Load. Canaries are
+// opaque, comparable values, which compare equal when the file did not change
+// in between the loads that returned them. The nil Canary stands for a missing
+// file.
+type Canary any
+
+// A FileCanary is the Canary of files of stores that rely on the identity of
+// files, which they do unless configured otherwise. Along with the inode
+// number of the file, it holds its size and modification time, so that
+// a file that got replaced by another reusing its inode number, as happens
+// quickly on some filesystems, still gets told apart unless both also share
+// their size and modification time.
+//
+// FileCanary values can be persisted, to carry a compare-and-swap over to
+// a later invocation of the program.
+type FileCanary struct {
+	Ino  uint64
+	Size int64
+
+	// ModTime is the modification time of the file, in nanoseconds since
+	// the Unix epoch, or zero if the backend does not know it.
+	ModTime int64
+}
+
+func fileCanary(st FileStat) FileCanary {
+	c := FileCanary{Ino: st.Ino, Size: st.Size}
+	if !st.ModTime.IsZero() {
+		c.ModTime = st.ModTime.UnixNano()
+	}
+	return c
+}
+
+// ErrCrossDevice is returned, wrapped in an *os.LinkError, when the lock
+// directory configured with WithLockDir is not on the same filesystem as the
+// file being stored.
+var ErrCrossDevice = errors.New("lock directory is not on the same filesystem as the destination")
+
+// ErrSymlink is returned, wrapped in an *os.PathError, when a store configured
+// with WithNoFollow encounters a symbolic link in place of a file.
+var ErrSymlink = errors.New("file is a symbolic link")
+
+// ErrTooLarge is returned, wrapped in an EncodeError, when an encoded value
+// exceeds the maximum size configured with WithMaxBytes.
+var ErrTooLarge = errors.New("encoded value exceeds the maximum size")
+
 type Decoder interface {
 	Decode(v any) error
 }
@@ -40,51 +102,248 @@ type Encoder interface {
 type Store[T any] struct {
 	newEncoder func(io.Writer) Encoder
 	newDecoder func(io.Reader) Decoder
+	dir        *os.File
+	backend    Backend
+	opts       options
+	canaryFunc func(*T) any
+	migrations map[int]Migration[T]
+	loads      *loadGroup[T]
 }
 
-func New[T any, E Encoder, D Decoder](newEncoder func(io.Writer) E, newDecoder func(io.Reader) D) *Store[T] {
-	return &Store[T]{
+// New returns a Store that marshals values of type T with the specified
+// encoder and decoder, and with the behavior configured by the specified
+// options.
+func New[T any, E Encoder, D Decoder](newEncoder func(io.Writer) E, newDecoder func(io.Reader) D, opts ...Option) *Store[T] {
+	store := &Store[T]{
 		newEncoder: func(w io.Writer) Encoder { return newEncoder(w) },
 		newDecoder: func(r io.Reader) Decoder { return newDecoder(r) },
 	}
+	for _, opt := range opts {
+		opt(&store.opts)
+	}
+	store.backend = store.opts.backend
+	if store.opts.objects != nil {
+		store.backend = unsupportedBackend{}
+	}
+	if store.opts.canaryFunc != nil {
+		fn, ok := store.opts.canaryFunc.(func(*T) any)
+		if !ok {
+			panic(fmt.Sprintf("store: canary function %T is incompatible with Store[%T]", store.opts.canaryFunc, *new(T)))
+		}
+		store.canaryFunc = fn
+	}
+	if store.opts.migrations != nil {
+		migrations, ok := store.opts.migrations.(map[int]Migration[T])
+		if !ok {
+			panic(fmt.Sprintf("store: migrations %T are incompatible with Store[%T]", store.opts.migrations, *new(T)))
+		}
+		store.migrations = migrations
+	}
+	if store.opts.sharedLoads {
+		clone, ok := store.opts.cloneFunc.(func(*T) T)
+		if !ok {
+			panic(fmt.Sprintf("store: clone function %T is incompatible with Store[%T]", store.opts.cloneFunc, *new(T)))
+		}
+		store.loads = newLoadGroup(clone)
+	}
+	return store
+}
+
+// InDir returns a copy of the store that resolves relative paths against the
+// specified directory rather than the current working directory.
+//
+// On systems that support it, operations are performed with openat(2) and
+// friends relative to the directory's file descriptor, which saves repeated
+// path resolution when operating on many files in a deep hierarchy. The
+// directory must remain open for as long as the returned store is in use.
+//
+// InDir has no effect on stores configured with WithBackend, unless the
+// backend is an OSBackend, whose directory it replaces.
+func (store *Store[T]) InDir(dir *os.File) *Store[T] {
+	st := *store
+	st.dir = dir
+	if b, ok := st.backend.(osBackend); ok {
+		b.dir = dir
+		st.backend = b
+	}
+	return &st
 }
 
 // Load reads the contents of the file at path and unmarshals it into v.
 //
 // Load may block if another store is in the process of writing to the file.
-func (store *Store[T]) Load(ctx context.Context, path string, v *T) (canary any, err error) {
+func (store *Store[T]) Load(ctx context.Context, path string, v *T) (canary Canary, err error) {
+	ctx, span := store.startSpan(ctx, "Load", path)
+	defer func() { endSpan(span, err) }()
+
+	return store.load(ctx, path, v, nil, false, nil)
+}
+
+// LoadIfChanged is like Load, except that it returns ErrNotModified and leaves
+// v untouched if the file still matches the specified canary, as returned by
+// a previous Load.
+//
+// Unless the store has a canary function, LoadIfChanged does not decode the
+// file at all when it did not change, which makes it cheaper than Load for
+// callers that poll large files.
+func (store *Store[T]) LoadIfChanged(ctx context.Context, path string, canary Canary, v *T) (newCanary Canary, err error) {
+	ctx, span := store.startSpan(ctx, "LoadIfChanged", path)
+	defer func() {
+		if err == ErrNotModified {
+			endSpan(span, nil)
+		} else {
+			endSpan(span, err)
+		}
+	}()
+
+	return store.load(ctx, path, v, canary, true, nil)
+}
+
+func (store *Store[T]) load(ctx context.Context, path string, v *T, canary Canary, ifChanged bool, info *os.FileInfo) (Canary, error) {
+	for {
+		newCanary, migrated, err := store.loadOnce(ctx, path, v, canary, ifChanged, info)
+		if !migrated || err != nil {
+			return newCanary, err
+		}
+
+		// The file holds an older schema version; store the migrated value
+		// back, unless another writer beat us to it, and load it again.
+		if err := store.storeMigrated(ctx, path, v, newCanary); err != nil && err != ErrRetry {
+			return nil, err
+		}
+	}
+}
+
+// loadOnce loads the file at path into v, and reports whether its contents
+// were migrated from an older schema version. If info is not nil, it is set
+// to the metadata of the file, unless the file is an object.
+func (store *Store[T]) loadOnce(ctx context.Context, path string, v *T, canary Canary, ifChanged bool, info *os.FileInfo) (Canary, bool, error) {
+	span := store.traced(ctx)
 
 	select {
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return nil, false, ctx.Err()
 	default:
 	}
 
-	rdf, err := openShared(path, os.O_RDONLY, 0)
+	if store.opts.objects != nil {
+		return store.loadObject(ctx, path, v, canary, ifChanged)
+	}
+
+	rdf, err := store.open(path, os.O_RDONLY, 0)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
-	defer rdf.Close()
+	defer closeFile(rdf)
 
-	if err := RLock(ctx, rdf); err != nil {
-		return nil, err
+	var start time.Time
+	if span != nil {
+		start = time.Now()
 	}
+	if err := store.fs().RLock(ctx, rdf); err != nil {
+		return nil, false, err
+	}
+	traceLockWait(span, start)
 	select {
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return nil, false, ctx.Err()
 	default:
 	}
+	if info != nil {
+		if *info, err = rdf.Stat(); err != nil {
+			return nil, false, err
+		}
+	}
 
-	if err := store.newDecoder(rdf).Decode(v); err != nil {
-		return nil, err
+	if store.canaryFunc != nil {
+		if !ifChanged {
+			migrated, err := store.decodeOrRecover(rdf, path, v)
+			if err != nil && !errors.Is(err, ErrCorrupt) {
+				return nil, false, err
+			}
+			return store.canaryFunc(v), migrated, err
+		}
+
+		var nv T
+		migrated, err := store.decodeOrRecover(rdf, path, &nv)
+		if err != nil && !errors.Is(err, ErrCorrupt) {
+			return nil, false, err
+		}
+		newCanary := store.canaryFunc(&nv)
+		if err == nil && !migrated && newCanary == canary {
+			return canary, false, ErrNotModified
+		}
+		*v = nv
+		return newCanary, migrated, err
 	}
 
-	newCanary, err := lstatIno(rdf, "")
+	st, err := store.fs().Fstat(rdf)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	var (
+		newCanary Canary    = fileCanary(st)
+		r         io.Reader = rdf
+	)
+	if store.opts.contentHash {
+		data, err := io.ReadAll(rdf)
+		if err != nil {
+			return nil, false, err
+		}
+		newCanary, r = hashContents(data), bytes.NewReader(data)
+	} else if store.opts.generations {
+		gen, ok, err := readGeneration(rdf)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			newCanary = generation(gen)
+		}
+	}
+	if ifChanged && newCanary == canary {
+		return canary, false, ErrNotModified
 	}
 
-	return newCanary, nil
+	var migrated bool
+	if store.loads != nil {
+		migrated, err = store.loads.do(ctx, st, v, func(v *T) (bool, error) {
+			return store.decodeOrRecover(r, path, v)
+		})
+	} else {
+		migrated, err = store.decodeOrRecover(r, path, v)
+	}
+	if err != nil {
+		if !errors.Is(err, ErrCorrupt) {
+			return nil, false, err
+		}
+		return newCanary, false, err
+	}
+	if span != nil {
+		span.SetAttributes(attribute.Int64("store.bytes_read", st.Size))
+	}
+	return newCanary, migrated, nil
+}
+
+// LoadVersion reads the contents of the k-th previous version of the file at
+// path, as kept with WithBackups, and unmarshals it into v. Version 0 is the
+// current contents of the file, and version 1 the most recent backup.
+//
+// If there is no such version, LoadVersion returns an error wrapping
+// os.ErrNotExist.
+func (store *Store[T]) LoadVersion(ctx context.Context, path string, k int, v *T) (err error) {
+	name := path
+	if k > 0 {
+		name = backupPath(path, k)
+	}
+
+	ctx, span := store.startSpan(ctx, "LoadVersion", name)
+	defer func() { endSpan(span, err) }()
+
+	if k < 0 {
+		return &os.PathError{Op: "load", Path: path, Err: os.ErrInvalid}
+	}
+	_, _, err = store.loadOnce(ctx, name, v, nil, false, nil)
+	return err
 }
 
 // Store marshals v and writes the result into the specified path, overwriting
@@ -94,43 +353,662 @@ func (store *Store[T]) Load(ctx context.Context, path string, v *T) (canary any,
 // half-written and corrupt.
 //
 // Store may block if another store is in the process of reading the file.
-func (store *Store[T]) Store(ctx context.Context, path string, mode os.FileMode, v *T, canary any) (err error) {
+func (store *Store[T]) Store(ctx context.Context, path string, mode os.FileMode, v *T, canary Canary) (err error) {
+	ctx, span := store.startSpan(ctx, "Store", path)
+	defer func() { endSpan(span, err) }()
 
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
+	return store.store(ctx, path, mode, v, canary, false)
+}
+
+// ForceStore marshals v and atomically writes the result into the specified
+// path, like Store, except that it unconditionally overwrites the file
+// regardless of whether it was modified concurrently.
+//
+// This discards any concurrent update to the file, and is meant as an escape
+// hatch for administrative tooling, for instance to reset the file to a
+// known-good value. Most callers should use Store or LoadAndStore instead.
+func (store *Store[T]) ForceStore(ctx context.Context, path string, mode os.FileMode, v *T) (err error) {
+	ctx, span := store.startSpan(ctx, "ForceStore", path)
+	defer func() { endSpan(span, err) }()
+
+	err = ErrRetry
+	for err == ErrRetry {
+		err = store.store(ctx, path, mode, v, nil, true)
+	}
+	return err
+}
+
+// StoreExclusive marshals v and atomically writes the result into the
+// specified path, like Store, but only if the file does not exist yet.
+// Otherwise, it fails with an error wrapping os.ErrExist and leaves the file
+// untouched. When multiple writers race to create the same file, exactly one
+// of them succeeds, which makes StoreExclusive suitable for claim files.
+//
+// The new contents are moved into place with renameat2(RENAME_NOREPLACE) on
+// Linux, without FILE_RENAME_REPLACE_IF_EXISTS on Windows, and by hard-linking
+// them elsewhere, so that existing files are never replaced, even by writers
+// that do not lock them.
+func (store *Store[T]) StoreExclusive(ctx context.Context, path string, mode os.FileMode, v *T) (err error) {
+	ctx, span := store.startSpan(ctx, "StoreExclusive", path)
+	defer func() { endSpan(span, err) }()
+
+	write, err := store.writer(path, v)
+	if err != nil {
+		return err
+	}
+
+	if store.opts.objects != nil {
+		err := store.putVersion(ctx, path, "", false, write)
+		if err == ErrRetry {
+			err = &os.PathError{Op: "store", Path: path, Err: os.ErrExist}
+		}
+		return err
+	}
+
+	var (
+		lf  File
+		lst FileStat
+	)
+	err = ErrRetry
+	for err == ErrRetry {
+		lf, lst, err = store.acquire(ctx, path, mode, nil, true)
+	}
+	if err != nil {
+		return err
+	}
+	defer store.release(ctx, lf)
+
+	// Check for the destination upfront, which spares writing the new
+	// contents when it exists; renaming them catches any file created
+	// behind the back of the lock.
+	switch _, err := store.fs().Lstat(path); {
+	case err == nil:
+		return &os.PathError{Op: "store", Path: path, Err: os.ErrExist}
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+	return store.commitRename(ctx, lf, lst, path, mode, write, store.renameNoReplace)
+}
+
+func (store *Store[T]) store(ctx context.Context, path string, mode os.FileMode, v *T, canary Canary, force bool) error {
+	write, err := store.writer(path, v)
+	if err != nil {
+		return err
+	}
+	return store.replace(ctx, path, mode, canary, force, write)
+}
+
+// writer returns a function that writes the encoding of v.
+func (store *Store[T]) writer(path string, v *T) (func(io.Writer) error, error) {
+
+	// When the size of the encoded value is limited, encode it upfront, so
+	// that values that are too large get rejected before touching any file.
+	var data *bytes.Buffer
+	if store.opts.maxBytes > 0 {
+		data = new(bytes.Buffer)
+		if err := store.encode(&limitedWriter{w: data, n: store.opts.maxBytes}, path, v); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(w io.Writer) error {
+		if store.opts.generations {
+			if err := store.writeGeneration(w, path); err != nil {
+				return err
+			}
+		}
+		if data != nil {
+			_, err := w.Write(data.Bytes())
+			return err
+		}
+		return store.encode(w, path, v)
+	}, nil
+}
+
+// replace atomically replaces the contents of the file at path with the data
+// written by the write function.
+func (store *Store[T]) replace(ctx context.Context, path string, mode os.FileMode, canary Canary, force bool, write func(io.Writer) error) error {
+	if store.opts.objects != nil {
+		return store.putObject(ctx, path, canary, force, write)
+	}
+
+	lf, lst, err := store.acquire(ctx, path, mode, canary, force)
+	if err != nil {
+		return err
+	}
+	defer store.release(ctx, lf)
+
+	return store.commit(ctx, lf, lst, path, mode, write)
+}
+
+// commit atomically replaces the contents of the file at path with the data
+// written by the write function. lf is the lock file of path, as returned by
+// acquire, along with its metadata lst.
+func (store *Store[T]) commit(ctx context.Context, lf File, lst FileStat, path string, mode os.FileMode, write func(io.Writer) error) error {
+	return store.commitRename(ctx, lf, lst, path, mode, write, store.fs().Rename)
+}
+
+// commitRename is like commit, except that it moves the new contents to path
+// with the specified rename function.
+func (store *Store[T]) commitRename(ctx context.Context, lf File, lst FileStat, path string, mode os.FileMode, write func(io.Writer) error, rename func(File, string) error) error {
+
+	// The recovery copy only replaces the previous one right before the
+	// file itself gets replaced, so that it never holds contents that do
+	// not get committed.
+	recovery, err := store.stageRecovery(path, mode&^os.ModeType, write)
+	if err != nil {
+		return err
+	}
+	if recovery != "" {
+		defer store.fs().Remove(recovery)
+		write = store.copyStaged(recovery)
+	}
+
+	if span := store.traced(ctx); span != nil {
+		writeContents := write
+		write = func(w io.Writer) error {
+			cw := &countingWriter{w: w}
+			defer func() {
+				span.SetAttributes(attribute.Int64("store.bytes_written", cw.n))
+			}()
+			return writeContents(cw)
+		}
+	}
+
+	if store.opts.alternateStream {
+		switch err := store.commitStream(path, mode, recovery, write); {
+		case err == nil:
+			if store.opts.stableLockFile {
+				return nil
+			}
+			// Like renaming it would, removing the unstable lock file
+			// makes writers waiting on it retry.
+			if err := store.fs().Remove(lf.Name()); err != nil {
+				return err
+			}
+			return store.syncDir(path)
+		case err != ErrUnsupported:
+			return err
+		}
 	}
 
 	// Write the updated contents to an alternate file, then atomically
 	// swap it with the original. This avoid corrupting the store should
 	// the process terminate mid-write.
 
-	wf, err := openShared(path+".lock", os.O_WRONLY|os.O_CREATE, mode&^os.ModeType)
+	if !store.opts.stableLockFile {
+		// The lock file doubles as the temporary file. It is almost always
+		// empty, since it gets renamed over the destination on success; it
+		// only needs truncating if a previous store failed mid-write.
+		if lst.Size != 0 {
+			if err := lf.Truncate(0); err != nil {
+				return err
+			}
+		}
+		if err := write(lf); err != nil {
+			return err
+		}
+		if err := store.setMetadata(path, lf, mode); err != nil {
+			return err
+		}
+		if err := store.syncData(lf); err != nil {
+			return err
+		}
+		if err := store.rotateBackups(path); err != nil {
+			return err
+		}
+		if err := store.commitRecovery(recovery, path); err != nil {
+			return err
+		}
+		if err := rename(lf, path); err != nil {
+			return err
+		}
+		return store.syncDir(path)
+	}
+
+	wf, unnamed, err := store.openTemp(path, mode&^os.ModeType)
 	if err != nil {
 		return err
 	}
-	defer wf.Close()
+	defer closeFile(wf)
+
+	var named File
+	if !unnamed {
+		named = wf
+	}
+
+	err = write(wf)
+	if err == nil {
+		err = store.setMetadata(path, wf, mode)
+	}
+	if err == nil {
+		err = store.syncData(wf)
+	}
+	if err == nil && named == nil {
+		named, err = store.linkTemp(wf, path)
+	}
+	if err == nil {
+		err = store.rotateBackups(path)
+	}
+	if err == nil {
+		err = store.commitRecovery(recovery, path)
+	}
+	if err == nil {
+		err = rename(named, path)
+	}
+	if err != nil {
+		if named != nil {
+			store.fs().Remove(named.Name())
+		}
+		return err
+	}
+	return store.syncDir(path)
+}
+
+// stagingStream is the alternate data stream in which commitStream stages
+// the new contents of files.
+const stagingStream = "staging"
+
+// commitStream replaces the contents of the file at path with the data
+// written by the write function, which it stages in an alternate data stream
+// of the file, as configured with WithAlternateDataStream. It returns
+// ErrUnsupported if the file does not exist yet, or cannot be replaced that
+// way, in which case the contents must be staged in a sibling file instead.
+// The staged recovery copy, if any, gets committed right before the file.
+func (store *Store[T]) commitStream(path string, mode os.FileMode, recovery string, write func(io.Writer) error) error {
+	if _, ok := store.osDir(); !ok || !systemHasStreams || store.opts.backups > 0 {
+		// Backups are links to the file, which must not change.
+		return ErrUnsupported
+	}
+	b := store.fs()
+	if st, err := b.Lstat(path); err != nil || st.Symlink {
+		return ErrUnsupported
+	}
+
+	staging := path + ":" + stagingStream
+	wf, err := b.OpenFile(staging, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0)
+	if err != nil {
+		// The file system does not support alternate data streams.
+		return ErrUnsupported
+	}
+	defer closeFile(wf)
+	osf, err := asOSFile("rename", wf)
+	if err != nil {
+		return err
+	}
+
+	err = write(wf)
+	if err == nil {
+		err = store.setMetadata(path, wf, mode)
+	}
+	if err == nil {
+		err = store.syncData(wf)
+	}
+	if err == nil {
+		err = store.commitRecovery(recovery, path)
+	}
+	if err == nil && renameStream(osf) != nil {
+		err = ErrUnsupported
+	}
+	if err != nil {
+		b.Remove(staging)
+	}
+	return err
+}
+
+// stage writes the new contents of the file at path to a temporary file, and
+// returns its name, along with the name of the temporary file holding its
+// recovery copy, if any. Like commit, it sets the metadata of the temporary
+// file; the caller must rotate the backups of path and commit the recovery
+// copy before renaming the temporary file over path. The lock of path must be
+// held.
+func (store *Store[T]) stage(path string, mode os.FileMode, write func(io.Writer) error) (temp, recovery string, err error) {
+	recovery, err = store.stageRecovery(path, mode&^os.ModeType, write)
+	if err != nil {
+		return "", "", err
+	}
+	if recovery != "" {
+		write = store.copyStaged(recovery)
+	}
+	temp, err = store.writeTemp(path, mode&^os.ModeType, write, func(f File) error {
+		return store.setMetadata(path, f, mode)
+	})
+	if err != nil {
+		if recovery != "" {
+			store.fs().Remove(recovery)
+		}
+		return "", "", err
+	}
+	return temp, recovery, nil
+}
+
+// writeTemp writes a new temporary file for the file at path, and returns its
+// name. Unless nil, finalize is called with the temporary file once written,
+// before it gets synced.
+func (store *Store[T]) writeTemp(path string, mode os.FileMode, write func(io.Writer) error, finalize func(File) error) (string, error) {
+	wf, unnamed, err := store.openTemp(path, mode)
+	if err != nil {
+		return "", err
+	}
+	defer closeFile(wf)
+
+	var named File
+	if !unnamed {
+		named = wf
+	}
+
+	err = write(wf)
+	if err == nil && finalize != nil {
+		err = finalize(wf)
+	}
+	if err == nil {
+		err = store.syncData(wf)
+	}
+	if err == nil && named == nil {
+		named, err = store.linkTemp(wf, path)
+	}
+	if err != nil {
+		if named != nil {
+			store.fs().Remove(named.Name())
+		}
+		return "", err
+	}
+	return named.Name(), nil
+}
+
+// stageRecovery writes the new contents of the file at path to a temporary
+// file, which commitRecovery makes its recovery copy, as configured with
+// WithRecovery. It returns the name of the temporary file, or an empty string
+// if the store keeps no recovery copies.
+func (store *Store[T]) stageRecovery(path string, mode os.FileMode, write func(io.Writer) error) (string, error) {
+	if !store.opts.recovery {
+		return "", nil
+	}
+	return store.writeTemp(recoveryPath(path), mode, write, nil)
+}
+
+// commitRecovery renames the temporary file written by stageRecovery over the
+// recovery copy of the file at path. It does nothing if temp is empty, or no
+// longer exists. The lock of path must be held.
+func (store *Store[T]) commitRecovery(temp, path string) error {
+	if temp == "" {
+		return nil
+	}
+	err := renamePath(store.fs(), temp, recoveryPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
 
-	if err := Lock(ctx, wf); err != nil {
+// copyStaged returns a function that copies the contents of the temporary
+// file written by stageRecovery. Once the recovery copy is staged, the file
+// gets written from it rather than by calling write again, which streamed
+// writers cannot do.
+func (store *Store[T]) copyStaged(temp string) func(io.Writer) error {
+	return func(w io.Writer) error {
+		f, err := store.open(temp, os.O_RDONLY, 0)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
 		return err
 	}
+}
+
+func recoveryPath(path string) string {
+	return path + ".bak"
+}
 
-	oldCanary, _ := canary.(uint64)
-	newCanary, err := lstatIno(nil, path)
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
+// rotateBackups shifts the backups of the file at path by one version, and
+// links the file at path as its most recent backup, as configured with
+// WithBackups. The lock of path must be held.
+func (store *Store[T]) rotateBackups(path string) error {
+	n := store.opts.backups
+	if n <= 0 {
+		return nil
+	}
+
+	b := store.fs()
+
+	// Renaming each backup onto the next version drops the oldest one
+	// without leaving a window where any version is missing.
+	for k := n - 1; k >= 1; k-- {
+		f, err := b.OpenFile(backupPath(path, k), os.O_RDONLY, 0)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = b.Rename(f, backupPath(path, k+1))
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if n == 1 {
+		if err := b.Remove(backupPath(path, 1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	// Linking rather than copying the current version keeps the rotation
+	// cheap, and leaves path in place for readers until the new contents
+	// replace it.
+	if err := b.Link(path, backupPath(path, 1)); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
-	// Compare canaries -- we use inodes as canaries, so an inode of 0 means
-	// the file was missing.
-	if newCanary != oldCanary {
-		// The destination changed while we were waiting for the lock. This
-		// means that another concurrent store completed, and we need
-		// to retry.
-		return ErrRetry
+	return nil
+}
+
+func backupPath(path string, k int) string {
+	return path + "." + strconv.Itoa(k)
+}
+
+// setMetadata sets the metadata of f, which is about to replace the file at
+// path, as configured with WithPreserveMetadata, WithExactMode and WithOwner.
+// Files of backends that do not support changing their metadata are left
+// untouched.
+func (store *Store[T]) setMetadata(path string, f File, mode os.FileMode) error {
+	if dir, ok := store.osDir(); ok && store.opts.preserveMetadata {
+		osf, err := asOSFile("copymetadata", f)
+		if err != nil {
+			return err
+		}
+		if err := copyMetadata(dir, path, osf); err != nil {
+			return err
+		}
+	}
+	if f, ok := f.(interface{ Chmod(os.FileMode) error }); ok && store.opts.exactMode {
+		if err := f.Chmod(mode & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)); err != nil {
+			return err
+		}
 	}
+	if f, ok := f.(interface{ Chown(uid, gid int) error }); ok && store.opts.chown {
+		if err := f.Chown(store.opts.uid, store.opts.gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	if ko, err := deleted(wf); ko {
+// syncData flushes the contents of f to stable storage if the store was
+// configured with WithSyncData.
+func (store *Store[T]) syncData(f File) error {
+	if !store.opts.syncData {
+		return nil
+	}
+	return f.Sync()
+}
+
+// syncDir flushes the directory containing path to stable storage if the
+// store was configured with WithSyncDir, and its backend is a DirSyncer.
+func (store *Store[T]) syncDir(path string) error {
+	s, ok := store.fs().(DirSyncer)
+	if !store.opts.syncDir || !ok {
+		return nil
+	}
+	return s.SyncDir(filepath.Dir(path))
+}
+
+// Delete removes the file at path, along with its lock file, provided that
+// the file did not change since the Load that returned canary. Otherwise,
+// Delete returns ErrRetry.
+//
+// Delete holds the exclusive lock of the file while removing it, which means
+// that concurrent stores either complete before the removal, or observe it:
+// a concurrent LoadAndStore retries, and calls its function with an error
+// wrapping os.ErrNotExist.
+func (store *Store[T]) Delete(ctx context.Context, path string, canary Canary) (err error) {
+	ctx, span := store.startSpan(ctx, "Delete", path)
+	defer func() { endSpan(span, err) }()
+
+	return store.remove(ctx, path, canary, false)
+}
+
+// remove deletes the file at the specified path, along with its lock file.
+func (store *Store[T]) remove(ctx context.Context, path string, canary Canary, force bool) error {
+	if store.opts.objects != nil {
+		return store.deleteObject(ctx, path, canary, force)
+	}
+
+	wf, _, err := store.acquire(ctx, path, 0666, canary, force)
+	if err != nil {
+		return err
+	}
+	defer store.release(ctx, wf)
+
+	// The destination must be removed before the lock file; otherwise, a
+	// concurrent store could create a new lock file and replace the
+	// destination before we get to remove it.
+	b := store.fs()
+	err = b.Remove(path)
+	if uerr := b.Remove(wf.Name()); err == nil {
+		err = uerr
+	}
+	if err != nil {
+		return err
+	}
+	return store.syncDir(path)
+}
+
+// acquire opens and exclusively locks the lock file of the specified path,
+// and returns it once it has verified that the destination matches the
+// canary (unless force is set) and that the lock is held on the right file.
+// It also returns the metadata of the lock file, as observed under the lock.
+func (store *Store[T]) acquire(ctx context.Context, path string, mode os.FileMode, canary Canary, force bool) (File, FileStat, error) {
+
+	select {
+	case <-ctx.Done():
+		return nil, FileStat{}, ctx.Err()
+	default:
+	}
+
+	lockPath := store.lockPath(path)
+	if store.opts.lockDir != "" {
+		if err := store.checkSameDevice(lockPath, path); err != nil {
+			return nil, FileStat{}, err
+		}
+	}
+
+	wf, err := store.open(lockPath, os.O_WRONLY|os.O_CREATE, mode&^os.ModeType)
+	if err != nil {
+		return nil, FileStat{}, err
+	}
+
+	start := time.Now()
+	st, err := store.lockAndVerify(ctx, wf, path, canary, force)
+	if err == nil && store.opts.noFollow {
+		err = store.checkNotSymlink(path)
+	}
+	if err == nil && store.opts.lockInfo {
+		st.Size, err = writeLockInfo(wf, newLockInfo(store.opts.lockLabel))
+	}
+	if err != nil {
+		closeFile(wf)
+		return nil, FileStat{}, err
+	}
+	store.debug(ctx, "lock acquired", "path", path, "wait", time.Since(start))
+	return wf, st, nil
+}
+
+// checkNotSymlink fails with ErrSymlink if the file at path is a symbolic
+// link, which stores configured with WithNoFollow refuse to replace.
+func (store *Store[T]) checkNotSymlink(path string) error {
+	st, err := store.fs().Lstat(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	case st.Symlink:
+		return &os.PathError{Op: "store", Path: path, Err: ErrSymlink}
+	}
+	return nil
+}
+
+// acquireAndLoad acquires the lock file of path regardless of its canary, and
+// loads the current contents of path into v while holding it. Since stores
+// must hold the lock file to replace path, the contents remain current until
+// the lock file is released.
+//
+// The error encountered while loading, if any, is returned as loadErr, with
+// the lock file still held.
+func (store *Store[T]) acquireAndLoad(ctx context.Context, path string, mode os.FileMode, v *T) (lf File, lst FileStat, loadErr, err error) {
+	err = ErrRetry
+	for err == ErrRetry {
+		lf, lst, err = store.acquire(ctx, path, mode, nil, true)
+	}
+	if err != nil {
+		return nil, FileStat{}, nil, err
+	}
+
+	rdf, err := store.open(path, os.O_RDONLY, 0)
+	if err != nil {
+		return lf, lst, err, nil
+	}
+	defer closeFile(rdf)
+
+	_, loadErr = store.decodeOrRecover(rdf, path, v)
+	return lf, lst, loadErr, nil
+}
+
+func (store *Store[T]) lockAndVerify(ctx context.Context, wf File, path string, canary Canary, force bool) (FileStat, error) {
+	span := store.traced(ctx)
+
+	var start time.Time
+	if span != nil || store.opts.logf != nil {
+		start = time.Now()
+	}
+	err := store.opts.lockOptions.wait(ctx, wf.Name(), func() *LockInfo {
+		info, _ := store.ReadLockInfo(path)
+		return info
+	}, func(ctx context.Context) error {
+		return store.fs().Lock(ctx, wf)
+	})
+	if err != nil {
+		return FileStat{}, err
+	}
+	traceLockWait(span, start)
+
+	if !force {
+		changed, err := store.changed(path, canary)
+		if err != nil {
+			return FileStat{}, err
+		}
+		if changed {
+			// The destination changed while we were waiting for the lock. This
+			// means that another concurrent store completed, and we need
+			// to retry.
+			store.debug(ctx, "destination changed while waiting for the lock", "path", path)
+			return FileStat{}, ErrRetry
+		}
+	}
+
+	st, ko, err := deleted(store.fs(), wf)
+	if ko {
 		if err == nil {
 			// Another process pulled the rug from under us; we managed to acquire an
 			// exclusive lock, but that lock is held on the final file, not the
@@ -140,20 +1018,58 @@ func (store *Store[T]) Store(ctx context.Context, path string, mode os.FileMode,
 			// finished atomically swapping the result.
 			//
 			// There's nothing we can do except return ErrRetry.
+			store.debug(ctx, "lock file pulled from under the lock", "path", path)
 			err = ErrRetry
 		}
-		return err
+		return FileStat{}, err
 	}
+	return st, nil
+}
 
-	if err := wf.Truncate(0); err != nil {
-		return err
+// changed returns whether the file at path no longer matches the canary.
+func (store *Store[T]) changed(path string, canary Canary) (bool, error) {
+	if store.canaryFunc != nil {
+		var v T
+		rdf, err := store.open(path, os.O_RDONLY, 0)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			return canary != nil, nil
+		case err != nil:
+			return false, err
+		}
+		defer closeFile(rdf)
+
+		if err := store.decode(rdf, path, &v); err != nil {
+			return false, err
+		}
+		return store.canaryFunc(&v) != canary, nil
 	}
 
-	if err := store.newEncoder(wf).Encode(v); err != nil {
-		return err
+	if store.opts.contentHash {
+		newCanary, err := store.fileContentHash(path)
+		if err != nil {
+			return false, err
+		}
+		return newCanary != canary, nil
+	}
+	if store.opts.generations {
+		gen, ok, err := store.fileGeneration(path)
+		if err != nil {
+			return false, err
+		}
+		if _, isGen := canary.(generation); ok || isGen {
+			return !ok || canary != Canary(generation(gen)), nil
+		}
 	}
 
-	return rename(wf, path)
+	st, err := store.fs().Lstat(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return canary != nil, nil
+	case err != nil:
+		return false, err
+	}
+	return Canary(fileCanary(st)) != canary, nil
 }
 
 // LoadAndStoreFunc is the signature of the user callback called by LoadAndStore.
@@ -165,14 +1081,24 @@ func (store *Store[T]) Store(ctx context.Context, path string, mode os.FileMode,
 // less commonly, because the file fails to unmarshal), the function is still
 // called with val set to a pointer to the zero value of T, and err is set to
 // the error that occured during loading.
+//
+// If the function returns ErrNoChange, the file is left untouched, and
+// LoadAndStore returns nil. This saves rewriting the file, along with its
+// backups and modification time, on passes that turn out to be read-only.
 type LoadAndStoreFunc[T any] func(ctx context.Context, val *T, err error) error
 
-func (store *Store[T]) tryLoadAndStore(ctx context.Context, path string, mode os.FileMode, fn LoadAndStoreFunc[T]) error {
+func (store *Store[T]) tryLoadAndStore(ctx context.Context, path string, mode os.FileMode, fn LoadAndStoreFunc[T]) (err error) {
+	ctx, span := store.startSpan(ctx, "LoadAndStore.attempt", path)
+	defer func() { endSpan(span, err) }()
+
 	var value T
 
 	canary, err := store.Load(ctx, path, &value)
 
 	if err := fn(ctx, &value, err); err != nil {
+		if err == ErrNoChange {
+			return nil
+		}
 		return err
 	}
 
@@ -191,27 +1117,429 @@ func (store *Store[T]) tryLoadAndStore(ctx context.Context, path string, mode os
 //
 // In effect, LoadAndStore has Compare-and-Swap semantics; the function is preferred
 // over Load and Store when the caller needs to update partially the contents of
-// the file.
-func (store *Store[T]) LoadAndStore(ctx context.Context, path string, mode os.FileMode, fn LoadAndStoreFunc[T]) error {
-	err := ErrRetry
-	for err == ErrRetry {
-		err = store.tryLoadAndStore(ctx, path, mode, fn)
+// the file. Retries are governed by WithRetryPolicy and WithOnRetry.
+func (store *Store[T]) LoadAndStore(ctx context.Context, path string, mode os.FileMode, fn LoadAndStoreFunc[T]) (err error) {
+	ctx, span := store.startSpan(ctx, "LoadAndStore", path)
+	defer func() { endSpan(span, err) }()
+
+	for attempt := 0; ; attempt++ {
+		if span != nil {
+			span.SetAttributes(attribute.Int("store.retries", attempt))
+		}
+		if attempt > 0 {
+			if err := store.retry(ctx, path, attempt); err != nil {
+				return err
+			}
+		}
+		if err := store.tryLoadAndStore(ctx, path, mode, fn); err != ErrRetry {
+			return err
+		}
+	}
+}
+
+// LoadAndStoreExclusive is like LoadAndStore, except that it holds the
+// exclusive lock of the file from before it loads until after it stores the
+// result of fn. This means that fn gets called exactly once and that the store
+// never needs to be retried, at the cost of blocking concurrent writers for
+// the duration of fn.
+//
+// LoadAndStoreExclusive is preferred over LoadAndStore under heavy write
+// contention, where the optimistic retries of LoadAndStore would otherwise
+// dominate.
+func (store *Store[T]) LoadAndStoreExclusive(ctx context.Context, path string, mode os.FileMode, fn LoadAndStoreFunc[T]) (err error) {
+	ctx, span := store.startSpan(ctx, "LoadAndStoreExclusive", path)
+	defer func() { endSpan(span, err) }()
+
+	var value T
+
+	lf, lst, loadErr, err := store.acquireAndLoad(ctx, path, mode, &value)
+	if err != nil {
+		return err
+	}
+	defer store.release(ctx, lf)
+
+	if err := fn(ctx, &value, loadErr); err != nil {
+		if err == ErrNoChange {
+			return nil
+		}
+		return err
+	}
+
+	write, err := store.writer(path, &value)
+	if err != nil {
+		return err
+	}
+	return store.commit(ctx, lf, lst, path, mode, write)
+}
+
+// open opens the file at path, or its lock file, with the backend of the
+// store. With WithNoFollow, it fails with ErrSymlink if the file is a symbolic
+// link.
+func (store *Store[T]) open(path string, flag int, mode os.FileMode) (File, error) {
+	if !store.opts.noFollow {
+		return store.fs().OpenFile(path, flag, mode)
+	}
+	f, err := store.fs().OpenFile(path, flag|oNoFollow, mode)
+	if isNoFollowError(err) {
+		return nil, &os.PathError{Op: "open", Path: path, Err: ErrSymlink}
+	}
+	return f, err
+}
+
+// lockPath returns the path of the lock file of path.
+func (store *Store[T]) lockPath(path string) string {
+	prefix, suffix := store.lockAffixes()
+	return store.auxPath(path, prefix, suffix)
+}
+
+// lockAffixes returns the prefix and suffix of the names of lock files.
+func (store *Store[T]) lockAffixes() (prefix, suffix string) {
+	suffix = store.opts.lockSuffix
+	if suffix == "" {
+		suffix = ".lock"
+		if store.opts.stableLockFile {
+			suffix = ".lockfile"
+		}
+	}
+	return store.opts.lockPrefix, suffix
+}
+
+// tempAffixes returns the prefix and suffix of the names of temporary files.
+func (store *Store[T]) tempAffixes() (prefix, suffix string) {
+	suffix = store.opts.tempSuffix
+	if suffix == "" {
+		suffix = ".tmp"
+	}
+	return store.opts.tempPrefix, suffix
+}
+
+// auxPath returns the path of an auxiliary file of path, named after path
+// with the specified prefix and suffix, and placed in the lock directory of
+// the store if any.
+func (store *Store[T]) auxPath(path, prefix, suffix string) string {
+	if store.opts.lockDir == "" && prefix == "" {
+		return path + suffix
+	}
+	dir, base := filepath.Split(path)
+	if store.opts.lockDir != "" {
+		dir = store.opts.lockDir
+	}
+	return filepath.Join(dir, prefix+base+suffix)
+}
+
+// checkSameDevice returns an error if the directories of the lock file and of
+// its destination are not on the same filesystem.
+func (store *Store[T]) checkSameDevice(lockPath, path string) error {
+	lst, err := store.fs().Lstat(filepath.Dir(lockPath))
+	if err != nil {
+		return err
+	}
+	pst, err := store.fs().Lstat(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	if lst.Dev != pst.Dev {
+		return &os.LinkError{Op: "rename", Old: lockPath, New: path, Err: ErrCrossDevice}
+	}
+	return nil
+}
+
+// tempName returns a new, random name for a temporary file of path.
+func (store *Store[T]) tempName(path string) (string, error) {
+	prefix, suffix := store.tempAffixes()
+
+	var random [8]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return "", err
+	}
+	return store.auxPath(path, prefix, "."+hex.EncodeToString(random[:])+suffix), nil
+}
+
+// openTemp creates a new temporary file for path.
+//
+// On systems that support it, the file is created without a name, so that it
+// never gets left behind should the process crash before the file gets
+// renamed to its destination. In that case, unnamed is true, and the file
+// must be given a name with linkTemp before being renamed.
+func (store *Store[T]) openTemp(path string, mode os.FileMode) (File, bool, error) {
+	if dir, ok := store.osDir(); ok {
+		f, err := openUnnamed(dir, filepath.Dir(store.auxPath(path, "", "")), mode)
+		switch {
+		case err == nil:
+			return f, true, nil
+		case !errors.Is(err, errUnnamedUnsupported):
+			return nil, false, err
+		}
+	}
+
+	for {
+		name, err := store.tempName(path)
+		if err != nil {
+			return nil, false, err
+		}
+		f, err := store.fs().OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		return f, false, err
+	}
+}
+
+// linkTemp gives a name to the unnamed temporary file f created by openTemp
+// for path, and returns the named file.
+func (store *Store[T]) linkTemp(f File, path string) (File, error) {
+	dir, _ := store.osDir()
+	osf, err := asOSFile("linkat", f)
+	if err != nil {
+		return nil, err
 	}
+
+	for {
+		name, err := store.tempName(path)
+		if err != nil {
+			return nil, err
+		}
+		err = linkUnnamed(dir, osf, name)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return namedFile{File: osf, name: name}, nil
+	}
+}
+
+// namedFile overrides the name of a file.
+type namedFile struct {
+	*os.File
+	name string
+}
+
+func (f namedFile) Name() string {
+	return f.name
+}
+
+// decodeOrRecover decodes the contents of the file at path from r into v,
+// like decode. If the contents are malformed and the store was configured
+// with WithRecovery, it decodes the recovery copy of the file instead, and
+// returns a CorruptError.
+func (store *Store[T]) decodeOrRecover(r io.Reader, path string, v *T) (migrated bool, err error) {
+	migrated, err = store.decodeMigrating(r, path, v)
+	var derr *DecodeError
+	if err == nil || !store.opts.recovery || !errors.As(err, &derr) {
+		return migrated, err
+	}
+
+	bak, berr := store.open(recoveryPath(path), os.O_RDONLY, 0)
+	if berr != nil {
+		return false, err
+	}
+	defer bak.Close()
+
+	var recovered T
+	if berr := store.decode(bak, recoveryPath(path), &recovered); berr != nil {
+		return false, err
+	}
+	*v = recovered
+	return false, &CorruptError{Path: path, Err: err, Recovered: v}
+}
+
+// decode decodes the contents of r into v. IO errors are returned as-is,
+// while any other decoding failure is wrapped in a DecodeError.
+func (store *Store[T]) decode(r io.Reader, path string, v *T) error {
+	_, err := store.decodeMigrating(r, path, v)
 	return err
 }
 
-func deleted(f *os.File) (ok bool, e error) {
-	fino, err := lstatIno(f, "")
+// decodeMigrating decodes r into v, like decode, and reports whether the
+// contents were migrated from an older schema version.
+func (store *Store[T]) decodeMigrating(r io.Reader, path string, v *T) (bool, error) {
+	if f, ok := r.(*os.File); ok && store.mappable() {
+		return false, store.decodeMapped(f, path, v)
+	}
+
+	rd := ioErrReader{r: r}
+	r, err := store.unwrapReader(&rd)
+	version := store.opts.schemaVersion
+	if err == nil && store.opts.versioned {
+		version, r, err = readSchemaVersion(r)
+	}
 	if err != nil {
-		return true, err
+		if rd.err != nil {
+			return false, rd.err
+		}
+		return false, &DecodeError{Path: path, Err: err}
 	}
 
-	pino, err := lstatIno(nil, f.Name())
-	switch {
-	case errors.Is(err, os.ErrNotExist):
+	dec := store.newDecoder(r)
+	if version != store.opts.schemaVersion {
+		migrate, ok := store.migrations[version]
+		if !ok || version > store.opts.schemaVersion {
+			return false, &DecodeError{Path: path, Err: fmt.Errorf("%w %d", ErrSchemaVersion, version)}
+		}
+		nv, err := migrate(dec.Decode)
+		if err != nil {
+			if rd.err != nil {
+				return false, rd.err
+			}
+			return false, &DecodeError{Path: path, Err: err}
+		}
+		*v = nv
 		return true, nil
-	case err != nil:
-		return true, err
 	}
-	return fino != pino, nil
+
+	if err := dec.Decode(v); err != nil {
+		if rd.err != nil {
+			return false, rd.err
+		}
+		return false, &DecodeError{Path: path, Err: err}
+	}
+	return false, nil
+}
+
+// encode encodes v into w. IO errors are returned as-is, while any other
+// encoding failure is wrapped in an EncodeError.
+func (store *Store[T]) encode(w io.Writer, path string, v *T) error {
+	wr := ioErrWriter{w: w}
+	ew, err := store.wrapWriter(&wr)
+	if err == nil {
+		err = store.newEncoder(ew).Encode(v)
+		if cerr := ew.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		if wr.err != nil && wr.err != ErrTooLarge {
+			return wr.err
+		}
+		return &EncodeError{Path: path, Err: err}
+	}
+	return nil
+}
+
+// wrapWriter returns a writer that transforms the encoded contents of a file
+// on their way to w, as configured by the options of the store. Closing the
+// returned writer flushes the transformed contents, but does not close w.
+//
+// Contents are prefixed with their schema version, compressed, encrypted, and
+// enveloped with their checksum, in that order.
+func (store *Store[T]) wrapWriter(w io.Writer) (io.WriteCloser, error) {
+	lw := &layeredWriter{Writer: w}
+	if store.opts.checksum {
+		ew, err := newEnvelopeWriter(lw.Writer)
+		if err != nil {
+			return nil, err
+		}
+		lw.push(ew)
+	}
+	if store.opts.keys != nil {
+		lw.push(newSealWriter(lw.Writer, store.opts.keys))
+	}
+	if store.opts.compressor != nil {
+		cw, err := store.opts.compressor.NewWriter(lw.Writer)
+		if err != nil {
+			return nil, err
+		}
+		lw.push(cw)
+	}
+	if store.opts.versioned {
+		if err := writeSchemaVersion(lw.Writer, store.opts.schemaVersion); err != nil {
+			return nil, err
+		}
+	}
+	return lw, nil
+}
+
+// unwrapReader returns a reader of the encoded contents of a file read from
+// r, undoing the transformations of wrapWriter.
+func (store *Store[T]) unwrapReader(r io.Reader) (io.Reader, error) {
+	var err error
+	if store.opts.generations {
+		if r, err = skipGeneration(r); err != nil {
+			return nil, err
+		}
+	}
+	if store.opts.checksum {
+		if r, err = openEnvelope(r); err != nil {
+			return nil, err
+		}
+	}
+	if store.opts.keys != nil {
+		if r, err = openSealed(r, store.opts.keys); err != nil {
+			return nil, err
+		}
+	}
+	if store.opts.compressor != nil {
+		if r, err = openCompressed(r, store.opts.compressor); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// layeredWriter writes to the innermost of a stack of transforming writers,
+// and closes them from the innermost to the outermost, so that each layer
+// flushes into the next.
+type layeredWriter struct {
+	io.Writer
+	layers []io.WriteCloser
+}
+
+func (w *layeredWriter) push(layer io.WriteCloser) {
+	w.layers = append(w.layers, layer)
+	w.Writer = layer
+}
+
+func (w *layeredWriter) Close() error {
+	for i := len(w.layers) - 1; i >= 0; i-- {
+		if err := w.layers[i].Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// limitedWriter writes to w until n bytes have been written, after which it
+// fails with ErrTooLarge.
+type limitedWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > w.n {
+		return 0, ErrTooLarge
+	}
+	n, err := w.w.Write(p)
+	w.n -= int64(n)
+	return n, err
+}
+
+// ioErrReader records the last IO error returned by the underlying reader.
+type ioErrReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *ioErrReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// ioErrWriter records the last IO error returned by the underlying writer.
+type ioErrWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *ioErrWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
 }
@@ -0,0 +1,103 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build !unix && !windows && !plan9
+// +build !unix,!windows,!plan9
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+)
+
+// resolve returns path as resolved relative to dir. The directory path is
+// made absolute so that resolving an already-resolved path is a no-op.
+func resolve(dir *os.File, path string) string {
+	if dir == nil || filepath.IsAbs(path) {
+		return path
+	}
+	dirname, err := filepath.Abs(dir.Name())
+	if err != nil {
+		dirname = dir.Name()
+	}
+	return filepath.Join(dirname, path)
+}
+
+// lstat returns the metadata of f if path is empty, or of path relative to
+// the directory f otherwise.
+//
+// There is no portable way to get the inode of a file, so we look for an Ino
+// field in the system-specific stat structure, and fall back to a combination
+// of the modification time and size of the file if there is none.
+func lstat(f *os.File, path string) (FileStat, error) {
+	var (
+		info os.FileInfo
+		err  error
+	)
+	if path == "" {
+		info, err = f.Stat()
+	} else {
+		info, err = os.Lstat(resolve(f, path))
+	}
+	if err != nil {
+		return FileStat{}, err
+	}
+
+	st := FileStat{Size: info.Size(), ModTime: info.ModTime(), Symlink: info.Mode()&os.ModeSymlink != 0}
+	if sys := reflect.Indirect(reflect.ValueOf(info.Sys())); sys.Kind() == reflect.Struct {
+		if dev := sys.FieldByName("Dev"); dev.IsValid() && dev.CanUint() {
+			st.Dev = dev.Uint()
+		}
+		if ino := sys.FieldByName("Ino"); ino.IsValid() && ino.CanUint() {
+			st.Ino = ino.Uint()
+			return st, nil
+		}
+	}
+	st.Ino = uint64(info.ModTime().UnixNano()) ^ uint64(info.Size()) | 1
+	return st, nil
+}
+
+// oNoFollow makes openShared fail with ELOOP if the file is a symbolic link.
+// Not all of these systems support O_NOFOLLOW, so openShared emulates it,
+// which is subject to races.
+const oNoFollow = 0x20000
+
+func openShared(dir *os.File, path string, flag int, mode os.FileMode) (*os.File, error) {
+	if flag&oNoFollow != 0 {
+		flag &^= oNoFollow
+		if info, err := os.Lstat(resolve(dir, path)); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return nil, &os.PathError{Op: "open", Path: path, Err: syscall.ELOOP}
+		}
+	}
+	return os.OpenFile(resolve(dir, path), flag, mode)
+}
+
+func rename(dir *os.File, f OSFile, to string) error {
+	return os.Rename(f.Name(), resolve(dir, to))
+}
+
+// renameNoReplace renames f to the path to, like rename, but fails with an
+// error wrapping os.ErrExist if to already exists.
+func renameNoReplace(dir *os.File, f OSFile, to string) error {
+	return linkNoReplace(dir, f, to)
+}
+
+// exchange atomically swaps the files at paths a and b, or returns
+// ErrUnsupported if the system cannot do so.
+func exchange(dir *os.File, a, b string) error {
+	return ErrUnsupported
+}
+
+func link(dir *os.File, oldpath, newpath string) error {
+	return os.Link(resolve(dir, oldpath), resolve(dir, newpath))
+}
+
+func unlink(dir *os.File, path string) error {
+	return os.Remove(resolve(dir, path))
+}
@@ -13,50 +13,238 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 
 	"golang.org/x/sys/unix"
 )
 
-// lstatIno tries to use statx with STATX_INO (which is less IO demanding than
-// regular stat), falling back to lstat/fstat if the syscall isn't implemented,
-// for instance if the kernel is too old.
-func lstatIno(f *os.File, path string) (uint64, error) {
+// oNoFollow makes openShared fail with ELOOP if the file is a symbolic link.
+const oNoFollow = unix.O_NOFOLLOW
+
+// lstat tries to use statx with STATX_INO|STATX_SIZE|STATX_MTIME (which is less IO
+// demanding than regular stat), falling back to fstatat/fstat if the syscall
+// isn't implemented, for instance if the kernel is too old.
+//
+// If path is empty, lstat returns the metadata of f. Otherwise, path is
+// resolved relative to the directory f, or the current working directory
+// if f is nil.
+func lstat(f *os.File, path string) (FileStat, error) {
 	dirfd := unix.AT_FDCWD
 	if f != nil {
 		dirfd = int(f.Fd())
 	}
+	if path != "" {
+		var (
+			release func()
+			err     error
+		)
+		dirfd, path, release, err = beneath(f, path)
+		if err != nil {
+			return FileStat{}, err
+		}
+		defer release()
+	}
 
 	var statx unix.Statx_t
-	err := unix.Statx(dirfd, path, unix.AT_EMPTY_PATH|unix.AT_SYMLINK_NOFOLLOW, unix.STATX_INO, &statx)
+	err := unix.Statx(dirfd, path, unix.AT_EMPTY_PATH|unix.AT_SYMLINK_NOFOLLOW, unix.STATX_TYPE|unix.STATX_INO|unix.STATX_SIZE|unix.STATX_MTIME, &statx)
 	switch {
 	case err == nil:
-		return statx.Ino, nil
+		return FileStat{
+			Dev:     unix.Mkdev(statx.Dev_major, statx.Dev_minor),
+			Ino:     statx.Ino,
+			Size:    int64(statx.Size),
+			ModTime: time.Unix(statx.Mtime.Sec, int64(statx.Mtime.Nsec)),
+			Symlink: uint32(statx.Mode)&unix.S_IFMT == unix.S_IFLNK,
+		}, nil
 	case errors.Is(err, unix.ENOSYS):
 		// Fallback to Lstat or Fstat if ENOSYS
 		var stat unix.Stat_t
 		if path == "" {
 			if err := unix.Fstat(dirfd, &stat); err != nil {
-				return 0, &os.PathError{Op: "fstat", Path: fmt.Sprintf("fd:%d", dirfd), Err: err}
+				return FileStat{}, &os.PathError{Op: "fstat", Path: fmt.Sprintf("fd:%d", dirfd), Err: err}
 			}
 		} else {
-			if err := unix.Lstat(path, &stat); err != nil {
-				return 0, &os.PathError{Op: "stat", Path: path, Err: err}
+			if err := unix.Fstatat(dirfd, path, &stat, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+				return FileStat{}, &os.PathError{Op: "fstatat", Path: path, Err: err}
 			}
 		}
-		return stat.Ino, nil
+		return FileStat{
+			Dev:     uint64(stat.Dev),
+			Ino:     stat.Ino,
+			Size:    stat.Size,
+			ModTime: time.Unix(int64(stat.Mtim.Sec), int64(stat.Mtim.Nsec)),
+			Symlink: stat.Mode&unix.S_IFMT == unix.S_IFLNK,
+		}, nil
 	default:
 		name := path
 		if name == "" {
 			name = fmt.Sprintf("fd:%d", dirfd)
 		}
-		return 0, &os.PathError{Op: "statx", Path: name, Err: err}
+		return FileStat{}, &os.PathError{Op: "statx", Path: name, Err: err}
+	}
+}
+
+func openShared(dir *os.File, path string, flag int, mode os.FileMode) (*os.File, error) {
+	if dir == nil {
+		return os.OpenFile(path, flag, mode)
+	}
+	fd, err := openat(dir, path, flag, uint32(mode.Perm()))
+	if err != nil {
+		return nil, &os.PathError{Op: "openat", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+// openat opens the file at path, resolved relative to dir, or the current
+// working directory if dir is nil. If dir is a Root, path is resolved beneath
+// it.
+func openat(dir *os.File, path string, flag int, perm uint32) (int, error) {
+	if dir == nil {
+		return unix.Openat(unix.AT_FDCWD, path, flag|unix.O_CLOEXEC, perm)
+	}
+	if isRoot(dir) {
+		return openBeneath(int(dir.Fd()), path, flag, perm)
+	}
+	return unix.Openat(int(dir.Fd()), path, flag|unix.O_CLOEXEC, perm)
+}
+
+// beneath returns the directory file descriptor and the name relative to it
+// at which to operate on path, resolved relative to dir, or the current
+// working directory if dir is nil.
+//
+// If dir is a Root, the parent directory of path is opened beneath it, so
+// that operations on the returned name cannot escape it, and release closes
+// that directory once the operation is done.
+func beneath(dir *os.File, path string) (dirfd int, name string, release func(), err error) {
+	release = func() {}
+	if dir == nil {
+		return unix.AT_FDCWD, path, release, nil
+	}
+	dirfd = int(dir.Fd())
+	if !isRoot(dir) {
+		return dirfd, path, release, nil
+	}
+
+	parent, name := filepath.Dir(path), filepath.Base(path)
+	if name == ".." {
+		return 0, "", nil, &os.PathError{Op: "openat2", Path: path, Err: ErrOutsideRoot}
+	}
+	if parent == "." {
+		return dirfd, name, release, nil
 	}
+	fd, err := openBeneath(dirfd, parent, unix.O_PATH|unix.O_DIRECTORY, 0)
+	if err != nil {
+		return 0, "", nil, &os.PathError{Op: "openat2", Path: parent, Err: err}
+	}
+	return fd, name, func() { unix.Close(fd) }, nil
 }
 
-func openShared(path string, flag int, mode os.FileMode) (*os.File, error) {
-	return os.OpenFile(path, flag, mode)
+func rename(dir *os.File, f OSFile, to string) error {
+	if dir == nil {
+		return os.Rename(f.Name(), to)
+	}
+	olddirfd, oldname, oldrelease, err := beneath(dir, f.Name())
+	if err != nil {
+		return err
+	}
+	defer oldrelease()
+	newdirfd, newname, newrelease, err := beneath(dir, to)
+	if err != nil {
+		return err
+	}
+	defer newrelease()
+
+	if err := unix.Renameat(olddirfd, oldname, newdirfd, newname); err != nil {
+		return &os.LinkError{Op: "renameat", Old: f.Name(), New: to, Err: err}
+	}
+	return nil
 }
 
-func rename(f OSFile, to string) error {
-	return os.Rename(f.Name(), to)
+// renameNoReplace renames f to the path to, like rename, but fails with an
+// error wrapping os.ErrExist if to already exists.
+func renameNoReplace(dir *os.File, f OSFile, to string) error {
+	olddirfd, oldname, oldrelease, err := beneath(dir, f.Name())
+	if err != nil {
+		return err
+	}
+	defer oldrelease()
+	newdirfd, newname, newrelease, err := beneath(dir, to)
+	if err != nil {
+		return err
+	}
+	defer newrelease()
+
+	err = unix.Renameat2(olddirfd, oldname, newdirfd, newname, unix.RENAME_NOREPLACE)
+	switch err {
+	case nil:
+		return nil
+	case unix.EINVAL, unix.ENOSYS:
+		// The kernel or the filesystem does not support RENAME_NOREPLACE.
+		return linkNoReplace(dir, f, to)
+	default:
+		return &os.LinkError{Op: "renameat2", Old: f.Name(), New: to, Err: err}
+	}
+}
+
+// exchange atomically swaps the files at paths a and b, or returns
+// ErrUnsupported if the filesystem cannot do so.
+func exchange(dir *os.File, a, b string) error {
+	adirfd, aname, arelease, err := beneath(dir, a)
+	if err != nil {
+		return err
+	}
+	defer arelease()
+	bdirfd, bname, brelease, err := beneath(dir, b)
+	if err != nil {
+		return err
+	}
+	defer brelease()
+
+	err = unix.Renameat2(adirfd, aname, bdirfd, bname, unix.RENAME_EXCHANGE)
+	switch err {
+	case nil:
+		return nil
+	case unix.EINVAL, unix.ENOSYS:
+		return ErrUnsupported
+	default:
+		return &os.LinkError{Op: "renameat2", Old: a, New: b, Err: err}
+	}
+}
+
+func link(dir *os.File, oldpath, newpath string) error {
+	if dir == nil {
+		return os.Link(oldpath, newpath)
+	}
+	olddirfd, oldname, oldrelease, err := beneath(dir, oldpath)
+	if err != nil {
+		return err
+	}
+	defer oldrelease()
+	newdirfd, newname, newrelease, err := beneath(dir, newpath)
+	if err != nil {
+		return err
+	}
+	defer newrelease()
+
+	if err := unix.Linkat(olddirfd, oldname, newdirfd, newname, 0); err != nil {
+		return &os.LinkError{Op: "linkat", Old: oldpath, New: newpath, Err: err}
+	}
+	return nil
+}
+
+func unlink(dir *os.File, path string) error {
+	if dir == nil {
+		return os.Remove(path)
+	}
+	dirfd, name, release, err := beneath(dir, path)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := unix.Unlinkat(dirfd, name, 0); err != nil {
+		return &os.PathError{Op: "unlinkat", Path: path, Err: err}
+	}
+	return nil
 }
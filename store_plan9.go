@@ -0,0 +1,105 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+func resolve(dir *os.File, path string) string {
+	if dir == nil || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir.Name(), path)
+}
+
+// lstat returns the status of the file at path, or of f itself if path is
+// empty. Plan 9 has neither inode numbers nor symbolic links: the path of the
+// Qid, which the file server keeps unique to the file, stands for the inode
+// number, and the server type and device stand for the device.
+func lstat(f *os.File, path string) (FileStat, error) {
+	var (
+		info os.FileInfo
+		err  error
+	)
+	if path == "" {
+		info, err = f.Stat()
+	} else {
+		info, err = os.Stat(resolve(f, path))
+	}
+	if err != nil {
+		return FileStat{}, err
+	}
+
+	st := FileStat{Size: info.Size(), ModTime: info.ModTime()}
+	if d, ok := info.Sys().(*syscall.Dir); ok {
+		st.Dev = uint64(d.Type)<<32 | uint64(d.Dev)
+		st.Ino = d.Qid.Path
+	}
+	return st, nil
+}
+
+// oNoFollow is ignored, since Plan 9 has no symbolic links.
+const oNoFollow = 0x20000
+
+// isNoFollowError returns false, since Plan 9 has no symbolic links.
+func isNoFollowError(err error) bool {
+	return false
+}
+
+func openShared(dir *os.File, path string, flag int, mode os.FileMode) (*os.File, error) {
+	return os.OpenFile(resolve(dir, path), flag&^oNoFollow, mode)
+}
+
+// rename renames f to the path to, which must be in the same directory, as
+// Plan 9 only renames files within their directory. Replacing an existing
+// file removes it first, which means that readers may briefly find no file
+// at all.
+func rename(dir *os.File, f OSFile, to string) error {
+	return os.Rename(f.Name(), resolve(dir, to))
+}
+
+// renameNoReplace is like rename, but fails if to already exists. Plan 9 has
+// no hard links to do this atomically with, but wstat refuses to rename a
+// file over an existing one, which makes it safe.
+func renameNoReplace(dir *os.File, f OSFile, to string) error {
+	newname := resolve(dir, to)
+	if filepath.Dir(f.Name()) != filepath.Dir(newname) {
+		return &os.LinkError{Op: "rename", Old: f.Name(), New: newname, Err: os.ErrInvalid}
+	}
+
+	var d syscall.Dir
+	d.Null()
+	d.Name = filepath.Base(newname)
+	buf := make([]byte, syscall.STATFIXLEN+len(d.Name))
+	n, err := d.Marshal(buf)
+	if err == nil {
+		err = syscall.Wstat(f.Name(), buf[:n])
+	}
+	if err != nil {
+		if _, serr := os.Stat(newname); serr == nil {
+			err = os.ErrExist
+		}
+		return &os.LinkError{Op: "rename", Old: f.Name(), New: newname, Err: err}
+	}
+	return nil
+}
+
+func exchange(dir *os.File, a, b string) error {
+	return ErrUnsupported
+}
+
+// link fails, since Plan 9 has no hard links.
+func link(dir *os.File, oldpath, newpath string) error {
+	return &os.LinkError{Op: "link", Old: resolve(dir, oldpath), New: resolve(dir, newpath), Err: ErrUnsupported}
+}
+
+func unlink(dir *os.File, path string) error {
+	return os.Remove(resolve(dir, path))
+}
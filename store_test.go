@@ -10,10 +10,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestStore(t *testing.T) {
@@ -78,7 +81,736 @@ func TestStore(t *testing.T) {
 		}
 	})
 
+	// Test whether ForceStore overwrites the file regardless of the canary
+	t.Run("ForceStore", func(t *testing.T) {
+		path := filepath.Join(dir, "force.json")
+
+		canary, _ := store.Load(context.Background(), path, &val)
+		if err := store.Store(context.Background(), path, 0777, &Test{Example: "concurrent"}, canary); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Store(context.Background(), path, 0777, &Test{Example: "stale"}, canary); err != ErrRetry {
+			t.Fatalf("expected ErrRetry, got %v", err)
+		}
+		if err := store.ForceStore(context.Background(), path, 0777, &Test{Example: "forced"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.Load(context.Background(), path, &val); err != nil {
+			t.Fatal(err)
+		}
+		if val.Example != "forced" {
+			t.Fatalf("expected forced, got %v", val.Example)
+		}
+	})
+
+	// Test whether codec errors are distinguishable from IO errors
+	t.Run("CodecErrors", func(t *testing.T) {
+		path := filepath.Join(dir, "malformed.json")
+		if err := os.WriteFile(path, []byte("{malformed"), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		var decodeErr *DecodeError
+		if _, err := store.Load(context.Background(), path, &val); !errors.As(err, &decodeErr) {
+			t.Fatalf("expected a DecodeError, got %T: %v", err, err)
+		}
+		if decodeErr.Path != path {
+			t.Fatalf("expected the DecodeError path to be %q, got %q", path, decodeErr.Path)
+		}
+
+		var encodeErr *EncodeError
+		anystore := New[any](json.NewEncoder, json.NewDecoder)
+		var unencodable any = make(chan int)
+		if err := anystore.ForceStore(context.Background(), path, 0777, &unencodable); !errors.As(err, &encodeErr) {
+			t.Fatalf("expected an EncodeError, got %T: %v", err, err)
+		}
+
+		var pathErr *os.PathError
+		if _, err := store.Load(context.Background(), dir, &val); errors.As(err, &decodeErr) || !errors.As(err, &pathErr) {
+			t.Fatalf("expected reading a directory to fail with a PathError, got %T: %v", err, err)
+		}
+	})
+
+	// Test whether values exceeding the maximum size are rejected
+	t.Run("MaxBytes", func(t *testing.T) {
+		store := New[Test](json.NewEncoder, json.NewDecoder, WithMaxBytes(32))
+		path := filepath.Join(dir, "maxbytes.json")
+
+		if err := store.ForceStore(context.Background(), path, 0777, &Test{Example: "small"}); err != nil {
+			t.Fatal(err)
+		}
+
+		large := Test{Example: "this value is way too large to fit"}
+		err := store.ForceStore(context.Background(), path, 0777, &large)
+		if !errors.Is(err, ErrTooLarge) {
+			t.Fatalf("expected ErrTooLarge, got %v", err)
+		}
+		var encodeErr *EncodeError
+		if !errors.As(err, &encodeErr) {
+			t.Fatalf("expected an EncodeError, got %T", err)
+		}
+
+		if _, err := store.Load(context.Background(), path, &val); err != nil {
+			t.Fatal(err)
+		}
+		if val.Example != "small" {
+			t.Fatalf("expected small, got %v", val.Example)
+		}
+	})
+
+	// Test whether durable stores work, both with and without a stable lock file
+	t.Run("Sync", func(t *testing.T) {
+		for _, opts := range [][]Option{
+			{WithSyncData(), WithSyncDir()},
+			{WithSyncData(), WithSyncDir(), WithStableLockFile()},
+		} {
+			store := New[Test](json.NewEncoder, json.NewDecoder, opts...)
+			path := filepath.Join(dir, "sync.json")
+
+			if err := store.ForceStore(context.Background(), path, 0777, &Test{Example: "synced"}); err != nil {
+				t.Fatal(err)
+			}
+			canary, err := store.Load(context.Background(), path, &val)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if val.Example != "synced" {
+				t.Fatalf("expected synced, got %v", val.Example)
+			}
+			if err := store.Rename(context.Background(), path, path+".renamed", canary, nil, false); err != nil && !errors.Is(err, os.ErrExist) {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	// Test whether lock and temporary files are created where configured
+	t.Run("LockDir", func(t *testing.T) {
+		datadir := filepath.Join(dir, "data")
+		lockdir := filepath.Join(dir, "locks")
+		for _, d := range []string{datadir, lockdir} {
+			if err := os.Mkdir(d, 0777); err != nil {
+				t.Fatal(err)
+			}
+		}
+		path := filepath.Join(datadir, "num")
+
+		stress(t, New[int](json.NewEncoder, json.NewDecoder, WithLockDir(lockdir)), path)
+
+		store := New[int](json.NewEncoder, json.NewDecoder,
+			WithLockDir(lockdir),
+			WithStableLockFile(),
+			WithLockFileName(".", ".lck"),
+			WithTempFileName(".", ".new"))
+		stress(t, store, filepath.Join(datadir, "stable"))
+
+		entries, err := os.ReadDir(datadir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if entry.Name() != "num" && entry.Name() != "stable" {
+				t.Errorf("unexpected file %q in data directory", entry.Name())
+			}
+		}
+		if _, err := os.Stat(filepath.Join(lockdir, ".stable.lck")); err != nil {
+			t.Fatal(err)
+		}
+
+		if runtime.GOOS == "linux" {
+			store := New[int](json.NewEncoder, json.NewDecoder, WithLockDir("/proc/self"))
+			if err := store.ForceStore(context.Background(), path, 0777, new(int)); !errors.Is(err, ErrCrossDevice) {
+				t.Fatalf("expected ErrCrossDevice, got %v", err)
+			}
+		}
+	})
+
+	// Test whether Delete honors canaries and removes lock files
+	t.Run("Delete", func(t *testing.T) {
+		path := filepath.Join(dir, "delete.json")
+
+		if err := store.ForceStore(context.Background(), path, 0777, &Test{Example: "delete"}); err != nil {
+			t.Fatal(err)
+		}
+		canary, err := store.Load(context.Background(), path, &val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Delete(context.Background(), path, nil); err != ErrRetry {
+			t.Fatalf("expected ErrRetry, got %v", err)
+		}
+		if err := store.Delete(context.Background(), path, canary); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range []string{path, path + ".lock"} {
+			if _, err := os.Stat(p); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("expected %s to be removed, got %v", p, err)
+			}
+		}
+
+		err = store.LoadAndStore(context.Background(), path, 0777, func(ctx context.Context, val *Test, err error) error {
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("expected ErrNotExist, got %v", err)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// Test whether LoadIfChanged skips unchanged files
+	t.Run("LoadIfChanged", func(t *testing.T) {
+		for _, store := range []*Store[Test]{
+			store,
+			New[Test](json.NewEncoder, json.NewDecoder, WithCanaryFunc(func(v *Test) any { return v.Example })),
+		} {
+			path := filepath.Join(dir, "ifchanged.json")
+
+			if err := store.ForceStore(context.Background(), path, 0777, &Test{Example: "first"}); err != nil {
+				t.Fatal(err)
+			}
+			canary, err := store.Load(context.Background(), path, &val)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			val = Test{Example: "untouched"}
+			if _, err := store.LoadIfChanged(context.Background(), path, canary, &val); err != ErrNotModified {
+				t.Fatalf("expected ErrNotModified, got %v", err)
+			}
+			if val.Example != "untouched" {
+				t.Fatalf("expected untouched, got %v", val.Example)
+			}
+
+			if err := store.ForceStore(context.Background(), path, 0777, &Test{Example: "second"}); err != nil {
+				t.Fatal(err)
+			}
+			newCanary, err := store.LoadIfChanged(context.Background(), path, canary, &val)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if val.Example != "second" {
+				t.Fatalf("expected second, got %v", val.Example)
+			}
+			if newCanary == canary {
+				t.Fatal("expected canary to change")
+			}
+		}
+	})
+
+	// Test whether WithBackups keeps previous versions
+	t.Run("Backups", func(t *testing.T) {
+		for _, opts := range [][]Option{
+			{WithBackups(2)},
+			{WithBackups(2), WithStableLockFile()},
+		} {
+			store := New[Test](json.NewEncoder, json.NewDecoder, opts...)
+			path := filepath.Join(t.TempDir(), "backups.json")
+
+			for _, example := range []string{"first", "second", "third", "fourth"} {
+				if err := store.ForceStore(context.Background(), path, 0777, &Test{Example: example}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for k, expected := range []string{"fourth", "third", "second"} {
+				if err := store.LoadVersion(context.Background(), path, k, &val); err != nil {
+					t.Fatal(err)
+				}
+				if val.Example != expected {
+					t.Fatalf("expected version %d to be %s, got %s", k, expected, val.Example)
+				}
+			}
+			if err := store.LoadVersion(context.Background(), path, 3, &val); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("expected ErrNotExist, got %v", err)
+			}
+		}
+	})
+
+	// Test whether WithRecovery falls back to the recovery copy
+	t.Run("Recovery", func(t *testing.T) {
+		store := New[Test](json.NewEncoder, json.NewDecoder, WithRecovery())
+		path := filepath.Join(t.TempDir(), "recovery.json")
+
+		if err := store.ForceStore(context.Background(), path, 0777, &Test{Example: "good"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(`{"Example": "tru`), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		val = Test{}
+		canary, err := store.Load(context.Background(), path, &val)
+		if !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("expected ErrCorrupt, got %v", err)
+		}
+		var derr *DecodeError
+		if !errors.As(err, &derr) {
+			t.Fatalf("expected a DecodeError, got %v", err)
+		}
+		if val.Example != "good" {
+			t.Fatalf("expected good, got %s", val.Example)
+		}
+
+		// Storing the recovered value repairs the file.
+		if err := store.Store(context.Background(), path, 0777, &val, canary); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Load(context.Background(), path, &val); err != nil {
+			t.Fatal(err)
+		}
+
+		// Without a recovery copy, the decode error is returned as-is.
+		os.Remove(path + ".bak")
+		if err := os.WriteFile(path, []byte(`{"Example": "tru`), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Load(context.Background(), path, &val); errors.Is(err, ErrCorrupt) || !errors.As(err, &derr) {
+			t.Fatalf("expected a DecodeError, got %v", err)
+		}
+	})
+
+	// Test whether returning ErrNoChange from LoadAndStore skips the store
+	t.Run("NoChange", func(t *testing.T) {
+		store := New[Test](json.NewEncoder, json.NewDecoder, WithBackups(1))
+		path := filepath.Join(t.TempDir(), "nochange.json")
+
+		if err := store.ForceStore(context.Background(), path, 0777, &Test{Example: "unchanged"}); err != nil {
+			t.Fatal(err)
+		}
+		before, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		readOnly := func(ctx context.Context, val *Test, err error) error {
+			if err != nil {
+				return err
+			}
+			if val.Example != "unchanged" {
+				t.Errorf("expected unchanged, got %s", val.Example)
+			}
+			val.Example = "discarded"
+			return ErrNoChange
+		}
+		if err := store.LoadAndStore(context.Background(), path, 0777, readOnly); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.LoadAndStoreExclusive(context.Background(), path, 0777, readOnly); err != nil {
+			t.Fatal(err)
+		}
+
+		after, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(before, after) {
+			t.Fatal("expected the file not to be rewritten")
+		}
+		if _, err := os.Stat(path + ".1"); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected no backup to be made, got %v", err)
+		}
+	})
+
+	// Test whether StoreExclusive only creates missing files
+	t.Run("StoreExclusive", func(t *testing.T) {
+		for _, opts := range [][]Option{
+			nil,
+			{WithStableLockFile()},
+		} {
+			store := New[Test](json.NewEncoder, json.NewDecoder, opts...)
+			path := filepath.Join(t.TempDir(), "claim.json")
+
+			const writers = 8
+			errs := make(chan error, writers)
+			for i := 0; i < writers; i++ {
+				go func(i int) {
+					errs <- store.StoreExclusive(context.Background(), path, 0666, &Test{Example: fmt.Sprint(i)})
+				}(i)
+			}
+			var winners int
+			for i := 0; i < writers; i++ {
+				switch err := <-errs; {
+				case err == nil:
+					winners++
+				case !errors.Is(err, os.ErrExist):
+					t.Fatalf("expected ErrExist, got %v", err)
+				}
+			}
+			if winners != 1 {
+				t.Fatalf("expected exactly one writer to succeed, got %d", winners)
+			}
+			if _, err := store.Load(context.Background(), path, &val); err != nil {
+				t.Fatal(err)
+			}
+
+			// Files created behind the back of the lock are not replaced
+			// either.
+			lf, err := os.Create(path + ".new")
+			if err != nil {
+				t.Fatal(err)
+			}
+			lf.Close()
+			if err := renameNoReplace(nil, lf, path); !errors.Is(err, os.ErrExist) {
+				t.Fatalf("expected ErrExist, got %v", err)
+			}
+		}
+	})
+
+	// Test whether WithNoFollow refuses symbolic links
+	t.Run("NoFollow", func(t *testing.T) {
+		store := New[Test](json.NewEncoder, json.NewDecoder, WithNoFollow())
+		dir := t.TempDir()
+
+		victim := filepath.Join(dir, "victim")
+		if err := os.WriteFile(victim, []byte(`{"Example": "victim"}`), 0666); err != nil {
+			t.Fatal(err)
+		}
+		link := filepath.Join(dir, "link.json")
+		if err := os.Symlink(victim, link); err != nil {
+			t.Skip(err)
+		}
+
+		if _, err := store.Load(context.Background(), link, &val); !errors.Is(err, ErrSymlink) {
+			t.Fatalf("expected ErrSymlink, got %v", err)
+		}
+		if err := store.ForceStore(context.Background(), link, 0666, &Test{Example: "pwned"}); !errors.Is(err, ErrSymlink) {
+			t.Fatalf("expected ErrSymlink, got %v", err)
+		}
+
+		// A planted lock file must not be written through either.
+		path := filepath.Join(dir, "state.json")
+		if err := os.Symlink(victim, path+".lock"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.ForceStore(context.Background(), path, 0666, &Test{Example: "pwned"}); !errors.Is(err, ErrSymlink) {
+			t.Fatalf("expected ErrSymlink, got %v", err)
+		}
+
+		data, err := os.ReadFile(victim)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != `{"Example": "victim"}` {
+			t.Fatalf("expected the target of the link to be untouched, got %s", data)
+		}
+
+		// Regular files are unaffected.
+		os.Remove(path + ".lock")
+		if err := store.ForceStore(context.Background(), path, 0666, &Test{Example: "regular"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Load(context.Background(), path, &val); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// Test whether Rename moves files atomically
+	t.Run("Rename", func(t *testing.T) {
+		from := filepath.Join(dir, "rename-from.json")
+		to := filepath.Join(dir, "rename-to.json")
+
+		if err := store.ForceStore(context.Background(), from, 0777, &Test{Example: "from"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.ForceStore(context.Background(), to, 0777, &Test{Example: "to"}); err != nil {
+			t.Fatal(err)
+		}
+
+		fromCanary, err := store.Load(context.Background(), from, &val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		toCanary, err := store.Load(context.Background(), to, &val)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.Rename(context.Background(), from, to, fromCanary, nil, false); !errors.Is(err, os.ErrExist) {
+			t.Fatalf("expected ErrExist, got %v", err)
+		}
+		if err := store.Rename(context.Background(), from, to, fromCanary, nil, true); err != ErrRetry {
+			t.Fatalf("expected ErrRetry, got %v", err)
+		}
+		if err := store.ForceStore(context.Background(), from, 0777, &Test{Example: "from"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Rename(context.Background(), from, to, fromCanary, toCanary, true); err != ErrRetry {
+			t.Fatalf("expected ErrRetry, got %v", err)
+		}
+		if fromCanary, err = store.Load(context.Background(), from, &val); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Rename(context.Background(), from, to, fromCanary, toCanary, true); err != nil {
+			t.Fatal(err)
+		}
+
+		if toCanary, err = store.Load(context.Background(), to, &val); err != nil {
+			t.Fatal(err)
+		}
+		if val.Example != "from" {
+			t.Fatalf("expected from, got %v", val.Example)
+		}
+		if _, err := store.Load(context.Background(), from, &val); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected ErrNotExist, got %v", err)
+		}
+		if err := store.Rename(context.Background(), from, to, nil, toCanary, true); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected ErrNotExist, got %v", err)
+		}
+	})
+
+	// Test whether Rename and Swap lock paths in the same order as
+	// transactions
+	t.Run("LockOrder", func(t *testing.T) {
+		store := New[int](json.NewEncoder, json.NewDecoder)
+		dir := t.TempDir()
+		// Compared raw, ./b sorts before a, unlike once cleaned.
+		a, b := filepath.Join(dir, "a"), dir+string(filepath.Separator)+"."+string(filepath.Separator)+"b"
+		txn := NewTxn(store, t.TempDir())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				err := txn.Run(ctx, []string{b, a}, 0666, func(ctx context.Context, vals []*int, errs []error) error {
+					*vals[0]++
+					return nil
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+		for i := 0; i < 1000; i++ {
+			var v int
+			canary, err := store.Load(ctx, b, &v)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				t.Fatal(err)
+			}
+			err = store.Rename(ctx, b, a, canary, nil, true)
+			if err != nil && err != ErrRetry && !errors.Is(err, os.ErrNotExist) {
+				t.Fatal(err)
+			}
+			if err := store.Swap(ctx, b, a); err != nil && !errors.Is(err, os.ErrNotExist) {
+				t.Fatal(err)
+			}
+		}
+		wg.Wait()
+	})
+
+	// Test whether Swap exchanges files atomically
+	t.Run("Swap", func(t *testing.T) {
+		blue := filepath.Join(dir, "swap-blue.json")
+		green := filepath.Join(dir, "swap-green.json")
+
+		if err := store.ForceStore(context.Background(), blue, 0777, &Test{Example: "blue"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.ForceStore(context.Background(), green, 0777, &Test{Example: "green"}); err != nil {
+			t.Fatal(err)
+		}
+
+		expect := func(path, expected string) {
+			t.Helper()
+			if _, err := store.Load(context.Background(), path, &val); err != nil {
+				t.Fatal(err)
+			}
+			if val.Example != expected {
+				t.Fatalf("expected %v, got %v", expected, val.Example)
+			}
+		}
+
+		if err := store.Swap(context.Background(), blue, green); err != nil {
+			t.Fatal(err)
+		}
+		expect(blue, "green")
+		expect(green, "blue")
+
+		// Exercise the fallback of systems without an atomic exchange.
+		if err := store.swapLinked(blue, green); err != nil {
+			t.Fatal(err)
+		}
+		expect(blue, "blue")
+		expect(green, "green")
+
+		// If the second rename of the fallback fails, blue gets its former
+		// contents back.
+		failing := New[Test](json.NewEncoder, json.NewDecoder, WithBackend(renameFailer{Backend: OSBackend(nil, FlockLocks), to: green}))
+		if err := failing.swapLinked(blue, green); !errors.Is(err, errRenameFailed) {
+			t.Fatalf("expected %v, got %v", errRenameFailed, err)
+		}
+		expect(blue, "blue")
+		expect(green, "green")
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if _, isTemp := store.tempBase(entry.Name()); isTemp {
+				t.Fatalf("expected no temporary file to be left behind, got %v", entry.Name())
+			}
+		}
+
+		missing := filepath.Join(dir, "swap-missing.json")
+		if err := store.Swap(context.Background(), blue, missing); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected ErrNotExist, got %v", err)
+		}
+		if err := store.swapLinked(blue, missing); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected ErrNotExist, got %v", err)
+		}
+		expect(blue, "blue")
+	})
+
+	// Test whether canaries derived from the value are honored
+	t.Run("CanaryFunc", func(t *testing.T) {
+		type Revisioned struct {
+			Revision int
+			Example  string
+		}
+
+		store := New[Revisioned](json.NewEncoder, json.NewDecoder, WithCanaryFunc(func(v *Revisioned) any {
+			return v.Revision
+		}))
+		path := filepath.Join(dir, "revisioned.json")
+
+		if err := store.Store(context.Background(), path, 0777, &Revisioned{Revision: 1}, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		var val Revisioned
+		canary, err := store.Load(context.Background(), path, &val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if canary != 1 {
+			t.Fatalf("expected canary to be 1, got %v", canary)
+		}
+
+		// Rewriting the file with the same revision keeps the canary valid,
+		// even though the file itself was replaced.
+		if err := store.ForceStore(context.Background(), path, 0777, &Revisioned{Revision: 1, Example: "same"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Store(context.Background(), path, 0777, &Revisioned{Revision: 2}, canary); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Store(context.Background(), path, 0777, &Revisioned{Revision: 3}, canary); err != ErrRetry {
+			t.Fatalf("expected ErrRetry, got %v", err)
+		}
+	})
+
+	t.Run("FileCanary", func(t *testing.T) {
+		store := New[Test](json.NewEncoder, json.NewDecoder)
+		path := filepath.Join(dir, "filecanary.json")
+
+		if err := store.Store(context.Background(), path, 0777, &Test{Example: "a"}, nil); err != nil {
+			t.Fatal(err)
+		}
+		var val Test
+		canary, err := store.Load(context.Background(), path, &val)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Canaries survive being persisted.
+		data, err := json.Marshal(canary)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var persisted FileCanary
+		if err := json.Unmarshal(data, &persisted); err != nil {
+			t.Fatal(err)
+		}
+		if persisted != canary {
+			t.Fatalf("expected %+v, got %+v", canary, persisted)
+		}
+
+		// Rewriting the file in place keeps its inode, like a new file
+		// reusing the inode number of the old one.
+		if err := os.WriteFile(path, []byte(`{"Example":"bb"}`), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Store(context.Background(), path, 0777, &Test{Example: "c"}, persisted); err != ErrRetry {
+			t.Fatalf("expected ErrRetry, got %v", err)
+		}
+	})
+
+	// Test whether a store bound to a directory resolves paths relative to it
+	t.Run("AlternateDataStream", func(t *testing.T) {
+		store := New[Test](json.NewEncoder, json.NewDecoder, WithAlternateDataStream())
+		path := filepath.Join(t.TempDir(), "ads.json")
+
+		// The first store creates the file from a sibling file, and the
+		// second one replaces it through its stream where supported.
+		for _, example := range []string{"a", "b"} {
+			if err := store.ForceStore(context.Background(), path, 0777, &Test{Example: example}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var val Test
+		if _, err := store.Load(context.Background(), path, &val); err != nil {
+			t.Fatal(err)
+		}
+		if val.Example != "b" {
+			t.Fatalf("expected %q, got %q", "b", val.Example)
+		}
+
+		entries, err := os.ReadDir(filepath.Dir(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("expected a single file, got %d entries", len(entries))
+		}
+	})
+
+	t.Run("InDir", func(t *testing.T) {
+		d, err := os.Open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Close()
+
+		store := store.InDir(d)
+
+		err = store.LoadAndStore(context.Background(), "indir.json", 0777, func(ctx context.Context, val *Test, _ error) error {
+			val.Example = "indir"
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var val Test
+		if _, err := store.Load(context.Background(), "indir.json", &val); err != nil {
+			t.Fatal(err)
+		}
+		if val.Example != "indir" {
+			t.Fatalf("expected indir, got %v", val.Example)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "indir.json")); err != nil {
+			t.Fatal("expected LoadAndStore to have created indir.json in the directory, got error", err)
+		}
+	})
+
 	t.Run("Stress", func(t *testing.T) {
+		stress(t, New[int](json.NewEncoder, json.NewDecoder), filepath.Join(dir, "num"))
+	})
+
+	t.Run("StressCanaryFunc", func(t *testing.T) {
+		canary := func(val *int) any { return *val }
+		stress(t, New[int](json.NewEncoder, json.NewDecoder, WithCanaryFunc(canary)), filepath.Join(dir, "num-canary"))
+	})
+
+	t.Run("StressExclusive", func(t *testing.T) {
+		path := filepath.Join(dir, "num-exclusive")
 		store := New[int](json.NewEncoder, json.NewDecoder)
 
 		const total = 1000
@@ -88,25 +820,88 @@ func TestStore(t *testing.T) {
 			wait.Add(1)
 			go func() {
 				defer wait.Done()
-				err := store.LoadAndStore(context.Background(), filepath.Join(dir, "num"), 0777, func(ctx context.Context, val *int, err error) error {
+				calls := 0
+				err := store.LoadAndStoreExclusive(context.Background(), path, 0777, func(ctx context.Context, val *int, err error) error {
+					calls++
 					*val++
 					return nil
 				})
 				if err != nil {
 					t.Error(err)
 				}
+				if calls != 1 {
+					t.Errorf("expected the callback to be called once, got %d calls", calls)
+				}
 			}()
 		}
 		wait.Wait()
 
 		var num int
-		if _, err := store.Load(context.Background(), filepath.Join(dir, "num"), &num); err != nil {
+		if _, err := store.Load(context.Background(), path, &num); err != nil {
 			t.Fatal(err)
 		}
 		if num != total {
 			t.Fatalf("expected total to be %d, got %d", total, num)
 		}
 	})
+
+	t.Run("StressStableLockFile", func(t *testing.T) {
+		path := filepath.Join(dir, "num-stable")
+		stress(t, New[int](json.NewEncoder, json.NewDecoder, WithStableLockFile()), path)
+
+		matches, err := filepath.Glob(path + ".*.tmp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != 0 {
+			t.Fatalf("expected no leftover temporary files, got %v", matches)
+		}
+	})
+}
+
+func stress(t *testing.T, store *Store[int], path string) {
+	t.Helper()
+
+	const total = 1000
+
+	var wait sync.WaitGroup
+	for i := 0; i < total; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			err := store.LoadAndStore(context.Background(), path, 0777, func(ctx context.Context, val *int, err error) error {
+				*val++
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wait.Wait()
+
+	var num int
+	if _, err := store.Load(context.Background(), path, &num); err != nil {
+		t.Fatal(err)
+	}
+	if num != total {
+		t.Fatalf("expected total to be %d, got %d", total, num)
+	}
+}
+
+var errRenameFailed = errors.New("rename failed")
+
+// renameFailer is a backend that fails to rename files to the path to.
+type renameFailer struct {
+	Backend
+	to string
+}
+
+func (b renameFailer) Rename(f File, newname string) error {
+	if newname == b.to {
+		return &os.LinkError{Op: "rename", Old: f.Name(), New: newname, Err: errRenameFailed}
+	}
+	return b.Backend.Rename(f, newname)
 }
 
 func TestRename(t *testing.T) {
@@ -114,21 +909,85 @@ func TestRename(t *testing.T) {
 
 	// The process should have an open file handle on the destination
 	dir := t.TempDir()
-	f0, err := openShared(filepath.Join(dir, "new"), os.O_RDWR|os.O_CREATE, 0)
+	f0, err := openShared(nil, filepath.Join(dir, "new"), os.O_RDWR|os.O_CREATE, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer f0.Close()
 
 	// Open the original file, then rename it to the destination
-	f, err := openShared(filepath.Join(dir, "orig"), os.O_RDWR|os.O_CREATE, 0)
+	f, err := openShared(nil, filepath.Join(dir, "orig"), os.O_RDWR|os.O_CREATE, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer f.Close()
 
-	if err := rename(f, filepath.Join(dir, "new")); err != nil {
+	if err := rename(nil, f, filepath.Join(dir, "new")); err != nil {
 		t.Fatal(err)
 	}
 	f.Close()
 }
+
+func BenchmarkStore(b *testing.B) {
+
+	type Test struct {
+		Example string
+	}
+
+	store := New[Test](json.NewEncoder, json.NewDecoder)
+	val := Test{Example: "benchmark"}
+
+	b.Run("Sequential", func(b *testing.B) {
+		path := filepath.Join(b.TempDir(), "bench.json")
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := store.ForceStore(context.Background(), path, 0666, &val); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Parallel", func(b *testing.B) {
+		path := filepath.Join(b.TempDir(), "bench.json")
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if err := store.ForceStore(context.Background(), path, 0666, &val); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
+
+func BenchmarkLoadAndStore(b *testing.B) {
+
+	store := New[int](json.NewEncoder, json.NewDecoder)
+
+	incr := func(ctx context.Context, val *int, err error) error {
+		*val++
+		return nil
+	}
+
+	b.Run("Sequential", func(b *testing.B) {
+		path := filepath.Join(b.TempDir(), "bench.json")
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := store.LoadAndStore(context.Background(), path, 0666, incr); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Parallel", func(b *testing.B) {
+		path := filepath.Join(b.TempDir(), "bench.json")
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if err := store.LoadAndStore(context.Background(), path, 0666, incr); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
@@ -12,28 +12,89 @@ package store
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"golang.org/x/sys/unix"
 )
 
-func lstatIno(f *os.File, path string) (uint64, error) {
+// oNoFollow makes openShared fail with ELOOP if the file is a symbolic link.
+const oNoFollow = unix.O_NOFOLLOW
+
+// lstat returns the metadata of f if path is empty. Otherwise, path is
+// resolved relative to the directory f, or the current working directory
+// if f is nil.
+func lstat(f *os.File, path string) (FileStat, error) {
 	var stat unix.Stat_t
-	if path == "" {
+	switch {
+	case path == "":
 		if err := unix.Fstat(int(f.Fd()), &stat); err != nil {
-			return 0, &os.PathError{Op: "fstat", Path: fmt.Sprintf("fd:%d", int(f.Fd())), Err: err}
+			return FileStat{}, &os.PathError{Op: "fstat", Path: fmt.Sprintf("fd:%d", int(f.Fd())), Err: err}
 		}
-	} else {
+	case f == nil:
 		if err := unix.Lstat(path, &stat); err != nil {
-			return 0, &os.PathError{Op: "stat", Path: path, Err: err}
+			return FileStat{}, &os.PathError{Op: "stat", Path: path, Err: err}
+		}
+	default:
+		if err := unix.Fstatat(int(f.Fd()), path, &stat, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			return FileStat{}, &os.PathError{Op: "fstatat", Path: path, Err: err}
 		}
 	}
-	return stat.Ino, nil
+	return FileStat{
+		Dev:     uint64(stat.Dev),
+		Ino:     uint64(stat.Ino),
+		Size:    stat.Size,
+		ModTime: time.Unix(int64(stat.Mtim.Sec), int64(stat.Mtim.Nsec)),
+		Symlink: stat.Mode&unix.S_IFMT == unix.S_IFLNK,
+	}, nil
 }
 
-func openShared(path string, flag int, mode os.FileMode) (*os.File, error) {
-	return os.OpenFile(path, flag, mode)
+func openShared(dir *os.File, path string, flag int, mode os.FileMode) (*os.File, error) {
+	if dir == nil {
+		return os.OpenFile(path, flag, mode)
+	}
+	fd, err := unix.Openat(int(dir.Fd()), path, flag|unix.O_CLOEXEC, uint32(mode.Perm()))
+	if err != nil {
+		return nil, &os.PathError{Op: "openat", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(fd), path), nil
 }
 
-func rename(f OSFile, to string) error {
-	return os.Rename(f.Name(), to)
+func rename(dir *os.File, f OSFile, to string) error {
+	if dir == nil {
+		return os.Rename(f.Name(), to)
+	}
+	dirfd := int(dir.Fd())
+	if err := unix.Renameat(dirfd, f.Name(), dirfd, to); err != nil {
+		return &os.LinkError{Op: "renameat", Old: f.Name(), New: to, Err: err}
+	}
+	return nil
+}
+
+// renameNoReplace renames f to the path to, like rename, but fails with an
+// error wrapping os.ErrExist if to already exists.
+func renameNoReplace(dir *os.File, f OSFile, to string) error {
+	return linkNoReplace(dir, f, to)
+}
+
+// exchange atomically swaps the files at paths a and b, or returns
+// ErrUnsupported if the system cannot do so.
+func exchange(dir *os.File, a, b string) error {
+	return ErrUnsupported
+}
+
+func link(dir *os.File, oldpath, newpath string) error {
+	if dir == nil {
+		return os.Link(oldpath, newpath)
+	}
+	return linkat(dir, oldpath, newpath)
+}
+
+func unlink(dir *os.File, path string) error {
+	if dir == nil {
+		return os.Remove(path)
+	}
+	if err := unix.Unlinkat(int(dir.Fd()), path, 0); err != nil {
+		return &os.PathError{Op: "unlinkat", Path: path, Err: err}
+	}
+	return nil
 }
@@ -8,8 +8,12 @@ package store
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"syscall"
+	"time"
 	"unsafe"
 
 	"golang.org/x/sys/windows"
@@ -38,37 +42,165 @@ func (info *fileRenameInfoEx) Bytes() []byte {
 	return data.Bytes()
 }
 
-func rename(f OSFile, to string) error {
+// resolve returns path as resolved relative to dir. Windows has no notion of
+// directory-relative operations through the Win32 API, so we simply join
+// the paths.
+func resolve(dir *os.File, path string) string {
+	if dir == nil || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir.Name(), path)
+}
+
+var procReplaceFileW = windows.MustLoadDLL("kernel32.dll").MustFindProc("ReplaceFileW")
+
+// Antivirus and indexing services briefly open files without sharing them,
+// which makes opening and renaming them fail with sharing violations.
+// retrySharing retries such operations with an exponential backoff, up to
+// sharingAttempts times.
+const (
+	sharingAttempts   = 8
+	sharingMinBackoff = time.Millisecond
+)
+
+func retrySharing(fn func() error) error {
+	backoff := sharingMinBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if attempt == sharingAttempts || !(errors.Is(err, windows.ERROR_SHARING_VIOLATION) || errors.Is(err, windows.ERROR_UNABLE_TO_REMOVE_REPLACED)) {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func rename(dir *os.File, f OSFile, to string) error {
 
 	// os.Rename does not work, because it doesn't replace the destination
 	// atomically, nor does it replace it when the destination is already
 	// opened by another process, defeating the whole purpose of rename.
 
-	u16path, err := windows.UTF16FromString(to)
+	return renameFallback(dir, f, to, true)
+}
+
+// renameNoReplace renames f to the path to, like rename, but fails with an
+// error wrapping os.ErrExist if to already exists.
+func renameNoReplace(dir *os.File, f OSFile, to string) error {
+	return renameFallback(dir, f, to, false)
+}
+
+// renameFallback renames f to the path to, replacing it if replace is set,
+// with the most atomic method that the system supports for the file:
+//
+//   - FileRenameInfoEx with POSIX semantics replaces files even while other
+//     processes have them open, but requires Windows 10 1607 or later, and
+//     NTFS.
+//   - FileRenameInfo replaces files atomically, but not while they are open.
+//   - ReplaceFile replaces files that are open, as long as they are shared
+//     for deletion, but not atomically.
+//
+// Files that are open without being shared for deletion cannot be replaced
+// at all, so renameFallback retries for a little while on sharing violations.
+func renameFallback(dir *os.File, f OSFile, to string, replace bool) error {
+	var flags uint32
+	if replace {
+		flags = windows.FILE_RENAME_REPLACE_IF_EXISTS
+	}
+
+	return retrySharing(func() error {
+		err := renameInfo(dir, f, to, windows.FileRenameInfoEx, flags|windows.FILE_RENAME_POSIX_SEMANTICS)
+		if errors.Is(err, windows.ERROR_INVALID_PARAMETER) || errors.Is(err, windows.ERROR_NOT_SUPPORTED) || errors.Is(err, windows.ERROR_INVALID_FUNCTION) {
+			// FileRenameInfo lays out its ReplaceIfExists boolean where
+			// FileRenameInfoEx has its flags.
+			err = renameInfo(dir, f, to, windows.FileRenameInfo, flags)
+			if replace && errors.Is(err, windows.ERROR_ACCESS_DENIED) {
+				err = replaceFile(dir, f, to)
+			}
+		}
+		return err
+	})
+}
+
+// renameInfo renames f to the path to with SetFileInformationByHandle, the
+// specified information class, and FILE_RENAME_* flags.
+func renameInfo(dir *os.File, f OSFile, to string, class uint32, flags uint32) error {
+	u16path, err := windows.UTF16FromString(resolve(dir, to))
 	if err != nil {
 		return &os.PathError{Op: "UTF16FromString", Path: to, Err: err}
 	}
 
 	info := fileRenameInfoEx{
-		Flags:    windows.FILE_RENAME_REPLACE_IF_EXISTS | windows.FILE_RENAME_POSIX_SEMANTICS,
+		Flags:    flags,
 		FileName: u16path,
 	}
 	bytes := info.Bytes()
 
-	err = windows.SetFileInformationByHandle(windows.Handle(f.Fd()), windows.FileRenameInfoEx, (*byte)(unsafe.Pointer(&bytes[0])), uint32(len(bytes)))
+	err = windows.SetFileInformationByHandle(windows.Handle(f.Fd()), class, (*byte)(unsafe.Pointer(&bytes[0])), uint32(len(bytes)))
 	if err != nil {
 		return &os.PathError{Op: fmt.Sprintf("rename %s", f.Name()), Path: to, Err: err}
 	}
 	return nil
 }
 
-func openShared(path string, flag int, _ os.FileMode) (*os.File, error) {
+// replaceFile replaces the file at the path to with f using ReplaceFile.
+func replaceFile(dir *os.File, f OSFile, to string) error {
+	replaced, err := windows.UTF16PtrFromString(resolve(dir, to))
+	if err != nil {
+		return &os.PathError{Op: "UTF16FromString", Path: to, Err: err}
+	}
+
+	// f might have been opened relative to a directory, and might have been
+	// renamed since; ask the system where it is.
+	buf := make([]uint16, windows.MAX_PATH)
+	for {
+		n, err := windows.GetFinalPathNameByHandle(windows.Handle(f.Fd()), &buf[0], uint32(len(buf)), 0)
+		if err != nil {
+			return &os.PathError{Op: "GetFinalPathNameByHandle", Path: "handle:" + f.Name(), Err: err}
+		}
+		if n < uint32(len(buf)) {
+			break
+		}
+		buf = make([]uint16, n)
+	}
+
+	const replaceFileIgnoreMergeErrors = 0x2
+	r1, _, e1 := syscall.SyscallN(procReplaceFileW.Addr(),
+		uintptr(unsafe.Pointer(replaced)),
+		uintptr(unsafe.Pointer(&buf[0])),
+		0, replaceFileIgnoreMergeErrors, 0, 0)
+	if r1 == 0 {
+		return &os.PathError{Op: fmt.Sprintf("rename %s", f.Name()), Path: to, Err: e1}
+	}
+	return nil
+}
+
+// exchange atomically swaps the files at paths a and b, or returns
+// ErrUnsupported if the system cannot do so.
+func exchange(dir *os.File, a, b string) error {
+	return ErrUnsupported
+}
+
+func link(dir *os.File, oldpath, newpath string) error {
+	return os.Link(resolve(dir, oldpath), resolve(dir, newpath))
+}
+
+func unlink(dir *os.File, path string) error {
+	return os.Remove(resolve(dir, path))
+}
+
+// oNoFollow makes openShared fail with ELOOP if the file is a symbolic link,
+// or any other reparse point. It does not collide with the O_* flags of
+// Windows.
+const oNoFollow = 0x20000
+
+func openShared(dir *os.File, path string, flag int, _ os.FileMode) (*os.File, error) {
 
 	// os.OpenFile is insufficient because Go opens file with FILE_SHARE_READ|FILE_SHARE_WRITE,
 	// but not FILE_SHARE_DELETE. This means it's impossible to atomically replace
 	// the destination in Load+Store operations.
 
-	u16path, err := windows.UTF16FromString(path)
+	u16path, err := windows.UTF16FromString(resolve(dir, path))
 	if err != nil {
 		return nil, &os.PathError{Op: "UTF16FromString", Path: path, Err: err}
 	}
@@ -99,31 +231,52 @@ func openShared(path string, flag int, _ os.FileMode) (*os.File, error) {
 		createmode = windows.OPEN_EXISTING
 	}
 
-	handle, err := windows.CreateFile(&u16path[0],
-		mode,
-		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
-		nil,
-		createmode,
-		windows.FILE_ATTRIBUTE_NORMAL,
-		windows.Handle(0),
-	)
+	attrs := uint32(windows.FILE_ATTRIBUTE_NORMAL)
+	if flag&oNoFollow != 0 {
+		attrs |= windows.FILE_FLAG_OPEN_REPARSE_POINT
+	}
+
+	var handle windows.Handle
+	err = retrySharing(func() (err error) {
+		handle, err = windows.CreateFile(&u16path[0],
+			mode,
+			windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+			nil,
+			createmode,
+			attrs,
+			windows.Handle(0),
+		)
+		return err
+	})
 	if err != nil {
 		return nil, &os.PathError{Op: "CreateFile", Path: path, Err: err}
 	}
 
+	if flag&oNoFollow != 0 {
+		var info windows.ByHandleFileInformation
+		err := windows.GetFileInformationByHandle(handle, &info)
+		if err == nil && info.FileAttributes&windows.FILE_ATTRIBUTE_REPARSE_POINT != 0 {
+			err = syscall.ELOOP
+		}
+		if err != nil {
+			windows.CloseHandle(handle)
+			return nil, &os.PathError{Op: "CreateFile", Path: path, Err: err}
+		}
+	}
+
 	return os.NewFile(uintptr(handle), path), nil
 }
 
-func lstatIno(f *os.File, path string) (uint64, error) {
+func lstat(f *os.File, path string) (FileStat, error) {
 	var info windows.ByHandleFileInformation
 	if path == "" {
 		if err := windows.GetFileInformationByHandle(windows.Handle(f.Fd()), &info); err != nil {
-			return 0, &os.PathError{Op: "GetFileInformationByHandle", Path: "handle:" + f.Name(), Err: err}
+			return FileStat{}, &os.PathError{Op: "GetFileInformationByHandle", Path: "handle:" + f.Name(), Err: err}
 		}
 	} else {
-		u16path, err := windows.UTF16FromString(path)
+		u16path, err := windows.UTF16FromString(resolve(f, path))
 		if err != nil {
-			return 0, &os.PathError{Op: "UTF16FromString", Path: path, Err: err}
+			return FileStat{}, &os.PathError{Op: "UTF16FromString", Path: path, Err: err}
 		}
 
 		handle, err := windows.CreateFile(&u16path[0],
@@ -135,13 +288,19 @@ func lstatIno(f *os.File, path string) (uint64, error) {
 			windows.Handle(0),
 		)
 		if err != nil {
-			return 0, &os.PathError{Op: "CreateFile", Path: path, Err: err}
+			return FileStat{}, &os.PathError{Op: "CreateFile", Path: path, Err: err}
 		}
 		defer windows.Close(handle)
 
 		if err := windows.GetFileInformationByHandle(handle, &info); err != nil {
-			return 0, &os.PathError{Op: "GetFileInformationByHandle", Path: path, Err: err}
+			return FileStat{}, &os.PathError{Op: "GetFileInformationByHandle", Path: path, Err: err}
 		}
 	}
-	return uint64(info.FileIndexHigh)<<32 | uint64(info.FileIndexLow), nil
+	return FileStat{
+		Dev:     uint64(info.VolumeSerialNumber),
+		Ino:     uint64(info.FileIndexHigh)<<32 | uint64(info.FileIndexLow),
+		Size:    int64(info.FileSizeHigh)<<32 | int64(info.FileSizeLow),
+		ModTime: time.Unix(0, info.LastWriteTime.Nanoseconds()),
+		Symlink: info.FileAttributes&windows.FILE_ATTRIBUTE_REPARSE_POINT != 0,
+	}, nil
 }
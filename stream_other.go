@@ -0,0 +1,16 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build !windows
+// +build !windows
+
+package store
+
+const systemHasStreams = false
+
+func renameStream(f OSFile) error {
+	return ErrUnsupported
+}
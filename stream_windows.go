@@ -0,0 +1,34 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+const systemHasStreams = true
+
+// renameStream renames the alternate data stream f over the default data
+// stream of its file, which replaces the contents of the file in one step.
+// This fails while other handles have the default stream open.
+//
+// The file keeps its identity, and writing f already updated its
+// modification time, so renameStream updates it again: files that got
+// loaded in between would otherwise keep matching their canary.
+func renameStream(f OSFile) error {
+	if err := renameInfo(nil, f, "::$DATA", windows.FileRenameInfo, windows.FILE_RENAME_REPLACE_IF_EXISTS); err != nil {
+		return err
+	}
+	now := windows.NsecToFiletime(time.Now().UnixNano())
+	if err := windows.SetFileTime(windows.Handle(f.Fd()), nil, nil, &now); err != nil {
+		return &os.PathError{Op: "SetFileTime", Path: f.Name(), Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build unix
+// +build unix
+
+package store
+
+import (
+	"os"
+)
+
+// syncDir flushes the directory at path, resolved relative to dir, to stable
+// storage, which makes the renames and unlinks of its entries durable.
+func syncDir(dir *os.File, path string) error {
+	d, err := openShared(dir, path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,17 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"os"
+)
+
+// syncDir is a no-op on Windows: directories cannot be flushed through the
+// Win32 API, and NTFS journals the metadata changes of renames itself.
+func syncDir(dir *os.File, path string) error {
+	return nil
+}
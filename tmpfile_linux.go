@@ -0,0 +1,55 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+var errUnnamedUnsupported = errors.New("unnamed temporary files are not supported")
+
+// openUnnamed creates an unnamed file with O_TMPFILE in the directory at
+// path, resolved relative to dir. It returns errUnnamedUnsupported if the
+// kernel or the filesystem does not support O_TMPFILE.
+func openUnnamed(dir *os.File, path string, mode os.FileMode) (*os.File, error) {
+	fd, err := openat(dir, path, unix.O_TMPFILE|unix.O_WRONLY, uint32(mode.Perm()))
+	switch {
+	case err == nil:
+		return os.NewFile(uintptr(fd), filepath.Join(path, "(unnamed)")), nil
+	case err == unix.EOPNOTSUPP || err == unix.EISDIR || err == unix.EINVAL:
+		// Kernels older than 3.11 ignore the bits of O_TMPFILE other than
+		// O_DIRECTORY, and fail with EISDIR.
+		return nil, errUnnamedUnsupported
+	default:
+		return nil, &os.PathError{Op: "openat", Path: path, Err: err}
+	}
+}
+
+// linkUnnamed gives a name, resolved relative to dir, to the unnamed file f.
+func linkUnnamed(dir *os.File, f *os.File, name string) error {
+	dirfd, base, release, err := beneath(dir, name)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Linking with AT_EMPTY_PATH requires CAP_DAC_READ_SEARCH, but linking
+	// through procfs does not.
+	proc := fmt.Sprintf("/proc/self/fd/%d", f.Fd())
+	if err := unix.Linkat(unix.AT_FDCWD, proc, dirfd, base, unix.AT_SYMLINK_FOLLOW); err != nil {
+		return &os.LinkError{Op: "linkat", Old: proc, New: name, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnnamedTempFile(t *testing.T) {
+	dir := t.TempDir()
+
+	f, err := openUnnamed(nil, dir, 0666)
+	if errors.Is(err, errUnnamedUnsupported) {
+		t.Skip("O_TMPFILE is not supported on", dir)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString("contents"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file must not show up in the directory until it gets linked.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected empty directory, got %d entries", len(entries))
+	}
+
+	name := filepath.Join(dir, "linked")
+	if err := linkUnnamed(nil, f, name); err != nil {
+		t.Fatal(err)
+	}
+	if err := linkUnnamed(nil, f, name); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("expected linking over an existing file to fail with ErrExist, got %v", err)
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "contents" {
+		t.Fatalf("expected contents, got %q", data)
+	}
+}
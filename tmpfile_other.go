@@ -0,0 +1,25 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build !linux
+// +build !linux
+
+package store
+
+import (
+	"errors"
+	"os"
+)
+
+var errUnnamedUnsupported = errors.New("unnamed temporary files are not supported")
+
+func openUnnamed(dir *os.File, path string, mode os.FileMode) (*os.File, error) {
+	return nil, errUnnamedUnsupported
+}
+
+func linkUnnamed(dir *os.File, f *os.File, name string) error {
+	return errUnnamedUnsupported
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "barney.ci/go-store"
+
+// WithTracerProvider configures the store to emit OpenTelemetry spans for
+// its operations using the specified tracer provider.
+//
+// Spans record the path of the file, the time spent waiting on locks, the
+// number of bytes read or written and the number of retries, as applicable.
+// Lock acquisitions outside of stores get traced with LockOptions.
+//
+// By default, no spans are emitted.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(opts *options) {
+		opts.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// startSpan starts a span for the specified operation. It returns a nil span
+// when tracing is disabled.
+func (store *Store[T]) startSpan(ctx context.Context, op, path string) (context.Context, trace.Span) {
+	if store.opts.tracer == nil {
+		return ctx, nil
+	}
+	return store.opts.tracer.Start(ctx, "store."+op, trace.WithAttributes(attribute.String("store.path", path)))
+}
+
+// traced returns the span of the current store operation, or nil if tracing
+// is disabled.
+func (store *Store[T]) traced(ctx context.Context) trace.Span {
+	if store.opts.tracer == nil {
+		return nil
+	}
+	return trace.SpanFromContext(ctx)
+}
+
+func endSpan(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceLockWait records the time spent waiting for a lock since start.
+func traceLockWait(span trace.Span, start time.Time) {
+	if span == nil {
+		return
+	}
+	span.SetAttributes(attribute.Int64("store.lock_wait_ns", int64(time.Since(start))))
+}
+
+// countingWriter counts the number of bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
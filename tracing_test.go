@@ -0,0 +1,171 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type recordedSpan struct {
+	trace.Span
+	name   string
+	attrs  map[attribute.Key]attribute.Value
+	status codes.Code
+	ended  bool
+}
+
+func (span *recordedSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, attr := range kv {
+		span.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (span *recordedSpan) SetStatus(code codes.Code, _ string) {
+	span.status = code
+}
+
+func (span *recordedSpan) End(...trace.SpanEndOption) {
+	span.ended = true
+}
+
+type recordingTracer struct {
+	trace.TracerProvider
+
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (tracer *recordingTracer) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return tracer
+}
+
+func (tracer *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	span := &recordedSpan{
+		Span:  trace.SpanFromContext(context.Background()),
+		name:  name,
+		attrs: map[attribute.Key]attribute.Value{},
+	}
+	config := trace.NewSpanStartConfig(opts...)
+	span.SetAttributes(config.Attributes()...)
+
+	tracer.mu.Lock()
+	tracer.spans = append(tracer.spans, span)
+	tracer.mu.Unlock()
+
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+func (tracer *recordingTracer) find(name string) *recordedSpan {
+	for _, span := range tracer.spans {
+		if span.name == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	tracer := &recordingTracer{}
+	store := New[int](json.NewEncoder, json.NewDecoder, WithTracerProvider(tracer))
+	path := filepath.Join(t.TempDir(), "traced.json")
+
+	err := store.LoadAndStore(context.Background(), path, 0666, func(ctx context.Context, val *int, err error) error {
+		*val = 42
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	las := tracer.find("store.LoadAndStore")
+	if las == nil {
+		t.Fatal("expected a store.LoadAndStore span")
+	}
+	if las.attrs["store.path"].AsString() != path {
+		t.Fatalf("expected store.path to be %q, got %q", path, las.attrs["store.path"].AsString())
+	}
+	if _, ok := las.attrs["store.retries"]; !ok {
+		t.Fatal("expected store.retries to be recorded")
+	}
+
+	// The initial load fails because the file does not exist.
+	load := tracer.find("store.Load")
+	if load == nil || load.status != codes.Error {
+		t.Fatalf("expected an errored store.Load span, got %+v", load)
+	}
+
+	st := tracer.find("store.Store")
+	if st == nil {
+		t.Fatal("expected a store.Store span")
+	}
+	if st.attrs["store.bytes_written"].AsInt64() != int64(len("42\n")) {
+		t.Fatalf("expected 3 bytes written, got %v", st.attrs["store.bytes_written"].AsInt64())
+	}
+	if _, ok := st.attrs["store.lock_wait_ns"]; !ok {
+		t.Fatal("expected store.lock_wait_ns to be recorded")
+	}
+
+	if err := store.LoadAndStore(context.Background(), path, 0666, func(ctx context.Context, val *int, err error) error {
+		return ErrNoChange
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var read int64
+	for _, span := range tracer.spans {
+		if span.name == "store.Load" && span.status != codes.Error {
+			read = span.attrs["store.bytes_read"].AsInt64()
+		}
+	}
+	if read != int64(len("42\n")) {
+		t.Fatalf("expected 3 bytes read, got %v", read)
+	}
+
+	for _, span := range tracer.spans {
+		if !span.ended {
+			t.Fatalf("span %s was not ended", span.name)
+		}
+	}
+}
+
+func TestLockTracing(t *testing.T) {
+	tracer := &recordingTracer{}
+	f, err := os.Create(filepath.Join(t.TempDir(), "lock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	opts := LockOptions{TracerProvider: tracer}
+	if err := opts.RLock(context.Background(), f); err != nil {
+		t.Fatal(err)
+	}
+	if err := opts.Lock(context.Background(), f); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"store.RLock", "store.Lock"} {
+		span := tracer.find(name)
+		if span == nil {
+			t.Fatalf("expected a %s span", name)
+		}
+		if span.attrs["store.path"].AsString() != f.Name() {
+			t.Fatalf("expected store.path to be %q, got %q", f.Name(), span.attrs["store.path"].AsString())
+		}
+		if _, ok := span.attrs["store.lock_wait_ns"]; !ok || !span.ended {
+			t.Fatalf("expected %s to record the lock wait and to be ended", name)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// journalSuffix is the suffix of the journal files of transactions.
+const journalSuffix = ".txn"
+
+// A Txn updates several files of a store atomically.
+//
+// Transactions lock their files in a deterministic order, so that concurrent
+// transactions never deadlock, and write all the new contents to temporary
+// files before renaming any of them. Before the first rename, the list of
+// pending renames gets recorded in a journal file; should the process crash
+// before all the renames are done, Recover completes them.
+//
+// Files updated by transactions can be accessed concurrently with the other
+// operations of the store, which lock them one at a time: readers never see
+// a partially written file, but may see some files of a transaction updated
+// and others not yet.
+type Txn[T any] struct {
+	store *Store[T]
+	dir   string
+}
+
+// TxnFunc is the function called by Txn.Run with the values of the files of
+// a transaction, in the order of the paths passed to Run. Each err is the
+// result of loading the corresponding value, which is left zero on error.
+//
+// The values get stored if and only if the function returns nil. If it
+// returns ErrNoChange, Run leaves the files untouched and returns nil.
+type TxnFunc[T any] func(ctx context.Context, vals []*T, errs []error) error
+
+type journalEntry struct {
+	Temp string
+	Path string
+
+	// Recovery is the temporary file holding the recovery copy of Path,
+	// if the store keeps them.
+	Recovery string `json:",omitempty"`
+
+	// Rotated is set once the backups of Path were rotated, which must
+	// not happen again should the transaction be recovered.
+	Rotated bool `json:",omitempty"`
+}
+
+// NewTxn returns a Txn that updates files with the specified store, and
+// keeps its journal files in dir. Relative paths are resolved like the paths
+// passed to the store.
+//
+// The journal directory must exist. It is usually shared by all the
+// transactions of an application, since Recover must see all their journal
+// files.
+func NewTxn[T any](store *Store[T], dir string) *Txn[T] {
+	return &Txn[T]{store: store, dir: dir}
+}
+
+// Run locks and loads the files at paths, calls fn with their values, and
+// stores the values as updated by fn, creating missing files with the
+// specified mode. Either all of the files get updated, or none of them do.
+//
+// A path must not appear more than once.
+func (txn *Txn[T]) Run(ctx context.Context, paths []string, mode os.FileMode, fn TxnFunc[T]) (err error) {
+	ctx, span := txn.store.startSpan(ctx, "Txn", txn.dir)
+	defer func() { endSpan(span, err) }()
+
+	order, err := lockOrder(paths)
+	if err != nil {
+		return err
+	}
+
+	lfs := make([]File, len(paths))
+	defer func() {
+		for _, lf := range lfs {
+			if lf != nil {
+				txn.store.release(ctx, lf)
+			}
+		}
+	}()
+
+	vals := make([]*T, len(paths))
+	errs := make([]error, len(paths))
+	for _, i := range order {
+		vals[i] = new(T)
+
+		lfs[i], _, errs[i], err = txn.store.acquireAndLoad(ctx, paths[i], mode, vals[i])
+		if err != nil {
+			return err
+		}
+		if errs[i] != nil {
+			*vals[i] = *new(T)
+		}
+	}
+
+	if err := fn(ctx, vals, errs); err != nil {
+		if err == ErrNoChange {
+			return nil
+		}
+		return err
+	}
+
+	// Write all the new contents, and only then commit to renaming them.
+	var committed bool
+	journal := make([]journalEntry, len(paths))
+	defer func() {
+		if err != nil && !committed {
+			for _, e := range journal {
+				for _, temp := range []string{e.Temp, e.Recovery} {
+					if temp != "" {
+						txn.store.fs().Remove(temp)
+					}
+				}
+			}
+		}
+	}()
+	for _, i := range order {
+		write, err := txn.store.writer(paths[i], vals[i])
+		if err != nil {
+			return err
+		}
+		temp, recovery, err := txn.store.stage(paths[i], mode, write)
+		if err != nil {
+			return err
+		}
+		journal[i] = journalEntry{Temp: temp, Path: paths[i], Recovery: recovery}
+	}
+
+	name, err := txn.writeJournal(journal)
+	if err != nil {
+		return err
+	}
+	committed = true
+
+	// From here on, the journal allows Recover to complete the transaction
+	// should any rename fail.
+	if err := txn.commit(name, journal, lfs, order); err != nil {
+		return err
+	}
+	return txn.store.fs().Remove(name)
+}
+
+// Recover completes the transactions whose journal files are left in the
+// journal directory, which happens when a process crashes, or fails to
+// rename files, while committing a transaction.
+//
+// Recover should be called when the application starts, before anything
+// else writes to the files of the transactions, or removes orphaned
+// temporary files with CleanOrphans.
+func (txn *Txn[T]) Recover(ctx context.Context) (err error) {
+	ctx, span := txn.store.startSpan(ctx, "Recover", txn.dir)
+	defer func() { endSpan(span, err) }()
+
+	entries, err := txn.store.fs().ReadDir(txn.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasSuffix(entry.Name(), journalSuffix) {
+			continue
+		}
+		if err := txn.recover(ctx, filepath.Join(txn.dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (txn *Txn[T]) recover(ctx context.Context, name string) error {
+	f, err := txn.store.fs().OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	var journal []journalEntry
+	if err := json.Unmarshal(data, &journal); err != nil {
+		// The journal was not completely written, which means that no
+		// rename happened; the temporary files are mere orphans.
+		return txn.store.fs().Remove(name)
+	}
+
+	paths := make([]string, len(journal))
+	for i, e := range journal {
+		paths[i] = e.Path
+	}
+	order, err := lockOrder(paths)
+	if err != nil {
+		return err
+	}
+
+	lfs := make([]File, len(paths))
+	defer func() {
+		for _, lf := range lfs {
+			if lf != nil {
+				txn.store.release(ctx, lf)
+			}
+		}
+	}()
+	for _, i := range order {
+		err := ErrRetry
+		for err == ErrRetry {
+			lfs[i], _, err = txn.store.acquire(ctx, paths[i], 0666, nil, true)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := txn.commit(name, journal, lfs, order); err != nil {
+		return err
+	}
+	return txn.store.fs().Remove(name)
+}
+
+// commit renames the temporary files of the journal named name over their
+// destination, skipping the ones that were already renamed. Before each
+// rename, it rotates the backups of the destination, recording it in the
+// journal, and commits its recovery copy. The lock files of the destinations
+// must be held.
+func (txn *Txn[T]) commit(name string, journal []journalEntry, lfs []File, order []int) error {
+	store := txn.store
+	for _, i := range order {
+		e := journal[i]
+		f, err := store.fs().OpenFile(e.Temp, os.O_RDONLY, 0)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			continue
+		case err != nil:
+			return err
+		}
+		if !e.Rotated && store.opts.backups > 0 {
+			err := store.rotateBackups(e.Path)
+			if err == nil {
+				journal[i].Rotated = true
+				err = txn.rewriteJournal(name, journal)
+			}
+			if err != nil {
+				f.Close()
+				return err
+			}
+		}
+		if err := store.commitRecovery(e.Recovery, e.Path); err != nil {
+			f.Close()
+			return err
+		}
+		err = store.fs().Rename(f, e.Path)
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		// Like after a regular store, the lock file must not survive the
+		// rename unless it is stable.
+		if !store.opts.stableLockFile {
+			if err := store.fs().Remove(lfs[i].Name()); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	for _, i := range order {
+		if err := store.syncDir(journal[i].Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (txn *Txn[T]) writeJournal(journal []journalEntry) (string, error) {
+	data, err := json.Marshal(journal)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		var random [8]byte
+		if _, err := rand.Read(random[:]); err != nil {
+			return "", err
+		}
+		name := filepath.Join(txn.dir, hex.EncodeToString(random[:])+journalSuffix)
+
+		f, err := txn.store.fs().OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		_, err = f.Write(data)
+		if err == nil {
+			err = txn.store.syncData(f)
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = txn.store.syncDir(name)
+		}
+		if err != nil {
+			txn.store.fs().Remove(name)
+			return "", err
+		}
+		return name, nil
+	}
+}
+
+// rewriteJournal atomically replaces the contents of the journal file name.
+func (txn *Txn[T]) rewriteJournal(name string, journal []journalEntry) error {
+	data, err := json.Marshal(journal)
+	if err != nil {
+		return err
+	}
+	b := txn.store.fs()
+	temp, err := txn.store.writeTemp(name, 0666, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if err := renamePath(b, temp, name); err != nil {
+		b.Remove(temp)
+		return err
+	}
+	return txn.store.syncDir(name)
+}
+
+// lockOrder returns the indices of paths in the order in which their lock
+// files must be acquired.
+func lockOrder(paths []string) ([]int, error) {
+	order := make([]int, len(paths))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return filepath.Clean(paths[order[i]]) < filepath.Clean(paths[order[j]])
+	})
+	for i := 1; i < len(order); i++ {
+		if filepath.Clean(paths[order[i]]) == filepath.Clean(paths[order[i-1]]) {
+			return nil, &os.PathError{Op: "txn", Path: paths[order[i]], Err: os.ErrInvalid}
+		}
+	}
+	return order, nil
+}
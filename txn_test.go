@@ -0,0 +1,289 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestTxn(t *testing.T) {
+	ctx := context.Background()
+
+	for _, stable := range []bool{false, true} {
+		var opts []Option
+		if stable {
+			opts = append(opts, WithStableLockFile())
+		}
+		store := New[int](json.NewEncoder, json.NewDecoder, opts...)
+
+		t.Run(fmt.Sprintf("Stable=%v", stable), func(t *testing.T) {
+			t.Run("Run", func(t *testing.T) {
+				dir := t.TempDir()
+				txn := NewTxn(store, t.TempDir())
+				paths := []string{filepath.Join(dir, "b"), filepath.Join(dir, "a")}
+
+				const total = 50
+				var wait sync.WaitGroup
+				for i := 0; i < total; i++ {
+					wait.Add(1)
+					go func(i int) {
+						defer wait.Done()
+
+						// Alternate the order of the paths, which must not
+						// cause deadlocks.
+						paths := []string{paths[i%2], paths[1-i%2]}
+						err := txn.Run(ctx, paths, 0666, func(ctx context.Context, vals []*int, errs []error) error {
+							for j, err := range errs {
+								if err != nil && !errors.Is(err, os.ErrNotExist) {
+									return err
+								}
+								*vals[j]++
+							}
+							return nil
+						})
+						if err != nil {
+							t.Error(err)
+						}
+					}(i)
+				}
+				wait.Wait()
+
+				for _, path := range paths {
+					var val int
+					if _, err := store.Load(ctx, path, &val); err != nil {
+						t.Fatal(err)
+					}
+					if val != total {
+						t.Fatalf("expected %s to be %d, got %d", path, total, val)
+					}
+				}
+
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, entry := range entries {
+					if name := entry.Name(); name != "a" && name != "b" && !(stable && filepath.Ext(name) == ".lockfile") {
+						t.Fatalf("unexpected file %s left behind", name)
+					}
+				}
+			})
+
+			t.Run("Abort", func(t *testing.T) {
+				dir := t.TempDir()
+				txn := NewTxn(store, t.TempDir())
+				paths := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}
+
+				abort := errors.New("abort")
+				err := txn.Run(ctx, paths, 0666, func(ctx context.Context, vals []*int, errs []error) error {
+					*vals[0] = 1
+					return abort
+				})
+				if err != abort {
+					t.Fatalf("expected abort, got %v", err)
+				}
+				for _, path := range paths {
+					if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+						t.Fatalf("expected %s to not exist, got %v", path, err)
+					}
+				}
+			})
+
+			t.Run("Options", func(t *testing.T) {
+				store := New[int](json.NewEncoder, json.NewDecoder, append(opts, WithBackups(1), WithRecovery(), WithExactMode())...)
+				dir := t.TempDir()
+				txn := NewTxn(store, t.TempDir())
+				paths := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}
+
+				for i := 0; i < 2; i++ {
+					err := txn.Run(ctx, paths, 0664, func(ctx context.Context, vals []*int, errs []error) error {
+						for _, val := range vals {
+							*val++
+						}
+						return nil
+					})
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				for _, path := range paths {
+					var val int
+					if err := store.LoadVersion(ctx, path, 1, &val); err != nil {
+						t.Fatal(err)
+					}
+					if val != 1 {
+						t.Fatalf("expected the backup of %s to be 1, got %d", path, val)
+					}
+					if data, err := os.ReadFile(recoveryPath(path)); err != nil {
+						t.Fatal(err)
+					} else if string(data) != "2\n" {
+						t.Fatalf("expected the recovery copy of %s to be 2, got %q", path, data)
+					}
+					if info, err := os.Stat(path); err != nil {
+						t.Fatal(err)
+					} else if info.Mode().Perm() != 0664 {
+						t.Fatalf("expected mode 0664, got %v", info.Mode())
+					}
+				}
+			})
+
+			t.Run("AbortRecovery", func(t *testing.T) {
+				store := New[int](json.NewEncoder, json.NewDecoder, append(opts, WithRecovery())...)
+				dir := t.TempDir()
+				paths := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}
+				for _, path := range paths {
+					if err := store.ForceStore(ctx, path, 0666, new(int)); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				// The journal cannot be written in a missing directory,
+				// which aborts the transaction after staging the files.
+				txn := NewTxn(store, filepath.Join(dir, "missing"))
+				err := txn.Run(ctx, paths, 0666, func(ctx context.Context, vals []*int, errs []error) error {
+					for _, val := range vals {
+						*val = 1
+					}
+					return nil
+				})
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Fatalf("expected ErrNotExist, got %v", err)
+				}
+				for _, path := range paths {
+					if data, err := os.ReadFile(recoveryPath(path)); err != nil {
+						t.Fatal(err)
+					} else if string(data) != "0\n" {
+						t.Fatalf("expected the recovery copy of %s to be left alone, got %q", path, data)
+					}
+				}
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, entry := range entries {
+					if _, isTemp := store.tempBase(entry.Name()); isTemp {
+						t.Fatalf("expected no temporary file to be left behind, got %v", entry.Name())
+					}
+				}
+			})
+
+			t.Run("RecoverRotated", func(t *testing.T) {
+				store := New[int](json.NewEncoder, json.NewDecoder, append(opts, WithBackups(2))...)
+				dir := t.TempDir()
+				journalDir := t.TempDir()
+				txn := NewTxn(store, journalDir)
+
+				a := filepath.Join(dir, "a")
+				for i := 0; i < 2; i++ {
+					v := i
+					if err := store.ForceStore(ctx, a, 0666, &v); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				// Simulate a crash after rotating the backups of a, but
+				// before renaming its new contents.
+				if err := store.rotateBackups(a); err != nil {
+					t.Fatal(err)
+				}
+				tmp := filepath.Join(dir, "a.0123456789abcdef.tmp")
+				if err := os.WriteFile(tmp, []byte("2"), 0666); err != nil {
+					t.Fatal(err)
+				}
+				journal, _ := json.Marshal([]journalEntry{{Temp: tmp, Path: a, Rotated: true}})
+				if err := os.WriteFile(filepath.Join(journalDir, "0123456789abcdef.txn"), journal, 0666); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := txn.Recover(ctx); err != nil {
+					t.Fatal(err)
+				}
+				for k, expected := range []int{2, 1, 0} {
+					var val int
+					if err := store.LoadVersion(ctx, a, k, &val); err != nil {
+						t.Fatal(err)
+					}
+					if val != expected {
+						t.Fatalf("expected version %d to be %d, got %d", k, expected, val)
+					}
+				}
+			})
+
+			t.Run("Duplicate", func(t *testing.T) {
+				dir := t.TempDir()
+				txn := NewTxn(store, t.TempDir())
+				paths := []string{filepath.Join(dir, "a"), filepath.Join(dir, ".", "a")}
+
+				err := txn.Run(ctx, paths, 0666, func(ctx context.Context, vals []*int, errs []error) error {
+					return nil
+				})
+				if !errors.Is(err, os.ErrInvalid) {
+					t.Fatalf("expected ErrInvalid, got %v", err)
+				}
+			})
+
+			t.Run("Recover", func(t *testing.T) {
+				dir := t.TempDir()
+				journalDir := t.TempDir()
+				txn := NewTxn(store, journalDir)
+
+				// Simulate a crash after the first of two renames.
+				a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+				if err := store.ForceStore(ctx, a, 0666, new(int)); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(a, []byte("1"), 0666); err != nil {
+					t.Fatal(err)
+				}
+				tmp := filepath.Join(dir, "b.0123456789abcdef.tmp")
+				if err := os.WriteFile(tmp, []byte("2"), 0666); err != nil {
+					t.Fatal(err)
+				}
+				journal, _ := json.Marshal([]journalEntry{
+					{Temp: filepath.Join(dir, "a.fedcba9876543210.tmp"), Path: a},
+					{Temp: tmp, Path: b},
+				})
+				if err := os.WriteFile(filepath.Join(journalDir, "0123456789abcdef.txn"), journal, 0666); err != nil {
+					t.Fatal(err)
+				}
+
+				// Journals that were not completely written are abandoned.
+				if err := os.WriteFile(filepath.Join(journalDir, "fedcba9876543210.txn"), journal[:len(journal)/2], 0666); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := txn.Recover(ctx); err != nil {
+					t.Fatal(err)
+				}
+
+				for path, expected := range map[string]int{a: 1, b: 2} {
+					var val int
+					if _, err := store.Load(ctx, path, &val); err != nil {
+						t.Fatal(err)
+					}
+					if val != expected {
+						t.Fatalf("expected %s to be %d, got %d", path, expected, val)
+					}
+				}
+				if entries, _ := os.ReadDir(journalDir); len(entries) != 0 {
+					t.Fatalf("expected the journal directory to be empty, got %v", entries)
+				}
+				if _, err := os.Stat(tmp); !errors.Is(err, os.ErrNotExist) {
+					t.Fatalf("expected %s to be renamed, got %v", tmp, err)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// errWatchUnsupported is returned by newWatcher on systems that cannot
+// notify the process of changes to a directory.
+var errWatchUnsupported = errors.New("watching files is not supported on this system")
+
+// errWatchLost is returned by watcher.wait when the watched directory got
+// removed or renamed, after which the watcher no longer reports changes.
+var errWatchLost = errors.New("the watched directory is gone")
+
+// watchPollInterval is the interval at which WaitForChange checks files that
+// it cannot watch.
+var watchPollInterval = 100 * time.Millisecond
+
+// WaitForChange blocks until the canary of the file at path differs from the
+// specified canary, as returned by Load, or until the context is done. It
+// returns immediately if the file already changed.
+//
+// The file is watched with inotify on Linux, kqueue on BSD and Darwin, and
+// ReadDirectoryChangesW on Windows. On other systems, or if the file cannot
+// be watched, it is polled instead.
+//
+// Waking up does not load the file; callers typically follow up with Load or
+// LoadIfChanged.
+func (store *Store[T]) WaitForChange(ctx context.Context, path string, canary Canary) (err error) {
+	ctx, span := store.startSpan(ctx, "WaitForChange", path)
+	defer func() { endSpan(span, err) }()
+
+	// The notifier must be set up before checking the canary, otherwise
+	// changes happening in between would go unnoticed.
+	n := store.notifier(path)
+	defer n.close()
+
+	for {
+		current, err := store.probe(ctx, path)
+		if err != nil {
+			return err
+		}
+		if current != canary {
+			return nil
+		}
+		if err := n.wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// A notifier waits for changes to a file with a watcher, falling back to
+// polling when the file cannot be watched.
+type notifier struct {
+	w *watcher
+}
+
+// notifier returns a notifier for the file at path. Files of other backends
+// than the file system of the operating system are always polled.
+func (store *Store[T]) notifier(path string) *notifier {
+	dir, ok := store.osDir()
+	if !ok {
+		return &notifier{}
+	}
+	w, err := newWatcher(dir, path)
+	if err != nil {
+		w = nil
+	}
+	return &notifier{w: w}
+}
+
+// wait blocks until the file might have changed. Spurious wakeups are
+// possible, so callers need to check whether the file actually changed.
+func (n *notifier) wait(ctx context.Context) error {
+	if n.w != nil {
+		switch err := n.w.wait(ctx); {
+		case err == errWatchLost:
+			// The directory is gone, but may come back; keep polling.
+			n.w.close()
+			n.w = nil
+		default:
+			return err
+		}
+	}
+
+	timer := time.NewTimer(watchPollInterval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (n *notifier) close() {
+	if n.w != nil {
+		n.w.close()
+	}
+}
+
+// probe returns the current canary of the file at path, without decoding it
+// unless the store uses a canary function.
+func (store *Store[T]) probe(ctx context.Context, path string) (Canary, error) {
+	var (
+		canary Canary
+		err    error
+	)
+	switch {
+	case store.canaryFunc != nil || store.opts.objects != nil:
+		var v T
+		canary, _, err = store.loadOnce(ctx, path, &v, nil, false, nil)
+	case store.opts.contentHash:
+		canary, err = store.fileContentHash(path)
+	default:
+		var st FileStat
+		if st, err = store.fs().Lstat(path); err == nil {
+			canary = fileCanary(st)
+		}
+		if err == nil && store.opts.generations {
+			var (
+				gen uint64
+				ok  bool
+			)
+			if gen, ok, err = store.fileGeneration(path); ok {
+				canary = generation(gen)
+			}
+		}
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return canary, err
+}
+
+// An Update is a new version of a watched file, as delivered by Watch.
+type Update[T any] struct {
+	// Value is the decoded contents of the file.
+	Value T
+
+	// Canary is the canary of Value, as returned by Load.
+	Canary Canary
+
+	// Err is set if the file could not be loaded, in which case Value is
+	// the zero value. A missing file is reported with an error wrapping
+	// os.ErrNotExist and a nil canary.
+	Err error
+}
+
+// Watch loads the file at path, and returns a channel that delivers its
+// current contents, followed by every new version of the file, until the
+// context is done, at which point the channel gets closed.
+//
+// The channel holds at most one pending update. Updates that the receiver
+// did not pick up by the time a newer version is available get replaced by
+// the newer version, so that rapid successive writes coalesce and slow
+// receivers always see the latest contents.
+//
+// Watch only fails if the initial load fails with an error other than
+// os.ErrNotExist. Later load errors are delivered on the channel, and
+// watching continues.
+func (store *Store[T]) Watch(ctx context.Context, path string) (<-chan Update[T], error) {
+	n := store.notifier(path)
+
+	var u Update[T]
+	u.Canary, u.Err = store.Load(ctx, path, &u.Value)
+	if u.Err != nil && !errors.Is(u.Err, os.ErrNotExist) {
+		n.close()
+		return nil, u.Err
+	}
+
+	ch := make(chan Update[T], 1)
+	ch <- u
+
+	go func() {
+		defer close(ch)
+		defer n.close()
+
+		canary, lastErr := u.Canary, u.Err
+		for {
+			if err := n.wait(ctx); err != nil {
+				return
+			}
+
+			var u Update[T]
+			u.Canary, u.Err = store.LoadIfChanged(ctx, path, canary, &u.Value)
+			switch {
+			case ctx.Err() != nil:
+				return
+			case errors.Is(u.Err, ErrNotModified):
+				continue
+			case u.Err != nil && lastErr != nil && u.Err.Error() == lastErr.Error():
+				// Do not report the same error again on every wakeup.
+				continue
+			case errors.Is(u.Err, os.ErrNotExist):
+				canary = nil
+			case u.Err != nil:
+				// Keep waiting for a change from the last good version.
+				u.Canary = canary
+			default:
+				canary = u.Canary
+			}
+			lastErr = u.Err
+
+			// Replace the pending update, if any. This never blocks, since
+			// this goroutine is the only sender.
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- u
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,29 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build !linux && !windows && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!windows,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package store
+
+import (
+	"context"
+	"os"
+)
+
+type watcher struct{}
+
+func newWatcher(dir *os.File, path string) (*watcher, error) {
+	return nil, errWatchUnsupported
+}
+
+func (w *watcher) wait(ctx context.Context) error {
+	return errWatchUnsupported
+}
+
+func (w *watcher) close() error {
+	return nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// A watcher reports the changes to a file through a kqueue. The kqueue
+// watches the directory of the file, which catches the file being replaced,
+// and the file itself, which catches in-place modifications. A pipe, also
+// registered with the kqueue, interrupts waits when the context is done.
+type watcher struct {
+	kq   int
+	pipe [2]int
+	dir  *os.File
+	file *os.File
+
+	storeDir *os.File
+	path     string
+}
+
+func newWatcher(dir *os.File, path string) (*watcher, error) {
+	d, err := openShared(dir, filepath.Dir(path), os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	kq, err := unix.Kqueue()
+	if err != nil {
+		d.Close()
+		return nil, os.NewSyscallError("kqueue", err)
+	}
+	unix.CloseOnExec(kq)
+
+	w := &watcher{kq: kq, pipe: [2]int{-1, -1}, dir: d, storeDir: dir, path: path}
+	if err := unix.Pipe(w.pipe[:]); err != nil {
+		w.close()
+		return nil, os.NewSyscallError("pipe", err)
+	}
+	unix.CloseOnExec(w.pipe[0])
+	unix.CloseOnExec(w.pipe[1])
+
+	changes := make([]unix.Kevent_t, 2)
+	unix.SetKevent(&changes[0], int(d.Fd()), unix.EVFILT_VNODE, unix.EV_ADD|unix.EV_CLEAR)
+	changes[0].Fflags = unix.NOTE_WRITE | unix.NOTE_DELETE | unix.NOTE_RENAME | unix.NOTE_REVOKE
+	unix.SetKevent(&changes[1], w.pipe[0], unix.EVFILT_READ, unix.EV_ADD)
+	if _, err := unix.Kevent(kq, changes, nil, nil); err != nil {
+		w.close()
+		return nil, os.NewSyscallError("kevent", err)
+	}
+
+	if err := w.watchFile(); err != nil {
+		w.close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// watchFile registers the file currently at the watched path with the kqueue,
+// replacing the previous one. A missing file is not an error, as its creation
+// shows up as a change to the directory.
+func (w *watcher) watchFile() error {
+	if w.file != nil {
+		// Closing the file removes it from the kqueue.
+		w.file.Close()
+		w.file = nil
+	}
+
+	f, err := openShared(w.storeDir, w.path, os.O_RDONLY, 0)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	}
+
+	change := make([]unix.Kevent_t, 1)
+	unix.SetKevent(&change[0], int(f.Fd()), unix.EVFILT_VNODE, unix.EV_ADD|unix.EV_CLEAR)
+	change[0].Fflags = unix.NOTE_WRITE | unix.NOTE_EXTEND | unix.NOTE_ATTRIB | unix.NOTE_DELETE | unix.NOTE_RENAME
+	if _, err := unix.Kevent(w.kq, change, nil, nil); err != nil {
+		f.Close()
+		return os.NewSyscallError("kevent", err)
+	}
+	w.file = f
+	return nil
+}
+
+// wait blocks until the watched file might have changed.
+func (w *watcher) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			unix.Write(w.pipe[1], []byte{0})
+		case <-done:
+		}
+	}()
+	defer func() {
+		close(done)
+		<-exited
+	}()
+
+	events := make([]unix.Kevent_t, 4)
+	for {
+		n, err := unix.Kevent(w.kq, nil, events, nil)
+		switch {
+		case err == unix.EINTR:
+			continue
+		case err != nil:
+			return os.NewSyscallError("kevent", err)
+		}
+
+		for _, ev := range events[:n] {
+			switch {
+			case int(ev.Ident) == w.pipe[0]:
+				return ctx.Err()
+			case int(ev.Ident) == int(w.dir.Fd()) && ev.Fflags&(unix.NOTE_DELETE|unix.NOTE_RENAME|unix.NOTE_REVOKE) != 0:
+				return errWatchLost
+			}
+		}
+		// Something changed in the directory or in the file; make sure to
+		// watch the file that is now at path before reporting the change.
+		return w.watchFile()
+	}
+}
+
+func (w *watcher) close() error {
+	if w.file != nil {
+		w.file.Close()
+	}
+	for _, fd := range w.pipe {
+		if fd >= 0 {
+			unix.Close(fd)
+		}
+	}
+	w.dir.Close()
+	return unix.Close(w.kq)
+}
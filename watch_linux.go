@@ -0,0 +1,112 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const watchMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MODIFY | unix.IN_CLOSE_WRITE |
+	unix.IN_ATTRIB | unix.IN_MOVED_FROM | unix.IN_MOVED_TO |
+	unix.IN_DELETE_SELF | unix.IN_MOVE_SELF | unix.IN_ONLYDIR
+
+// A watcher reports the changes to a file through an inotify instance that
+// watches its directory. The inotify file descriptor is non-blocking, which
+// lets the runtime poller wait on it and interrupt reads with deadlines.
+type watcher struct {
+	f    *os.File
+	name string
+	buf  [4096]byte
+}
+
+func newWatcher(dir *os.File, path string) (*watcher, error) {
+	d, err := openShared(dir, filepath.Dir(path), os.O_RDONLY|unix.O_DIRECTORY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	f := os.NewFile(uintptr(fd), "inotify")
+
+	// Watch the directory through its file descriptor, which resolves it
+	// relative to dir like the other operations of the store.
+	if _, err := unix.InotifyAddWatch(fd, fmt.Sprintf("/proc/self/fd/%d", d.Fd()), watchMask); err != nil {
+		f.Close()
+		return nil, &os.PathError{Op: "inotify_add_watch", Path: filepath.Dir(path), Err: err}
+	}
+	return &watcher{f: f, name: filepath.Base(path)}, nil
+}
+
+// wait blocks until the watched file might have changed.
+func (w *watcher) wait(ctx context.Context) error {
+	if err := w.f.SetReadDeadline(time.Time{}); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			w.f.SetReadDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	defer func() {
+		close(done)
+		<-exited
+	}()
+
+	for {
+		n, err := w.f.Read(w.buf[:])
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&w.buf[off]))
+			name := w.buf[off+unix.SizeofInotifyEvent : off+unix.SizeofInotifyEvent+int(ev.Len)]
+			off += unix.SizeofInotifyEvent + int(ev.Len)
+
+			switch {
+			case ev.Mask&(unix.IN_IGNORED|unix.IN_DELETE_SELF|unix.IN_MOVE_SELF|unix.IN_UNMOUNT) != 0:
+				return errWatchLost
+			case ev.Mask&unix.IN_Q_OVERFLOW != 0:
+				return nil
+			}
+			if i := bytes.IndexByte(name, 0); i >= 0 {
+				name = name[:i]
+			}
+			if string(name) == w.name {
+				return nil
+			}
+		}
+	}
+}
+
+func (w *watcher) close() error {
+	return w.f.Close()
+}
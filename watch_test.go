@@ -0,0 +1,201 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWaitForChange(t *testing.T) {
+	type Value struct {
+		Revision int
+	}
+
+	stores := map[string]*Store[Value]{
+		"Inode":      New[Value](json.NewEncoder, json.NewDecoder),
+		"CanaryFunc": New[Value](json.NewEncoder, json.NewDecoder, WithCanaryFunc(func(v *Value) any { return v.Revision })),
+	}
+
+	for name, store := range stores {
+		store := store
+		t.Run(name, func(t *testing.T) {
+			t.Run("Changed", func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "value.json")
+				if err := store.ForceStore(context.Background(), path, 0666, &Value{Revision: 1}); err != nil {
+					t.Fatal(err)
+				}
+
+				// A nil canary stands for a missing file, so the file already
+				// changed.
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+				if err := store.WaitForChange(ctx, path, nil); err != nil {
+					t.Fatal(err)
+				}
+			})
+
+			t.Run("Store", func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "value.json")
+				if err := store.ForceStore(context.Background(), path, 0666, &Value{Revision: 1}); err != nil {
+					t.Fatal(err)
+				}
+				var v Value
+				canary, err := store.Load(context.Background(), path, &v)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				go func() {
+					time.Sleep(50 * time.Millisecond)
+					store.ForceStore(context.Background(), path, 0666, &Value{Revision: 2})
+				}()
+
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				if err := store.WaitForChange(ctx, path, canary); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := store.Load(context.Background(), path, &v); err != nil {
+					t.Fatal(err)
+				}
+				if v.Revision != 2 {
+					t.Fatalf("expected revision 2, got %d", v.Revision)
+				}
+			})
+
+			t.Run("Created", func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "value.json")
+
+				go func() {
+					time.Sleep(50 * time.Millisecond)
+					store.ForceStore(context.Background(), path, 0666, &Value{Revision: 1})
+				}()
+
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				if err := store.WaitForChange(ctx, path, nil); err != nil {
+					t.Fatal(err)
+				}
+			})
+
+			t.Run("Cancel", func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "value.json")
+				if err := store.ForceStore(context.Background(), path, 0666, &Value{Revision: 1}); err != nil {
+					t.Fatal(err)
+				}
+				var v Value
+				canary, err := store.Load(context.Background(), path, &v)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				defer cancel()
+				if err := store.WaitForChange(ctx, path, canary); !errors.Is(err, context.DeadlineExceeded) {
+					t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+				}
+			})
+		})
+	}
+}
+
+func TestWatch(t *testing.T) {
+	type Value struct {
+		Revision int
+	}
+
+	store := New[Value](json.NewEncoder, json.NewDecoder)
+
+	next := func(t *testing.T, ch <-chan Update[Value]) Update[Value] {
+		t.Helper()
+		select {
+		case u, ok := <-ch:
+			if !ok {
+				t.Fatal("channel closed unexpectedly")
+			}
+			return u
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for update")
+		}
+		panic("unreachable")
+	}
+
+	t.Run("Updates", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "value.json")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ch, err := store.Watch(ctx, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u := next(t, ch); !errors.Is(u.Err, os.ErrNotExist) || u.Canary != nil {
+			t.Fatalf("expected missing file, got %+v", u)
+		}
+
+		for i := 1; i <= 3; i++ {
+			if err := store.ForceStore(context.Background(), path, 0666, &Value{Revision: i}); err != nil {
+				t.Fatal(err)
+			}
+			u := next(t, ch)
+			if u.Err != nil {
+				t.Fatal(u.Err)
+			}
+			if u.Value.Revision != i {
+				t.Fatalf("expected revision %d, got %d", i, u.Value.Revision)
+			}
+		}
+
+		cancel()
+		for range ch {
+		}
+	})
+
+	t.Run("Coalesce", func(t *testing.T) {
+		// Inode numbers of skipped versions may get reused, which would hide
+		// the last version from an inode canary.
+		store := New[Value](json.NewEncoder, json.NewDecoder, WithCanaryFunc(func(v *Value) any { return v.Revision }))
+
+		path := filepath.Join(t.TempDir(), "value.json")
+		if err := store.ForceStore(context.Background(), path, 0666, &Value{Revision: 0}); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ch, err := store.Watch(ctx, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 1; i <= 100; i++ {
+			if err := store.ForceStore(context.Background(), path, 0666, &Value{Revision: i}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Slow receivers skip intermediate versions, but eventually see the
+		// latest one.
+		for {
+			u := next(t, ch)
+			if u.Err != nil {
+				t.Fatal(u.Err)
+			}
+			if u.Value.Revision == 100 {
+				break
+			}
+		}
+	})
+}
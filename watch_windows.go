@@ -0,0 +1,134 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build windows
+// +build windows
+
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const watchFilter = windows.FILE_NOTIFY_CHANGE_FILE_NAME | windows.FILE_NOTIFY_CHANGE_LAST_WRITE |
+	windows.FILE_NOTIFY_CHANGE_SIZE | windows.FILE_NOTIFY_CHANGE_ATTRIBUTES
+
+// A watcher reports the changes to a file with overlapped ReadDirectoryChangesW
+// calls on its directory. A call is always pending, so that the system buffers
+// the changes happening in between waits.
+type watcher struct {
+	dir        windows.Handle
+	name       string
+	overlapped windows.Overlapped
+	buf        [4096]byte
+}
+
+func newWatcher(dir *os.File, path string) (*watcher, error) {
+	u16path, err := windows.UTF16PtrFromString(resolve(dir, filepath.Dir(path)))
+	if err != nil {
+		return nil, &os.PathError{Op: "UTF16FromString", Path: path, Err: err}
+	}
+
+	h, err := windows.CreateFile(u16path,
+		windows.FILE_LIST_DIRECTORY,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil,
+		windows.OPEN_EXISTING,
+		windows.FILE_FLAG_BACKUP_SEMANTICS|windows.FILE_FLAG_OVERLAPPED,
+		windows.Handle(0),
+	)
+	if err != nil {
+		return nil, &os.PathError{Op: "CreateFile", Path: filepath.Dir(path), Err: err}
+	}
+
+	ev, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		windows.CloseHandle(h)
+		return nil, wrapSyscallError("CreateEvent", err)
+	}
+
+	w := &watcher{dir: h, name: filepath.Base(path)}
+	w.overlapped.HEvent = ev
+	if err := w.read(); err != nil {
+		w.close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *watcher) read() error {
+	err := windows.ReadDirectoryChanges(w.dir, &w.buf[0], uint32(len(w.buf)), false, watchFilter, nil, &w.overlapped, 0)
+	if err != nil && err != windows.ERROR_IO_PENDING {
+		return wrapSyscallError("ReadDirectoryChangesW", err)
+	}
+	return nil
+}
+
+// wait blocks until the watched file might have changed.
+func (w *watcher) wait(ctx context.Context) error {
+	for {
+		done := make(chan struct{})
+		exited := make(chan struct{})
+		go func() {
+			defer close(exited)
+			select {
+			case <-ctx.Done():
+				windows.CancelIoEx(w.dir, &w.overlapped)
+			case <-done:
+			}
+		}()
+
+		var n uint32
+		err := windows.GetOverlappedResult(w.dir, &w.overlapped, &n, true)
+		close(done)
+		<-exited
+
+		switch {
+		case err == windows.ERROR_OPERATION_ABORTED:
+			// Issue a new call for the next wait.
+			if err := w.read(); err != nil {
+				return err
+			}
+			return ctx.Err()
+		case err == windows.ERROR_ACCESS_DENIED:
+			// The directory was deleted.
+			return errWatchLost
+		case err != nil:
+			return wrapSyscallError("GetOverlappedResult", err)
+		}
+
+		changed := n == 0 // The buffer overflowed.
+		for off := uint32(0); !changed && off < n; {
+			info := (*windows.FileNotifyInformation)(unsafe.Pointer(&w.buf[off]))
+			name := windows.UTF16ToString(unsafe.Slice(&info.FileName, info.FileNameLength/2))
+			changed = strings.EqualFold(name, w.name)
+			if info.NextEntryOffset == 0 {
+				break
+			}
+			off += info.NextEntryOffset
+		}
+
+		if err := w.read(); err != nil {
+			return err
+		}
+		if changed {
+			return nil
+		}
+	}
+}
+
+func (w *watcher) close() error {
+	windows.CancelIoEx(w.dir, &w.overlapped)
+	windows.GetOverlappedResult(w.dir, &w.overlapped, new(uint32), true)
+	windows.CloseHandle(w.overlapped.HEvent)
+	return windows.CloseHandle(w.dir)
+}
@@ -0,0 +1,20 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build unix && !linux && !darwin
+// +build unix,!linux,!darwin
+
+package store
+
+import (
+	"os"
+)
+
+// copyXattrs does nothing on this system, whose extended attributes are not
+// supported.
+func copyXattrs(src, dst *os.File) error {
+	return nil
+}
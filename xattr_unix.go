@@ -0,0 +1,69 @@
+// Copyright 2023 Arista Networks, Inc. All rights reserved.
+//
+// Use of this source code is governed by the MIT license that can be found
+// in the LICENSE file.
+//
+
+//go:build linux || darwin
+// +build linux darwin
+
+package store
+
+import (
+	"bytes"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyXattrs copies the extended attributes of src to dst. On Linux, these
+// include POSIX ACLs and SELinux labels.
+func copyXattrs(src, dst *os.File) error {
+	names, err := xattr(func(buf []byte) (int, error) {
+		return unix.Flistxattr(int(src.Fd()), buf)
+	})
+	switch {
+	case err == unix.ENOTSUP:
+		return nil
+	case err != nil:
+		return &os.PathError{Op: "flistxattr", Path: src.Name(), Err: err}
+	}
+
+	for _, name := range bytes.Split(names, []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		attr := string(name)
+		value, err := xattr(func(buf []byte) (int, error) {
+			return unix.Fgetxattr(int(src.Fd()), attr, buf)
+		})
+		if err != nil {
+			return &os.PathError{Op: "fgetxattr", Path: src.Name(), Err: err}
+		}
+		if err := unix.Fsetxattr(int(dst.Fd()), attr, value, 0); err != nil {
+			return &os.PathError{Op: "fsetxattr", Path: dst.Name(), Err: err}
+		}
+	}
+	return nil
+}
+
+// xattr calls get with a buffer large enough to hold its result, and returns
+// that result.
+func xattr(get func(buf []byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := get(nil)
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		buf := make([]byte, size)
+		n, err := get(buf)
+		if err == unix.ERANGE {
+			// The attribute grew in between the calls.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}